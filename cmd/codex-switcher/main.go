@@ -1,16 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 
 	"codex-switcher/internal/app"
 	"codex-switcher/internal/cli"
 )
 
 func main() {
-	if err := cli.NewRootCommand().Execute(); err != nil {
-		_, _ = fmt.Fprintln(os.Stderr, err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	go func() {
+		// Commands that watch the context stop cleanly on the first
+		// interrupt; a second one falls back to the default and exits.
+		<-ctx.Done()
+		stop()
+	}()
+	err := cli.NewRootCommand().ExecuteContext(ctx)
+	stop()
+	if err != nil {
+		var exitErr *app.ExitError
+		if !errors.As(err, &exitErr) || exitErr.Err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+		}
 		os.Exit(app.ExitCode(err))
 	}
 }
@@ -4,7 +4,13 @@ go 1.22.0
 
 require github.com/spf13/cobra v1.8.1
 
-require github.com/pelletier/go-toml/v2 v2.2.2
+require (
+	github.com/godbus/dbus/v5 v5.2.2
+	github.com/pelletier/go-toml/v2 v2.2.2
+	golang.org/x/crypto v0.31.0
+	golang.org/x/sys v0.28.0
+	golang.org/x/term v0.27.0
+)
 
 require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
@@ -1,5 +1,12 @@
 package app
 
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
 type Adapter interface {
 	Tool() ToolName
 	Inspect(paths ToolPaths) (InspectToolResult, error)
@@ -8,15 +15,134 @@ type Adapter interface {
 	ClearActiveCredential(paths ToolPaths) error
 }
 
-func adapterFor(tool ToolName) Adapter {
-	switch tool {
-	case ToolCodex:
-		return &codexAdapter{}
-	case ToolOpenCode:
-		return &openCodeAdapter{}
-	case ToolOpenClaw:
-		return &openClawAdapter{}
-	default:
-		return nil
+// activeSnapshotter is implemented by adapters whose active credential does not
+// live in a plain file at ToolPaths.ActivePath.
+type activeSnapshotter interface {
+	SnapshotActive(paths ToolPaths) ([]byte, bool, error)
+	RestoreActive(paths ToolPaths, content []byte, seen bool) error
+}
+
+func snapshotActive(adapter Adapter, paths ToolPaths) ([]byte, bool, error) {
+	if snap, ok := adapter.(activeSnapshotter); ok {
+		return snap.SnapshotActive(paths)
+	}
+	content, err := os.ReadFile(paths.ActivePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return content, true, nil
+}
+
+func restoreActive(adapter Adapter, paths ToolPaths, content []byte, seen bool) error {
+	if snap, ok := adapter.(activeSnapshotter); ok {
+		return snap.RestoreActive(paths, content, seen)
+	}
+	if seen {
+		return writeFileAtomic(paths.ActivePath, content, 0o600)
+	}
+	return os.Remove(paths.ActivePath)
+}
+
+// toolRegistration describes a supported tool: how to build its adapter,
+// where its active credential lives and how exec points a child process at a
+// temporary copy. Built-in tools register themselves from init; tools declared
+// in config.toml are registered on first lookup.
+type toolRegistration struct {
+	tool       ToolName
+	newAdapter func() Adapter
+	// activePath resolves the active credential file. Profiles, state and the
+	// lock live in a profiles directory next to it.
+	activePath func(home string) (string, error)
+	// execRoot is the tool's root under the exec temp dir and execEnv points
+	// the child at it. A nil execEnv means the tool cannot be redirected.
+	execRoot string
+	execEnv  func(env []string, paths ToolPaths) []string
+}
+
+var builtinTools []toolRegistration
+
+func registerTool(reg toolRegistration) {
+	for _, existing := range builtinTools {
+		if existing.tool == reg.tool {
+			panic(fmt.Sprintf("tool %s registered twice", reg.tool))
+		}
+	}
+	builtinTools = append(builtinTools, reg)
+	sort.Slice(builtinTools, func(i, j int) bool { return builtinTools[i].tool < builtinTools[j].tool })
+}
+
+// toolRegistry caches the tools declared in the switcher config so the file
+// is parsed once per process rather than on every lookup. It is keyed by the
+// config path, which only changes when the data dir does.
+var toolRegistry struct {
+	sync.Mutex
+	loaded     bool
+	path       string
+	configured []toolRegistration
+	err        error
+}
+
+// resetToolRegistry makes the next lookup re-read the switcher config, for
+// callers that have just written it.
+func resetToolRegistry() {
+	toolRegistry.Lock()
+	defer toolRegistry.Unlock()
+	toolRegistry.loaded = false
+	toolRegistry.configured = nil
+	toolRegistry.err = nil
+}
+
+// registeredTools lists built-in tools followed by those declared in the
+// switcher config, each group in name order. A broken config still returns
+// the built-in tools and the declarations before the bad one.
+func registeredTools() ([]toolRegistration, error) {
+	path, err := resolveSwitcherConfigPath()
+	if err != nil {
+		return append([]toolRegistration{}, builtinTools...), err
+	}
+	toolRegistry.Lock()
+	defer toolRegistry.Unlock()
+	if !toolRegistry.loaded || toolRegistry.path != path {
+		toolRegistry.configured, toolRegistry.err = configuredTools()
+		toolRegistry.path = path
+		toolRegistry.loaded = true
+	}
+	return append(append([]toolRegistration{}, builtinTools...), toolRegistry.configured...), toolRegistry.err
+}
+
+// lookupTool finds a tool's registration. Built-in tools resolve even when
+// the config is broken; any other name reports the config error with it.
+func lookupTool(tool ToolName) (toolRegistration, error) {
+	regs, configErr := registeredTools()
+	for _, reg := range regs {
+		if reg.tool == tool {
+			return reg, nil
+		}
+	}
+	if configErr != nil {
+		return toolRegistration{}, fmt.Errorf("unsupported tool %s: %w", tool, configErr)
+	}
+	return toolRegistration{}, fmt.Errorf("unsupported tool %s", tool)
+}
+
+// AllTools returns every registered tool. When the config cannot be loaded it
+// returns the tools it could register along with the error.
+func AllTools() ([]ToolName, error) {
+	regs, err := registeredTools()
+	tools := make([]ToolName, 0, len(regs))
+	for _, reg := range regs {
+		tools = append(tools, reg.tool)
+	}
+	return tools, err
+}
+
+func adapterFor(tool ToolName) (Adapter, error) {
+	reg, err := lookupTool(tool)
+	if err != nil {
+		return nil, err
 	}
+	return reg.newAdapter(), nil
 }
@@ -13,40 +13,75 @@ import (
 
 type codexAdapter struct{}
 
+func init() {
+	registerTool(toolRegistration{
+		tool:       ToolCodex,
+		newAdapter: func() Adapter { return &codexAdapter{} },
+		activePath: codexActivePath,
+		execRoot:   "codex",
+		execEnv: func(env []string, paths ToolPaths) []string {
+			return setEnvValue(env, "CODEX_HOME", paths.RootDir)
+		},
+	})
+}
+
 func (a *codexAdapter) Tool() ToolName { return ToolCodex }
 
 type codexConfig struct {
 	StoreMode string `toml:"cli_auth_credentials_store"`
 }
 
-func (a *codexAdapter) inspectStoreMode(paths ToolPaths) (mode string, blocked bool, reason string) {
-	mode = "file"
+type codexStoreSelection struct {
+	mode    string
+	store   codexCredentialStore
+	blocked bool
+	reason  string
+}
+
+func (a *codexAdapter) readStoreMode(paths ToolPaths) string {
+	mode := "file"
 	configPath := filepath.Join(paths.RootDir, "config.toml")
 	bytes, err := os.ReadFile(configPath)
 	if err != nil {
-		return mode, false, ""
+		return mode
 	}
 	var cfg codexConfig
 	if err := toml.Unmarshal(bytes, &cfg); err != nil {
-		return mode, false, ""
+		return mode
 	}
 	if cfg.StoreMode != "" {
 		mode = strings.ToLower(strings.TrimSpace(cfg.StoreMode))
 	}
+	return mode
+}
 
-	switch mode {
+func (a *codexAdapter) selectStore(paths ToolPaths) codexStoreSelection {
+	sel := codexStoreSelection{mode: a.readStoreMode(paths), store: codexFileStore{}}
+	switch sel.mode {
 	case "keyring":
-		return mode, true, "codex is configured for keyring storage"
+		keyring, err := openCodexKeyring()
+		if err != nil {
+			sel.blocked = true
+			sel.reason = "codex is configured for keyring storage but the secret service is unavailable: " + err.Error()
+			return sel
+		}
+		sel.store = keyring
 	case "ephemeral":
-		return mode, true, "codex is configured for ephemeral storage"
+		sel.blocked = true
+		sel.reason = "codex is configured for ephemeral storage"
 	case "auto":
-		cred, ok, _ := a.ReadActiveCredential(paths)
+		keyring, err := openCodexKeyring()
+		if err == nil {
+			sel.store = codexAutoStore{keyring: keyring}
+			return sel
+		}
+		cred, ok, _ := a.readCredential(codexFileStore{}, paths)
 		if !ok || cred.Access == "" {
-			return mode, true, "codex auto mode appears keyring-backed (no file tokens found)"
+			sel.blocked = true
+			sel.reason = "codex auto mode appears keyring-backed (no file tokens found) and the secret service is unavailable: " + err.Error()
 		}
 	}
-
-	return mode, false, ""
+	return sel
 }
 
 func (a *codexAdapter) Inspect(paths ToolPaths) (InspectToolResult, error) {
@@ -55,12 +90,13 @@ func (a *codexAdapter) Inspect(paths ToolPaths) (InspectToolResult, error) {
 		Paths: paths,
 	}
 
-	mode, blocked, reason := a.inspectStoreMode(paths)
-	out.StoreMode = mode
-	out.SwitchBlocked = blocked
-	out.SwitchBlockReason = reason
+	sel := a.selectStore(paths)
+	out.StoreMode = sel.mode
+	out.CredentialBackend = sel.store.Backend()
+	out.SwitchBlocked = sel.blocked
+	out.SwitchBlockReason = sel.reason
 
-	cred, ok, err := a.ReadActiveCredential(paths)
+	cred, ok, err := a.readCredential(sel.store, paths)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return out, nil
@@ -76,7 +112,11 @@ func (a *codexAdapter) Inspect(paths ToolPaths) (InspectToolResult, error) {
 }
 
 func (a *codexAdapter) ReadActiveCredential(paths ToolPaths) (Credential, bool, error) {
-	bytes, err := os.ReadFile(paths.ActivePath)
+	return a.readCredential(a.selectStore(paths).store, paths)
+}
+
+func (a *codexAdapter) readCredential(store codexCredentialStore, paths ToolPaths) (Credential, bool, error) {
+	bytes, err := store.Load(paths)
 	if err != nil {
 		return Credential{}, false, err
 	}
@@ -105,6 +145,11 @@ func (a *codexAdapter) ReadActiveCredential(paths ToolPaths) (Credential, bool,
 		AccountID: accountID,
 		IDToken:   idToken,
 	}
+	if lastRefresh, _ := data["last_refresh"].(string); lastRefresh != "" {
+		if parsed, err := time.Parse(time.RFC3339, lastRefresh); err == nil {
+			cred.UpdatedAt = parsed.UnixMilli()
+		}
+	}
 	return normalizeCredentialIdentity(cred), true, nil
 }
 
@@ -113,8 +158,9 @@ func (a *codexAdapter) WriteActiveCredential(paths ToolPaths, cred Credential) e
 		return fmt.Errorf("codex credential requires access and refresh token")
 	}
 
+	store := a.selectStore(paths).store
 	var data map[string]any
-	bytes, err := os.ReadFile(paths.ActivePath)
+	bytes, err := store.Load(paths)
 	if err == nil {
 		_ = json.Unmarshal(bytes, &data)
 	}
@@ -143,12 +189,20 @@ func (a *codexAdapter) WriteActiveCredential(paths ToolPaths, cred Credential) e
 	data["tokens"] = tokensRaw
 	data["last_refresh"] = time.Now().UTC().Format(time.RFC3339)
 
-	return writeJSONAtomic(paths.ActivePath, data)
+	content, err := encodeCodexAuth(data)
+	if err != nil {
+		return err
+	}
+	return store.Save(paths, content)
 }
 
 func (a *codexAdapter) ClearActiveCredential(paths ToolPaths) error {
+	store := a.selectStore(paths).store
+	if store.Backend() != codexBackendFile {
+		return store.Delete(paths)
+	}
 	var data map[string]any
-	bytes, err := os.ReadFile(paths.ActivePath)
+	bytes, err := store.Load(paths)
 	if err == nil {
 		_ = json.Unmarshal(bytes, &data)
 	}
@@ -171,3 +225,22 @@ func (a *codexAdapter) ClearActiveCredential(paths ToolPaths) error {
 	data["last_refresh"] = time.Now().UTC().Format(time.RFC3339)
 	return writeJSONAtomic(paths.ActivePath, data)
 }
+
+func (a *codexAdapter) SnapshotActive(paths ToolPaths) ([]byte, bool, error) {
+	content, err := a.selectStore(paths).store.Load(paths)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return content, true, nil
+}
+
+func (a *codexAdapter) RestoreActive(paths ToolPaths, content []byte, seen bool) error {
+	store := a.selectStore(paths).store
+	if !seen {
+		return store.Delete(paths)
+	}
+	return store.Save(paths, content)
+}
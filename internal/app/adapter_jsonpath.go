@@ -0,0 +1,437 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// jsonToolConfig is a [tools.<name>] table of config.toml, declaring a tool
+// that keeps OpenAI OAuth tokens in a JSON file:
+//
+//	[tools.mytool]
+//	active_file = "~/.mytool/auth.json"
+//	active_file_env = ["MYTOOL_AUTH_FILE"]  # first one set overrides active_file
+//	access = "tokens.access_token"
+//	refresh = "tokens.refresh_token"
+//	expires = "tokens.expires_at"           # optional
+//	expires_unit = "s"                      # "ms" (default) or "s"
+//	account_id = "tokens.account_id"        # optional
+//	id_token = "tokens.id_token"            # optional
+//
+// Paths are dot-separated object keys.
+type jsonToolConfig struct {
+	ActiveFile    string   `toml:"active_file"`
+	ActiveFileEnv []string `toml:"active_file_env"`
+	Access        string   `toml:"access"`
+	Refresh       string   `toml:"refresh"`
+	Expires       string   `toml:"expires"`
+	ExpiresUnit   string   `toml:"expires_unit"`
+	AccountID     string   `toml:"account_id"`
+	IDToken       string   `toml:"id_token"`
+}
+
+// configuredTools registers the tools declared in the switcher config.
+func configuredTools() ([]toolRegistration, error) {
+	raw, path, err := loadSwitcherConfig()
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(raw.Tools))
+	for name := range raw.Tools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	regs := make([]toolRegistration, 0, len(names))
+	for _, name := range names {
+		config := raw.Tools[name]
+		if err := validateJSONToolConfig(name, config); err != nil {
+			return regs, fmt.Errorf("%s: tool %q: %w", path, name, err)
+		}
+		regs = append(regs, jsonToolRegistration(ToolName(name), config))
+	}
+	return regs, nil
+}
+
+func validateJSONToolConfig(name string, config jsonToolConfig) error {
+	if !profileNamePattern.MatchString(name) || strings.ToLower(name) != name {
+		return fmt.Errorf("invalid tool name")
+	}
+	for _, reg := range builtinTools {
+		if string(reg.tool) == name {
+			return fmt.Errorf("conflicts with the built-in adapter")
+		}
+	}
+	if strings.TrimSpace(config.ActiveFile) == "" {
+		return fmt.Errorf("active_file is required")
+	}
+	if strings.TrimSpace(config.Access) == "" || strings.TrimSpace(config.Refresh) == "" {
+		return fmt.Errorf("access and refresh paths are required")
+	}
+	if config.ExpiresUnit != "" && config.ExpiresUnit != "ms" && config.ExpiresUnit != "s" {
+		return fmt.Errorf("expires_unit must be \"ms\" or \"s\"")
+	}
+	return nil
+}
+
+func jsonToolRegistration(tool ToolName, config jsonToolConfig) toolRegistration {
+	reg := toolRegistration{
+		tool:       tool,
+		newAdapter: func() Adapter { return &jsonPathAdapter{tool: tool, config: config} },
+		activePath: func(home string) (string, error) {
+			candidates := make([]string, 0, len(config.ActiveFileEnv)+1)
+			for _, key := range config.ActiveFileEnv {
+				candidates = append(candidates, os.Getenv(key))
+			}
+			candidates = append(candidates, config.ActiveFile)
+			return resolvePathWithHome(firstNonEmpty(candidates...), home), nil
+		},
+		execRoot: string(tool),
+	}
+	if len(config.ActiveFileEnv) > 0 {
+		reg.execEnv = func(env []string, paths ToolPaths) []string {
+			return setEnvValue(env, config.ActiveFileEnv[0], paths.ActivePath)
+		}
+	}
+	return reg
+}
+
+// jsonPathAdapter reads and writes the tokens at the configured JSON paths,
+// leaving the rest of the file untouched.
+type jsonPathAdapter struct {
+	tool   ToolName
+	config jsonToolConfig
+}
+
+func (a *jsonPathAdapter) Tool() ToolName { return a.tool }
+
+func (a *jsonPathAdapter) Inspect(paths ToolPaths) (InspectToolResult, error) {
+	out := InspectToolResult{Tool: a.Tool(), Paths: paths}
+	cred, ok, err := a.ReadActiveCredential(paths)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return out, nil
+		}
+		return out, err
+	}
+	out.HasActive = ok
+	out.Capturable = ok && cred.Access != "" && cred.Refresh != ""
+	out.AccountID = cred.AccountID
+	out.Email = cred.Email
+	out.Expires = cred.Expires
+	return out, nil
+}
+
+func (a *jsonPathAdapter) ReadActiveCredential(paths ToolPaths) (Credential, bool, error) {
+	content, err := os.ReadFile(paths.ActivePath)
+	if err != nil {
+		return Credential{}, false, err
+	}
+	root, err := parseJSONRoot(content)
+	if err != nil {
+		return Credential{}, false, err
+	}
+	access, _ := jsonPathGet(root, a.config.Access).(string)
+	refresh, _ := jsonPathGet(root, a.config.Refresh).(string)
+	if access == "" || refresh == "" {
+		return Credential{}, false, nil
+	}
+	cred := Credential{Provider: "openai-codex", Access: access, Refresh: refresh}
+	if a.config.Expires != "" {
+		cred.Expires = toInt64(jsonPathGet(root, a.config.Expires))
+		if a.config.ExpiresUnit == "s" {
+			cred.Expires *= 1000
+		}
+	}
+	if a.config.AccountID != "" {
+		cred.AccountID, _ = jsonPathGet(root, a.config.AccountID).(string)
+	}
+	if a.config.IDToken != "" {
+		cred.IDToken, _ = jsonPathGet(root, a.config.IDToken).(string)
+	}
+	return normalizeCredentialIdentity(cred), true, nil
+}
+
+func (a *jsonPathAdapter) WriteActiveCredential(paths ToolPaths, cred Credential) error {
+	if cred.Access == "" || cred.Refresh == "" {
+		return fmt.Errorf("%s credential requires access and refresh token", a.tool)
+	}
+	root, err := a.readRoot(paths)
+	if err != nil {
+		return err
+	}
+	// Set in declaration order so keys the file lacks are appended the same
+	// way every time.
+	type pathValue struct {
+		path  string
+		value any
+	}
+	values := []pathValue{{a.config.Access, cred.Access}, {a.config.Refresh, cred.Refresh}}
+	if a.config.Expires != "" && cred.Expires > 0 {
+		expires := cred.Expires
+		if a.config.ExpiresUnit == "s" {
+			expires /= 1000
+		}
+		values = append(values, pathValue{a.config.Expires, expires})
+	}
+	if a.config.AccountID != "" && cred.AccountID != "" {
+		values = append(values, pathValue{a.config.AccountID, cred.AccountID})
+	}
+	if a.config.IDToken != "" && cred.IDToken != "" {
+		values = append(values, pathValue{a.config.IDToken, cred.IDToken})
+	}
+	for _, item := range values {
+		encoded, err := json.Marshal(item.value)
+		if err != nil {
+			return err
+		}
+		if root, err = jsonPathSet(root, item.path, encoded); err != nil {
+			return fmt.Errorf("%s: %w", paths.ActivePath, err)
+		}
+	}
+	return writeJSONObject(paths.ActivePath, root)
+}
+
+func (a *jsonPathAdapter) ClearActiveCredential(paths ToolPaths) error {
+	root, err := a.readRoot(paths)
+	if err != nil {
+		return err
+	}
+	for _, path := range []string{a.config.Access, a.config.Refresh, a.config.Expires, a.config.AccountID, a.config.IDToken} {
+		root = jsonPathDelete(root, path)
+	}
+	return writeJSONObject(paths.ActivePath, root)
+}
+
+// readRoot loads the active file for rewriting; a missing file starts empty.
+func (a *jsonPathAdapter) readRoot(paths ToolPaths) (jsonObject, error) {
+	content, err := os.ReadFile(paths.ActivePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return jsonObject{}, nil
+		}
+		return nil, err
+	}
+	root, err := parseJSONRoot(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", paths.ActivePath, err)
+	}
+	return root, nil
+}
+
+// jsonMember is one key/value pair of a JSON object, held as the text it was
+// read from so a rewrite leaves every field it does not touch as it was.
+type jsonMember struct {
+	name  string
+	key   json.RawMessage
+	value json.RawMessage
+}
+
+// jsonObject is a JSON object that keeps its members in file order.
+type jsonObject []jsonMember
+
+var errNotJSONObject = errors.New("not a JSON object")
+
+// parseJSONRoot parses a whole tool file, treating a literal null as empty.
+func parseJSONRoot(content []byte) (jsonObject, error) {
+	if isJSONNull(content) {
+		return jsonObject{}, nil
+	}
+	return parseJSONObject(content)
+}
+
+func parseJSONObject(data []byte) (jsonObject, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := tok.(json.Delim); !ok || delim != '{' {
+		return nil, errNotJSONObject
+	}
+	obj := jsonObject{}
+	for dec.More() {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name, _ := tok.(string)
+		key := bytes.TrimLeft(data[start:dec.InputOffset()], " \t\r\n,")
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		obj = obj.setMember(name, append(json.RawMessage{}, key...), value)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the top-level object")
+	}
+	return obj, nil
+}
+
+func isJSONNull(data []byte) bool {
+	return string(bytes.TrimSpace(data)) == "null"
+}
+
+func (o jsonObject) get(name string) (json.RawMessage, bool) {
+	for _, member := range o {
+		if member.name == name {
+			return member.value, true
+		}
+	}
+	return nil, false
+}
+
+// set replaces a member's value in place, or appends the member when absent.
+func (o jsonObject) set(name string, value json.RawMessage) jsonObject {
+	return o.setMember(name, nil, value)
+}
+
+func (o jsonObject) setMember(name string, key json.RawMessage, value json.RawMessage) jsonObject {
+	for i := range o {
+		if o[i].name == name {
+			o[i].value = value
+			return o
+		}
+	}
+	if key == nil {
+		key, _ = json.Marshal(name)
+	}
+	return append(o, jsonMember{name: name, key: key, value: value})
+}
+
+func (o jsonObject) without(name string) jsonObject {
+	for i := range o {
+		if o[i].name == name {
+			return append(o[:i:i], o[i+1:]...)
+		}
+	}
+	return o
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, member := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(member.key)
+		buf.WriteByte(':')
+		buf.Write(member.value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// writeJSONObject indents the object without re-encoding its members, so
+// number literals and string escapes keep their original spelling.
+func writeJSONObject(path string, root jsonObject) error {
+	if err := ensureParentDir(path); err != nil {
+		return err
+	}
+	compact, err := root.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, compact, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	return writeFileAtomic(path, out.Bytes(), 0o600)
+}
+
+// jsonPathGet decodes the value at path, with numbers as json.Number so
+// integers beyond float64 precision come back intact.
+func jsonPathGet(root jsonObject, path string) any {
+	keys := strings.Split(path, ".")
+	node := root
+	for _, key := range keys[:len(keys)-1] {
+		raw, ok := node.get(key)
+		if !ok {
+			return nil
+		}
+		next, err := parseJSONObject(raw)
+		if err != nil {
+			return nil
+		}
+		node = next
+	}
+	raw, ok := node.get(keys[len(keys)-1])
+	if !ok {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil
+	}
+	return value
+}
+
+func jsonPathSet(root jsonObject, path string, value json.RawMessage) (jsonObject, error) {
+	return setJSONPath(root, strings.Split(path, "."), 0, value)
+}
+
+func setJSONPath(node jsonObject, keys []string, depth int, value json.RawMessage) (jsonObject, error) {
+	key := keys[depth]
+	if depth == len(keys)-1 {
+		return node.set(key, value), nil
+	}
+	child := jsonObject{}
+	if raw, ok := node.get(key); ok && !isJSONNull(raw) {
+		parsed, err := parseJSONObject(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s is not an object", strings.Join(keys[:depth+1], "."))
+		}
+		child = parsed
+	}
+	child, err := setJSONPath(child, keys, depth+1, value)
+	if err != nil {
+		return nil, err
+	}
+	encoded, err := child.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return node.set(key, encoded), nil
+}
+
+func jsonPathDelete(root jsonObject, path string) jsonObject {
+	if path == "" {
+		return root
+	}
+	return deleteJSONPath(root, strings.Split(path, "."), 0)
+}
+
+func deleteJSONPath(node jsonObject, keys []string, depth int) jsonObject {
+	key := keys[depth]
+	if depth == len(keys)-1 {
+		return node.without(key)
+	}
+	raw, ok := node.get(key)
+	if !ok {
+		return node
+	}
+	child, err := parseJSONObject(raw)
+	if err != nil {
+		return node
+	}
+	encoded, err := deleteJSONPath(child, keys, depth+1).MarshalJSON()
+	if err != nil {
+		return node
+	}
+	return node.set(key, encoded)
+}
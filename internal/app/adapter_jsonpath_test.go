@@ -0,0 +1,181 @@
+package app
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testJSONToolConfig = `
+[tools.mytool]
+active_file = "~/.mytool/auth.json"
+active_file_env = ["MYTOOL_AUTH_FILE"]
+access = "tokens.access_token"
+refresh = "tokens.refresh_token"
+expires = "tokens.expires_at"
+expires_unit = "s"
+account_id = "tokens.account_id"
+`
+
+func TestJSONPathAdapterRegisteredFromConfig(t *testing.T) {
+	tmp := setupVaultTestHome(t)
+	writeSwitcherConfig(t, testJSONToolConfig)
+	activePath := filepath.Join(tmp, "mytool", "auth.json")
+	t.Setenv("MYTOOL_AUTH_FILE", activePath)
+
+	tools, err := ParseTools("mytool,codex")
+	if err != nil || len(tools) != 2 || tools[1] != "mytool" {
+		t.Fatalf("expected configured tool accepted, got %v %v", tools, err)
+	}
+	if all := mustAllTools(t); all[len(all)-1] != "mytool" {
+		t.Fatalf("expected configured tool listed after built-ins, got %v", all)
+	}
+	// The config is read once per process, not on every lookup.
+	configPath, err := resolveSwitcherConfigPath()
+	if err != nil {
+		t.Fatalf("config path: %v", err)
+	}
+	if err := os.WriteFile(configPath, nil, 0o600); err != nil {
+		t.Fatalf("clear config: %v", err)
+	}
+	paths := mustToolPaths(t, "mytool")
+	if paths.ActivePath != activePath || paths.ProfileDir != filepath.Join(tmp, "mytool", "profiles") {
+		t.Fatalf("expected env override to place the tool, got %+v", paths)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(activePath), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(activePath, []byte(`{"theme":"dark","tokens":{"access_token":"a1","refresh_token":"r1","expires_at":1700000000,"account_id":"acct-1"}}`), 0o600); err != nil {
+		t.Fatalf("write active: %v", err)
+	}
+	adapter := mustAdapter(t, "mytool")
+	cred, ok, err := adapter.ReadActiveCredential(paths)
+	if err != nil || !ok || cred.Access != "a1" || cred.Refresh != "r1" || cred.Expires != 1700000000000 || cred.AccountID != "acct-1" {
+		t.Fatalf("expected tokens read from paths, got %+v %v %v", cred, ok, err)
+	}
+
+	svc := NewService()
+	if _, err := svc.Capture("first", []ToolName{"mytool"}, false); err != nil {
+		t.Fatalf("capture: %v", err)
+	}
+	if err := saveProfile(paths, "second", Credential{Provider: "openai-codex", Access: "a2", Refresh: "r2", Expires: 1800000000000, AccountID: "acct-2"}, true); err != nil {
+		t.Fatalf("save second: %v", err)
+	}
+	if _, err := svc.Switch("second", []ToolName{"mytool"}, SwitchOptions{}); err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+
+	content, err := os.ReadFile(activePath)
+	if err != nil {
+		t.Fatalf("read active: %v", err)
+	}
+	var root map[string]any
+	if err := json.Unmarshal(content, &root); err != nil {
+		t.Fatalf("parse active: %v", err)
+	}
+	tokens, _ := root["tokens"].(map[string]any)
+	if root["theme"] != "dark" || tokens["access_token"] != "a2" || tokens["expires_at"] != float64(1800000000) {
+		t.Fatalf("expected tokens rewritten in place, got %s", content)
+	}
+}
+
+func TestConfiguredToolsRejectInvalidDeclarations(t *testing.T) {
+	setupVaultTestHome(t)
+	writeSwitcherConfig(t, `
+[tools.codex]
+active_file = "~/auth.json"
+access = "a"
+refresh = "r"
+`)
+	_, err := ParseTools("codex")
+	if err != nil {
+		t.Fatalf("expected built-in tools unaffected, got %v", err)
+	}
+	if _, err := ParseTools("mytool"); err == nil || !strings.Contains(err.Error(), "built-in") {
+		t.Fatalf("expected the conflicting declaration reported, got %v", err)
+	}
+	if _, err := resolveUsageTools([]ToolName{"mytool"}); err == nil || !strings.Contains(err.Error(), "built-in") {
+		t.Fatalf("expected undeclared tool rejected with the config error, got %v", err)
+	}
+	if _, err := resolveToolPaths("mytool"); err == nil || !strings.Contains(err.Error(), "built-in") {
+		t.Fatalf("expected lookup to report the config error, got %v", err)
+	}
+	if tools, err := AllTools(); err == nil || len(tools) == 0 {
+		t.Fatalf("expected built-in tools listed with the config error, got %v %v", tools, err)
+	}
+}
+
+func TestJSONPathAdapterPreservesUnrelatedFields(t *testing.T) {
+	tmp := setupVaultTestHome(t)
+	writeSwitcherConfig(t, testJSONToolConfig)
+	activePath := filepath.Join(tmp, "mytool", "auth.json")
+	t.Setenv("MYTOOL_AUTH_FILE", activePath)
+	paths := mustToolPaths(t, "mytool")
+
+	original := `{
+  "zeta": 9007199254740993,
+  "tokens": {
+    "refresh_token": "r1",
+    "scope": "a<b>&c \u00e9",
+    "access_token": "a1",
+    "expires_at": 1700000000
+  },
+  "ratio": 1.50,
+  "alpha": [
+    12345678901234567890,
+    null
+  ]
+}
+`
+	if err := os.MkdirAll(filepath.Dir(activePath), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(activePath, []byte(original), 0o600); err != nil {
+		t.Fatalf("write active: %v", err)
+	}
+	adapter := mustAdapter(t, "mytool")
+	if err := adapter.WriteActiveCredential(paths, Credential{Provider: "openai-codex", Access: "a2", Refresh: "r2", Expires: 1800000000000, AccountID: "acct-2"}); err != nil {
+		t.Fatalf("write credential: %v", err)
+	}
+	want := `{
+  "zeta": 9007199254740993,
+  "tokens": {
+    "refresh_token": "r2",
+    "scope": "a<b>&c \u00e9",
+    "access_token": "a2",
+    "expires_at": 1800000000,
+    "account_id": "acct-2"
+  },
+  "ratio": 1.50,
+  "alpha": [
+    12345678901234567890,
+    null
+  ]
+}
+`
+	if content, _ := os.ReadFile(activePath); string(content) != want {
+		t.Fatalf("expected only the token fields changed, got:\n%s", content)
+	}
+
+	if err := adapter.ClearActiveCredential(paths); err != nil {
+		t.Fatalf("clear credential: %v", err)
+	}
+	want = `{
+  "zeta": 9007199254740993,
+  "tokens": {
+    "scope": "a<b>&c \u00e9"
+  },
+  "ratio": 1.50,
+  "alpha": [
+    12345678901234567890,
+    null
+  ]
+}
+`
+	if content, _ := os.ReadFile(activePath); string(content) != want {
+		t.Fatalf("expected only the token fields removed, got:\n%s", content)
+	}
+}
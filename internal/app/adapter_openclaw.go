@@ -11,6 +11,18 @@ import (
 
 type openClawAdapter struct{}
 
+func init() {
+	registerTool(toolRegistration{
+		tool:       ToolOpenClaw,
+		newAdapter: func() Adapter { return &openClawAdapter{} },
+		activePath: openClawActivePath,
+		execRoot:   "openclaw-agent",
+		execEnv: func(env []string, paths ToolPaths) []string {
+			return setEnvValue(env, "OPENCLAW_AGENT_DIR", paths.RootDir)
+		},
+	})
+}
+
 const openClawManagedProfileID = "openai-codex:default"
 const openClawLegacyPendingLoginSentinelID = "openai-codex:rotater:__pending_login__"
 const openClawLegacyPendingKnownIDsKey = "codex_switcher_pending_known_profile_ids"
@@ -174,8 +186,21 @@ func migrateOpenClawStore(paths ToolPaths) (openClawMigrationStats, error) {
 		}
 		return stats, err
 	}
+	stats = planOpenClawMigration(&store)
 	stats.HasStore = true
+	if !stats.Changed {
+		return stats, nil
+	}
+	if err := writeOpenClawStore(paths.ActivePath, store); err != nil {
+		return stats, err
+	}
+	return stats, nil
+}
 
+// planOpenClawMigration rewrites store in memory into managed single-profile
+// mode and reports what changed; callers decide whether to persist it.
+func planOpenClawMigration(store *openClawStore) openClawMigrationStats {
+	stats := openClawMigrationStats{}
 	if store.Profiles == nil {
 		store.Profiles = map[string]openClawCredential{}
 	}
@@ -186,17 +211,17 @@ func migrateOpenClawStore(paths ToolPaths) (openClawMigrationStats, error) {
 		store.Raw = map[string]any{}
 	}
 
-	beforeLegacyCount := countLegacySwitcherOpenClawProfiles(store)
+	beforeLegacyCount := countLegacySwitcherOpenClawProfiles(*store)
 	beforeSentinel := orderContainsID(store.Order["openai-codex"], openClawLegacyPendingLoginSentinelID)
 	_, beforePendingKnown := store.Raw[openClawLegacyPendingKnownIDsKey]
 	beforeManaged, hadManaged := store.Profiles[openClawManagedProfileID]
 	beforeOrder := append([]string{}, store.Order["openai-codex"]...)
 	beforeVersion := store.Version
 
-	preferred, hasPreferred := selectPreferredOpenClawCredentialEntry(store)
+	preferred, hasPreferred := selectPreferredOpenClawCredentialEntry(*store)
 
-	cleanupLegacyOpenClawPendingMarkers(&store)
-	removeLegacySwitcherOpenClawProfiles(&store)
+	cleanupLegacyOpenClawPendingMarkers(store)
+	removeLegacySwitcherOpenClawProfiles(store)
 
 	if hasPreferred {
 		store.Profiles[openClawManagedProfileID] = preferred
@@ -210,7 +235,7 @@ func migrateOpenClawStore(paths ToolPaths) (openClawMigrationStats, error) {
 	if store.Version == 0 {
 		store.Version = 1
 	}
-	stats.RemovedLegacyRotater = beforeLegacyCount - countLegacySwitcherOpenClawProfiles(store)
+	stats.RemovedLegacyRotater = beforeLegacyCount - countLegacySwitcherOpenClawProfiles(*store)
 	stats.RemovedPendingSentinel = beforeSentinel && !orderContainsID(store.Order["openai-codex"], openClawLegacyPendingLoginSentinelID)
 	_, afterPendingKnown := store.Raw[openClawLegacyPendingKnownIDsKey]
 	stats.RemovedPendingKnownMarker = beforePendingKnown && !afterPendingKnown
@@ -237,13 +262,7 @@ func migrateOpenClawStore(paths ToolPaths) (openClawMigrationStats, error) {
 		}
 	}
 
-	if !stats.Changed {
-		return stats, nil
-	}
-	if err := writeOpenClawStore(paths.ActivePath, store); err != nil {
-		return stats, err
-	}
-	return stats, nil
+	return stats
 }
 
 func readOpenClawStore(path string) (openClawStore, error) {
@@ -4,10 +4,23 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 )
 
 type openCodeAdapter struct{}
 
+func init() {
+	registerTool(toolRegistration{
+		tool:       ToolOpenCode,
+		newAdapter: func() Adapter { return &openCodeAdapter{} },
+		activePath: openCodeActivePath,
+		execRoot:   filepath.Join("data", "opencode"),
+		execEnv: func(env []string, paths ToolPaths) []string {
+			return setEnvValue(env, "XDG_DATA_HOME", filepath.Dir(paths.RootDir))
+		},
+	})
+}
+
 func (a *openCodeAdapter) Tool() ToolName { return ToolOpenCode }
 
 func (a *openCodeAdapter) Inspect(paths ToolPaths) (InspectToolResult, error) {
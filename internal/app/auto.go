@@ -0,0 +1,213 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+const profilePinFileName = ".codex-profile"
+
+// ProfilePin is a directory-scoped profile declaration read from a
+// .codex-profile file. The file holds either a bare profile name or TOML with
+// `profile` and an optional `tools` list.
+type ProfilePin struct {
+	Path    string     `json:"path"`
+	Profile string     `json:"profile"`
+	Tools   []ToolName `json:"tools,omitempty"`
+}
+
+type profilePinFile struct {
+	Profile string `toml:"profile"`
+	Tools   any    `toml:"tools"`
+}
+
+type AutoOptions struct {
+	Dir    string
+	Tools  []ToolName
+	DryRun bool
+}
+
+type AutoResult struct {
+	Pin     *ProfilePin    `json:"pin,omitempty"`
+	Action  string         `json:"action"`
+	Pending []ToolName     `json:"pending,omitempty"`
+	Switch  []SwitchResult `json:"switch,omitempty"`
+}
+
+// FindProfilePin walks up from dir to the filesystem root and returns the
+// first .codex-profile it finds.
+func FindProfilePin(dir string) (ProfilePin, bool, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ProfilePin{}, false, err
+	}
+	for {
+		path := filepath.Join(dir, profilePinFileName)
+		content, err := os.ReadFile(path)
+		if err == nil {
+			pin, err := parseProfilePin(content)
+			if err != nil {
+				return ProfilePin{}, false, fmt.Errorf("%s: %w", path, err)
+			}
+			pin.Path = path
+			return pin, true, nil
+		}
+		if !os.IsNotExist(err) && !errors.Is(err, os.ErrPermission) {
+			return ProfilePin{}, false, err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ProfilePin{}, false, nil
+		}
+		dir = parent
+	}
+}
+
+func parseProfilePin(content []byte) (ProfilePin, error) {
+	text := strings.TrimSpace(string(content))
+	if !strings.Contains(text, "=") {
+		for _, line := range strings.Split(text, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			if err := validateProfileName(line); err != nil {
+				return ProfilePin{}, err
+			}
+			return ProfilePin{Profile: line}, nil
+		}
+		return ProfilePin{}, errors.New("no profile declared")
+	}
+
+	var raw profilePinFile
+	if err := toml.Unmarshal(content, &raw); err != nil {
+		return ProfilePin{}, err
+	}
+	pin := ProfilePin{Profile: strings.TrimSpace(raw.Profile)}
+	if err := validateProfileName(pin.Profile); err != nil {
+		return ProfilePin{}, err
+	}
+	var toolCSV string
+	switch tools := raw.Tools.(type) {
+	case nil:
+		return pin, nil
+	case string:
+		toolCSV = tools
+	case []any:
+		parts := make([]string, 0, len(tools))
+		for _, item := range tools {
+			name, ok := item.(string)
+			if !ok {
+				return ProfilePin{}, errors.New("tools must be a list of strings")
+			}
+			parts = append(parts, name)
+		}
+		toolCSV = strings.Join(parts, ",")
+	default:
+		return ProfilePin{}, errors.New("tools must be a string or a list of strings")
+	}
+	tools, err := ParseTools(toolCSV)
+	if err != nil {
+		return ProfilePin{}, err
+	}
+	pin.Tools = tools
+	return pin, nil
+}
+
+// Auto switches to the profile pinned for opts.Dir on every tool whose
+// recorded active profile differs. Tools come from the pin file when it
+// declares them; otherwise opts.Tools is narrowed to tools that have the
+// profile. When nothing differs only the state files are read.
+func (s *Service) Auto(opts AutoOptions) (AutoResult, error) {
+	dir := opts.Dir
+	if dir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return AutoResult{}, WrapExit(ExitIOFailure, err)
+		}
+		dir = wd
+	}
+	pin, ok, err := FindProfilePin(dir)
+	if err != nil {
+		return AutoResult{}, WrapExit(ExitUserError, err)
+	}
+	if !ok {
+		return AutoResult{Action: "no_pin"}, nil
+	}
+	result := AutoResult{Pin: &pin}
+
+	tools := pin.Tools
+	explicit := len(tools) > 0
+	if !explicit {
+		tools = opts.Tools
+		if len(tools) == 0 {
+			all, err := AllTools()
+			if err != nil {
+				return result, WrapExit(ExitUserError, err)
+			}
+			tools = all
+		}
+	}
+	for _, tool := range tools {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return result, WrapExit(ExitIOFailure, err)
+		}
+		state, err := loadState(paths)
+		if err != nil {
+			return result, WrapExit(ExitIOFailure, err)
+		}
+		if state.ActiveProfile == pin.Profile {
+			continue
+		}
+		if !explicit {
+			names, err := listProfiles(paths)
+			if err != nil {
+				return result, WrapExit(ExitIOFailure, err)
+			}
+			if !containsString(names, pin.Profile) {
+				continue
+			}
+		}
+		result.Pending = append(result.Pending, tool)
+	}
+
+	if len(result.Pending) == 0 {
+		result.Action = "unchanged"
+		return result, nil
+	}
+	if opts.DryRun {
+		result.Action = "would_switch"
+		return result, nil
+	}
+	switched, err := s.Switch(pin.Profile, result.Pending, SwitchOptions{})
+	result.Switch = switched
+	if err != nil {
+		return result, err
+	}
+	result.Action = "switched"
+	return result, nil
+}
+
+func containsString(values []string, want string) bool {
+	for _, value := range values {
+		if value == want {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTool(tools []ToolName, want ToolName) bool {
+	for _, tool := range tools {
+		if tool == want {
+			return true
+		}
+	}
+	return false
+}
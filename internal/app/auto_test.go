@@ -0,0 +1,95 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseProfilePinFormats(t *testing.T) {
+	cases := map[string]ProfilePin{
+		"work\n":                     {Profile: "work"},
+		"# client repos\nclient-a\n": {Profile: "client-a"},
+		"profile = \"work\"\ntools = [\"codex\"]":        {Profile: "work", Tools: []ToolName{ToolCodex}},
+		"profile = \"work\"\ntools = \"opencode,codex\"": {Profile: "work", Tools: []ToolName{ToolCodex, ToolOpenCode}},
+	}
+	for input, want := range cases {
+		got, err := parseProfilePin([]byte(input))
+		if err != nil {
+			t.Fatalf("parse %q: %v", input, err)
+		}
+		if got.Profile != want.Profile || !toolsEqual(got.Tools, want.Tools) {
+			t.Fatalf("parse %q: expected %+v, got %+v", input, want, got)
+		}
+	}
+	for _, input := range []string{"", "bad name\n", "profile = \"work\"\ntools = [\"vim\"]"} {
+		if _, err := parseProfilePin([]byte(input)); err == nil {
+			t.Fatalf("expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestAutoSwitchesToPinnedProfileOnce(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmp, "xdg"))
+	t.Setenv("OPENCLAW_AGENT_DIR", filepath.Join(tmp, "agent"))
+
+	paths := mustToolPaths(t, ToolCodex)
+	for _, name := range []string{"personal", "client"} {
+		if err := saveProfile(paths, name, Credential{Provider: "openai-codex", Access: name + "-access", Refresh: name + "-refresh", AccountID: "acct-" + name}, true); err != nil {
+			t.Fatalf("save %s: %v", name, err)
+		}
+	}
+	svc := NewService()
+	if _, err := svc.Switch("personal", []ToolName{ToolCodex}, SwitchOptions{}); err != nil {
+		t.Fatalf("switch personal: %v", err)
+	}
+
+	repo := filepath.Join(tmp, "repo")
+	nested := filepath.Join(repo, "src", "pkg")
+	if err := os.MkdirAll(nested, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repo, profilePinFileName), []byte("client\n"), 0o600); err != nil {
+		t.Fatalf("write pin: %v", err)
+	}
+
+	none, err := svc.Auto(AutoOptions{Dir: tmp})
+	if err != nil || none.Action != "no_pin" {
+		t.Fatalf("expected no pin outside the repo, got %+v %v", none, err)
+	}
+
+	result, err := svc.Auto(AutoOptions{Dir: nested})
+	if err != nil {
+		t.Fatalf("auto: %v", err)
+	}
+	if result.Action != "switched" || !toolsEqual(result.Pending, []ToolName{ToolCodex}) {
+		t.Fatalf("expected codex switched to the pinned profile, got %+v", result)
+	}
+	tokens, err := readCodexTokens(paths.ActivePath)
+	if err != nil {
+		t.Fatalf("read active: %v", err)
+	}
+	if tokens["refresh_token"] != "client-refresh" {
+		t.Fatalf("expected client credential active, got %+v", tokens)
+	}
+
+	again, err := svc.Auto(AutoOptions{Dir: nested})
+	if err != nil || again.Action != "unchanged" {
+		t.Fatalf("expected second run to be a no-op, got %+v %v", again, err)
+	}
+}
+
+func toolsEqual(a []ToolName, b []ToolName) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
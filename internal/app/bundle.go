@@ -0,0 +1,426 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	bundleFormat         = "codex-switcher/bundle"
+	bundleVersion        = 1
+	importedNameSuffix   = "-imported"
+	maxImportRenameTries = 100
+)
+
+// Conflict policies for ImportBundle when a profile name already exists.
+const (
+	ImportConflictSkip      = "skip"
+	ImportConflictRename    = "rename"
+	ImportConflictOverwrite = "overwrite"
+)
+
+// profileBundle is the plaintext sealed inside a .cswb file.
+type profileBundle struct {
+	Version   int                    `json:"version"`
+	CreatedAt string                 `json:"createdAt"`
+	Source    string                 `json:"source,omitempty"`
+	Profiles  []bundleProfile        `json:"profiles"`
+	States    map[ToolName]StateFile `json:"states,omitempty"`
+	Config    string                 `json:"config,omitempty"`
+}
+
+type bundleProfile struct {
+	Tool    ToolName    `json:"tool"`
+	Name    string      `json:"name"`
+	Profile ProfileFile `json:"profile"`
+}
+
+type ExportBundleOptions struct {
+	Out        string
+	Tools      []ToolName
+	Profiles   []string
+	Passphrase []byte
+	Force      bool
+}
+
+type BundleEntry struct {
+	Tool      ToolName `json:"tool"`
+	Profile   string   `json:"profile"`
+	AccountID string   `json:"accountId,omitempty"`
+	Email     string   `json:"email,omitempty"`
+}
+
+type ExportBundleResult struct {
+	Out      string        `json:"out"`
+	Profiles []BundleEntry `json:"profiles"`
+	Config   bool          `json:"config"`
+}
+
+// ExportBundle seals the selected profiles, their metadata, each tool's
+// switcher state and the switcher config into one passphrase-encrypted file.
+func (s *Service) ExportBundle(opts ExportBundleOptions) (ExportBundleResult, error) {
+	result := ExportBundleResult{Out: opts.Out}
+	if len(opts.Passphrase) == 0 {
+		return result, WrapExit(ExitUserError, errors.New("a bundle passphrase is required"))
+	}
+	if !opts.Force {
+		if _, err := os.Stat(opts.Out); err == nil {
+			return result, WrapExit(ExitUserError, fmt.Errorf("%s already exists (use --force to overwrite)", opts.Out))
+		}
+	}
+	for _, name := range opts.Profiles {
+		if err := validateProfileName(name); err != nil {
+			return result, WrapExit(ExitUserError, err)
+		}
+	}
+
+	bundle := profileBundle{
+		Version:   bundleVersion,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		States:    map[ToolName]StateFile{},
+	}
+	if host, err := os.Hostname(); err == nil {
+		bundle.Source = host
+	}
+	found := map[string]bool{}
+	for _, tool := range opts.Tools {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return result, WrapExit(ExitIOFailure, err)
+		}
+		profiles, state, err := collectBundleTool(paths, opts.Profiles)
+		if err != nil {
+			return result, WrapExit(ExitIOFailure, err)
+		}
+		for _, entry := range profiles {
+			found[entry.Name] = true
+			bundle.Profiles = append(bundle.Profiles, entry)
+			result.Profiles = append(result.Profiles, BundleEntry{Tool: tool, Profile: entry.Name, AccountID: entry.Profile.AccountID, Email: entry.Profile.Email})
+		}
+		if len(profiles) > 0 {
+			bundle.States[tool] = state
+		}
+	}
+	for _, name := range opts.Profiles {
+		if !found[name] {
+			return result, WrapExit(ExitUserError, fmt.Errorf("profile %q not found for selected tools", name))
+		}
+	}
+	if len(bundle.Profiles) == 0 {
+		return result, WrapExit(ExitUserError, errors.New("no profiles to export"))
+	}
+	if configPath, err := resolveSwitcherConfigPath(); err == nil {
+		if content, err := os.ReadFile(configPath); err == nil {
+			bundle.Config = string(content)
+			result.Config = true
+		}
+	}
+
+	content, err := sealBundle(bundle, opts.Passphrase)
+	if err != nil {
+		return result, WrapExit(ExitIOFailure, err)
+	}
+	if err := writeFileAtomic(opts.Out, content, 0o600); err != nil {
+		return result, WrapExit(ExitIOFailure, err)
+	}
+	return result, nil
+}
+
+// collectBundleTool reads the named profiles of one tool, or all of them, and
+// its state under a shared lock so a concurrent refresh cannot hand the
+// bundle a refresh token it has already spent.
+func collectBundleTool(paths ToolPaths, names []string) ([]bundleProfile, StateFile, error) {
+	lock, err := acquireSharedLock(paths.LockPath)
+	if err != nil {
+		return nil, StateFile{}, err
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+
+	if len(names) == 0 {
+		names, err = listProfiles(paths)
+		if err != nil {
+			return nil, StateFile{}, err
+		}
+	}
+	profiles := make([]bundleProfile, 0, len(names))
+	for _, name := range names {
+		p, err := readStoredProfile(paths, name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, StateFile{}, fmt.Errorf("%s/%s: %w", paths.Tool, name, err)
+		}
+		profiles = append(profiles, bundleProfile{Tool: paths.Tool, Name: name, Profile: p})
+	}
+	if len(profiles) == 0 {
+		return nil, StateFile{}, nil
+	}
+	state, err := loadState(paths)
+	if err != nil {
+		return nil, StateFile{}, err
+	}
+	return profiles, state, nil
+}
+
+func sealBundle(bundle profileBundle, passphrase []byte) ([]byte, error) {
+	plaintext, err := json.Marshal(bundle)
+	if err != nil {
+		return nil, err
+	}
+	params, err := newEncryptionParams()
+	if err != nil {
+		return nil, err
+	}
+	key, err := deriveKeyFromSecret(passphrase, params)
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := sealEnvelopeFormat(bundleFormat, key, params, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+func openBundle(content []byte, passphrase []byte) (profileBundle, error) {
+	var envelope encryptedEnvelope
+	if err := json.Unmarshal(content, &envelope); err != nil || envelope.Format != bundleFormat {
+		return profileBundle{}, errors.New("not a codex-switcher bundle")
+	}
+	key, err := deriveKeyFromSecret(passphrase, envelope.Params)
+	if err != nil {
+		return profileBundle{}, err
+	}
+	plaintext, err := openEnvelopeFormat(bundleFormat, key, envelope)
+	if err != nil {
+		return profileBundle{}, err
+	}
+	var bundle profileBundle
+	if err := json.Unmarshal(plaintext, &bundle); err != nil {
+		return profileBundle{}, fmt.Errorf("invalid bundle contents: %w", err)
+	}
+	if bundle.Version > bundleVersion {
+		return profileBundle{}, fmt.Errorf("bundle version %d is newer than this codex-switcher supports", bundle.Version)
+	}
+	return bundle, nil
+}
+
+type ImportBundleOptions struct {
+	Path       string
+	Tools      []ToolName
+	Passphrase []byte
+	Conflict   string
+	DryRun     bool
+}
+
+type ImportBundleEntry struct {
+	Tool      ToolName `json:"tool"`
+	Profile   string   `json:"profile"`
+	StoredAs  string   `json:"storedAs,omitempty"`
+	AccountID string   `json:"accountId,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Status    string   `json:"status"`
+	Warning   string   `json:"warning,omitempty"`
+	// SourceActive is set when the profile was the active one on the source
+	// machine, where its refresh token is most likely still being rotated.
+	SourceActive bool `json:"sourceActive,omitempty"`
+}
+
+type ImportBundleResult struct {
+	Source    string              `json:"source,omitempty"`
+	CreatedAt string              `json:"createdAt,omitempty"`
+	Profiles  []ImportBundleEntry `json:"profiles"`
+	Config    string              `json:"config,omitempty"`
+}
+
+// TokenSinkRisk lists the imported profiles whose refresh tokens may still be
+// in use on the source machine. Whichever machine refreshes first invalidates
+// the other's copy, so one side must log in again.
+func (r ImportBundleResult) TokenSinkRisk() []ImportBundleEntry {
+	out := []ImportBundleEntry{}
+	for _, item := range r.Profiles {
+		if item.Status == "imported" || item.Status == "overwritten" || item.Status == "renamed" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// ImportBundle validates every profile in a bundle and stores it through
+// saveProfile, resolving existing names with opts.Conflict. Active
+// credentials and tool state are never changed; the switcher config is only
+// written when none exists yet.
+func (s *Service) ImportBundle(opts ImportBundleOptions) (ImportBundleResult, error) {
+	conflict := strings.ToLower(strings.TrimSpace(opts.Conflict))
+	if conflict == "" {
+		conflict = ImportConflictSkip
+	}
+	if conflict != ImportConflictSkip && conflict != ImportConflictRename && conflict != ImportConflictOverwrite {
+		return ImportBundleResult{}, WrapExit(ExitUserError, fmt.Errorf("invalid conflict policy %q (use skip, rename or overwrite)", opts.Conflict))
+	}
+	content, err := os.ReadFile(opts.Path)
+	if err != nil {
+		return ImportBundleResult{}, WrapExit(ExitUserError, err)
+	}
+	bundle, err := openBundle(content, opts.Passphrase)
+	if err != nil {
+		return ImportBundleResult{}, WrapExit(ExitAuthFailure, err)
+	}
+
+	result := ImportBundleResult{Source: bundle.Source, CreatedAt: bundle.CreatedAt}
+	for _, tool := range opts.Tools {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return result, WrapExit(ExitIOFailure, err)
+		}
+		entries := []bundleProfile{}
+		for _, item := range bundle.Profiles {
+			if item.Tool == tool {
+				entries = append(entries, item)
+			}
+		}
+		if len(entries) == 0 {
+			continue
+		}
+		imported, err := importToolProfiles(paths, entries, bundle.States[tool], conflict, opts.DryRun)
+		result.Profiles = append(result.Profiles, imported...)
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if bundle.Config != "" {
+		result.Config = importBundleConfig(bundle.Config, opts.DryRun)
+	}
+	return result, nil
+}
+
+func importToolProfiles(paths ToolPaths, entries []bundleProfile, sourceState StateFile, conflict string, dryRun bool) ([]ImportBundleEntry, error) {
+	lock, err := acquireLock(paths.LockPath)
+	if err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+
+	out := make([]ImportBundleEntry, 0, len(entries))
+	for _, item := range entries {
+		entry := ImportBundleEntry{
+			Tool:         paths.Tool,
+			Profile:      item.Name,
+			AccountID:    item.Profile.AccountID,
+			Email:        item.Profile.Email,
+			SourceActive: sourceState.ActiveProfile == item.Name,
+		}
+		cred, err := validateBundleProfile(item)
+		if err != nil {
+			entry.Status = "invalid"
+			entry.Warning = err.Error()
+			out = append(out, entry)
+			continue
+		}
+
+		target := item.Name
+		entry.Status = "imported"
+		if existing, err := readStoredProfile(paths, item.Name); err == nil {
+			switch {
+			case existing.Refresh == cred.Refresh:
+				entry.Status = "unchanged"
+			case conflict == ImportConflictSkip:
+				entry.Status = "skipped_conflict"
+				entry.Warning = "profile already exists (use --conflict rename or overwrite)"
+			case conflict == ImportConflictOverwrite:
+				entry.Status = "overwritten"
+			default:
+				target, err = unusedProfileName(paths, item.Name)
+				if err != nil {
+					return out, WrapExit(ExitIOFailure, err)
+				}
+				entry.Status = "renamed"
+				entry.StoredAs = target
+			}
+		} else if !os.IsNotExist(err) {
+			return out, WrapExit(ExitIOFailure, fmt.Errorf("%s/%s: %w", paths.Tool, item.Name, err))
+		}
+		if entry.Status == "unchanged" || entry.Status == "skipped_conflict" || dryRun {
+			out = append(out, entry)
+			continue
+		}
+		meta := item.Profile.ProfileMetadata
+		if err := saveProfileWithMetadata(paths, target, cred, true, historyOpImport, &meta); err != nil {
+			return out, WrapExit(ExitIOFailure, fmt.Errorf("%s/%s: %w", paths.Tool, target, err))
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+func validateBundleProfile(item bundleProfile) (Credential, error) {
+	if err := validateProfileName(item.Name); err != nil {
+		return Credential{}, err
+	}
+	p := item.Profile
+	if p.Version > profileFileVersion {
+		return Credential{}, fmt.Errorf("profile format version %d is newer than this codex-switcher supports", p.Version)
+	}
+	if p.Provider != "openai-codex" {
+		return Credential{}, fmt.Errorf("unsupported provider %q", p.Provider)
+	}
+	if p.Access == "" || p.Refresh == "" {
+		return Credential{}, errors.New("missing access/refresh token")
+	}
+	for _, tag := range p.Tags {
+		if _, err := NormalizeTag(tag); err != nil {
+			return Credential{}, err
+		}
+	}
+	return normalizeCredentialIdentity(credentialFromProfileFile(p)), nil
+}
+
+func unusedProfileName(paths ToolPaths, name string) (string, error) {
+	for i := 1; i <= maxImportRenameTries; i++ {
+		candidate := name + importedNameSuffix
+		if i > 1 {
+			candidate = fmt.Sprintf("%s%s-%d", name, importedNameSuffix, i)
+		}
+		if _, err := os.Stat(profilePath(paths, candidate)); os.IsNotExist(err) {
+			return candidate, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no free name for %q", name)
+}
+
+func importBundleConfig(config string, dryRun bool) string {
+	path, err := resolveSwitcherConfigPath()
+	if err != nil {
+		return "skipped"
+	}
+	if _, err := os.Stat(path); err == nil {
+		return "kept_local"
+	}
+	if dryRun {
+		return "imported"
+	}
+	if err := ensureParentDir(path); err != nil {
+		return "failed: " + err.Error()
+	}
+	if err := writeFileAtomic(path, []byte(config), 0o600); err != nil {
+		return "failed: " + err.Error()
+	}
+	resetToolRegistry()
+	return "imported"
+}
@@ -0,0 +1,156 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportImportBundleRoundTrip(t *testing.T) {
+	setupVaultTestHome(t)
+	codexPaths := mustToolPaths(t, ToolCodex)
+	for _, name := range []string{"work", "personal"} {
+		if err := saveProfile(codexPaths, name, Credential{Provider: "openai-codex", Access: name + "-access", Refresh: name + "-refresh", AccountID: "acct-" + name}, true); err != nil {
+			t.Fatalf("save %s: %v", name, err)
+		}
+	}
+	label := "Work account"
+	svc := NewService()
+	if _, err := svc.AnnotateProfile("work", []ToolName{ToolCodex}, AnnotateOptions{Label: &label, AddTags: []string{"team"}}); err != nil {
+		t.Fatalf("annotate: %v", err)
+	}
+	writeSwitcherConfig(t, "[groups]\nfocus = { codex = \"work\" }\n")
+
+	out := filepath.Join(t.TempDir(), "bundle.cswb")
+	exported, err := svc.ExportBundle(ExportBundleOptions{Out: out, Tools: mustAllTools(t), Passphrase: []byte("bundle-secret")})
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(exported.Profiles) != 2 || !exported.Config {
+		t.Fatalf("unexpected export result %+v", exported)
+	}
+	if _, err := svc.ExportBundle(ExportBundleOptions{Out: out, Tools: mustAllTools(t), Passphrase: []byte("bundle-secret")}); ExitCode(err) != ExitUserError {
+		t.Fatalf("expected existing bundle protected, got %v", err)
+	}
+
+	// Import on a fresh machine that already has a different "work" profile.
+	setupVaultTestHome(t)
+	codexPaths = mustToolPaths(t, ToolCodex)
+	if err := saveProfile(codexPaths, "work", Credential{Provider: "openai-codex", Access: "local-access", Refresh: "local-refresh", AccountID: "acct-local"}, true); err != nil {
+		t.Fatalf("save local: %v", err)
+	}
+	if _, err := svc.ImportBundle(ImportBundleOptions{Path: out, Tools: mustAllTools(t), Passphrase: []byte("wrong")}); ExitCode(err) != ExitAuthFailure {
+		t.Fatalf("expected wrong passphrase rejected, got %v", err)
+	}
+
+	result, err := svc.ImportBundle(ImportBundleOptions{Path: out, Tools: mustAllTools(t), Passphrase: []byte("bundle-secret"), Conflict: ImportConflictRename})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	statuses := map[string]ImportBundleEntry{}
+	for _, item := range result.Profiles {
+		statuses[item.Profile] = item
+	}
+	if statuses["work"].Status != "renamed" || statuses["work"].StoredAs != "work-imported" || statuses["personal"].Status != "imported" {
+		t.Fatalf("unexpected import statuses %+v", result.Profiles)
+	}
+	if len(result.TokenSinkRisk()) != 2 || result.Config != "imported" {
+		t.Fatalf("expected both imports flagged and config imported, got %+v", result)
+	}
+
+	local, err := loadProfile(codexPaths, "work")
+	if err != nil || local.Refresh != "local-refresh" {
+		t.Fatalf("expected local work profile untouched, got %+v %v", local, err)
+	}
+	imported, err := readStoredProfile(codexPaths, "work-imported")
+	if err != nil || imported.Refresh != "work-refresh" || imported.Label != label || !imported.HasTag("team") {
+		t.Fatalf("expected imported profile with metadata, got %+v %v", imported, err)
+	}
+	versions, _ := listProfileVersions(codexPaths, "work-imported")
+	if len(versions) != 1 || versions[0].Op != historyOpImport {
+		t.Fatalf("expected import recorded in history, got %+v", versions)
+	}
+	groups, err := loadProfileGroups()
+	if err != nil || len(groups) != 1 || groups[0].Name != "focus" {
+		t.Fatalf("expected config imported, got %+v %v", groups, err)
+	}
+
+	again, err := svc.ImportBundle(ImportBundleOptions{Path: out, Tools: []ToolName{ToolCodex}, Passphrase: []byte("bundle-secret")})
+	if err != nil {
+		t.Fatalf("re-import: %v", err)
+	}
+	for _, item := range again.Profiles {
+		if item.Profile == "work" && item.Status != "skipped_conflict" || item.Profile == "personal" && item.Status != "unchanged" {
+			t.Fatalf("unexpected re-import status %+v", item)
+		}
+	}
+	if again.Config != "kept_local" {
+		t.Fatalf("expected local config kept, got %q", again.Config)
+	}
+}
+
+func TestExportBundleWaitsForWriters(t *testing.T) {
+	setupVaultTestHome(t)
+	paths := mustToolPaths(t, ToolCodex)
+	if err := saveProfile(paths, "work", Credential{Provider: "openai-codex", Access: "a1", Refresh: "r1", AccountID: "acct-work"}, true); err != nil {
+		t.Fatalf("save work: %v", err)
+	}
+	lock, err := acquireLock(paths.LockPath)
+	if err != nil {
+		t.Fatalf("lock: %v", err)
+	}
+	released := make(chan struct{})
+	go func() {
+		// A refresh rotates the tokens while holding the lock.
+		time.Sleep(200 * time.Millisecond)
+		_ = saveProfile(paths, "work", Credential{Provider: "openai-codex", Access: "a2", Refresh: "r2", AccountID: "acct-work"}, true)
+		_ = lock.Release()
+		close(released)
+	}()
+
+	out := filepath.Join(t.TempDir(), "bundle.cswb")
+	if _, err := NewService().ExportBundle(ExportBundleOptions{Out: out, Tools: []ToolName{ToolCodex}, Passphrase: []byte("secret")}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	<-released
+	content, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("read bundle: %v", err)
+	}
+	bundle, err := openBundle(content, []byte("secret"))
+	if err != nil {
+		t.Fatalf("open bundle: %v", err)
+	}
+	if len(bundle.Profiles) != 1 || bundle.Profiles[0].Profile.Refresh != "r2" {
+		t.Fatalf("expected the export to wait for the rotated tokens, got %+v", bundle.Profiles)
+	}
+}
+
+func TestImportBundleRejectsInvalidProfiles(t *testing.T) {
+	setupVaultTestHome(t)
+	bundle := profileBundle{Version: bundleVersion, Profiles: []bundleProfile{
+		{Tool: ToolCodex, Name: "bad name", Profile: ProfileFile{Provider: "openai-codex", Access: "a", Refresh: "r"}},
+		{Tool: ToolCodex, Name: "empty", Profile: ProfileFile{Provider: "openai-codex"}},
+	}}
+	content, err := sealBundle(bundle, []byte("secret"))
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "bad.cswb")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	result, err := NewService().ImportBundle(ImportBundleOptions{Path: path, Tools: mustAllTools(t), Passphrase: []byte("secret")})
+	if err != nil {
+		t.Fatalf("import: %v", err)
+	}
+	for _, item := range result.Profiles {
+		if item.Status != "invalid" {
+			t.Fatalf("expected invalid profile rejected, got %+v", item)
+		}
+	}
+	if profiles, _ := listProfiles(mustToolPaths(t, ToolCodex)); len(profiles) != 0 {
+		t.Fatalf("expected nothing written, got %v", profiles)
+	}
+}
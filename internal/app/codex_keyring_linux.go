@@ -0,0 +1,279 @@
+//go:build linux
+
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	secretServiceName       = "org.freedesktop.secrets"
+	secretServicePath       = dbus.ObjectPath("/org/freedesktop/secrets")
+	secretServiceInterface  = "org.freedesktop.Secret.Service"
+	secretCollectionIface   = "org.freedesktop.Secret.Collection"
+	secretItemInterface     = "org.freedesktop.Secret.Item"
+	secretSessionInterface  = "org.freedesktop.Secret.Session"
+	secretPromptInterface   = "org.freedesktop.Secret.Prompt"
+	secretPromptTimeout     = 2 * time.Minute
+	secretContentType       = "text/plain; charset=utf8"
+	secretNoPrompt          = dbus.ObjectPath("/")
+	secretItemLabelProperty = "org.freedesktop.Secret.Item.Label"
+	secretItemAttrsProperty = "org.freedesktop.Secret.Item.Attributes"
+)
+
+type secretValue struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+type secretServiceStore struct{}
+
+// secretServiceBus is the session bus connection shared by every keyring
+// operation in the process. It is keyed by the bus address so a changed
+// DBUS_SESSION_BUS_ADDRESS gets a fresh connection.
+var secretServiceBus struct {
+	mu      sync.Mutex
+	address string
+	conn    *dbus.Conn
+}
+
+func sessionBusConn() (*dbus.Conn, error) {
+	secretServiceBus.mu.Lock()
+	defer secretServiceBus.mu.Unlock()
+	address := os.Getenv("DBUS_SESSION_BUS_ADDRESS")
+	if secretServiceBus.conn != nil && secretServiceBus.address == address && secretServiceBus.conn.Connected() {
+		return secretServiceBus.conn, nil
+	}
+	if secretServiceBus.conn != nil {
+		_ = secretServiceBus.conn.Close()
+		secretServiceBus.conn = nil
+	}
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		return nil, fmt.Errorf("connect session bus: %w", err)
+	}
+	secretServiceBus.address = address
+	secretServiceBus.conn = conn
+	return conn, nil
+}
+
+func openCodexKeyring() (codexCredentialStore, error) {
+	session, err := openSecretService()
+	if err != nil {
+		return nil, err
+	}
+	session.close()
+	return secretServiceStore{}, nil
+}
+
+func (secretServiceStore) Backend() string { return codexBackendSecretService }
+
+func (secretServiceStore) Load(paths ToolPaths) ([]byte, error) {
+	session, err := openSecretService()
+	if err != nil {
+		return nil, err
+	}
+	defer session.close()
+	item, ok, err := session.findItem(codexKeyringAttributes(paths))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	var secret secretValue
+	if err := session.conn.Object(secretServiceName, item).Call(secretItemInterface+".GetSecret", 0, session.path).Store(&secret); err != nil {
+		return nil, fmt.Errorf("read secret service item: %w", err)
+	}
+	return secret.Value, nil
+}
+
+func (secretServiceStore) Save(paths ToolPaths, content []byte) error {
+	session, err := openSecretService()
+	if err != nil {
+		return err
+	}
+	defer session.close()
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, content); err != nil {
+		return err
+	}
+	value := secretValue{Session: session.path, Parameters: []byte{}, Value: compact.Bytes(), ContentType: secretContentType}
+
+	// Overwrite Codex's own item in place: CreateItem only replaces an item
+	// with an identical attribute set, so any difference would leave a
+	// duplicate that Codex might read instead.
+	item, ok, err := session.findItem(codexKeyringAttributes(paths))
+	if err != nil {
+		return err
+	}
+	if ok {
+		if err := session.conn.Object(secretServiceName, item).Call(secretItemInterface+".SetSecret", 0, value).Err; err != nil {
+			return fmt.Errorf("write secret service item: %w", err)
+		}
+		return nil
+	}
+
+	collection, err := session.defaultCollection()
+	if err != nil {
+		return err
+	}
+	if err := session.unlock([]dbus.ObjectPath{collection}); err != nil {
+		return err
+	}
+	attrs := codexKeyringItemAttributes(paths)
+	properties := map[string]dbus.Variant{
+		secretItemLabelProperty: dbus.MakeVariant(fmt.Sprintf("%s (%s)", codexKeyringService, attrs["username"])),
+		secretItemAttrsProperty: dbus.MakeVariant(attrs),
+	}
+	var prompt dbus.ObjectPath
+	if err := session.conn.Object(secretServiceName, collection).Call(secretCollectionIface+".CreateItem", 0, properties, value, true).Store(&item, &prompt); err != nil {
+		return fmt.Errorf("write secret service item: %w", err)
+	}
+	return session.waitPrompt(prompt)
+}
+
+func (secretServiceStore) Delete(paths ToolPaths) error {
+	session, err := openSecretService()
+	if err != nil {
+		return err
+	}
+	defer session.close()
+	item, ok, err := session.findItem(codexKeyringAttributes(paths))
+	if err != nil || !ok {
+		return err
+	}
+	var prompt dbus.ObjectPath
+	if err := session.conn.Object(secretServiceName, item).Call(secretItemInterface+".Delete", 0).Store(&prompt); err != nil {
+		return fmt.Errorf("delete secret service item: %w", err)
+	}
+	return session.waitPrompt(prompt)
+}
+
+func codexKeyringAttributes(paths ToolPaths) map[string]string {
+	return map[string]string{
+		"service":  codexKeyringService,
+		"username": codexKeyringAccount(paths),
+	}
+}
+
+// codexKeyringItemAttributes is the full attribute set the keyring crate used
+// by Codex writes on a new item, so an item created here is the one Codex
+// would have created itself.
+func codexKeyringItemAttributes(paths ToolPaths) map[string]string {
+	attrs := codexKeyringAttributes(paths)
+	attrs["target"] = "default"
+	attrs["application"] = "rust-keyring"
+	return attrs
+}
+
+type secretServiceSession struct {
+	conn    *dbus.Conn
+	service dbus.BusObject
+	path    dbus.ObjectPath
+}
+
+func openSecretService() (*secretServiceSession, error) {
+	conn, err := sessionBusConn()
+	if err != nil {
+		return nil, err
+	}
+	service := conn.Object(secretServiceName, secretServicePath)
+	var output dbus.Variant
+	var path dbus.ObjectPath
+	if err := service.Call(secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).Store(&output, &path); err != nil {
+		return nil, fmt.Errorf("open secret service session: %w", err)
+	}
+	return &secretServiceSession{conn: conn, service: service, path: path}, nil
+}
+
+func (s *secretServiceSession) close() {
+	_ = s.conn.Object(secretServiceName, s.path).Call(secretSessionInterface+".Close", 0).Err
+}
+
+func (s *secretServiceSession) findItem(attrs map[string]string) (dbus.ObjectPath, bool, error) {
+	var unlocked, locked []dbus.ObjectPath
+	if err := s.service.Call(secretServiceInterface+".SearchItems", 0, attrs).Store(&unlocked, &locked); err != nil {
+		return "", false, fmt.Errorf("search secret service: %w", err)
+	}
+	if len(unlocked) > 0 {
+		return unlocked[0], true, nil
+	}
+	if len(locked) > 0 {
+		if err := s.unlock(locked[:1]); err != nil {
+			return "", false, err
+		}
+		return locked[0], true, nil
+	}
+	return "", false, nil
+}
+
+func (s *secretServiceSession) defaultCollection() (dbus.ObjectPath, error) {
+	var collection dbus.ObjectPath
+	if err := s.service.Call(secretServiceInterface+".ReadAlias", 0, "default").Store(&collection); err != nil {
+		return "", fmt.Errorf("read default secret collection: %w", err)
+	}
+	if collection == secretNoPrompt || collection == "" {
+		return "", errors.New("secret service has no default collection")
+	}
+	return collection, nil
+}
+
+func (s *secretServiceSession) unlock(objects []dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	if err := s.service.Call(secretServiceInterface+".Unlock", 0, objects).Store(&unlocked, &prompt); err != nil {
+		return fmt.Errorf("unlock secret service: %w", err)
+	}
+	return s.waitPrompt(prompt)
+}
+
+func (s *secretServiceSession) waitPrompt(prompt dbus.ObjectPath) error {
+	if prompt == "" || prompt == secretNoPrompt {
+		return nil
+	}
+	signals := make(chan *dbus.Signal, 4)
+	s.conn.Signal(signals)
+	defer s.conn.RemoveSignal(signals)
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(secretPromptInterface),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := s.conn.AddMatchSignal(match...); err != nil {
+		return err
+	}
+	defer func() { _ = s.conn.RemoveMatchSignal(match...) }()
+
+	if err := s.conn.Object(secretServiceName, prompt).Call(secretPromptInterface+".Prompt", 0, "").Err; err != nil {
+		return fmt.Errorf("secret service prompt: %w", err)
+	}
+	timeout := time.After(secretPromptTimeout)
+	for {
+		select {
+		case signal := <-signals:
+			if signal.Path != prompt || signal.Name != secretPromptInterface+".Completed" {
+				continue
+			}
+			if len(signal.Body) > 0 {
+				if dismissed, _ := signal.Body[0].(bool); dismissed {
+					return errors.New("secret service prompt was dismissed")
+				}
+			}
+			return nil
+		case <-timeout:
+			return errors.New("timed out waiting for secret service prompt")
+		}
+	}
+}
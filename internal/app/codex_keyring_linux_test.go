@@ -0,0 +1,356 @@
+//go:build linux
+
+package app
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+type fakeSecretService struct {
+	conn  *dbus.Conn
+	mu    sync.Mutex
+	next  int
+	items map[dbus.ObjectPath]*fakeSecretItem
+}
+
+type fakeSecretItem struct {
+	service *fakeSecretService
+	path    dbus.ObjectPath
+	attrs   map[string]string
+	value   []byte
+}
+
+type fakeSecretCollection struct {
+	service *fakeSecretService
+}
+
+type fakeSecretSession struct{}
+
+const (
+	fakeSecretCollectionPath = dbus.ObjectPath("/org/freedesktop/secrets/collection/login")
+	fakeSecretSessionPath    = dbus.ObjectPath("/org/freedesktop/secrets/session/1")
+)
+
+func (s *fakeSecretService) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.NewError("org.freedesktop.DBus.Error.NotSupported", []any{algorithm})
+	}
+	return dbus.MakeVariant(""), fakeSecretSessionPath, nil
+}
+
+func (s *fakeSecretService) SearchItems(attrs map[string]string) ([]dbus.ObjectPath, []dbus.ObjectPath, *dbus.Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matches := []dbus.ObjectPath{}
+	for path, item := range s.items {
+		if attributesMatch(item.attrs, attrs) {
+			matches = append(matches, path)
+		}
+	}
+	return matches, []dbus.ObjectPath{}, nil
+}
+
+func (s *fakeSecretService) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	return objects, secretNoPrompt, nil
+}
+
+func (s *fakeSecretService) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	if name == "default" {
+		return fakeSecretCollectionPath, nil
+	}
+	return secretNoPrompt, nil
+}
+
+func (c fakeSecretCollection) CreateItem(properties map[string]dbus.Variant, secret secretValue, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	s := c.service
+	attrs, ok := properties[secretItemAttrsProperty].Value().(map[string]string)
+	if !ok {
+		return "", "", dbus.MakeFailedError(fmt.Errorf("missing attributes"))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if replace {
+		for path, item := range s.items {
+			if attributesEqual(item.attrs, attrs) {
+				item.value = secret.Value
+				return path, secretNoPrompt, nil
+			}
+		}
+	}
+	s.next++
+	path := dbus.ObjectPath(fmt.Sprintf("%s/%d", fakeSecretCollectionPath, s.next))
+	item := &fakeSecretItem{service: s, path: path, attrs: attrs, value: secret.Value}
+	if err := s.conn.Export(item, path, secretItemInterface); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+	s.items[path] = item
+	return path, secretNoPrompt, nil
+}
+
+func (i *fakeSecretItem) GetSecret(session dbus.ObjectPath) (secretValue, *dbus.Error) {
+	i.service.mu.Lock()
+	defer i.service.mu.Unlock()
+	return secretValue{Session: session, Parameters: []byte{}, Value: i.value, ContentType: secretContentType}, nil
+}
+
+func (i *fakeSecretItem) SetSecret(secret secretValue) *dbus.Error {
+	i.service.mu.Lock()
+	defer i.service.mu.Unlock()
+	i.value = secret.Value
+	return nil
+}
+
+func (i *fakeSecretItem) Delete() (dbus.ObjectPath, *dbus.Error) {
+	i.service.mu.Lock()
+	defer i.service.mu.Unlock()
+	delete(i.service.items, i.path)
+	return secretNoPrompt, nil
+}
+
+func (fakeSecretSession) Close() *dbus.Error { return nil }
+
+func attributesMatch(have map[string]string, want map[string]string) bool {
+	for key, value := range want {
+		if have[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+func attributesEqual(have map[string]string, want map[string]string) bool {
+	return len(have) == len(want) && attributesMatch(have, want)
+}
+
+func (s *fakeSecretService) addItem(t *testing.T, attrs map[string]string, value []byte) {
+	t.Helper()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	path := dbus.ObjectPath(fmt.Sprintf("%s/%d", fakeSecretCollectionPath, s.next))
+	item := &fakeSecretItem{service: s, path: path, attrs: attrs, value: value}
+	if err := s.conn.Export(item, path, secretItemInterface); err != nil {
+		t.Fatalf("export item: %v", err)
+	}
+	s.items[path] = item
+}
+
+func (s *fakeSecretService) itemCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.items)
+}
+
+func (s *fakeSecretService) secretFor(account string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range s.items {
+		if item.attrs["service"] == codexKeyringService && item.attrs["username"] == account {
+			return item.value, true
+		}
+	}
+	return nil, false
+}
+
+func startTestSessionBus(t *testing.T) {
+	t.Helper()
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		t.Skip("dbus-daemon not available")
+	}
+	cmd := exec.Command(daemon, "--session", "--nofork", "--print-address=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatalf("dbus-daemon pipe: %v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Skipf("start dbus-daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+	lines := make(chan string, 1)
+	go func() {
+		line, _ := bufio.NewReader(stdout).ReadString('\n')
+		lines <- strings.TrimSpace(line)
+	}()
+	select {
+	case address := <-lines:
+		if address == "" {
+			t.Skip("dbus-daemon did not report an address")
+		}
+		t.Setenv("DBUS_SESSION_BUS_ADDRESS", address)
+	case <-time.After(5 * time.Second):
+		t.Skip("timed out waiting for dbus-daemon")
+	}
+}
+
+func startFakeSecretService(t *testing.T) *fakeSecretService {
+	t.Helper()
+	conn, err := dbus.ConnectSessionBus()
+	if err != nil {
+		t.Fatalf("connect session bus: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	service := &fakeSecretService{conn: conn, items: map[dbus.ObjectPath]*fakeSecretItem{}}
+	if err := conn.Export(service, secretServicePath, secretServiceInterface); err != nil {
+		t.Fatalf("export service: %v", err)
+	}
+	if err := conn.Export(fakeSecretCollection{service: service}, fakeSecretCollectionPath, secretCollectionIface); err != nil {
+		t.Fatalf("export collection: %v", err)
+	}
+	// godbus does not synchronise Export, so the session is exported up front
+	// and item exports happen under service.mu.
+	if err := conn.Export(fakeSecretSession{}, fakeSecretSessionPath, secretSessionInterface); err != nil {
+		t.Fatalf("export session: %v", err)
+	}
+	reply, err := conn.RequestName(secretServiceName, dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("request secret service name: %v (%v)", err, reply)
+	}
+	return service
+}
+
+func writeCodexStoreMode(t *testing.T, paths ToolPaths, mode string) {
+	t.Helper()
+	if err := os.MkdirAll(paths.RootDir, 0o700); err != nil {
+		t.Fatalf("mkdir codex home: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(paths.RootDir, "config.toml"), []byte(fmt.Sprintf("cli_auth_credentials_store = %q\n", mode)), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+}
+
+func TestCodexKeyringModeSwitchesThroughSecretService(t *testing.T) {
+	startTestSessionBus(t)
+	fake := startFakeSecretService(t)
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	paths := mustToolPaths(t, ToolCodex)
+	writeCodexStoreMode(t, paths, "keyring")
+
+	adapter := &codexAdapter{}
+	work := Credential{Access: "work-access", Refresh: "work-refresh", AccountID: "acct-work"}
+	personal := Credential{Access: "personal-access", Refresh: "personal-refresh", AccountID: "acct-personal"}
+	if err := adapter.WriteActiveCredential(paths, work); err != nil {
+		t.Fatalf("write keyring credential: %v", err)
+	}
+	if _, err := os.Stat(paths.ActivePath); !os.IsNotExist(err) {
+		t.Fatalf("expected no auth.json in keyring mode, got %v", err)
+	}
+	if err := saveProfile(paths, "personal", personal, true); err != nil {
+		t.Fatalf("save personal: %v", err)
+	}
+
+	inspect, err := adapter.Inspect(paths)
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if inspect.SwitchBlocked || inspect.CredentialBackend != codexBackendSecretService || inspect.AccountID != "acct-work" {
+		t.Fatalf("unexpected inspect result %+v", inspect)
+	}
+
+	svc := NewService()
+	results, err := svc.Switch("personal", []ToolName{ToolCodex}, SwitchOptions{})
+	if err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != "switched" {
+		t.Fatalf("unexpected switch results %+v", results)
+	}
+
+	raw, ok := fake.secretFor(codexKeyringAccount(paths))
+	if !ok {
+		t.Fatalf("expected keyring item for %s", codexKeyringAccount(paths))
+	}
+	var stored struct {
+		Tokens map[string]string `json:"tokens"`
+	}
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		t.Fatalf("decode keyring item: %v", err)
+	}
+	if stored.Tokens["refresh_token"] != "personal-refresh" {
+		t.Fatalf("expected keyring switched to personal, got %s", raw)
+	}
+	if _, err := loadProfile(paths, "__last__"); err != nil {
+		t.Fatalf("expected previous keyring credential snapshotted: %v", err)
+	}
+}
+
+func TestCodexKeyringModeBlockedWithoutSecretService(t *testing.T) {
+	startTestSessionBus(t)
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	paths := mustToolPaths(t, ToolCodex)
+	writeCodexStoreMode(t, paths, "keyring")
+
+	inspect, err := (&codexAdapter{}).Inspect(paths)
+	if err != nil {
+		t.Fatalf("inspect: %v", err)
+	}
+	if !inspect.SwitchBlocked || !strings.Contains(inspect.SwitchBlockReason, "secret service") {
+		t.Fatalf("expected keyring mode blocked without secret service, got %+v", inspect)
+	}
+}
+
+func TestCodexKeyringSaveOverwritesCodexItem(t *testing.T) {
+	startTestSessionBus(t)
+	fake := startFakeSecretService(t)
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	paths := mustToolPaths(t, ToolCodex)
+	writeCodexStoreMode(t, paths, "keyring")
+
+	// Codex created this item; its attribute set need not match ours exactly.
+	fake.addItem(t, map[string]string{
+		"service":  codexKeyringService,
+		"username": codexKeyringAccount(paths),
+		"target":   "codex",
+	}, []byte(`{"tokens":{"access_token":"old","refresh_token":"old"}}`))
+
+	adapter := &codexAdapter{}
+	if err := adapter.WriteActiveCredential(paths, Credential{Access: "new-access", Refresh: "new-refresh", AccountID: "acct-new"}); err != nil {
+		t.Fatalf("write keyring credential: %v", err)
+	}
+	if count := fake.itemCount(); count != 1 {
+		t.Fatalf("expected the existing item overwritten, got %d items", count)
+	}
+	cred, ok, err := adapter.ReadActiveCredential(paths)
+	if err != nil || !ok || cred.Refresh != "new-refresh" {
+		t.Fatalf("expected new credential read back, got %+v %v %v", cred, ok, err)
+	}
+}
+
+type failingCodexStore struct{}
+
+func (failingCodexStore) Backend() string                { return codexBackendSecretService }
+func (failingCodexStore) Load(ToolPaths) ([]byte, error) { return nil, os.ErrNotExist }
+func (failingCodexStore) Save(ToolPaths, []byte) error   { return fmt.Errorf("keyring locked") }
+func (failingCodexStore) Delete(ToolPaths) error         { return nil }
+
+func TestCodexAutoStoreReportsKeyringSaveFailure(t *testing.T) {
+	tmp := t.TempDir()
+	paths := ToolPaths{Tool: ToolCodex, RootDir: tmp, ActivePath: filepath.Join(tmp, "auth.json")}
+	store := codexAutoStore{keyring: failingCodexStore{}}
+	if err := store.Save(paths, []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "keyring locked") {
+		t.Fatalf("expected keyring failure reported, got %v", err)
+	}
+	if _, err := os.Stat(paths.ActivePath); !os.IsNotExist(err) {
+		t.Fatalf("expected no plaintext fallback, got %v", err)
+	}
+}
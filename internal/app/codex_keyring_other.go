@@ -0,0 +1,9 @@
+//go:build !linux
+
+package app
+
+import "errors"
+
+func openCodexKeyring() (codexCredentialStore, error) {
+	return nil, errors.New("keyring storage is only supported through the Linux Secret Service")
+}
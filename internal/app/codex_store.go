@@ -0,0 +1,100 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const (
+	codexKeyringService = "Codex Auth"
+
+	codexBackendFile          = "file"
+	codexBackendSecretService = "secret-service"
+)
+
+// codexCredentialStore holds the raw auth.json document wherever Codex keeps
+// it; Load reports a missing credential with os.ErrNotExist.
+type codexCredentialStore interface {
+	Backend() string
+	Load(paths ToolPaths) ([]byte, error)
+	Save(paths ToolPaths, content []byte) error
+	Delete(paths ToolPaths) error
+}
+
+type codexFileStore struct{}
+
+func (codexFileStore) Backend() string { return codexBackendFile }
+
+func (codexFileStore) Load(paths ToolPaths) ([]byte, error) {
+	return os.ReadFile(paths.ActivePath)
+}
+
+func (codexFileStore) Save(paths ToolPaths, content []byte) error {
+	if err := ensureParentDir(paths.ActivePath); err != nil {
+		return err
+	}
+	return writeFileAtomic(paths.ActivePath, content, 0o600)
+}
+
+func (codexFileStore) Delete(paths ToolPaths) error {
+	err := os.Remove(paths.ActivePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// codexAutoStore mirrors Codex's auto mode: the keyring wins when it holds a
+// credential, auth.json is the fallback, and a successful keyring save drops
+// the file copy so the two cannot diverge. A failed keyring save is reported
+// rather than quietly written to auth.json in plaintext.
+type codexAutoStore struct {
+	keyring codexCredentialStore
+}
+
+func (s codexAutoStore) Backend() string { return s.keyring.Backend() }
+
+func (s codexAutoStore) Load(paths ToolPaths) ([]byte, error) {
+	content, err := s.keyring.Load(paths)
+	if err == nil || !os.IsNotExist(err) {
+		return content, err
+	}
+	return codexFileStore{}.Load(paths)
+}
+
+func (s codexAutoStore) Save(paths ToolPaths, content []byte) error {
+	if err := s.keyring.Save(paths, content); err != nil {
+		return fmt.Errorf("save codex credential to the keyring: %w", err)
+	}
+	return codexFileStore{}.Delete(paths)
+}
+
+func (s codexAutoStore) Delete(paths ToolPaths) error {
+	if err := s.keyring.Delete(paths); err != nil {
+		return err
+	}
+	return codexFileStore{}.Delete(paths)
+}
+
+// codexKeyringAccount matches the account name Codex derives for its keyring
+// entry: "cli|" plus the first 16 hex digits of sha256(canonical CODEX_HOME).
+func codexKeyringAccount(paths ToolPaths) string {
+	root := paths.RootDir
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+	sum := sha256.Sum256([]byte(root))
+	return "cli|" + hex.EncodeToString(sum[:])[:16]
+}
+
+func encodeCodexAuth(data map[string]any) ([]byte, error) {
+	content, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
@@ -0,0 +1,197 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rotatingTokenServer accepts each access token it issued for a single usage
+// call and rotates any refresh token not yet consumed, like the real
+// endpoint. Every usage call therefore refreshes and writes tokens back.
+func rotatingTokenServer(t *testing.T) {
+	t.Helper()
+	var mu sync.Mutex
+	usable := map[string]bool{}
+	consumed := map[string]bool{}
+	issued := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodGet {
+			access := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !usable[access] {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			delete(usable, access)
+			_, _ = w.Write([]byte(`{"plan_type":"plus","rate_limit":{"primary_window":{"limit_window_seconds":18000,"used_percent":1,"reset_at":1773000000}}}`))
+			return
+		}
+		_ = r.ParseForm()
+		refresh := r.PostForm.Get("refresh_token")
+		if consumed[refresh] {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		consumed[refresh] = true
+		issued++
+		account := strings.SplitN(refresh, "-", 2)[0]
+		access := fmt.Sprintf("%s-access-%d", account, issued)
+		usable[access] = true
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  access,
+			"refresh_token": fmt.Sprintf("%s-refresh-%d", account, issued),
+		})
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("CODEX_SWITCHER_USAGE_URL", server.URL+"/backend-api/wham/usage")
+	t.Setenv("CODEX_SWITCHER_TOKEN_URL", server.URL+"/oauth/token")
+}
+
+func TestConcurrentSwitchUsageCaptureKeepStateCoherent(t *testing.T) {
+	setupVaultTestHome(t)
+	rotatingTokenServer(t)
+	tools := []ToolName{ToolCodex, ToolOpenCode}
+	for _, tool := range tools {
+		paths := mustToolPaths(t, tool)
+		for _, name := range []string{"personal", "work", "spare"} {
+			cred := Credential{Provider: "openai-codex", Access: name + "-access-0", Refresh: name + "-refresh-0-" + string(tool), AccountID: "acct-" + name}
+			if err := saveProfile(paths, name, cred, true); err != nil {
+				t.Fatalf("save %s/%s: %v", tool, name, err)
+			}
+		}
+	}
+	svc := NewService()
+	if _, err := svc.Switch("personal", tools, SwitchOptions{}); err != nil {
+		t.Fatalf("initial switch: %v", err)
+	}
+
+	const rounds = 12
+	var wg sync.WaitGroup
+	errs := make(chan error, 6*rounds)
+	run := func(op func(i int) error) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				if err := op(i); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	run(func(i int) error {
+		target := []string{"work", "personal", "spare"}[i%3]
+		_, err := svc.Switch(target, tools, SwitchOptions{})
+		if target == "spare" && ExitCode(err) == ExitUserError {
+			// Renamed away at the moment; the rename rewrites state when it is active.
+			return nil
+		}
+		return err
+	})
+	run(func(int) error {
+		_, err := svc.Usage(context.Background(), UsageOptions{Tools: tools})
+		return err
+	})
+	run(func(int) error {
+		_, err := svc.Usage(context.Background(), UsageOptions{})
+		return err
+	})
+	run(func(i int) error {
+		if i%4 != 0 {
+			_, err := svc.Status(tools)
+			return err
+		}
+		_, err := svc.Capture("snapshot", []ToolName{ToolCodex}, true)
+		return err
+	})
+	run(func(i int) error {
+		return checkToolCoherent(mustToolPaths(t, tools[i%2]))
+	})
+	run(func(i int) error {
+		names := []string{"spare", "spare-renamed"}
+		_, err := svc.RenameProfile(names[i%2], names[(i+1)%2], tools)
+		return err
+	})
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("concurrent operation failed: %v", err)
+	}
+
+	if _, err := svc.Switch("work", tools, SwitchOptions{}); err != nil {
+		t.Fatalf("final switch: %v", err)
+	}
+	// Only codex profiles share tokens through capture, so every opencode
+	// profile, including the renamed one, must still hold a live, unconsumed
+	// refresh token. Querying opencode alone keeps codex copies of the same
+	// accounts from answering for it.
+	results, err := svc.Usage(context.Background(), UsageOptions{Tools: []ToolName{ToolOpenCode}})
+	if err != nil {
+		t.Fatalf("final usage: %v", err)
+	}
+	for _, result := range results {
+		if result.Tool == ToolOpenCode && result.Status != "ok" {
+			t.Fatalf("opencode/%s lost its rotated tokens: %+v", result.Profile, result)
+		}
+	}
+	for _, tool := range tools {
+		if err := checkToolCoherent(mustToolPaths(t, tool)); err != nil {
+			t.Fatal(err)
+		}
+		paths := mustToolPaths(t, tool)
+		if _, err := os.Stat(profilePath(paths, "spare")); err != nil {
+			t.Fatalf("%s: expected the renamed profile back under its name: %v", tool, err)
+		}
+		if _, err := os.Stat(profilePath(paths, "spare-renamed")); !os.IsNotExist(err) {
+			t.Fatalf("%s: expected no write-back under the old name, got %v", tool, err)
+		}
+	}
+}
+
+// checkToolCoherent verifies, under a shared lock, that the state file, the
+// active credential and the tracked profile agree with each other.
+func checkToolCoherent(paths ToolPaths) error {
+	lock, err := acquireSharedLock(paths.LockPath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+
+	state, err := loadState(paths)
+	if err != nil {
+		return fmt.Errorf("%s: state unreadable: %w", paths.Tool, err)
+	}
+	adapter, err := adapterFor(paths.Tool)
+	if err != nil {
+		return err
+	}
+	active, ok, err := adapter.ReadActiveCredential(paths)
+	if err != nil || !ok {
+		return fmt.Errorf("%s: active credential unreadable: %v", paths.Tool, err)
+	}
+	if state.ActiveCredentialHash != "" && state.ActiveCredentialHash != credentialFingerprint(active) {
+		return fmt.Errorf("%s: state tracks %q but its hash no longer matches the active credential", paths.Tool, state.ActiveProfile)
+	}
+	if state.ActiveProfile == "" {
+		return nil
+	}
+	stored, err := loadProfile(paths, state.ActiveProfile)
+	if err != nil {
+		return fmt.Errorf("%s: active profile %q unreadable: %w", paths.Tool, state.ActiveProfile, err)
+	}
+	if !credentialsLikelyMatch(stored, active) {
+		return fmt.Errorf("%s: profile %q holds %s but the active credential is %s", paths.Tool, state.ActiveProfile, stored.Refresh, active.Refresh)
+	}
+	return nil
+}
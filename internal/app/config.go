@@ -0,0 +1,47 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+const switcherConfigFileName = "config.toml"
+
+// switcherConfigFile is the optional config.toml in the switcher data dir.
+type switcherConfigFile struct {
+	Groups  map[string]map[string]string `toml:"groups"`
+	History profileHistoryConfig         `toml:"history"`
+	Tools   map[string]jsonToolConfig    `toml:"tools"`
+}
+
+func resolveSwitcherConfigPath() (string, error) {
+	dataDir, err := resolveSwitcherDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, switcherConfigFileName), nil
+}
+
+// loadSwitcherConfig returns the parsed config and its path. A missing file
+// yields the zero config.
+func loadSwitcherConfig() (switcherConfigFile, string, error) {
+	path, err := resolveSwitcherConfigPath()
+	if err != nil {
+		return switcherConfigFile{}, "", err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return switcherConfigFile{}, path, nil
+		}
+		return switcherConfigFile{}, path, err
+	}
+	var raw switcherConfigFile
+	if err := toml.Unmarshal(content, &raw); err != nil {
+		return switcherConfigFile{}, path, fmt.Errorf("%s: %w", path, err)
+	}
+	return raw, path, nil
+}
@@ -0,0 +1,467 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DoctorInfo    = "info"
+	DoctorWarning = "warning"
+	DoctorError   = "error"
+)
+
+type DoctorOptions struct {
+	Tools        []ToolName
+	Fix          bool
+	TrialRefresh bool
+}
+
+type DoctorFinding struct {
+	Tool     ToolName `json:"tool,omitempty"`
+	Check    string   `json:"check"`
+	Severity string   `json:"severity"`
+	Profile  string   `json:"profile,omitempty"`
+	Path     string   `json:"path,omitempty"`
+	Message  string   `json:"message"`
+	Fix      string   `json:"fix,omitempty"`
+	Fixed    bool     `json:"fixed,omitempty"`
+	FixError string   `json:"fixError,omitempty"`
+}
+
+// Unresolved reports whether the finding still needs attention after --fix.
+func (f DoctorFinding) Unresolved() bool {
+	return f.Severity != DoctorInfo && !f.Fixed
+}
+
+type doctorRun struct {
+	fix      bool
+	findings []DoctorFinding
+	seen     map[string]bool
+}
+
+// add records a finding; with --fix enabled and a non-nil apply, the fix is
+// attempted immediately and its outcome recorded on the finding. A path is
+// reported once per check even when several scans reach it.
+func (d *doctorRun) add(finding DoctorFinding, apply func() error) {
+	if finding.Path != "" {
+		key := finding.Check + "\x00" + finding.Path
+		if d.seen[key] {
+			return
+		}
+		d.seen[key] = true
+	}
+	if d.fix && apply != nil && finding.Fix != "" {
+		if err := apply(); err != nil {
+			finding.FixError = err.Error()
+		} else {
+			finding.Fixed = true
+		}
+	}
+	d.findings = append(d.findings, finding)
+}
+
+func (s *Service) Doctor(opts DoctorOptions) ([]DoctorFinding, error) {
+	run := &doctorRun{fix: opts.Fix, seen: map[string]bool{}}
+
+	for _, tool := range opts.Tools {
+		adapter, err := adapterFor(tool)
+		if err != nil {
+			return run.findings, WrapExit(ExitUserError, err)
+		}
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return run.findings, WrapExit(ExitIOFailure, err)
+		}
+		if err := s.doctorTool(run, paths, adapter); err != nil {
+			return run.findings, err
+		}
+		if opts.TrialRefresh {
+			if err := doctorTrialRefresh(run, paths, adapter); err != nil {
+				return run.findings, WrapExit(ExitIOFailure, err)
+			}
+		}
+	}
+
+	if dataDir, err := resolveSwitcherDataDir(); err == nil {
+		doctorTempFiles(run, "", dataDir)
+		doctorPermissions(run, "", dataDir)
+	}
+	if vaultDir, ok := activeVaultDir(); ok {
+		doctorTempFiles(run, "", vaultDir)
+		doctorPermissions(run, "", vaultDir)
+	}
+	return run.findings, nil
+}
+
+func (s *Service) doctorTool(run *doctorRun, paths ToolPaths, adapter Adapter) error {
+	doctorLock(run, paths)
+
+	if run.fix {
+		lock, err := acquireLock(paths.LockPath)
+		if err != nil {
+			return WrapExit(ExitIOFailure, err)
+		}
+		defer func() {
+			_ = lock.Release()
+		}()
+	}
+
+	doctorTempFiles(run, paths.Tool, paths.RootDir, paths.ProfileDir)
+	doctorPermissions(run, paths.Tool, paths.ProfileDir, paths.ActivePath)
+	if err := doctorActiveState(run, paths, adapter); err != nil {
+		return WrapExit(ExitIOFailure, err)
+	}
+	if err := doctorProfiles(run, paths); err != nil {
+		return WrapExit(ExitIOFailure, err)
+	}
+	if paths.Tool == ToolOpenClaw {
+		doctorOpenClaw(run, paths)
+	}
+	return nil
+}
+
+func doctorLock(run *doctorRun, paths ToolPaths) {
+	held, stale, err := probeLock(paths.LockPath)
+	if err != nil {
+		return
+	}
+	if held {
+		run.add(DoctorFinding{
+			Tool:     paths.Tool,
+			Check:    "lock",
+			Severity: DoctorInfo,
+			Path:     paths.LockPath,
+			Message:  "lock is held by another running codex-switcher process",
+		}, nil)
+		return
+	}
+	if !stale {
+		return
+	}
+	run.add(DoctorFinding{
+		Tool:     paths.Tool,
+		Check:    "lock",
+		Severity: DoctorWarning,
+		Path:     paths.LockPath,
+		Message:  "stale lock file left by an interrupted run",
+		Fix:      "remove the lock file",
+	}, func() error {
+		return removeIfExists(paths.LockPath)
+	})
+}
+
+// doctorTempFiles reports temporary files left by writeFileAtomic. Files newer
+// than the lock staleness window may belong to a write still in progress.
+func doctorTempFiles(run *doctorRun, tool ToolName, dirs ...string) {
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasPrefix(name, ".") || !strings.Contains(name, ".tmp.") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil || time.Since(info.ModTime()) < lockStaleAfter {
+				continue
+			}
+			path := filepath.Join(dir, name)
+			run.add(DoctorFinding{
+				Tool:     tool,
+				Check:    "temp_file",
+				Severity: DoctorWarning,
+				Path:     path,
+				Message:  "leftover temporary file from an interrupted write",
+				Fix:      "remove the temporary file",
+			}, func() error {
+				return removeIfExists(path)
+			})
+		}
+	}
+}
+
+// doctorPermissions flags credential files and directories readable by other
+// users. Each path may be a file or a directory; directories are checked
+// together with the files directly inside them.
+func doctorPermissions(run *doctorRun, tool ToolName, paths ...string) {
+	if runtime.GOOS == "windows" {
+		return
+	}
+	check := func(path string, info os.FileInfo) {
+		want := os.FileMode(0o600)
+		if info.IsDir() {
+			want = 0o700
+		}
+		mode := info.Mode().Perm()
+		if mode&0o077 == 0 {
+			return
+		}
+		run.add(DoctorFinding{
+			Tool:     tool,
+			Check:    "permissions",
+			Severity: DoctorWarning,
+			Path:     path,
+			Message:  fmt.Sprintf("mode %04o is accessible to other users", mode),
+			Fix:      fmt.Sprintf("chmod %04o", want),
+		}, func() error {
+			return os.Chmod(path, want)
+		})
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		check(path, info)
+		if !info.IsDir() {
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.Type()&os.ModeSymlink != 0 {
+				continue
+			}
+			child, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			check(filepath.Join(path, entry.Name()), child)
+		}
+	}
+}
+
+func doctorActiveState(run *doctorRun, paths ToolPaths, adapter Adapter) error {
+	state, err := loadState(paths)
+	if err != nil {
+		run.add(DoctorFinding{
+			Tool:     paths.Tool,
+			Check:    "state",
+			Severity: DoctorError,
+			Path:     paths.StatePath,
+			Message:  fmt.Sprintf("state file is unreadable: %v", err),
+			Fix:      "reset active profile tracking",
+		}, func() error {
+			return saveState(paths, StateFile{Version: 1})
+		})
+		return nil
+	}
+	if state.ActiveProfile == "" || state.ActiveCredentialHash == "" {
+		return nil
+	}
+
+	active, hasActive, err := adapter.ReadActiveCredential(paths)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if hasActive && credentialFingerprint(active) == state.ActiveCredentialHash {
+		return nil
+	}
+
+	finding := DoctorFinding{
+		Tool:     paths.Tool,
+		Check:    "state",
+		Severity: DoctorWarning,
+		Profile:  state.ActiveProfile,
+		Path:     paths.StatePath,
+		Message:  fmt.Sprintf("active profile %q no longer matches the active credential", state.ActiveProfile),
+		Fix:      "clear active profile tracking",
+	}
+	retrack := hasActive && profileMatchesCredential(paths, state.ActiveProfile, active)
+	if retrack {
+		finding.Message = fmt.Sprintf("active profile %q has rotated tokens the state file does not know about", state.ActiveProfile)
+		finding.Fix = "re-track the active credential"
+	}
+	run.add(finding, func() error {
+		if retrack {
+			setActiveProfileTracking(&state, state.ActiveProfile, active)
+		} else {
+			clearActiveProfileTracking(&state)
+		}
+		return saveState(paths, state)
+	})
+	return nil
+}
+
+func doctorProfiles(run *doctorRun, paths ToolPaths) error {
+	names, err := listProfiles(paths)
+	if err != nil {
+		return err
+	}
+
+	byAccount := map[string][]string{}
+	for _, name := range names {
+		path := profilePath(paths, name)
+		stored, err := readStoredProfile(paths, name)
+		var mismatch *vaultAccountMismatchError
+		if errors.As(err, &mismatch) {
+			run.add(DoctorFinding{
+				Tool:     paths.Tool,
+				Check:    "vault_account",
+				Severity: DoctorError,
+				Profile:  name,
+				Path:     path,
+				Message:  mismatch.Error(),
+			}, nil)
+			continue
+		}
+		if err != nil {
+			run.add(DoctorFinding{
+				Tool:     paths.Tool,
+				Check:    "profile",
+				Severity: DoctorError,
+				Profile:  name,
+				Path:     path,
+				Message:  fmt.Sprintf("profile is unreadable: %v", err),
+			}, nil)
+			continue
+		}
+		cred := credentialFromProfileFile(stored)
+		if parseJWTClaims(cred.Access) == nil {
+			run.add(DoctorFinding{
+				Tool:     paths.Tool,
+				Check:    "jwt",
+				Severity: DoctorError,
+				Profile:  name,
+				Path:     path,
+				Message:  "access token is not a parsable JWT; log in again",
+			}, nil)
+		}
+
+		normalized := normalizeCredentialIdentity(cred)
+		switch {
+		case normalized.AccountID == "":
+			run.add(DoctorFinding{
+				Tool:     paths.Tool,
+				Check:    "account_id",
+				Severity: DoctorWarning,
+				Profile:  name,
+				Path:     path,
+				Message:  "profile has no account id; usage and sync cannot identify it",
+			}, nil)
+		case cred.AccountID == "":
+			run.add(DoctorFinding{
+				Tool:     paths.Tool,
+				Check:    "account_id",
+				Severity: DoctorWarning,
+				Profile:  name,
+				Path:     path,
+				Message:  fmt.Sprintf("stored account id is missing (token says %s)", normalized.AccountID),
+				Fix:      "store the account id from the access token",
+			}, func() error {
+				return saveProfileAs(paths, name, normalized, true, historyOpDoctor)
+			})
+		}
+		if normalized.AccountID != "" {
+			byAccount[normalized.AccountID] = append(byAccount[normalized.AccountID], name)
+		}
+	}
+
+	accounts := make([]string, 0, len(byAccount))
+	for accountID, profiles := range byAccount {
+		if len(profiles) > 1 {
+			accounts = append(accounts, accountID)
+		}
+	}
+	sort.Strings(accounts)
+	for _, accountID := range accounts {
+		run.add(DoctorFinding{
+			Tool:     paths.Tool,
+			Check:    "duplicate_account",
+			Severity: DoctorWarning,
+			Profile:  strings.Join(byAccount[accountID], ","),
+			Message:  fmt.Sprintf("profiles %s all hold account %s; their refresh tokens will invalidate each other", strings.Join(byAccount[accountID], ", "), accountID),
+		}, nil)
+	}
+	return nil
+}
+
+func doctorOpenClaw(run *doctorRun, paths ToolPaths) {
+	store, err := readOpenClawStore(paths.ActivePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			run.add(DoctorFinding{
+				Tool:     paths.Tool,
+				Check:    "openclaw_store",
+				Severity: DoctorError,
+				Path:     paths.ActivePath,
+				Message:  fmt.Sprintf("auth store is unreadable: %v", err),
+			}, nil)
+		}
+		return
+	}
+	if stats := planOpenClawMigration(&store); !stats.Changed {
+		return
+	}
+	run.add(DoctorFinding{
+		Tool:     paths.Tool,
+		Check:    "openclaw_store",
+		Severity: DoctorWarning,
+		Path:     paths.ActivePath,
+		Message:  "auth store is not in managed single-profile mode",
+		Fix:      "run migrate-openclaw",
+	}, func() error {
+		_, err := migrateOpenClawStore(paths)
+		return err
+	})
+}
+
+// doctorTrialRefresh refreshes every profile once to prove its refresh token
+// is still accepted. Refresh tokens rotate on use, so successful refreshes are
+// always stored, whether or not --fix was given.
+func doctorTrialRefresh(run *doctorRun, paths ToolPaths, adapter Adapter) error {
+	candidates, err := collectRefreshCandidates(paths, adapter)
+	if err != nil {
+		return err
+	}
+	httpClient := &http.Client{Timeout: defaultHTTPTimeout}
+	for _, candidate := range candidates {
+		finding := DoctorFinding{
+			Tool:    paths.Tool,
+			Check:   "refresh_token",
+			Profile: candidate.profile,
+			Path:    profilePath(paths, candidate.profile),
+		}
+		if candidate.loadErr != nil || candidate.cred.Refresh == "" {
+			continue
+		}
+		next, err := refreshCredential(context.Background(), httpClient, candidate.cred)
+		if err != nil {
+			finding.Severity = DoctorWarning
+			finding.Message = fmt.Sprintf("trial refresh failed: %v", err)
+			if isTokenRejected(err) {
+				finding.Severity = DoctorError
+				finding.Message = fmt.Sprintf("refresh token was rejected; log in again (%v)", err)
+			}
+			run.add(finding, nil)
+			continue
+		}
+		if _, err := storeRefreshedProfile(paths, adapter, candidate, next); err != nil {
+			finding.Severity = DoctorError
+			finding.Message = fmt.Sprintf("trial refresh succeeded but the new tokens could not be stored: %v", err)
+			run.add(finding, nil)
+		}
+	}
+	return nil
+}
+
+func removeIfExists(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,162 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func doctorFindingsByCheck(findings []DoctorFinding) map[string][]DoctorFinding {
+	byCheck := map[string][]DoctorFinding{}
+	for _, finding := range findings {
+		byCheck[finding.Check] = append(byCheck[finding.Check], finding)
+	}
+	return byCheck
+}
+
+func TestDoctorReportsAndFixesProblems(t *testing.T) {
+	setupVaultTestHome(t)
+	paths := mustToolPaths(t, ToolCodex)
+	access := makeJWT(t, map[string]any{"chatgpt_account_id": "acct-work"})
+	if err := saveProfile(paths, "work", Credential{Provider: "openai-codex", Access: access, Refresh: "work-refresh"}, true); err != nil {
+		t.Fatalf("save work: %v", err)
+	}
+	if err := saveProfile(paths, "work-copy", Credential{Provider: "openai-codex", Access: access, Refresh: "copy-refresh", AccountID: "acct-work"}, true); err != nil {
+		t.Fatalf("save copy: %v", err)
+	}
+	if err := saveProfile(paths, "opaque", Credential{Provider: "openai-codex", Access: "not-a-jwt", Refresh: "opaque-refresh"}, true); err != nil {
+		t.Fatalf("save opaque: %v", err)
+	}
+	svc := NewService()
+	if _, err := svc.Switch("work", []ToolName{ToolCodex}, SwitchOptions{}); err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+	// Codex rotated its own tokens behind the switcher's back.
+	if err := mustAdapter(t, ToolCodex).WriteActiveCredential(paths, Credential{Provider: "openai-codex", Access: access, Refresh: "work-refresh-2", AccountID: "acct-work"}); err != nil {
+		t.Fatalf("write active: %v", err)
+	}
+
+	// A leftover O_EXCL lock file only exists where advisory locks are unavailable.
+	useLockFallback(t)
+	old := time.Now().Add(-time.Hour)
+	if err := os.WriteFile(paths.LockPath, []byte("1\n1\n"), 0o600); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	tmpFile := filepath.Join(paths.ProfileDir, ".openai-codex.work.json.tmp.1")
+	if err := os.WriteFile(tmpFile, []byte("{}"), 0o600); err != nil {
+		t.Fatalf("write tmp: %v", err)
+	}
+	if err := os.Chtimes(tmpFile, old, old); err != nil {
+		t.Fatalf("chtimes: %v", err)
+	}
+	if err := os.Chmod(profilePath(paths, "opaque"), 0o644); err != nil {
+		t.Fatalf("chmod: %v", err)
+	}
+
+	findings, err := svc.Doctor(DoctorOptions{Tools: []ToolName{ToolCodex}})
+	if err != nil {
+		t.Fatalf("doctor: %v", err)
+	}
+	byCheck := doctorFindingsByCheck(findings)
+	for _, check := range []string{"lock", "temp_file", "state", "jwt", "account_id", "duplicate_account"} {
+		if len(byCheck[check]) == 0 {
+			t.Fatalf("expected %s finding, got %+v", check, findings)
+		}
+	}
+	if runtime.GOOS != "windows" && len(byCheck["permissions"]) != 1 {
+		t.Fatalf("expected one permissions finding, got %+v", byCheck["permissions"])
+	}
+	if _, err := os.Stat(paths.LockPath); err != nil {
+		t.Fatalf("expected report-only run to leave the lock, got %v", err)
+	}
+
+	fixed, err := svc.Doctor(DoctorOptions{Tools: []ToolName{ToolCodex}, Fix: true})
+	if err != nil {
+		t.Fatalf("doctor --fix: %v", err)
+	}
+	for _, finding := range fixed {
+		if finding.Fix != "" && !finding.Fixed {
+			t.Fatalf("expected fix applied, got %+v", finding)
+		}
+	}
+	if _, err := os.Stat(tmpFile); !os.IsNotExist(err) {
+		t.Fatalf("expected temp file removed, got %v", err)
+	}
+	stored, err := readStoredProfile(paths, "work")
+	if err != nil || stored.AccountID != "acct-work" {
+		t.Fatalf("expected account id stored, got %+v %v", stored, err)
+	}
+	state, err := loadState(paths)
+	if err != nil || state.ActiveProfile != "work" {
+		t.Fatalf("expected work still tracked, got %+v %v", state, err)
+	}
+
+	again, err := svc.Doctor(DoctorOptions{Tools: []ToolName{ToolCodex}})
+	if err != nil {
+		t.Fatalf("doctor again: %v", err)
+	}
+	byCheck = doctorFindingsByCheck(again)
+	for _, check := range []string{"lock", "temp_file", "state", "permissions"} {
+		if len(byCheck[check]) != 0 {
+			t.Fatalf("expected %s resolved, got %+v", check, byCheck[check])
+		}
+	}
+	if len(byCheck["account_id"]) != 1 || byCheck["account_id"][0].Profile != "opaque" {
+		t.Fatalf("expected only the opaque profile without an account id, got %+v", byCheck["account_id"])
+	}
+}
+
+func TestDoctorFlagsOpenClawStoreNeedingMigration(t *testing.T) {
+	setupVaultTestHome(t)
+	paths := mustToolPaths(t, ToolOpenClaw)
+	store := map[string]any{
+		"profiles": map[string]any{
+			"openai-codex:manual": map[string]any{"type": "oauth", "provider": "openai-codex", "access": "a", "refresh": "r", "accountId": "acct"},
+		},
+		"order": map[string]any{"openai-codex": []string{"openai-codex:manual"}},
+	}
+	if err := writeJSONAtomic(paths.ActivePath, store); err != nil {
+		t.Fatalf("write store: %v", err)
+	}
+
+	findings, err := NewService().Doctor(DoctorOptions{Tools: []ToolName{ToolOpenClaw}})
+	if err != nil {
+		t.Fatalf("doctor: %v", err)
+	}
+	if got := doctorFindingsByCheck(findings)["openclaw_store"]; len(got) != 1 || got[0].Fixed {
+		t.Fatalf("expected unfixed openclaw finding, got %+v", findings)
+	}
+	if _, err := NewService().Doctor(DoctorOptions{Tools: []ToolName{ToolOpenClaw}, Fix: true}); err != nil {
+		t.Fatalf("doctor --fix: %v", err)
+	}
+	findings, _ = NewService().Doctor(DoctorOptions{Tools: []ToolName{ToolOpenClaw}})
+	if got := doctorFindingsByCheck(findings)["openclaw_store"]; len(got) != 0 {
+		t.Fatalf("expected store migrated, got %+v", got)
+	}
+}
+
+func TestDoctorTrialRefreshFlagsRejectedTokens(t *testing.T) {
+	setupVaultTestHome(t)
+	newRefreshTokenServer(t, map[string]string{"good-refresh": "good-refresh-2"})
+	paths := mustToolPaths(t, ToolCodex)
+	for _, name := range []string{"good", "revoked"} {
+		if err := saveProfile(paths, name, Credential{Provider: "openai-codex", Access: name + "-access", Refresh: name + "-refresh", AccountID: "acct-" + name}, true); err != nil {
+			t.Fatalf("save %s: %v", name, err)
+		}
+	}
+
+	findings, err := NewService().Doctor(DoctorOptions{Tools: []ToolName{ToolCodex}, TrialRefresh: true})
+	if err != nil {
+		t.Fatalf("doctor: %v", err)
+	}
+	got := doctorFindingsByCheck(findings)["refresh_token"]
+	if len(got) != 1 || got[0].Profile != "revoked" || got[0].Severity != DoctorError {
+		t.Fatalf("expected revoked token flagged, got %+v", got)
+	}
+	cred, err := loadProfile(paths, "good")
+	if err != nil || cred.Refresh != "good-refresh-2" {
+		t.Fatalf("expected rotated token stored, got %+v %v", cred, err)
+	}
+}
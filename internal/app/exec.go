@@ -0,0 +1,292 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+type ExecOptions struct {
+	Profile string
+	Tools   []ToolName
+	Command []string
+	Stdin   io.Reader
+	Stdout  io.Writer
+	Stderr  io.Writer
+}
+
+type ExecToolResult struct {
+	Tool    ToolName `json:"tool"`
+	Profile string   `json:"profile"`
+	Status  string   `json:"status"`
+	Warning string   `json:"warning,omitempty"`
+}
+
+type ExecResult struct {
+	ExitCode int              `json:"exitCode"`
+	Tools    []ExecToolResult `json:"tools"`
+}
+
+type execTarget struct {
+	tool      ToolName
+	reg       toolRegistration
+	adapter   Adapter
+	paths     ToolPaths
+	tempPaths ToolPaths
+	candidate refreshCandidate
+}
+
+// Exec runs a command with the profile materialized into a private temporary
+// home for each tool, leaving the globally active credentials untouched.
+// Tokens the child refreshed are written back to the stored profile after it
+// exits.
+func (s *Service) Exec(opts ExecOptions) (ExecResult, error) {
+	if err := validateProfileName(opts.Profile); err != nil {
+		return ExecResult{}, WrapExit(ExitUserError, err)
+	}
+	if len(opts.Command) == 0 {
+		return ExecResult{}, WrapExit(ExitUserError, errors.New("no command given"))
+	}
+
+	tempRoot, err := os.MkdirTemp("", "codex-switcher-exec-")
+	if err != nil {
+		return ExecResult{}, WrapExit(ExitIOFailure, err)
+	}
+	defer func() {
+		_ = os.RemoveAll(tempRoot)
+	}()
+
+	env := os.Environ()
+	if dataDir, err := resolveSwitcherDataDir(); err == nil {
+		env = setEnvValue(env, "CODEX_SWITCHER_DATA_DIR", dataDir)
+	}
+	targets := make([]execTarget, 0, len(opts.Tools))
+	var result ExecResult
+	for _, tool := range opts.Tools {
+		target, skip, err := prepareExecTarget(tool, opts.Profile, tempRoot)
+		if err != nil {
+			cleanupExecTargets(targets)
+			return ExecResult{}, err
+		}
+		if skip != "" {
+			result.Tools = append(result.Tools, ExecToolResult{Tool: tool, Profile: opts.Profile, Status: "skipped", Warning: skip})
+			continue
+		}
+		targets = append(targets, target)
+		env = target.reg.execEnv(env, target.tempPaths)
+	}
+	if len(targets) == 0 {
+		return result, WrapExit(ExitUserError, fmt.Errorf("profile %q not found for any selected tool", opts.Profile))
+	}
+
+	result.ExitCode, err = runExecChild(opts, env)
+	for _, target := range targets {
+		result.Tools = append(result.Tools, captureExecTarget(target))
+	}
+	cleanupExecTargets(targets)
+	if err != nil {
+		return result, WrapExit(result.ExitCode, err)
+	}
+	return result, nil
+}
+
+func prepareExecTarget(tool ToolName, profile string, tempRoot string) (execTarget, string, error) {
+	reg, err := lookupTool(tool)
+	if err != nil {
+		return execTarget{}, "", WrapExit(ExitUserError, err)
+	}
+	if reg.execEnv == nil {
+		return execTarget{}, "no environment variable redirects this tool", nil
+	}
+	adapter := reg.newAdapter()
+	paths, err := resolveToolPaths(tool)
+	if err != nil {
+		return execTarget{}, "", WrapExit(ExitIOFailure, err)
+	}
+	candidates, err := collectRefreshCandidates(paths, adapter)
+	if err != nil {
+		return execTarget{}, "", WrapExit(ExitIOFailure, err)
+	}
+	var candidate refreshCandidate
+	found := false
+	for _, item := range candidates {
+		if item.profile == profile {
+			candidate, found = item, true
+			break
+		}
+	}
+	if !found {
+		return execTarget{}, "profile not found", nil
+	}
+	if candidate.loadErr != nil {
+		return execTarget{}, "", WrapExit(ExitIOFailure, fmt.Errorf("%s profile %q could not be loaded: %w", tool, profile, candidate.loadErr))
+	}
+	if candidate.cred.Access == "" || candidate.cred.Refresh == "" {
+		return execTarget{}, "", WrapExit(ExitIOFailure, fmt.Errorf("%s profile %q has no usable tokens", tool, profile))
+	}
+
+	tempPaths := toolPathsForRoot(tool, filepath.Join(tempRoot, reg.execRoot), filepath.Base(paths.ActivePath))
+	if err := mirrorToolRoot(paths, tempPaths); err != nil {
+		return execTarget{}, "", WrapExit(ExitIOFailure, err)
+	}
+	if codex, ok := adapter.(*codexAdapter); ok {
+		if sel := codex.selectStore(tempPaths); sel.blocked && sel.mode != "auto" {
+			return execTarget{}, "", WrapExit(ExitUserError, errors.New(sel.reason))
+		}
+	}
+	if oa, ok := adapter.(*openClawAdapter); ok {
+		err = oa.WriteWithProfile(tempPaths, profile, candidate.cred)
+	} else {
+		err = adapter.WriteActiveCredential(tempPaths, candidate.cred)
+	}
+	if err != nil {
+		return execTarget{}, "", WrapExit(ExitIOFailure, err)
+	}
+	return execTarget{tool: tool, reg: reg, adapter: adapter, paths: paths, tempPaths: tempPaths, candidate: candidate}, "", nil
+}
+
+// mirrorToolRoot gives the temporary root the same configuration and data as
+// the real one: the active credential file is copied so unrelated providers
+// survive, and everything else except stored profiles is symlinked.
+func mirrorToolRoot(paths ToolPaths, tempPaths ToolPaths) error {
+	if err := os.MkdirAll(tempPaths.RootDir, 0o700); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(paths.RootDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	activeName := filepath.Base(paths.ActivePath)
+	profileDirName := filepath.Base(paths.ProfileDir)
+	for _, entry := range entries {
+		name := entry.Name()
+		if name == profileDirName {
+			continue
+		}
+		if name == activeName {
+			content, err := os.ReadFile(paths.ActivePath)
+			if err != nil {
+				return err
+			}
+			if err := writeFileAtomic(tempPaths.ActivePath, content, 0o600); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.Symlink(filepath.Join(paths.RootDir, name), filepath.Join(tempPaths.RootDir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runExecChild(opts ExecOptions, env []string) (int, error) {
+	cmd := exec.Command(opts.Command[0], opts.Command[1:]...)
+	cmd.Env = env
+	cmd.Stdin = opts.Stdin
+	cmd.Stdout = opts.Stdout
+	cmd.Stderr = opts.Stderr
+
+	// Keyboard signals already reach the child through the terminal's
+	// process group; they are caught here only so the switcher outlives the
+	// child and can save its tokens. SIGTERM and SIGHUP are addressed to the
+	// switcher alone and are passed on.
+	signals := make(chan os.Signal, 4)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			return 127, err
+		}
+		return 126, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if sig == syscall.SIGTERM || sig == syscall.SIGHUP {
+					_ = cmd.Process.Signal(sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err := cmd.Wait()
+	if err == nil {
+		return 0, nil
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return 1, err
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+	return exitErr.ExitCode(), nil
+}
+
+func captureExecTarget(target execTarget) ExecToolResult {
+	out := ExecToolResult{Tool: target.tool, Profile: target.candidate.profile, Status: "unchanged"}
+	next, ok, err := target.adapter.ReadActiveCredential(target.tempPaths)
+	if err != nil && !os.IsNotExist(err) {
+		out.Status = "error"
+		out.Warning = err.Error()
+		return out
+	}
+	original := target.candidate.cred
+	if !ok || (next.Access == original.Access && next.Refresh == original.Refresh) {
+		return out
+	}
+	if next.AccountID != "" && original.AccountID != "" && next.AccountID != original.AccountID {
+		out.Status = "skipped"
+		out.Warning = "the command signed in to a different account; stored profile left unchanged"
+		return out
+	}
+	stored, err := storeRefreshedProfile(target.paths, target.adapter, target.candidate, next)
+	if err != nil {
+		out.Status = "error"
+		out.Warning = err.Error()
+		return out
+	}
+	if !stored {
+		out.Status = "skipped"
+		out.Warning = "profile changed to newer tokens or another account while the command was running; refreshed tokens discarded"
+		return out
+	}
+	out.Status = "captured"
+	return out
+}
+
+// cleanupExecTargets removes credentials the temporary homes may have placed
+// outside the temp directory, such as keyring entries.
+func cleanupExecTargets(targets []execTarget) {
+	for _, target := range targets {
+		_ = restoreActive(target.adapter, target.tempPaths, nil, false)
+	}
+}
+
+func setEnvValue(env []string, key string, value string) []string {
+	prefix := key + "="
+	out := make([]string, 0, len(env)+1)
+	for _, item := range env {
+		if !strings.HasPrefix(item, prefix) {
+			out = append(out, item)
+		}
+	}
+	return append(out, prefix+value)
+}
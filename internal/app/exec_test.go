@@ -0,0 +1,107 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecRunsInPrivateHomeAndCapturesRefreshedTokens(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	t.Setenv("CODEX_SWITCHER_DATA_DIR", filepath.Join(tmp, "data"))
+
+	paths := mustToolPaths(t, ToolCodex)
+	svc := NewService()
+	expires := time.Now().Add(time.Hour).Unix()
+	personal := Credential{Provider: "openai-codex", Access: makeJWT(t, map[string]any{"exp": expires, "sub": "p"}), Refresh: "personal-refresh", AccountID: "acct-personal"}
+	work := Credential{Provider: "openai-codex", Access: makeJWT(t, map[string]any{"exp": expires, "sub": "w"}), Refresh: "work-refresh", AccountID: "acct-work"}
+	if err := saveProfile(paths, "work", work, true); err != nil {
+		t.Fatalf("save work: %v", err)
+	}
+	if err := (&codexAdapter{}).WriteActiveCredential(paths, personal); err != nil {
+		t.Fatalf("write active: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(paths.RootDir, "config.toml"), []byte("model = \"o3\"\n"), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	script := `grep -q work-refresh "$CODEX_HOME/auth.json" || exit 90
+grep -q o3 "$CODEX_HOME/config.toml" || exit 91
+echo "$CODEX_HOME"
+printf '{"auth_mode":"chatgpt","tokens":{"access_token":"rotated-access","refresh_token":"rotated-refresh","account_id":"acct-work"}}' > "$CODEX_HOME/auth.json"
+exit 7`
+	var stdout bytes.Buffer
+	result, err := svc.Exec(ExecOptions{
+		Profile: "work",
+		Tools:   []ToolName{ToolCodex},
+		Command: []string{"sh", "-c", script},
+		Stdout:  &stdout,
+		Stderr:  &stdout,
+	})
+	if err != nil {
+		t.Fatalf("exec: %v", err)
+	}
+	if result.ExitCode != 7 {
+		t.Fatalf("expected child exit code 7, got %d (%s)", result.ExitCode, stdout.String())
+	}
+	if len(result.Tools) != 1 || result.Tools[0].Status != "captured" {
+		t.Fatalf("expected refreshed tokens captured, got %+v", result.Tools)
+	}
+
+	stored, err := loadProfile(paths, "work")
+	if err != nil {
+		t.Fatalf("load work: %v", err)
+	}
+	if stored.Refresh != "rotated-refresh" || stored.Access != "rotated-access" {
+		t.Fatalf("expected stored profile updated, got %+v", stored)
+	}
+	tokens, err := readCodexTokens(paths.ActivePath)
+	if err != nil {
+		t.Fatalf("read active: %v", err)
+	}
+	if tokens["refresh_token"] != "personal-refresh" {
+		t.Fatalf("expected global active credential untouched, got %+v", tokens)
+	}
+	tempHome := strings.TrimSpace(stdout.String())
+	if _, err := os.Stat(tempHome); !os.IsNotExist(err) {
+		t.Fatalf("expected temporary home %q removed, got %v", tempHome, err)
+	}
+}
+
+func TestExecRejectsUnknownProfile(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+
+	_, err := NewService().Exec(ExecOptions{Profile: "missing", Tools: []ToolName{ToolCodex}, Command: []string{"true"}})
+	if ExitCode(err) != ExitUserError {
+		t.Fatalf("expected user error for missing profile, got %v", err)
+	}
+}
+
+func TestExecReportsMissingCommandLikeAShell(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	t.Setenv("CODEX_SWITCHER_DATA_DIR", filepath.Join(tmp, "data"))
+
+	paths := mustToolPaths(t, ToolCodex)
+	work := Credential{Provider: "openai-codex", Access: "work-access", Refresh: "work-refresh", AccountID: "acct-work"}
+	if err := saveProfile(paths, "work", work, true); err != nil {
+		t.Fatalf("save work: %v", err)
+	}
+
+	result, err := NewService().Exec(ExecOptions{Profile: "work", Tools: []ToolName{ToolCodex}, Command: []string{filepath.Join(tmp, "no-such-command")}})
+	if ExitCode(err) != 127 || result.ExitCode != 127 {
+		t.Fatalf("expected exit code 127 for a missing command, got %d %v", result.ExitCode, err)
+	}
+}
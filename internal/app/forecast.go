@@ -0,0 +1,182 @@
+package app
+
+import (
+	"sort"
+	"time"
+)
+
+const (
+	forecastLookback = 6 * time.Hour
+	forecastMinSpan  = 5 * time.Minute
+)
+
+type UsageForecast struct {
+	Tool                ToolName `json:"tool"`
+	Profile             string   `json:"profile"`
+	AccountID           string   `json:"accountId,omitempty"`
+	Window              string   `json:"window,omitempty"`
+	UsedPercent         float64  `json:"usedPercent"`
+	BurnRatePerHour     float64  `json:"burnRatePerHour"`
+	ResetAt             int64    `json:"resetAt,omitempty"`
+	ExhaustAt           int64    `json:"exhaustAt,omitempty"`
+	ExhaustsBeforeReset bool     `json:"exhaustsBeforeReset"`
+	ProjectedAtReset    float64  `json:"projectedAtReset"`
+	Headroom            float64  `json:"headroom"`
+	Samples             int      `json:"samples"`
+	Status              string   `json:"status"`
+	Error               string   `json:"error,omitempty"`
+}
+
+// ForecastUsage annotates each window in results with a burn rate and
+// projected exhaustion time derived from recorded history, and returns one
+// forecast per profile (its most constrained window) ranked by headroom.
+// recordedAt is the time RecordUsage stamped on these same results, or zero
+// if they were not recorded; those samples are the current reading rather
+// than history and are left out of the fit.
+func (s *Service) ForecastUsage(results []UsageResult, now, recordedAt time.Time) ([]UsageForecast, error) {
+	path, err := resolveUsageHistoryPath()
+	if err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+	samples, err := readUsageHistory(path)
+	if err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+
+	forecasts := make([]UsageForecast, 0, len(results))
+	for i := range results {
+		item := &results[i]
+		forecast := UsageForecast{Tool: item.Tool, Profile: item.Profile, AccountID: item.AccountID, Status: item.Status, Error: item.Error}
+		if !item.HasUsage() || len(item.Windows) == 0 {
+			forecasts = append(forecasts, forecast)
+			continue
+		}
+		for wi := range item.Windows {
+			window := &item.Windows[wi]
+			points := usageWindowPoints(samples, *item, window.Label, recordedAt)
+			count := forecastUsageWindow(window, points, now)
+			candidate := UsageForecast{
+				Tool:                item.Tool,
+				Profile:             item.Profile,
+				AccountID:           item.AccountID,
+				Window:              window.Label,
+				UsedPercent:         window.UsedPercent,
+				BurnRatePerHour:     window.BurnRatePerHour,
+				ResetAt:             window.ResetAt,
+				ExhaustAt:           window.ExhaustAt,
+				ExhaustsBeforeReset: window.ExhaustsBeforeReset,
+				ProjectedAtReset:    projectedUsageAtReset(*window, now),
+				Samples:             count,
+				Status:              item.Status,
+			}
+			candidate.Headroom = 100 - candidate.ProjectedAtReset
+			if wi == 0 || candidate.Headroom < forecast.Headroom {
+				forecast = candidate
+			}
+		}
+		forecasts = append(forecasts, forecast)
+	}
+
+	sort.SliceStable(forecasts, func(i, j int) bool {
+		a, b := forecasts[i], forecasts[j]
+		if usageStatusHasData(a.Status) != usageStatusHasData(b.Status) {
+			return usageStatusHasData(a.Status)
+		}
+		if a.Headroom != b.Headroom {
+			return a.Headroom > b.Headroom
+		}
+		if a.ExhaustAt != b.ExhaustAt {
+			if a.ExhaustAt == 0 || b.ExhaustAt == 0 {
+				return a.ExhaustAt == 0
+			}
+			return a.ExhaustAt > b.ExhaustAt
+		}
+		if a.Tool != b.Tool {
+			return a.Tool < b.Tool
+		}
+		return a.Profile < b.Profile
+	})
+	return forecasts, nil
+}
+
+func usageWindowPoints(samples []UsageSample, item UsageResult, label string, recordedAt time.Time) []UsageSeriesPoint {
+	points := []UsageSeriesPoint{}
+	for _, sample := range samples {
+		if sample.Tool != item.Tool || sample.Profile != item.Profile {
+			continue
+		}
+		if !recordedAt.IsZero() && sample.At == recordedAt.UnixMilli() {
+			continue
+		}
+		if sample.AccountID != "" && item.AccountID != "" && sample.AccountID != item.AccountID {
+			continue
+		}
+		for _, window := range sample.Windows {
+			if window.Label == label {
+				points = append(points, UsageSeriesPoint{At: sample.At, UsedPercent: window.UsedPercent, ResetAt: window.ResetAt})
+			}
+		}
+	}
+	return points
+}
+
+// forecastUsageWindow fits a least-squares line through the samples of the
+// window's current reset period and fills in the burn rate and exhaustion
+// estimate. It returns how many samples backed the estimate.
+func forecastUsageWindow(window *UsageWindow, history []UsageSeriesPoint, now time.Time) int {
+	nowMillis := now.UnixMilli()
+	cutoff := now.Add(-forecastLookback).UnixMilli()
+	slack := usageWindowResetSlack.Milliseconds()
+
+	points := make([]UsageSeriesPoint, 0, len(history)+1)
+	for _, point := range history {
+		if point.At < cutoff {
+			continue
+		}
+		if window.ResetAt != 0 && point.ResetAt != 0 && (point.ResetAt-window.ResetAt > slack || window.ResetAt-point.ResetAt > slack) {
+			continue
+		}
+		points = append(points, point)
+	}
+	points = append(points, UsageSeriesPoint{At: nowMillis, UsedPercent: window.UsedPercent, ResetAt: window.ResetAt})
+	if len(points) < 2 || time.Duration(nowMillis-points[0].At)*time.Millisecond < forecastMinSpan {
+		return len(points)
+	}
+
+	var sumX, sumY, sumXY, sumXX float64
+	n := float64(len(points))
+	for _, point := range points {
+		x := float64(point.At-nowMillis) / float64(time.Hour/time.Millisecond)
+		sumX += x
+		sumY += point.UsedPercent
+		sumXY += x * point.UsedPercent
+		sumXX += x * x
+	}
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return len(points)
+	}
+	slope := (n*sumXY - sumX*sumY) / denominator
+	if slope <= 0 {
+		return len(points)
+	}
+
+	window.BurnRatePerHour = slope
+	if window.UsedPercent >= 100 {
+		window.ExhaustAt = nowMillis
+	} else {
+		hours := (100 - window.UsedPercent) / slope
+		window.ExhaustAt = now.Add(time.Duration(hours * float64(time.Hour))).UnixMilli()
+	}
+	window.ExhaustAtISO = time.UnixMilli(window.ExhaustAt).UTC().Format(time.RFC3339)
+	window.ExhaustsBeforeReset = window.ResetAt == 0 || window.ExhaustAt < window.ResetAt
+	return len(points)
+}
+
+func projectedUsageAtReset(window UsageWindow, now time.Time) float64 {
+	projected := window.UsedPercent
+	if window.BurnRatePerHour > 0 && window.ResetAt > now.UnixMilli() {
+		projected += window.BurnRatePerHour * time.UnixMilli(window.ResetAt).Sub(now).Hours()
+	}
+	return min(projected, 100)
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestForecastUsageProjectsExhaustionAndRanksHeadroom(t *testing.T) {
+	t.Setenv("CODEX_SWITCHER_DATA_DIR", filepath.Join(t.TempDir(), "data"))
+	svc := NewService()
+	now := time.Now()
+	reset := now.Add(4 * time.Hour).UnixMilli()
+
+	for i, used := range []float64{20, 30, 40} {
+		at := now.Add(time.Duration(i-3) * time.Hour)
+		if err := svc.RecordUsage([]UsageResult{
+			usageSampleResult("hot", used, reset),
+			usageSampleResult("cool", 10, reset),
+		}, at); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+
+	results := []UsageResult{
+		usageSampleResult("hot", 50, reset),
+		usageSampleResult("cool", 10, reset),
+		{Tool: ToolCodex, Profile: "broken", Status: "auth_error", Error: "refresh rejected"},
+	}
+	forecasts, err := svc.ForecastUsage(results, now, time.Time{})
+	if err != nil {
+		t.Fatalf("forecast: %v", err)
+	}
+
+	hot := results[0].Windows[0]
+	if math.Abs(hot.BurnRatePerHour-10) > 0.01 {
+		t.Fatalf("expected 10%%/h burn rate, got %+v", hot)
+	}
+	wantExhaust := now.Add(5 * time.Hour).UnixMilli()
+	if diff := hot.ExhaustAt - wantExhaust; diff > 1000 || diff < -1000 {
+		t.Fatalf("expected exhaustion in five hours, got %v", time.UnixMilli(hot.ExhaustAt))
+	}
+	if hot.ExhaustsBeforeReset {
+		t.Fatalf("expected window to reset before exhaustion, got %+v", hot)
+	}
+	if results[1].Windows[0].BurnRatePerHour != 0 || results[1].Windows[0].ExhaustAt != 0 {
+		t.Fatalf("expected idle profile to have no eta, got %+v", results[1].Windows[0])
+	}
+
+	if len(forecasts) != 3 || forecasts[0].Profile != "cool" || forecasts[1].Profile != "hot" || forecasts[2].Profile != "broken" {
+		t.Fatalf("unexpected forecast ranking %+v", forecasts)
+	}
+	if math.Abs(forecasts[1].ProjectedAtReset-90) > 0.1 {
+		t.Fatalf("expected hot projected at 90%% on reset, got %+v", forecasts[1])
+	}
+}
+
+func TestForecastExcludesTheJustRecordedSamples(t *testing.T) {
+	t.Setenv("CODEX_SWITCHER_DATA_DIR", filepath.Join(t.TempDir(), "data"))
+	svc := NewService()
+	now := time.Now()
+	reset := now.Add(4 * time.Hour).UnixMilli()
+
+	for i, used := range []float64{20, 30} {
+		if err := svc.RecordUsage([]UsageResult{usageSampleResult("hot", used, reset)}, now.Add(time.Duration(i-2)*time.Hour)); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	results := []UsageResult{usageSampleResult("hot", 40, reset)}
+	recordedAt := now.Add(-5 * time.Second)
+	if err := svc.RecordUsage(results, recordedAt); err != nil {
+		t.Fatalf("record usage: %v", err)
+	}
+
+	forecasts, err := svc.ForecastUsage(results, now, recordedAt)
+	if err != nil {
+		t.Fatalf("forecast: %v", err)
+	}
+	if len(forecasts) != 1 || forecasts[0].Samples != 3 {
+		t.Fatalf("expected two history samples plus the current reading, got %+v", forecasts)
+	}
+}
+
+func TestForecastIgnoresSamplesFromPreviousWindow(t *testing.T) {
+	now := time.Now()
+	window := UsageWindow{Label: "5h", UsedPercent: 5, ResetAt: now.Add(5 * time.Hour).UnixMilli()}
+	history := []UsageSeriesPoint{
+		{At: now.Add(-2 * time.Hour).UnixMilli(), UsedPercent: 80, ResetAt: now.Add(-time.Hour).UnixMilli()},
+		{At: now.Add(-90 * time.Minute).UnixMilli(), UsedPercent: 95, ResetAt: now.Add(-time.Hour).UnixMilli()},
+	}
+	if count := forecastUsageWindow(&window, history, now); count != 1 {
+		t.Fatalf("expected only the current sample to count, got %d", count)
+	}
+	if window.ExhaustAt != 0 {
+		t.Fatalf("expected no projection from the previous window, got %+v", window)
+	}
+}
@@ -0,0 +1,128 @@
+package app
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ProfileGroup maps each tool to the profile it should use, letting one
+// switch put different tools on different accounts.
+type ProfileGroup struct {
+	Name     string              `json:"name"`
+	Profiles map[ToolName]string `json:"profiles"`
+	Active   bool                `json:"active"`
+}
+
+// Tools returns the tools the group covers in sorted order.
+func (g ProfileGroup) Tools() []ToolName {
+	tools := make([]ToolName, 0, len(g.Profiles))
+	for tool := range g.Profiles {
+		tools = append(tools, tool)
+	}
+	sort.Slice(tools, func(i, j int) bool { return tools[i] < tools[j] })
+	return tools
+}
+
+// loadProfileGroups reads the [groups] table of the switcher config, e.g.
+//
+//	[groups]
+//	focus = { codex = "personal", opencode = "work", openclaw = "work" }
+//
+// A missing config yields no groups.
+func loadProfileGroups() ([]ProfileGroup, error) {
+	raw, path, err := loadSwitcherConfig()
+	if err != nil {
+		return nil, err
+	}
+	groups := make([]ProfileGroup, 0, len(raw.Groups))
+	for name, entries := range raw.Groups {
+		if !profileNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("%s: invalid group name %q", path, name)
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("%s: group %q maps no tools", path, name)
+		}
+		group := ProfileGroup{Name: name, Profiles: map[ToolName]string{}}
+		for toolName, profile := range entries {
+			tools, err := ParseTools(toolName)
+			if err != nil || len(tools) != 1 {
+				return nil, fmt.Errorf("%s: group %q: unknown tool %q", path, name, toolName)
+			}
+			if err := validateProfileName(profile); err != nil {
+				return nil, fmt.Errorf("%s: group %q: %w", path, name, err)
+			}
+			group.Profiles[tools[0]] = profile
+		}
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// Groups lists the configured groups and marks the ones whose every tool
+// currently has the group's profile active.
+func (s *Service) Groups() ([]ProfileGroup, error) {
+	groups, err := loadProfileGroups()
+	if err != nil {
+		return nil, err
+	}
+	active := map[ToolName]string{}
+	for i := range groups {
+		groups[i].Active = true
+		for tool, profile := range groups[i].Profiles {
+			current, ok := active[tool]
+			if !ok {
+				current = currentActiveProfile([]ToolName{tool})
+				active[tool] = current
+			}
+			if current != profile {
+				groups[i].Active = false
+			}
+		}
+	}
+	return groups, nil
+}
+
+// activeGroup picks the fully active group covering the most tools, so a
+// narrower group that happens to match as well does not hide a wider one.
+func activeGroup(groups []ProfileGroup) (ProfileGroup, bool) {
+	var best ProfileGroup
+	found := false
+	for _, group := range groups {
+		if group.Active && (!found || len(group.Profiles) > len(best.Profiles)) {
+			best = group
+			found = true
+		}
+	}
+	return best, found
+}
+
+// SwitchGroup switches every tool of the named group to its mapped profile
+// in one transaction. tools narrows the group when non-empty. Unlike Switch,
+// a blocked tool or a missing profile fails the whole group up front.
+func (s *Service) SwitchGroup(name string, tools []ToolName, opts SwitchOptions) ([]SwitchResult, error) {
+	groups, err := loadProfileGroups()
+	if err != nil {
+		return nil, WrapExit(ExitUserError, err)
+	}
+	var group ProfileGroup
+	for _, candidate := range groups {
+		if candidate.Name == name {
+			group = candidate
+		}
+	}
+	if group.Name == "" {
+		return nil, WrapExit(ExitUserError, fmt.Errorf("group %q is not defined", name))
+	}
+	plan := make([]switchPlanEntry, 0, len(group.Profiles))
+	for _, tool := range group.Tools() {
+		if len(tools) > 0 && !containsTool(tools, tool) {
+			continue
+		}
+		plan = append(plan, switchPlanEntry{tool: tool, profile: group.Profiles[tool]})
+	}
+	if len(plan) == 0 {
+		return nil, WrapExit(ExitUserError, fmt.Errorf("group %q maps none of the selected tools", name))
+	}
+	return s.switchPlan(plan, opts, true)
+}
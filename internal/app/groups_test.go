@@ -0,0 +1,112 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSwitcherConfig(t *testing.T, content string) {
+	t.Helper()
+	path, err := resolveSwitcherConfigPath()
+	if err != nil {
+		t.Fatalf("config path: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	resetToolRegistry()
+}
+
+func TestSwitchGroupSwitchesEachToolToItsProfile(t *testing.T) {
+	setupVaultTestHome(t)
+	codexPaths := mustToolPaths(t, ToolCodex)
+	openCodePaths := mustToolPaths(t, ToolOpenCode)
+	for _, item := range []struct {
+		paths   ToolPaths
+		profile string
+	}{{codexPaths, "personal"}, {codexPaths, "work"}, {openCodePaths, "work"}} {
+		cred := Credential{Provider: "openai-codex", Access: item.profile + "-access", Refresh: item.profile + "-refresh", AccountID: "acct-" + item.profile}
+		if err := saveProfile(item.paths, item.profile, cred, true); err != nil {
+			t.Fatalf("save %s/%s: %v", item.paths.Tool, item.profile, err)
+		}
+	}
+	writeSwitcherConfig(t, `
+[groups]
+focus = { codex = "personal", opencode = "work" }
+solo = { codex = "work" }
+broken = { codex = "personal", opencode = "missing" }
+`)
+
+	svc := NewService()
+	results, err := svc.SwitchGroup("focus", nil, SwitchOptions{})
+	if err != nil {
+		t.Fatalf("switch group: %v", err)
+	}
+	if len(results) != 2 || results[0].ToProfile != "personal" || results[1].ToProfile != "work" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	tokens, err := readCodexTokens(codexPaths.ActivePath)
+	if err != nil || tokens["refresh_token"] != "personal-refresh" {
+		t.Fatalf("expected codex on personal, got %v %v", tokens, err)
+	}
+
+	status, err := svc.Status([]ToolName{ToolCodex, ToolOpenCode})
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	for _, item := range status {
+		if item.ActiveGroup != "focus" {
+			t.Fatalf("expected focus reported active for %s, got %+v", item.Tool, item)
+		}
+	}
+
+	if _, err := svc.SwitchGroup("broken", nil, SwitchOptions{}); ExitCode(err) != ExitUserError {
+		t.Fatalf("expected missing profile to fail the group, got %v", err)
+	}
+	if _, err := svc.SwitchGroup("nope", nil, SwitchOptions{}); ExitCode(err) != ExitUserError {
+		t.Fatalf("expected unknown group rejected, got %v", err)
+	}
+	groups, err := svc.Groups()
+	if err != nil {
+		t.Fatalf("groups: %v", err)
+	}
+	if group, ok := activeGroup(groups); !ok || group.Name != "focus" {
+		t.Fatalf("expected failed group switch to leave focus active, got %+v", groups)
+	}
+
+	if _, err := svc.SwitchGroup("solo", nil, SwitchOptions{}); err != nil {
+		t.Fatalf("switch solo: %v", err)
+	}
+	status, err = svc.Status([]ToolName{ToolCodex, ToolOpenCode})
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if status[0].ActiveGroup != "solo" || status[1].ActiveGroup != "" {
+		t.Fatalf("expected only codex in the active solo group, got %+v", status)
+	}
+}
+
+func TestLoadProfileGroupsRejectsUnknownTool(t *testing.T) {
+	setupVaultTestHome(t)
+	writeSwitcherConfig(t, "[groups.focus]\nvscode = \"work\"\n")
+	if _, err := loadProfileGroups(); err == nil {
+		t.Fatalf("expected unknown tool rejected")
+	}
+}
+
+func TestStatusReportsBrokenGroupsAsWarning(t *testing.T) {
+	setupVaultTestHome(t)
+	writeSwitcherConfig(t, "[groups.focus]\nvscode = \"work\"\n")
+	results, err := NewService().Status([]ToolName{ToolCodex})
+	if err != nil {
+		t.Fatalf("expected status despite broken groups, got %v", err)
+	}
+	if len(results) != 1 || !strings.Contains(results[0].Warning, "unknown tool") {
+		t.Fatalf("expected the group error as a warning, got %+v", results)
+	}
+}
@@ -0,0 +1,415 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	profileHistoryDirName = "history"
+	defaultHistoryKeep    = 10
+)
+
+// Operations recorded with each profile version.
+const (
+	historyOpSave           = "save"
+	historyOpCapture        = "capture"
+	historyOpLogin          = "login"
+	historyOpSwitchSnapshot = "switch-snapshot"
+	historyOpRefresh        = "refresh"
+	historyOpUsageRefresh   = "usage-refresh"
+	historyOpSync           = "sync"
+	historyOpAnnotate       = "annotate"
+	historyOpRestore        = "restore"
+	historyOpImport         = "import"
+	historyOpDoctor         = "doctor"
+)
+
+// profileHistoryConfig is the [history] table of config.toml:
+//
+//	[history]
+//	keep = 10        # versions kept per profile, 0 disables history
+//	max_age = "30d"  # versions older than this are pruned
+type profileHistoryConfig struct {
+	Keep   *int   `toml:"keep"`
+	MaxAge string `toml:"max_age"`
+}
+
+type profileHistoryPolicy struct {
+	keep   int
+	maxAge time.Duration
+}
+
+func loadProfileHistoryPolicy() (profileHistoryPolicy, error) {
+	raw, path, err := loadSwitcherConfig()
+	if err != nil {
+		return profileHistoryPolicy{}, err
+	}
+	policy := profileHistoryPolicy{keep: defaultHistoryKeep}
+	if raw.History.Keep != nil {
+		if *raw.History.Keep < 0 {
+			return policy, fmt.Errorf("%s: history.keep must not be negative", path)
+		}
+		policy.keep = *raw.History.Keep
+	}
+	if raw.History.MaxAge != "" {
+		age, err := parseHistoryAge(raw.History.MaxAge)
+		if err != nil {
+			return policy, fmt.Errorf("%s: history.max_age: %w", path, err)
+		}
+		policy.maxAge = age
+	}
+	return policy, nil
+}
+
+// parseHistoryAge accepts Go durations plus a whole-day suffix such as "30d".
+func parseHistoryAge(raw string) (time.Duration, error) {
+	raw = strings.TrimSpace(raw)
+	if days, ok := strings.CutSuffix(raw, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid age %q", raw)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	age, err := time.ParseDuration(raw)
+	if err != nil || age <= 0 {
+		return 0, fmt.Errorf("invalid age %q", raw)
+	}
+	return age, nil
+}
+
+// ProfileVersion is one archived copy of a profile file.
+type ProfileVersion struct {
+	Tool      ToolName `json:"tool"`
+	Profile   string   `json:"profile"`
+	Version   int      `json:"version"`
+	SavedAt   int64    `json:"savedAt"`
+	Op        string   `json:"op"`
+	AccountID string   `json:"accountId,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	ExpiresAt int64    `json:"expiresAt,omitempty"`
+	Error     string   `json:"error,omitempty"`
+
+	path string
+}
+
+func profileHistoryDir(paths ToolPaths, name string) string {
+	return filepath.Join(paths.ProfileDir, profileHistoryDirName, name)
+}
+
+// listProfileVersions returns the archived versions of a profile, oldest
+// first. Files are named <version>-<unix ms>-<op>.json.
+func listProfileVersions(paths ToolPaths, name string) ([]ProfileVersion, error) {
+	dir := profileHistoryDir(paths, name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	versions := make([]ProfileVersion, 0, len(entries))
+	for _, entry := range entries {
+		parts := strings.SplitN(strings.TrimSuffix(entry.Name(), ".json"), "-", 3)
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") || len(parts) != 3 {
+			continue
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			continue
+		}
+		savedAt, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, ProfileVersion{
+			Tool:    paths.Tool,
+			Profile: name,
+			Version: version,
+			SavedAt: savedAt,
+			Op:      parts[2],
+			path:    filepath.Join(dir, entry.Name()),
+		})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions, nil
+}
+
+// recordProfileVersion archives the profile file just written for name and
+// prunes older versions. A write that changed nothing is not archived.
+func recordProfileVersion(paths ToolPaths, name string, written ProfileFile, op string) error {
+	policy, err := loadProfileHistoryPolicy()
+	if err != nil {
+		policy = profileHistoryPolicy{keep: defaultHistoryKeep}
+	}
+	if policy.keep == 0 {
+		return nil
+	}
+	versions, err := listProfileVersions(paths, name)
+	if err != nil {
+		return err
+	}
+	next := 1
+	if len(versions) > 0 {
+		latest := versions[len(versions)-1]
+		if previous, err := readProfileFile(latest.path); err == nil && profileFilesEquivalent(previous, written) {
+			return nil
+		}
+		next = latest.Version + 1
+	}
+	content, err := os.ReadFile(profilePath(paths, name))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	path := filepath.Join(profileHistoryDir(paths, name), fmt.Sprintf("%06d-%d-%s.json", next, now.UnixMilli(), op))
+	if err := ensureParentDir(path); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, content, 0o600); err != nil {
+		return err
+	}
+	versions = append(versions, ProfileVersion{Version: next, SavedAt: now.UnixMilli(), path: path})
+	return pruneProfileVersions(versions, policy, now)
+}
+
+// pruneProfileVersions drops versions beyond the keep count or older than
+// the max age. The newest version always survives.
+func pruneProfileVersions(versions []ProfileVersion, policy profileHistoryPolicy, now time.Time) error {
+	var errs []error
+	for i, version := range versions[:len(versions)-1] {
+		tooMany := len(versions)-i > policy.keep
+		tooOld := policy.maxAge > 0 && now.Sub(time.UnixMilli(version.SavedAt)) > policy.maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		if err := os.Remove(version.path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reencodeProfileHistory rewrites every archived version with the store's
+// current encryption setting so history never keeps a weaker copy.
+func reencodeProfileHistory(paths ToolPaths) error {
+	entries, err := os.ReadDir(filepath.Join(paths.ProfileDir, profileHistoryDirName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		versions, err := listProfileVersions(paths, entry.Name())
+		if err != nil {
+			return err
+		}
+		for _, version := range versions {
+			p, err := readProfileFile(version.path)
+			if err != nil {
+				return err
+			}
+			content, err := encodeProfileFile(paths.ProfileDir, p)
+			if err != nil {
+				return err
+			}
+			if err := writeFileAtomic(version.path, content, 0o600); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func renameProfileHistory(paths ToolPaths, from string, to string) error {
+	fromDir := profileHistoryDir(paths, from)
+	if _, err := os.Stat(fromDir); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	toDir := profileHistoryDir(paths, to)
+	if _, err := os.Stat(toDir); err == nil {
+		return fmt.Errorf("history for %q already exists", to)
+	}
+	return os.Rename(fromDir, toDir)
+}
+
+// ProfileHistory lists the archived versions of a profile for every selected
+// tool, newest first.
+func (s *Service) ProfileHistory(name string, tools []ToolName) ([]ProfileVersion, error) {
+	if err := validateProfileName(name); err != nil {
+		return nil, WrapExit(ExitUserError, err)
+	}
+	out := []ProfileVersion{}
+	for _, tool := range tools {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		versions, err := listProfileVersions(paths, name)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		for i := len(versions) - 1; i >= 0; i-- {
+			version := versions[i]
+			if p, err := readProfileFile(version.path); err != nil {
+				version.Error = err.Error()
+			} else {
+				cred := normalizeCredentialIdentity(credentialFromProfileFile(p))
+				version.AccountID = cred.AccountID
+				version.Email = cred.Email
+				version.ExpiresAt = cred.ExpiresAt()
+			}
+			out = append(out, version)
+		}
+	}
+	return out, nil
+}
+
+// selectProfileVersion resolves --at: a bare number picks that version,
+// anything else is a time and picks the newest version saved at or before it.
+func selectProfileVersion(versions []ProfileVersion, at string) (ProfileVersion, error) {
+	at = strings.TrimSpace(at)
+	if n, err := strconv.Atoi(at); err == nil {
+		for _, version := range versions {
+			if version.Version == n {
+				return version, nil
+			}
+		}
+		return ProfileVersion{}, fmt.Errorf("version %d not found", n)
+	}
+	when, err := time.Parse(time.RFC3339, at)
+	if err != nil {
+		when, err = time.ParseInLocation("2006-01-02", at, time.Local)
+		if err != nil {
+			return ProfileVersion{}, fmt.Errorf("invalid --at %q (use a version number, RFC3339 time, or YYYY-MM-DD)", at)
+		}
+	}
+	for i := len(versions) - 1; i >= 0; i-- {
+		if versions[i].SavedAt <= when.UnixMilli() {
+			return versions[i], nil
+		}
+	}
+	return ProfileVersion{}, fmt.Errorf("no version saved at or before %s", when.Format(time.RFC3339))
+}
+
+type RestoreProfileResult struct {
+	Tool    ToolName `json:"tool"`
+	Profile string   `json:"profile"`
+	Version int      `json:"version"`
+	SavedAt int64    `json:"savedAt"`
+	Active  bool     `json:"active"`
+	Status  string   `json:"status"`
+	Warning string   `json:"warning,omitempty"`
+}
+
+// RestoreProfile writes an archived version back as the current profile in
+// every selected tool that has history for it. When the profile is the
+// tool's active one the active credential is replaced as well, since the
+// next switch would otherwise snapshot the bad tokens over the restore.
+func (s *Service) RestoreProfile(name string, tools []ToolName, at string) ([]RestoreProfileResult, error) {
+	if err := validateProfileName(name); err != nil {
+		return nil, WrapExit(ExitUserError, err)
+	}
+	results := make([]RestoreProfileResult, 0, len(tools))
+	for _, tool := range tools {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		versions, err := listProfileVersions(paths, name)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		if len(versions) == 0 {
+			continue
+		}
+		version, err := selectProfileVersion(versions, at)
+		if err != nil {
+			results = append(results, RestoreProfileResult{Tool: tool, Profile: name, Status: "skipped", Warning: err.Error()})
+			continue
+		}
+		result, err := restoreProfileVersion(paths, name, version)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+	if len(results) == 0 {
+		return nil, WrapExit(ExitUserError, fmt.Errorf("no history for profile %q in selected tools", name))
+	}
+	return results, nil
+}
+
+func restoreProfileVersion(paths ToolPaths, name string, version ProfileVersion) (RestoreProfileResult, error) {
+	result := RestoreProfileResult{Tool: paths.Tool, Profile: name, Version: version.Version, SavedAt: version.SavedAt, Status: "restored"}
+	lock, err := acquireLock(paths.LockPath)
+	if err != nil {
+		return result, WrapExit(ExitIOFailure, err)
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+
+	p, err := readProfileFile(version.path)
+	if err != nil {
+		return result, WrapExit(ExitIOFailure, err)
+	}
+	p.Version = profileFileVersion
+	p.UpdatedAt = time.Now().UnixMilli()
+	if vaultDir, ok := activeVaultDir(); ok {
+		if err := writeProfileFile(vaultProfilePath(vaultDir, name), p); err != nil {
+			return result, WrapExit(ExitIOFailure, err)
+		}
+	}
+	if err := writeProfileFile(profilePath(paths, name), p); err != nil {
+		return result, WrapExit(ExitIOFailure, err)
+	}
+	if err := recordProfileVersion(paths, name, p, historyOpRestore); err != nil {
+		result.Warning = fmt.Sprintf("restored but not archived: %v", err)
+	}
+
+	state, err := loadState(paths)
+	if err != nil {
+		return result, WrapExit(ExitIOFailure, err)
+	}
+	if state.ActiveProfile != name {
+		return result, nil
+	}
+	adapter, err := adapterFor(paths.Tool)
+	if err != nil {
+		return result, WrapExit(ExitUserError, err)
+	}
+	cred := normalizeCredentialIdentity(credentialFromProfileFile(p))
+	if cred.Access == "" || cred.Refresh == "" {
+		result.Warning = "restored version has no tokens; active credential left unchanged"
+		return result, nil
+	}
+	if oa, ok := adapter.(*openClawAdapter); ok {
+		err = oa.WriteWithProfile(paths, name, cred)
+	} else {
+		err = adapter.WriteActiveCredential(paths, cred)
+	}
+	if err != nil {
+		return result, WrapExit(ExitIOFailure, err)
+	}
+	setActiveProfileTracking(&state, name, cred)
+	if err := saveState(paths, state); err != nil {
+		return result, WrapExit(ExitIOFailure, err)
+	}
+	result.Active = true
+	return result, nil
+}
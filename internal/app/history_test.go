@@ -0,0 +1,113 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func historyCred(n int) Credential {
+	return Credential{Provider: "openai-codex", Access: fmt.Sprintf("access-%d", n), Refresh: fmt.Sprintf("refresh-%d", n), AccountID: "acct-work"}
+}
+
+func TestProfileHistoryRecordsDedupesAndPrunes(t *testing.T) {
+	setupVaultTestHome(t)
+	writeSwitcherConfig(t, "[history]\nkeep = 3\n")
+	paths := mustToolPaths(t, ToolCodex)
+
+	if err := saveProfileAs(paths, "work", historyCred(1), true, historyOpLogin); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if err := saveProfileAs(paths, "work", historyCred(1), true, historyOpUsageRefresh); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	versions, err := listProfileVersions(paths, "work")
+	if err != nil || len(versions) != 1 || versions[0].Op != historyOpLogin {
+		t.Fatalf("expected unchanged save deduped, got %+v %v", versions, err)
+	}
+
+	for n := 2; n <= 5; n++ {
+		if err := saveProfileAs(paths, "work", historyCred(n), true, historyOpRefresh); err != nil {
+			t.Fatalf("save %d: %v", n, err)
+		}
+	}
+	versions, err = listProfileVersions(paths, "work")
+	if err != nil || len(versions) != 3 || versions[0].Version != 3 || versions[2].Version != 5 {
+		t.Fatalf("expected versions 3..5 kept, got %+v %v", versions, err)
+	}
+
+	now := time.Now()
+	aged := []ProfileVersion{
+		{Version: 1, SavedAt: now.Add(-48 * time.Hour).UnixMilli(), path: versions[0].path},
+		{Version: 2, SavedAt: now.Add(-48 * time.Hour).UnixMilli(), path: versions[1].path},
+	}
+	if err := pruneProfileVersions(aged, profileHistoryPolicy{keep: 10, maxAge: 24 * time.Hour}, now); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	if _, err := os.Stat(versions[0].path); !os.IsNotExist(err) {
+		t.Fatalf("expected aged version pruned, got %v", err)
+	}
+	if _, err := os.Stat(versions[1].path); err != nil {
+		t.Fatalf("expected newest version kept regardless of age, got %v", err)
+	}
+}
+
+func TestRestoreProfileRewritesActiveCredential(t *testing.T) {
+	setupVaultTestHome(t)
+	paths := mustToolPaths(t, ToolCodex)
+	if err := saveProfileAs(paths, "work", historyCred(1), true, historyOpLogin); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	svc := NewService()
+	if _, err := svc.Switch("work", []ToolName{ToolCodex}, SwitchOptions{}); err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+	if err := saveProfileAs(paths, "work", historyCred(2), true, historyOpCapture); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	history, err := svc.ProfileHistory("work", []ToolName{ToolCodex, ToolOpenCode})
+	if err != nil || len(history) != 2 || history[0].Op != historyOpCapture || history[1].AccountID != "acct-work" {
+		t.Fatalf("unexpected history %+v %v", history, err)
+	}
+
+	results, err := svc.RestoreProfile("work", []ToolName{ToolCodex, ToolOpenCode}, "1")
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != "restored" || !results[0].Active {
+		t.Fatalf("unexpected restore results %+v", results)
+	}
+	cred, err := loadProfile(paths, "work")
+	if err != nil || cred.Refresh != "refresh-1" {
+		t.Fatalf("expected profile restored, got %+v %v", cred, err)
+	}
+	tokens, err := readCodexTokens(paths.ActivePath)
+	if err != nil || tokens["refresh_token"] != "refresh-1" {
+		t.Fatalf("expected active credential restored, got %v %v", tokens, err)
+	}
+	versions, _ := listProfileVersions(paths, "work")
+	if len(versions) != 3 || versions[2].Op != historyOpRestore {
+		t.Fatalf("expected restore archived as a new version, got %+v", versions)
+	}
+
+	if _, err := selectProfileVersion(versions, "2000-01-01"); err == nil {
+		t.Fatalf("expected no version before 2000")
+	}
+	if picked, err := selectProfileVersion(versions, time.Now().Add(time.Minute).Format(time.RFC3339)); err != nil || picked.Version != 3 {
+		t.Fatalf("expected newest version for a future time, got %+v %v", picked, err)
+	}
+}
+
+func TestParseHistoryAge(t *testing.T) {
+	if age, err := parseHistoryAge("30d"); err != nil || age != 30*24*time.Hour {
+		t.Fatalf("unexpected 30d: %v %v", age, err)
+	}
+	if age, err := parseHistoryAge("12h"); err != nil || age != 12*time.Hour {
+		t.Fatalf("unexpected 12h: %v %v", age, err)
+	}
+	if _, err := parseHistoryAge("-1d"); err == nil {
+		t.Fatalf("expected negative age rejected")
+	}
+}
@@ -0,0 +1,374 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	switchJournalDirName = "switch-journals"
+	switchJournalVersion = 1
+	switchJournalFormat  = "codex-switcher/switch-journal"
+)
+
+// switchJournal is the write-ahead record of a switch in progress. It holds
+// the original active credential and state file of every tool the switch
+// touches and is written before the first mutation. Removing it is the commit
+// point, so a journal found on disk whose tools are not locked belongs to a
+// switch that did not finish. Each switch writes its own file, so switches of
+// unrelated tools do not get in each other's way.
+type switchJournal struct {
+	Version   int                  `json:"version"`
+	PID       int                  `json:"pid"`
+	StartedAt string               `json:"startedAt"`
+	Entries   []switchJournalEntry `json:"entries"`
+
+	path string
+}
+
+// switchJournalEntry keeps the original active credential sealed under the
+// tool's profile store key when that store is encrypted, so the journal
+// never holds tokens in a weaker form than the profiles do.
+type switchJournalEntry struct {
+	Tool         ToolName           `json:"tool"`
+	Paths        ToolPaths          `json:"paths"`
+	Profile      string             `json:"profile"`
+	Action       string             `json:"action"`
+	ActiveRaw    []byte             `json:"activeRaw,omitempty"`
+	ActiveSealed *encryptedEnvelope `json:"activeSealed,omitempty"`
+	ActiveSeen   bool               `json:"activeSeen"`
+	StateRaw     []byte             `json:"stateRaw,omitempty"`
+	StateSeen    bool               `json:"stateSeen"`
+	Applied      bool               `json:"applied"`
+}
+
+// switchFailpoint lets tests stop a switch between steps as if the process
+// had been killed: no rollback runs and the journal stays behind.
+var switchFailpoint func(step string) bool
+
+func hitSwitchFailpoint(step string) error {
+	if switchFailpoint != nil && switchFailpoint(step) {
+		return fmt.Errorf("failpoint %s", step)
+	}
+	return nil
+}
+
+func resolveSwitchJournalDir() (string, error) {
+	dataDir, err := resolveSwitcherDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, switchJournalDirName), nil
+}
+
+// listSwitchJournals returns the journal files on disk, oldest first.
+func listSwitchJournals() ([]string, error) {
+	dir, err := resolveSwitchJournalDir()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	paths := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// beginSwitchJournal records the switch about to run. The caller holds the
+// locks of every record's tool, so a journal that names one of them cannot
+// belong to a live switch and must be recovered first.
+func beginSwitchJournal(records []rollbackRecord) (*switchJournal, error) {
+	dir, err := resolveSwitchJournalDir()
+	if err != nil {
+		return nil, err
+	}
+	pending, err := listSwitchJournals()
+	if err != nil {
+		return nil, err
+	}
+	locked := map[string]bool{}
+	for _, record := range records {
+		locked[record.paths.LockPath] = true
+	}
+	for _, path := range pending {
+		var other switchJournal
+		if err := readJSONFile(path, &other); err == nil && !journalTouches(other, locked) {
+			continue
+		}
+		return nil, fmt.Errorf("an interrupted switch is pending recovery (%s); run `codex-switcher recover`", path)
+	}
+
+	now := time.Now()
+	journal := &switchJournal{
+		Version:   switchJournalVersion,
+		PID:       os.Getpid(),
+		StartedAt: now.UTC().Format(time.RFC3339),
+		path:      filepath.Join(dir, fmt.Sprintf("%020d-%d.json", now.UnixNano(), os.Getpid())),
+	}
+	for _, record := range records {
+		entry := switchJournalEntry{
+			Tool:       record.tool,
+			Paths:      record.paths,
+			Profile:    record.profile,
+			Action:     record.action,
+			ActiveSeen: record.activeSeen,
+			StateRaw:   record.stateRaw,
+			StateSeen:  record.stateSeen,
+		}
+		if err := entry.sealActive(record.activeRaw); err != nil {
+			return nil, err
+		}
+		journal.Entries = append(journal.Entries, entry)
+	}
+	if err := ensureParentDir(journal.path); err != nil {
+		return nil, err
+	}
+	if err := writeJSONAtomic(journal.path, journal); err != nil {
+		return nil, err
+	}
+	return journal, nil
+}
+
+func journalTouches(journal switchJournal, locked map[string]bool) bool {
+	for _, entry := range journal.Entries {
+		if locked[entry.Paths.LockPath] {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *switchJournalEntry) sealActive(raw []byte) error {
+	if len(raw) == 0 {
+		return nil
+	}
+	marker, encrypted, err := loadEncryptionMarker(e.Paths.ProfileDir)
+	if err != nil {
+		return err
+	}
+	if !encrypted {
+		e.ActiveRaw = raw
+		return nil
+	}
+	key, err := storeEncryptionKey(marker, false)
+	if err != nil {
+		return err
+	}
+	envelope, err := sealEnvelopeFormat(switchJournalFormat, key, marker.Params, raw)
+	if err != nil {
+		return err
+	}
+	e.ActiveSealed = &envelope
+	return nil
+}
+
+func (e switchJournalEntry) openActive() ([]byte, error) {
+	if e.ActiveSealed == nil {
+		return e.ActiveRaw, nil
+	}
+	key, err := deriveEncryptionKey(e.ActiveSealed.Params, false)
+	if err != nil {
+		return nil, err
+	}
+	return openEnvelopeFormat(switchJournalFormat, key, *e.ActiveSealed)
+}
+
+func (j *switchJournal) markApplied(index int) error {
+	j.Entries[index].Applied = true
+	return writeJSONAtomic(j.path, j)
+}
+
+func (j *switchJournal) remove() error {
+	if err := os.Remove(j.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (j *switchJournal) allApplied() bool {
+	for _, entry := range j.Entries {
+		if !entry.Applied {
+			return false
+		}
+	}
+	return true
+}
+
+func (j *switchJournal) rollbackRecords() ([]rollbackRecord, error) {
+	records := make([]rollbackRecord, 0, len(j.Entries))
+	for _, entry := range j.Entries {
+		adapter, err := adapterFor(entry.Tool)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", j.path, err)
+		}
+		activeRaw, err := entry.openActive()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", j.path, entry.Tool, err)
+		}
+		records = append(records, rollbackRecord{
+			tool: entry.Tool, paths: entry.Paths, adapter: adapter,
+			activeRaw: activeRaw, activeSeen: entry.ActiveSeen,
+			stateRaw: entry.StateRaw, stateSeen: entry.StateSeen,
+			profile: entry.Profile, action: entry.Action,
+		})
+	}
+	return records, nil
+}
+
+func readSwitchJournal(path string) (*switchJournal, error) {
+	var journal switchJournal
+	if err := readJSONFile(path, &journal); err != nil {
+		return nil, err
+	}
+	if journal.Version != switchJournalVersion {
+		return nil, fmt.Errorf("%s: unsupported journal version %d", path, journal.Version)
+	}
+	for _, entry := range journal.Entries {
+		if _, err := lookupTool(entry.Tool); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	journal.path = path
+	return &journal, nil
+}
+
+type RecoverMode string
+
+const (
+	RecoverAuto     RecoverMode = ""
+	RecoverRollback RecoverMode = "rollback"
+	RecoverForward  RecoverMode = "forward"
+)
+
+type RecoverToolResult struct {
+	Tool    ToolName `json:"tool"`
+	Profile string   `json:"profile"`
+	Applied bool     `json:"applied"`
+}
+
+type RecoverResult struct {
+	Action    string              `json:"action"`
+	StartedAt string              `json:"startedAt,omitempty"`
+	Tools     []RecoverToolResult `json:"tools,omitempty"`
+	Switch    []SwitchResult      `json:"switch,omitempty"`
+}
+
+// Recover finishes every switch that was interrupted before it committed,
+// oldest first, and returns one result per journal. A rollback restores every
+// tool to its state before the switch; rolling forward restores the same
+// state and replays the switch from there. In auto mode a switch whose tools
+// were all written is rolled forward and any other is rolled back.
+func (s *Service) Recover(mode RecoverMode) ([]RecoverResult, error) {
+	paths, err := listSwitchJournals()
+	if err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+	results := []RecoverResult{}
+	for _, path := range paths {
+		result, err := s.recoverSwitchJournal(path, mode)
+		if err != nil {
+			return results, err
+		}
+		if result.Action != "none" {
+			results = append(results, result)
+		}
+	}
+	return results, nil
+}
+
+func (s *Service) recoverSwitchJournal(path string, mode RecoverMode) (RecoverResult, error) {
+	journal, err := readSwitchJournal(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return RecoverResult{Action: "none"}, nil
+		}
+		return RecoverResult{}, WrapExit(ExitIOFailure, err)
+	}
+
+	locks := make([]*FileLock, 0, len(journal.Entries))
+	release := func() {
+		for _, lock := range locks {
+			_ = lock.Release()
+		}
+		locks = nil
+	}
+	defer release()
+	for _, entry := range journal.Entries {
+		lock, err := acquireLock(entry.Paths.LockPath)
+		if err != nil {
+			return RecoverResult{}, WrapExit(ExitIOFailure, fmt.Errorf("switch journal from %s is still locked: %w", journal.StartedAt, err))
+		}
+		locks = append(locks, lock)
+	}
+	// The switch that owned the journal may have finished while we waited.
+	journal, err = readSwitchJournal(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return RecoverResult{Action: "none"}, nil
+		}
+		return RecoverResult{}, WrapExit(ExitIOFailure, err)
+	}
+
+	result := RecoverResult{StartedAt: journal.StartedAt}
+	for _, entry := range journal.Entries {
+		result.Tools = append(result.Tools, RecoverToolResult{Tool: entry.Tool, Profile: entry.Profile, Applied: entry.Applied})
+	}
+	if mode == RecoverAuto {
+		mode = RecoverRollback
+		if journal.allApplied() {
+			mode = RecoverForward
+		}
+	}
+
+	if mode == RecoverForward && journal.allApplied() {
+		if err := journal.remove(); err != nil {
+			return result, WrapExit(ExitIOFailure, err)
+		}
+		result.Action = "rolled_forward"
+		return result, nil
+	}
+
+	records, err := journal.rollbackRecords()
+	if err != nil {
+		return result, WrapExit(ExitIOFailure, err)
+	}
+	s.rollback(records)
+	if err := journal.remove(); err != nil {
+		return result, WrapExit(ExitIOFailure, err)
+	}
+	if mode != RecoverForward {
+		result.Action = "rolled_back"
+		return result, nil
+	}
+
+	release()
+	plan := make([]switchPlanEntry, 0, len(journal.Entries))
+	opts := SwitchOptions{}
+	for _, entry := range journal.Entries {
+		plan = append(plan, switchPlanEntry{tool: entry.Tool, profile: entry.Profile})
+		if entry.Action == "prepare" {
+			opts.CreateMissing = true
+		}
+	}
+	result.Switch, err = s.switchPlan(plan, opts, false)
+	if err != nil {
+		return result, err
+	}
+	result.Action = "rolled_forward"
+	return result, nil
+}
@@ -0,0 +1,184 @@
+package app
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+var journalFailpointSteps = []string{
+	"journal",
+	"codex/snapshot", "codex/active", "codex/state",
+	"opencode/snapshot", "opencode/active", "opencode/state",
+	"commit",
+}
+
+func setupJournalTest(t *testing.T) ([]ToolName, []ToolPaths) {
+	t.Helper()
+	setupVaultTestHome(t)
+	tools := []ToolName{ToolCodex, ToolOpenCode}
+	paths := []ToolPaths{mustToolPaths(t, ToolCodex), mustToolPaths(t, ToolOpenCode)}
+	for _, p := range paths {
+		for _, profile := range []string{"personal", "work"} {
+			cred := Credential{Provider: "openai-codex", Access: profile + "-access", Refresh: profile + "-refresh", AccountID: "acct-" + profile}
+			if err := saveProfile(p, profile, cred, true); err != nil {
+				t.Fatalf("save %s/%s: %v", p.Tool, profile, err)
+			}
+		}
+	}
+	if _, err := NewService().Switch("personal", tools, SwitchOptions{}); err != nil {
+		t.Fatalf("initial switch: %v", err)
+	}
+	return tools, paths
+}
+
+func readOrNil(t *testing.T, path string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return content
+}
+
+func crashSwitchAt(t *testing.T, step string, tools []ToolName) {
+	t.Helper()
+	switchFailpoint = func(current string) bool { return current == step }
+	defer func() { switchFailpoint = nil }()
+	if _, err := NewService().Switch("work", tools, SwitchOptions{}); err == nil {
+		t.Fatalf("%s: expected failpoint to stop the switch", step)
+	}
+	if journals, err := listSwitchJournals(); err != nil || len(journals) != 1 {
+		t.Fatalf("%s: expected journal left behind, got %v %v", step, journals, err)
+	}
+}
+
+func TestRecoverRollsBackInterruptedSwitchAtEveryStep(t *testing.T) {
+	for _, step := range journalFailpointSteps {
+		t.Run(step, func(t *testing.T) {
+			tools, paths := setupJournalTest(t)
+			before := map[string][]byte{}
+			for _, p := range paths {
+				before[p.ActivePath] = readOrNil(t, p.ActivePath)
+				before[p.StatePath] = readOrNil(t, p.StatePath)
+			}
+
+			crashSwitchAt(t, step, tools)
+			if _, err := NewService().Switch("work", tools, SwitchOptions{}); ExitCode(err) != ExitIOFailure {
+				t.Fatalf("expected switch refused while a journal is pending, got %v", err)
+			}
+
+			results, err := NewService().Recover(RecoverRollback)
+			if err != nil {
+				t.Fatalf("recover: %v", err)
+			}
+			if len(results) != 1 || results[0].Action != "rolled_back" || len(results[0].Tools) != 2 {
+				t.Fatalf("unexpected recover results %+v", results)
+			}
+			for path, content := range before {
+				if got := readOrNil(t, path); !bytes.Equal(got, content) {
+					t.Fatalf("%s not restored:\nwant %s\ngot  %s", path, content, got)
+				}
+			}
+			if results, err := NewService().Recover(RecoverAuto); err != nil || len(results) != 0 {
+				t.Fatalf("expected journal cleared, got %+v %v", results, err)
+			}
+		})
+	}
+}
+
+func TestRecoverRollsForwardInterruptedSwitchAtEveryStep(t *testing.T) {
+	for _, step := range journalFailpointSteps {
+		t.Run(step, func(t *testing.T) {
+			tools, paths := setupJournalTest(t)
+			crashSwitchAt(t, step, tools)
+
+			mode := RecoverForward
+			if step == "commit" {
+				mode = RecoverAuto
+			}
+			results, err := NewService().Recover(mode)
+			if err != nil {
+				t.Fatalf("recover: %v", err)
+			}
+			if len(results) != 1 || results[0].Action != "rolled_forward" {
+				t.Fatalf("unexpected recover results %+v", results)
+			}
+			for _, p := range paths {
+				state, err := loadState(p)
+				if err != nil || state.ActiveProfile != "work" || state.PreviousProfile != "personal" {
+					t.Fatalf("%s: expected work active after personal, got %+v %v", p.Tool, state, err)
+				}
+			}
+			tokens, err := readCodexTokens(paths[0].ActivePath)
+			if err != nil || tokens["refresh_token"] != "work-refresh" {
+				t.Fatalf("expected codex on work, got %v %v", tokens, err)
+			}
+		})
+	}
+}
+
+func TestRecoverAutoRollsBackPartialSwitch(t *testing.T) {
+	tools, paths := setupJournalTest(t)
+	crashSwitchAt(t, "opencode/snapshot", tools)
+	results, err := NewService().Recover(RecoverAuto)
+	if err != nil || len(results) != 1 || results[0].Action != "rolled_back" {
+		t.Fatalf("expected partial switch rolled back, got %+v %v", results, err)
+	}
+	if !results[0].Tools[0].Applied || results[0].Tools[1].Applied {
+		t.Fatalf("expected only codex reported applied, got %+v", results[0].Tools)
+	}
+	state, err := loadState(paths[0])
+	if err != nil || state.ActiveProfile != "personal" {
+		t.Fatalf("expected codex back on personal, got %+v %v", state, err)
+	}
+}
+
+func TestSwitchJournalOnlyBlocksOverlappingTools(t *testing.T) {
+	tools, paths := setupJournalTest(t)
+	crashSwitchAt(t, "codex/state", tools[:1])
+
+	// The journal left behind only covers codex, so opencode still switches.
+	results, err := NewService().Switch("work", tools[1:], SwitchOptions{})
+	if err != nil || len(results) != 1 || results[0].Status != "switched" {
+		t.Fatalf("expected opencode switch unaffected, got %+v %v", results, err)
+	}
+	if _, err := NewService().Switch("work", tools, SwitchOptions{}); ExitCode(err) != ExitIOFailure {
+		t.Fatalf("expected codex switch refused while its journal is pending, got %v", err)
+	}
+	if _, err := NewService().Recover(RecoverRollback); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	state, err := loadState(paths[1])
+	if err != nil || state.ActiveProfile != "work" {
+		t.Fatalf("expected opencode left on work, got %+v %v", state, err)
+	}
+}
+
+func TestSwitchJournalSealsTokensOfEncryptedStores(t *testing.T) {
+	tools, paths := setupJournalTest(t)
+	t.Setenv("CODEX_SWITCHER_PASSPHRASE", "correct horse")
+	if _, err := NewService().EncryptProfiles(tools[:1]); err != nil {
+		t.Fatalf("encrypt profiles: %v", err)
+	}
+	before := readOrNil(t, paths[0].ActivePath)
+	crashSwitchAt(t, "codex/active", tools[:1])
+
+	journals, err := listSwitchJournals()
+	if err != nil || len(journals) != 1 {
+		t.Fatalf("expected one journal, got %v %v", journals, err)
+	}
+	journal, err := readSwitchJournal(journals[0])
+	if err != nil {
+		t.Fatalf("read journal: %v", err)
+	}
+	if entry := journal.Entries[0]; len(entry.ActiveRaw) != 0 || entry.ActiveSealed == nil {
+		t.Fatalf("expected the active credential sealed, got %+v", entry)
+	}
+	if _, err := NewService().Recover(RecoverRollback); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+	if got := readOrNil(t, paths[0].ActivePath); !bytes.Equal(got, before) {
+		t.Fatalf("expected codex credential restored:\nwant %s\ngot  %s", before, got)
+	}
+}
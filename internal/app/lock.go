@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -15,22 +16,109 @@ const (
 	lockStaleAfter  = 30 * time.Second
 )
 
+type lockMode int
+
+const (
+	lockExclusive lockMode = iota
+	lockShared
+)
+
+// errLockUnsupported is returned by the platform lock primitive when the
+// filesystem holding the lock file has no advisory locking (some network and
+// FUSE mounts). Locking then falls back to O_EXCL lock files.
+var errLockUnsupported = errors.New("advisory file locking not supported")
+
+// lockFile takes an advisory lock on file without blocking and reports
+// whether it was acquired. Tests swap it to exercise the fallback.
+var lockFile = platformLockFile
+
+// FileLock is held until Release. Advisory locks are dropped by the kernel
+// when the holder exits, so they are never considered stale; only locks taken
+// through the O_EXCL fallback expire after lockStaleAfter.
+//
+// Releases before advisory locking always used O_EXCL lock files. A live
+// holder of that kind is recognised by its PID and fresh timestamp in the
+// file and waited out. The reverse is not covered: an older binary removes
+// the lock file of a holder it thinks is stale after lockStaleAfter, so
+// every codex-switcher sharing a home must be upgraded together.
 type FileLock struct {
-	path string
+	path     string
+	file     *os.File
+	mode     lockMode
+	fallback bool
 }
 
+// acquireLock takes the exclusive lock used by every command that writes.
 func acquireLock(path string) (*FileLock, error) {
+	return acquireLockMode(path, lockExclusive)
+}
+
+// acquireSharedLock lets read-only commands run alongside each other while
+// still waiting out writers. The O_EXCL fallback has no shared mode and
+// treats it as exclusive. Readers never create the lock directory; until a
+// writer has, there is nothing to guard and a nil lock is returned.
+func acquireSharedLock(path string) (*FileLock, error) {
+	if _, err := os.Stat(filepath.Dir(path)); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return acquireLockMode(path, lockShared)
+}
+
+func acquireLockMode(path string, mode lockMode) (*FileLock, error) {
 	if err := ensureParentDir(path); err != nil {
 		return nil, err
 	}
 
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
 	deadline := time.Now().Add(lockWaitTimeout)
+	for {
+		ok, err := lockFile(file, mode)
+		if errors.Is(err, errLockUnsupported) {
+			_ = file.Close()
+			return acquireExclusiveLockFile(path, deadline)
+		}
+		if err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+		if ok {
+			// Read the holder details first: an older binary only removes
+			// the file after they were written, so a removal that races
+			// with this check still fails sameFile.
+			if !legacyLockHeld(path) && sameFile(file, path) {
+				if mode == lockExclusive {
+					// Holder details are informational only, for whoever inspects the file.
+					_ = file.Truncate(0)
+					_, _ = file.WriteAt([]byte(lockFileContent()), 0)
+				}
+				return &FileLock{path: path, file: file, mode: mode}, nil
+			}
+			// The file was replaced under us or an older binary holds it
+			// through O_EXCL; let go and look again at whatever is at path.
+			_ = platformUnlockFile(file)
+			_ = file.Close()
+			if file, err = os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0o600); err != nil {
+				return nil, err
+			}
+		}
+		if time.Now().After(deadline) {
+			_ = file.Close()
+			return nil, fmt.Errorf("timeout acquiring lock %s", path)
+		}
+		time.Sleep(lockRetryDelay)
+	}
+}
+
+func acquireExclusiveLockFile(path string, deadline time.Time) (*FileLock, error) {
 	for {
 		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
 		if err == nil {
-			_, _ = file.WriteString(fmt.Sprintf("%d\n%d\n", os.Getpid(), time.Now().Unix()))
+			_, _ = file.WriteString(lockFileContent())
 			_ = file.Close()
-			return &FileLock{path: path}, nil
+			return &FileLock{path: path, fallback: true}, nil
 		}
 
 		if !errors.Is(err, os.ErrExist) {
@@ -50,32 +138,125 @@ func acquireLock(path string) (*FileLock, error) {
 	}
 }
 
-func isStaleLock(path string) (bool, error) {
+func lockFileContent() string {
+	return fmt.Sprintf("%d\n%d\n", os.Getpid(), time.Now().Unix())
+}
+
+// readLockFileContent parses the PID and creation time written by
+// lockFileContent; ok is false when the file is empty or malformed.
+func readLockFileContent(path string) (pid int, created time.Time, ok bool, err error) {
 	bytes, err := os.ReadFile(path)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return false, nil
+			err = nil
 		}
-		return false, err
+		return 0, time.Time{}, false, err
 	}
 	parts := strings.Split(strings.TrimSpace(string(bytes)), "\n")
 	if len(parts) < 2 {
-		return true, nil
+		return 0, time.Time{}, false, nil
 	}
-	ts, err := strconv.ParseInt(parts[1], 10, 64)
+	pid, pidErr := strconv.Atoi(parts[0])
+	ts, tsErr := strconv.ParseInt(parts[1], 10, 64)
+	if pidErr != nil || tsErr != nil {
+		return 0, time.Time{}, false, nil
+	}
+	return pid, time.Unix(ts, 0), true, nil
+}
+
+func isStaleLock(path string) (bool, error) {
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	_, created, ok, err := readLockFileContent(path)
+	if err != nil {
+		return false, err
+	}
+	return !ok || time.Since(created) > lockStaleAfter, nil
+}
+
+// legacyLockHeld reports whether an advisory lock file we could lock is
+// nevertheless held by an older binary through O_EXCL. Exclusive holders
+// clear the file on release, so holder details left in it belong either to
+// such a binary or to a run that died, told apart by whether the PID lives.
+func legacyLockHeld(path string) bool {
+	pid, created, ok, err := readLockFileContent(path)
+	if err != nil || !ok || pid == os.Getpid() {
+		return false
+	}
+	return time.Since(created) <= lockStaleAfter && processAlive(pid)
+}
+
+func sameFile(file *os.File, path string) bool {
+	opened, err := file.Stat()
 	if err != nil {
-		return true, nil
+		return false
 	}
-	created := time.Unix(ts, 0)
-	return time.Since(created) > lockStaleAfter, nil
+	current, err := os.Stat(path)
+	return err == nil && os.SameFile(opened, current)
 }
 
+// probeLock reports whether another process currently holds the lock at path
+// and whether a leftover O_EXCL lock file is stale. An unheld advisory lock
+// file is normal and reported as neither, unless it still carries holder
+// details from an older binary: a live one holds it, a dead one left it
+// stale.
+func probeLock(path string) (held bool, stale bool, err error) {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	defer file.Close()
+
+	ok, err := lockFile(file, lockExclusive)
+	if errors.Is(err, errLockUnsupported) {
+		stale, err := isStaleLock(path)
+		return err == nil && !stale, stale, err
+	}
+	if err != nil {
+		return false, false, err
+	}
+	if ok {
+		_ = platformUnlockFile(file)
+		if legacyLockHeld(path) {
+			return true, false, nil
+		}
+		pid, created, hasHolder, err := readLockFileContent(path)
+		if err != nil || !hasHolder {
+			return false, false, err
+		}
+		return false, pid != os.Getpid() && (time.Since(created) > lockStaleAfter || !processAlive(pid)), nil
+	}
+	return true, false, nil
+}
+
+// Release drops the lock. Advisory lock files are left in place: removing
+// one would let a waiter that already opened it lock an orphaned inode while
+// a newcomer locks a fresh file at the same path.
 func (l *FileLock) Release() error {
 	if l == nil {
 		return nil
 	}
-	if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+	if l.fallback {
+		if err := os.Remove(l.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		return nil
+	}
+	if l.mode == lockExclusive {
+		// Clear the holder details so they are not taken for a live
+		// O_EXCL holder once the advisory lock is gone.
+		_ = l.file.Truncate(0)
+	}
+	unlockErr := platformUnlockFile(l.file)
+	if err := l.file.Close(); err != nil {
 		return err
 	}
-	return nil
+	return unlockErr
 }
@@ -0,0 +1,19 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package app
+
+import "os"
+
+func platformLockFile(file *os.File, mode lockMode) (bool, error) {
+	return false, errLockUnsupported
+}
+
+func platformUnlockFile(file *os.File) error {
+	return nil
+}
+
+// processAlive is only consulted for advisory lock files, which this
+// platform never has.
+func processAlive(pid int) bool {
+	return false
+}
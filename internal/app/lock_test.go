@@ -0,0 +1,149 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func useLockFallback(t *testing.T) {
+	t.Helper()
+	lockFile = func(*os.File, lockMode) (bool, error) { return false, errLockUnsupported }
+	t.Cleanup(func() { lockFile = platformLockFile })
+}
+
+func TestSharedLocksCoexistAndExcludeWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".rotater.lock")
+	first, err := acquireSharedLock(path)
+	if err != nil {
+		t.Fatalf("first shared lock: %v", err)
+	}
+	second, err := acquireSharedLock(path)
+	if err != nil {
+		t.Fatalf("second shared lock: %v", err)
+	}
+	if first.fallback {
+		t.Skip("advisory locks unavailable on this filesystem")
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer file.Close()
+	if ok, err := lockFile(file, lockExclusive); err != nil || ok {
+		t.Fatalf("expected writer excluded by readers, got %v %v", ok, err)
+	}
+	if held, stale, err := probeLock(path); err != nil || !held || stale {
+		t.Fatalf("expected lock reported held, got %v %v %v", held, stale, err)
+	}
+
+	_ = first.Release()
+	_ = second.Release()
+	writer, err := acquireLock(path)
+	if err != nil {
+		t.Fatalf("exclusive lock after readers left: %v", err)
+	}
+	_ = writer.Release()
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected lock file kept for the next holder, got %v", err)
+	}
+	if held, stale, err := probeLock(path); err != nil || held || stale {
+		t.Fatalf("expected released lock reported free, got %v %v %v", held, stale, err)
+	}
+}
+
+func TestLockFallbackReclaimsStaleLockFiles(t *testing.T) {
+	useLockFallback(t)
+	path := filepath.Join(t.TempDir(), ".rotater.lock")
+	if err := os.WriteFile(path, []byte("1\n1\n"), 0o600); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	if held, stale, err := probeLock(path); err != nil || held || !stale {
+		t.Fatalf("expected stale lock, got %v %v %v", held, stale, err)
+	}
+
+	lock, err := acquireSharedLock(path)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if held, _, err := probeLock(path); err != nil || !held {
+		t.Fatalf("expected fresh lock file reported held, got %v %v", held, err)
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected fallback lock file removed, got %v", err)
+	}
+}
+
+func TestLockWaitsForOlderBinaryHoldingLockFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".rotater.lock")
+	// An older binary holds the lock through O_EXCL: live PID, fresh timestamp.
+	legacy := fmt.Sprintf("%d\n%d\n", os.Getppid(), time.Now().Unix())
+	if err := os.WriteFile(path, []byte(legacy), 0o600); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	probe, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	ok, err := lockFile(probe, lockExclusive)
+	_ = probe.Close()
+	if err != nil || !ok {
+		t.Skip("advisory locks unavailable on this filesystem")
+	}
+	if held, stale, err := probeLock(path); err != nil || !held || stale {
+		t.Fatalf("expected older binary's lock reported held, got %v %v %v", held, stale, err)
+	}
+
+	released := make(chan time.Time, 1)
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		released <- time.Now()
+		_ = os.Remove(path)
+	}()
+	lock, err := acquireLock(path)
+	acquired := time.Now()
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	if at := <-released; acquired.Before(at) {
+		t.Fatalf("expected lock acquired only after the older binary released it")
+	}
+	if err := lock.Release(); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if content, err := os.ReadFile(path); err != nil || len(content) != 0 {
+		t.Fatalf("expected released lock file cleared, got %q %v", content, err)
+	}
+}
+
+func TestLockFileLeftByDeadHolderIsStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".rotater.lock")
+	if err := os.WriteFile(path, []byte(fmt.Sprintf("%d\n%d\n", deadPID(t), time.Now().Unix())), 0o600); err != nil {
+		t.Fatalf("write lock: %v", err)
+	}
+	if held, stale, err := probeLock(path); err != nil || held || !stale {
+		t.Fatalf("expected dead holder's lock reported stale, got %v %v %v", held, stale, err)
+	}
+	lock, err := acquireLock(path)
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	_ = lock.Release()
+}
+
+// deadPID returns the PID of a process that has already exited.
+func deadPID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("run child: %v", err)
+	}
+	return cmd.Process.Pid
+}
@@ -0,0 +1,207 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAuthorizeURL      = "https://auth.openai.com/oauth/authorize"
+	defaultLoginCallbackAddr = "127.0.0.1:1455"
+	defaultLoginTimeout      = 5 * time.Minute
+	loginCallbackPath        = "/auth/callback"
+	loginScope               = "openid profile email offline_access"
+)
+
+type LoginOptions struct {
+	Force        bool
+	CallbackAddr string
+	Timeout      time.Duration
+	OnAuthURL    func(authURL string)
+}
+
+type LoginResult struct {
+	Tool      ToolName `json:"tool"`
+	Profile   string   `json:"profile"`
+	AccountID string   `json:"accountId,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	Expires   int64    `json:"expires,omitempty"`
+	Status    string   `json:"status"`
+}
+
+type loginCallback struct {
+	code string
+	err  error
+}
+
+func (s *Service) Login(profile string, tools []ToolName, opts LoginOptions) ([]LoginResult, error) {
+	if err := validateProfileName(profile); err != nil {
+		return nil, WrapExit(ExitUserError, err)
+	}
+
+	targets := make([]ToolPaths, 0, len(tools))
+	for _, tool := range tools {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		if !opts.Force {
+			if _, err := os.Stat(profilePath(paths, profile)); err == nil {
+				return nil, WrapExit(ExitUserError, fmt.Errorf("profile %q already exists for %s (use --force to overwrite)", profile, tool))
+			}
+		}
+		targets = append(targets, paths)
+	}
+
+	cred, err := runPKCELogin(opts)
+	if err != nil {
+		return nil, WrapExit(ExitAuthFailure, err)
+	}
+
+	results := make([]LoginResult, 0, len(targets))
+	for _, paths := range targets {
+		lock, err := acquireLock(paths.LockPath)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		if err := saveProfileAs(paths, profile, cred, opts.Force, historyOpLogin); err != nil {
+			_ = lock.Release()
+			return nil, WrapExit(ExitUserError, err)
+		}
+		if err := lock.Release(); err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		results = append(results, LoginResult{
+			Tool:      paths.Tool,
+			Profile:   profile,
+			AccountID: cred.AccountID,
+			Email:     cred.Email,
+			Expires:   cred.Expires,
+			Status:    "saved",
+		})
+	}
+	return results, nil
+}
+
+func runPKCELogin(opts LoginOptions) (Credential, error) {
+	verifier, err := randomURLToken(64)
+	if err != nil {
+		return Credential{}, err
+	}
+	state, err := randomURLToken(32)
+	if err != nil {
+		return Credential{}, err
+	}
+	challengeSum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(challengeSum[:])
+
+	listener, err := net.Listen("tcp", firstNonEmpty(opts.CallbackAddr, defaultLoginCallbackAddr))
+	if err != nil {
+		return Credential{}, fmt.Errorf("start login callback server: %w", err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	redirectURI := "http://localhost:" + strconv.Itoa(port) + loginCallbackPath
+
+	callbacks := make(chan loginCallback, 1)
+	mux := http.NewServeMux()
+	mux.HandleFunc(loginCallbackPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		result := loginCallback{code: query.Get("code")}
+		switch {
+		case query.Get("state") != state:
+			result.err = errors.New("login callback state mismatch")
+		case query.Get("error") != "":
+			result.err = fmt.Errorf("authorization failed: %s", firstNonEmpty(query.Get("error_description"), query.Get("error")))
+		case result.code == "":
+			result.err = errors.New("login callback missing authorization code")
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if result.err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = fmt.Fprintf(w, "<html><body><p>codex-switcher login failed: %s</p></body></html>", result.err)
+		} else {
+			_, _ = fmt.Fprint(w, "<html><body><p>codex-switcher login complete. You can close this window.</p></body></html>")
+		}
+		select {
+		case callbacks <- result:
+		default:
+		}
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	defer func() {
+		_ = server.Close()
+	}()
+
+	values := url.Values{}
+	values.Set("response_type", "code")
+	values.Set("client_id", oauthClientID)
+	values.Set("redirect_uri", redirectURI)
+	values.Set("scope", loginScope)
+	values.Set("code_challenge", challenge)
+	values.Set("code_challenge_method", "S256")
+	values.Set("id_token_add_organizations", "true")
+	values.Set("codex_cli_simplified_flow", "true")
+	values.Set("state", state)
+	authURL := oauthAuthorizeURL() + "?" + values.Encode()
+	if opts.OnAuthURL != nil {
+		opts.OnAuthURL(authURL)
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = defaultLoginTimeout
+	}
+	var code string
+	select {
+	case result := <-callbacks:
+		if result.err != nil {
+			return Credential{}, result.err
+		}
+		code = result.code
+	case <-time.After(timeout):
+		return Credential{}, fmt.Errorf("timed out after %s waiting for login callback", timeout)
+	}
+
+	return exchangeAuthorizationCode(&http.Client{Timeout: defaultHTTPTimeout}, code, redirectURI, verifier)
+}
+
+func exchangeAuthorizationCode(client *http.Client, code string, redirectURI string, verifier string) (Credential, error) {
+	values := url.Values{}
+	values.Set("grant_type", "authorization_code")
+	values.Set("code", code)
+	values.Set("redirect_uri", redirectURI)
+	values.Set("client_id", oauthClientID)
+	values.Set("code_verifier", verifier)
+
+	body, err := postTokenRequest(context.Background(), client, values, "code exchange")
+	if err != nil {
+		return Credential{}, err
+	}
+	return credentialFromTokenResponse(body, Credential{}, "code exchange")
+}
+
+func oauthAuthorizeURL() string {
+	return strings.TrimRight(firstNonEmpty(strings.TrimSpace(os.Getenv("CODEX_SWITCHER_AUTHORIZE_URL")), defaultAuthorizeURL), "?")
+}
+
+func randomURLToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
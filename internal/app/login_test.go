@@ -0,0 +1,157 @@
+package app
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoginRunsPKCEFlowAndSavesProfiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmp, "xdg"))
+
+	access := makeJWT(t, map[string]any{"chatgpt_account_id": "acct-login", "email": "login@example.com"})
+
+	var mu sync.Mutex
+	challenge := ""
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/oauth/token" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		mu.Lock()
+		expected := challenge
+		mu.Unlock()
+		if r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("code") != "code-123" || base64.RawURLEncoding.EncodeToString(sum[:]) != expected {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  access,
+			"refresh_token": "login-refresh",
+			"expires_in":    3600,
+		})
+	}))
+	defer server.Close()
+	t.Setenv("CODEX_SWITCHER_AUTHORIZE_URL", server.URL+"/oauth/authorize")
+	t.Setenv("CODEX_SWITCHER_TOKEN_URL", server.URL+"/oauth/token")
+
+	callbackErr := make(chan error, 1)
+	svc := NewService()
+	results, err := svc.Login("work", []ToolName{ToolCodex, ToolOpenCode}, LoginOptions{
+		CallbackAddr: "127.0.0.1:0",
+		Timeout:      10 * time.Second,
+		OnAuthURL: func(authURL string) {
+			parsed, err := url.Parse(authURL)
+			if err != nil {
+				callbackErr <- err
+				return
+			}
+			if !strings.HasPrefix(authURL, server.URL+"/oauth/authorize?") {
+				t.Errorf("unexpected authorize url %q", authURL)
+			}
+			query := parsed.Query()
+			if query.Get("code_challenge_method") != "S256" || query.Get("client_id") != oauthClientID {
+				t.Errorf("unexpected authorize query %v", query)
+			}
+			mu.Lock()
+			challenge = query.Get("code_challenge")
+			mu.Unlock()
+			go func() {
+				res, err := http.Get(query.Get("redirect_uri") + "?code=code-123&state=" + url.QueryEscape(query.Get("state")))
+				if err == nil {
+					_ = res.Body.Close()
+				}
+				callbackErr <- err
+			}()
+		},
+	})
+	if err != nil {
+		t.Fatalf("login failed: %v", err)
+	}
+	if err := <-callbackErr; err != nil {
+		t.Fatalf("callback request failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected two login results, got %+v", results)
+	}
+
+	for _, tool := range []ToolName{ToolCodex, ToolOpenCode} {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			t.Fatalf("resolve paths: %v", err)
+		}
+		profile, err := loadProfile(paths, "work")
+		if err != nil {
+			t.Fatalf("%s: load profile: %v", tool, err)
+		}
+		if profile.Access != access || profile.Refresh != "login-refresh" || profile.AccountID != "acct-login" || profile.Email != "login@example.com" {
+			t.Fatalf("%s: unexpected saved profile %+v", tool, profile)
+		}
+		if profile.Expires <= time.Now().UnixMilli() {
+			t.Fatalf("%s: expected future expiry, got %d", tool, profile.Expires)
+		}
+	}
+}
+
+func TestLoginRejectsStateMismatch(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	t.Setenv("CODEX_SWITCHER_TOKEN_URL", "http://127.0.0.1:1/unused")
+
+	svc := NewService()
+	_, err := svc.Login("work", []ToolName{ToolCodex}, LoginOptions{
+		CallbackAddr: "127.0.0.1:0",
+		Timeout:      10 * time.Second,
+		OnAuthURL: func(authURL string) {
+			parsed, _ := url.Parse(authURL)
+			go func() {
+				res, err := http.Get(parsed.Query().Get("redirect_uri") + "?code=code-123&state=forged")
+				if err == nil {
+					_ = res.Body.Close()
+				}
+			}()
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "state mismatch") {
+		t.Fatalf("expected state mismatch error, got %v", err)
+	}
+	if ExitCode(err) != ExitAuthFailure {
+		t.Fatalf("expected auth failure exit code, got %d", ExitCode(err))
+	}
+}
+
+func TestLoginRefusesExistingProfileWithoutForce(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+
+	paths, err := resolveToolPaths(ToolCodex)
+	if err != nil {
+		t.Fatalf("resolve paths: %v", err)
+	}
+	if err := saveProfile(paths, "work", Credential{Provider: "openai-codex", Access: "a", Refresh: "r"}, true); err != nil {
+		t.Fatalf("save profile: %v", err)
+	}
+
+	svc := NewService()
+	_, err = svc.Login("work", []ToolName{ToolCodex}, LoginOptions{CallbackAddr: "127.0.0.1:0"})
+	if err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("expected existing profile error, got %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultMetricsInterval = 5 * time.Minute
+
+type MetricsOptions struct {
+	Tools     []ToolName
+	Interval  time.Duration
+	OnResults func([]UsageResult)
+}
+
+// MetricsCollector serves Prometheus text-format metrics. Usage is polled at
+// most once per Interval no matter how often the endpoint is scraped.
+type MetricsCollector struct {
+	svc  *Service
+	opts MetricsOptions
+	now  func() time.Time
+
+	mu           sync.Mutex
+	lastPoll     time.Time
+	pollDuration time.Duration
+	pollErr      error
+	usage        []UsageResult
+	status       []StatusToolResult
+	expiries     []profileExpiry
+	refreshes    map[metricKey]float64
+	authErrors   map[metricKey]float64
+	usageErrors  map[metricKey]float64
+}
+
+type metricKey struct {
+	tool    ToolName
+	profile string
+}
+
+type profileExpiry struct {
+	key       metricKey
+	expiresAt int64
+}
+
+func (s *Service) NewMetricsCollector(opts MetricsOptions) *MetricsCollector {
+	if opts.Interval <= 0 {
+		opts.Interval = defaultMetricsInterval
+	}
+	return &MetricsCollector{
+		svc:         s,
+		opts:        opts,
+		now:         time.Now,
+		refreshes:   map[metricKey]float64{},
+		authErrors:  map[metricKey]float64{},
+		usageErrors: map[metricKey]float64{},
+	}
+}
+
+func (c *MetricsCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = w.Write(c.Render())
+}
+
+// Render polls if the cached data is older than the configured interval and
+// returns the current exposition.
+func (c *MetricsCollector) Render() []byte {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.lastPoll.IsZero() || now.Sub(c.lastPoll) >= c.opts.Interval {
+		c.poll(now)
+	}
+	return c.render(now)
+}
+
+func (c *MetricsCollector) poll(now time.Time) {
+	c.lastPoll = now
+	tools, err := resolveUsageTools(c.opts.Tools)
+	if err != nil {
+		c.pollErr = err
+		return
+	}
+	usage, err := c.svc.Usage(context.Background(), UsageOptions{Tools: tools, AllProfiles: true})
+	c.pollDuration = c.now().Sub(now)
+	c.pollErr = err
+	if err != nil {
+		return
+	}
+	c.usage = usage
+	for _, item := range usage {
+		key := metricKey{tool: item.Tool, profile: item.Profile}
+		if item.Refreshed && item.Status == "ok" {
+			c.refreshes[key]++
+		}
+		switch item.Status {
+		case "auth_error":
+			c.authErrors[key]++
+		case "ok", "shared":
+		default:
+			c.usageErrors[key]++
+		}
+	}
+	if c.opts.OnResults != nil {
+		c.opts.OnResults(usage)
+	}
+
+	if status, err := c.svc.Status(tools); err == nil {
+		c.status = status
+	}
+	c.expiries = c.expiries[:0]
+	for _, tool := range tools {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			continue
+		}
+		names, err := listProfiles(paths)
+		if err != nil {
+			continue
+		}
+		for _, name := range names {
+			cred, err := loadProfile(paths, name)
+			if err != nil || cred.ExpiresAt() == 0 {
+				continue
+			}
+			c.expiries = append(c.expiries, profileExpiry{key: metricKey{tool: tool, profile: name}, expiresAt: cred.ExpiresAt()})
+		}
+	}
+}
+
+type metricFamily struct {
+	name string
+	help string
+	kind string
+	rows []string
+}
+
+func (f *metricFamily) add(labels []string, value float64) {
+	f.rows = append(f.rows, fmt.Sprintf("%s%s %s", f.name, formatMetricLabels(labels), strconv.FormatFloat(value, 'g', -1, 64)))
+}
+
+func (c *MetricsCollector) render(now time.Time) []byte {
+	usagePercent := &metricFamily{name: "codex_switcher_usage_percent", help: "Used percent of each rate-limit window.", kind: "gauge"}
+	resetSeconds := &metricFamily{name: "codex_switcher_window_reset_seconds", help: "Seconds until each rate-limit window resets.", kind: "gauge"}
+	credits := &metricFamily{name: "codex_switcher_credits_balance", help: "Remaining credits balance reported for the profile.", kind: "gauge"}
+	usageUp := &metricFamily{name: "codex_switcher_usage_up", help: "Whether the last usage query for the profile succeeded.", kind: "gauge"}
+	expiry := &metricFamily{name: "codex_switcher_token_expiry_seconds", help: "Seconds until the saved access token expires (negative when expired).", kind: "gauge"}
+	active := &metricFamily{name: "codex_switcher_profile_active", help: "Whether the profile is the tool's verified active profile.", kind: "gauge"}
+	refreshes := &metricFamily{name: "codex_switcher_token_refreshes_total", help: "Token refreshes performed while polling usage.", kind: "counter"}
+	authErrors := &metricFamily{name: "codex_switcher_auth_errors_total", help: "Usage polls that failed authentication even after a refresh attempt.", kind: "counter"}
+	usageErrors := &metricFamily{name: "codex_switcher_usage_errors_total", help: "Usage polls that failed for reasons other than authentication.", kind: "counter"}
+	lastPoll := &metricFamily{name: "codex_switcher_last_poll_timestamp_seconds", help: "Unix time of the last usage poll.", kind: "gauge"}
+	pollDuration := &metricFamily{name: "codex_switcher_poll_duration_seconds", help: "Duration of the last usage poll.", kind: "gauge"}
+	pollUp := &metricFamily{name: "codex_switcher_poll_up", help: "Whether the last usage poll completed without a fatal error.", kind: "gauge"}
+
+	for _, item := range c.usage {
+		labels := []string{"tool", string(item.Tool), "profile", item.Profile}
+		up := 0.0
+		if item.HasUsage() {
+			up = 1
+		}
+		usageUp.add(labels, up)
+		if !item.HasUsage() {
+			continue
+		}
+		for _, window := range item.Windows {
+			windowLabels := append(append([]string{}, labels...), "window", window.Label)
+			usagePercent.add(windowLabels, window.UsedPercent)
+			if window.ResetAt > 0 {
+				resetSeconds.add(windowLabels, float64(window.ResetAt-now.UnixMilli())/1000)
+			}
+		}
+		if item.CreditsBalance != nil {
+			credits.add(labels, *item.CreditsBalance)
+		}
+	}
+	for _, item := range c.expiries {
+		expiry.add([]string{"tool", string(item.key.tool), "profile", item.key.profile}, float64(item.expiresAt-now.UnixMilli())/1000)
+	}
+	for _, item := range c.status {
+		for _, name := range item.Profiles {
+			value := 0.0
+			if name == item.ActiveProfile {
+				value = 1
+			}
+			active.add([]string{"tool", string(item.Tool), "profile", name}, value)
+		}
+	}
+	addCounterRows(refreshes, c.refreshes)
+	addCounterRows(authErrors, c.authErrors)
+	addCounterRows(usageErrors, c.usageErrors)
+	lastPoll.add(nil, float64(c.lastPoll.UnixMilli())/1000)
+	pollDuration.add(nil, c.pollDuration.Seconds())
+	up := 1.0
+	if c.pollErr != nil {
+		up = 0
+	}
+	pollUp.add(nil, up)
+
+	var buf bytes.Buffer
+	for _, family := range []*metricFamily{usagePercent, resetSeconds, credits, usageUp, expiry, active, refreshes, authErrors, usageErrors, lastPoll, pollDuration, pollUp} {
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", family.name, family.help, family.name, family.kind)
+		for _, row := range family.rows {
+			buf.WriteString(row)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+func addCounterRows(family *metricFamily, values map[metricKey]float64) {
+	keys := make([]metricKey, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].tool != keys[j].tool {
+			return keys[i].tool < keys[j].tool
+		}
+		return keys[i].profile < keys[j].profile
+	})
+	for _, key := range keys {
+		family.add([]string{"tool", string(key.tool), "profile", key.profile}, values[key])
+	}
+}
+
+func formatMetricLabels(pairs []string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], escapeMetricLabel(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeMetricLabel(value string) string {
+	return metricLabelEscaper.Replace(value)
+}
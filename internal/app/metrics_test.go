@@ -0,0 +1,69 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetricsCollectorCachesPollsAndRendersGauges(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = w.Write([]byte(`{"plan_type":"plus","credits":{"balance":12.5},"rate_limit":{"primary_window":{"limit_window_seconds":18000,"used_percent":42,"reset_at":4102444800}}}`))
+	}))
+	defer server.Close()
+	t.Setenv("CODEX_SWITCHER_USAGE_URL", server.URL)
+
+	paths := mustToolPaths(t, ToolCodex)
+	expires := time.Now().Add(time.Hour).UnixMilli()
+	if err := saveProfile(paths, "work", Credential{Provider: "openai-codex", Access: "a", Refresh: "r", AccountID: "acct", Expires: expires}, true); err != nil {
+		t.Fatalf("save profile: %v", err)
+	}
+
+	now := time.Now()
+	collector := NewService().NewMetricsCollector(MetricsOptions{Tools: []ToolName{ToolCodex}, Interval: time.Minute})
+	collector.now = func() time.Time { return now }
+
+	first := string(collector.Render())
+	second := string(collector.Render())
+	if hits.Load() != 1 {
+		t.Fatalf("expected cached second scrape, got %d usage calls", hits.Load())
+	}
+	if first != second {
+		t.Fatalf("expected identical cached output")
+	}
+	for _, want := range []string{
+		`codex_switcher_usage_percent{tool="codex",profile="work",window="5h"} 42`,
+		`codex_switcher_credits_balance{tool="codex",profile="work"} 12.5`,
+		`codex_switcher_usage_up{tool="codex",profile="work"} 1`,
+		`# TYPE codex_switcher_token_refreshes_total counter`,
+		`codex_switcher_token_expiry_seconds{tool="codex",profile="work"} `,
+		`codex_switcher_poll_up 1`,
+	} {
+		if !strings.Contains(first, want) {
+			t.Fatalf("expected %q in metrics output:\n%s", want, first)
+		}
+	}
+
+	now = now.Add(2 * time.Minute)
+	collector.Render()
+	if hits.Load() != 2 {
+		t.Fatalf("expected a new poll after the interval, got %d usage calls", hits.Load())
+	}
+}
+
+func TestFormatMetricLabelsEscapesValues(t *testing.T) {
+	got := formatMetricLabels([]string{"profile", "a\"b\\c\nd"})
+	if want := `{profile="a\"b\\c\nd"}`; got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+}
@@ -1,62 +1,61 @@
 package app
 
 import (
-	"errors"
 	"os"
 	"path/filepath"
 	"strings"
 )
 
 func resolveToolPaths(tool ToolName) (ToolPaths, error) {
+	reg, err := lookupTool(tool)
+	if err != nil {
+		return ToolPaths{}, err
+	}
 	home, err := os.UserHomeDir()
 	if err != nil {
 		return ToolPaths{}, err
 	}
+	activePath, err := reg.activePath(home)
+	if err != nil {
+		return ToolPaths{}, err
+	}
+	return toolPathsForRoot(tool, filepath.Dir(activePath), filepath.Base(activePath)), nil
+}
 
-	switch tool {
-	case ToolCodex:
-		root := resolvePathWithHome(firstNonEmpty(os.Getenv("CODEX_HOME"), filepath.Join(home, ".codex")), home)
-		return ToolPaths{
-			Tool:       tool,
-			RootDir:    root,
-			ActivePath: filepath.Join(root, "auth.json"),
-			ProfileDir: filepath.Join(root, "profiles"),
-			StatePath:  filepath.Join(root, "profiles", ".rotater-state.json"),
-			LockPath:   filepath.Join(root, "profiles", ".rotater.lock"),
-		}, nil
-	case ToolOpenCode:
-		xdgData := firstNonEmpty(os.Getenv("XDG_DATA_HOME"), filepath.Join(home, ".local", "share"))
-		root := filepath.Join(resolvePathWithHome(xdgData, home), "opencode")
-		return ToolPaths{
-			Tool:       tool,
-			RootDir:    root,
-			ActivePath: filepath.Join(root, "auth.json"),
-			ProfileDir: filepath.Join(root, "profiles"),
-			StatePath:  filepath.Join(root, "profiles", ".rotater-state.json"),
-			LockPath:   filepath.Join(root, "profiles", ".rotater.lock"),
-		}, nil
-	case ToolOpenClaw:
-		openClawHome := resolveOpenClawHome(home)
-		openClawStateDir := resolveOpenClawStateDir(openClawHome)
-		agentDir := firstNonEmpty(
-			strings.TrimSpace(os.Getenv("OPENCLAW_AGENT_DIR")),
-			strings.TrimSpace(os.Getenv("PI_CODING_AGENT_DIR")),
-			filepath.Join(openClawStateDir, "agents", "main", "agent"),
-		)
-		root := resolvePathWithHome(agentDir, openClawHome)
-		return ToolPaths{
-			Tool:       tool,
-			RootDir:    root,
-			ActivePath: filepath.Join(root, "auth-profiles.json"),
-			ProfileDir: filepath.Join(root, "profiles"),
-			StatePath:  filepath.Join(root, "profiles", ".rotater-state.json"),
-			LockPath:   filepath.Join(root, "profiles", ".rotater.lock"),
-		}, nil
-	default:
-		return ToolPaths{}, errors.New("unsupported tool")
+// toolPathsForRoot lays out a tool's files under an already-resolved root
+// directory.
+func toolPathsForRoot(tool ToolName, root string, activeName string) ToolPaths {
+	return ToolPaths{
+		Tool:       tool,
+		RootDir:    root,
+		ActivePath: filepath.Join(root, activeName),
+		ProfileDir: filepath.Join(root, "profiles"),
+		StatePath:  filepath.Join(root, "profiles", ".rotater-state.json"),
+		LockPath:   filepath.Join(root, "profiles", ".rotater.lock"),
 	}
 }
 
+func codexActivePath(home string) (string, error) {
+	root := resolvePathWithHome(firstNonEmpty(os.Getenv("CODEX_HOME"), filepath.Join(home, ".codex")), home)
+	return filepath.Join(root, "auth.json"), nil
+}
+
+func openCodeActivePath(home string) (string, error) {
+	xdgData := firstNonEmpty(os.Getenv("XDG_DATA_HOME"), filepath.Join(home, ".local", "share"))
+	return filepath.Join(resolvePathWithHome(xdgData, home), "opencode", "auth.json"), nil
+}
+
+func openClawActivePath(home string) (string, error) {
+	openClawHome := resolveOpenClawHome(home)
+	openClawStateDir := resolveOpenClawStateDir(openClawHome)
+	agentDir := firstNonEmpty(
+		strings.TrimSpace(os.Getenv("OPENCLAW_AGENT_DIR")),
+		strings.TrimSpace(os.Getenv("PI_CODING_AGENT_DIR")),
+		filepath.Join(openClawStateDir, "agents", "main", "agent"),
+	)
+	return filepath.Join(resolvePathWithHome(agentDir, openClawHome), "auth-profiles.json"), nil
+}
+
 func resolveOpenClawHome(fallbackHome string) string {
 	return resolvePathWithHome(
 		firstNonEmpty(
@@ -0,0 +1,496 @@
+package app
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	encryptedProfileFormat = "codex-switcher/encrypted-profile"
+	encryptionMarkerName   = ".encryption.json"
+	encryptionCipher       = "xchacha20poly1305"
+	encryptionKDF          = "scrypt"
+	scryptN                = 1 << 15
+	scryptR                = 8
+	scryptP                = 1
+	encryptionCheckText    = "codex-switcher"
+)
+
+var errNoEncryptionKey = errors.New("profile store is encrypted; set CODEX_SWITCHER_PASSPHRASE or CODEX_SWITCHER_KEY_FILE, or run interactively")
+
+type KeySource interface {
+	Secret(confirmNew bool) ([]byte, error)
+}
+
+type EnvKeySource struct {
+	Var string
+}
+
+func (k EnvKeySource) Secret(bool) ([]byte, error) {
+	value := os.Getenv(k.Var)
+	if value == "" {
+		return nil, nil
+	}
+	return []byte(value), nil
+}
+
+type KeyFileSource struct {
+	PathVar string
+}
+
+func (k KeyFileSource) Secret(bool) ([]byte, error) {
+	path := strings.TrimSpace(os.Getenv(k.PathVar))
+	if path == "" {
+		return nil, nil
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read key file: %w", err)
+	}
+	content = bytes.TrimSpace(content)
+	if len(content) == 0 {
+		return nil, fmt.Errorf("key file %s is empty", path)
+	}
+	return content, nil
+}
+
+type PromptKeySource struct {
+	Prompt func(confirmNew bool) ([]byte, error)
+
+	mu     sync.Mutex
+	cached []byte
+}
+
+func (k *PromptKeySource) Secret(confirmNew bool) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.cached != nil {
+		return k.cached, nil
+	}
+	if k.Prompt == nil {
+		return nil, nil
+	}
+	secret, err := k.Prompt(confirmNew)
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) > 0 {
+		k.cached = secret
+	}
+	return secret, nil
+}
+
+var (
+	keySourcesMu sync.Mutex
+	keySources   = []KeySource{
+		KeyFileSource{PathVar: "CODEX_SWITCHER_KEY_FILE"},
+		EnvKeySource{Var: "CODEX_SWITCHER_PASSPHRASE"},
+	}
+	interactiveKeySource KeySource
+	derivedKeys          = map[string][]byte{}
+)
+
+// SetInteractiveKeySource installs the fallback consulted after the key file
+// and environment variable sources, typically a terminal passphrase prompt.
+func SetInteractiveKeySource(source KeySource) {
+	keySourcesMu.Lock()
+	defer keySourcesMu.Unlock()
+	interactiveKeySource = source
+}
+
+func resolveEncryptionSecret(confirmNew bool) ([]byte, error) {
+	keySourcesMu.Lock()
+	sources := append([]KeySource{}, keySources...)
+	if interactiveKeySource != nil {
+		sources = append(sources, interactiveKeySource)
+	}
+	keySourcesMu.Unlock()
+	for _, source := range sources {
+		secret, err := source.Secret(confirmNew)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) > 0 {
+			return secret, nil
+		}
+	}
+	return nil, errNoEncryptionKey
+}
+
+type encryptionParams struct {
+	KDF  string `json:"kdf"`
+	Salt string `json:"salt"`
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+}
+
+type encryptedEnvelope struct {
+	Format     string           `json:"format"`
+	Version    int              `json:"version"`
+	Cipher     string           `json:"cipher"`
+	Params     encryptionParams `json:"params"`
+	Nonce      string           `json:"nonce"`
+	Ciphertext string           `json:"ciphertext"`
+}
+
+type encryptionMarker struct {
+	Version int               `json:"version"`
+	Params  encryptionParams  `json:"params"`
+	Check   encryptedEnvelope `json:"check"`
+}
+
+func deriveEncryptionKey(params encryptionParams, confirmNew bool) ([]byte, error) {
+	if params.KDF != encryptionKDF {
+		return nil, fmt.Errorf("unsupported key derivation %q", params.KDF)
+	}
+	secret, err := resolveEncryptionSecret(confirmNew)
+	if err != nil {
+		return nil, err
+	}
+	return deriveKeyFromSecret(secret, params)
+}
+
+func deriveKeyFromSecret(secret []byte, params encryptionParams) ([]byte, error) {
+	if params.KDF != encryptionKDF {
+		return nil, fmt.Errorf("unsupported key derivation %q", params.KDF)
+	}
+	salt, err := base64.StdEncoding.DecodeString(params.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption salt: %w", err)
+	}
+	secretSum := sha256.Sum256(secret)
+	cacheKey := hex.EncodeToString(secretSum[:]) + "\x00" + params.Salt + fmt.Sprintf("\x00%d/%d/%d", params.N, params.R, params.P)
+
+	keySourcesMu.Lock()
+	key, ok := derivedKeys[cacheKey]
+	keySourcesMu.Unlock()
+	if ok {
+		return key, nil
+	}
+	key, err = scrypt.Key(secret, salt, params.N, params.R, params.P, chacha20poly1305.KeySize)
+	if err != nil {
+		return nil, err
+	}
+	keySourcesMu.Lock()
+	derivedKeys[cacheKey] = key
+	keySourcesMu.Unlock()
+	return key, nil
+}
+
+func sealEnvelope(key []byte, params encryptionParams, plaintext []byte) (encryptedEnvelope, error) {
+	return sealEnvelopeFormat(encryptedProfileFormat, key, params, plaintext)
+}
+
+// sealEnvelopeFormat seals plaintext under a format tag that is also bound
+// as associated data, so an envelope of one kind cannot pass for another.
+func sealEnvelopeFormat(format string, key []byte, params encryptionParams, plaintext []byte) (encryptedEnvelope, error) {
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return encryptedEnvelope{}, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return encryptedEnvelope{}, err
+	}
+	ciphertext := aead.Seal(nil, nonce, plaintext, []byte(format))
+	return encryptedEnvelope{
+		Format:     format,
+		Version:    1,
+		Cipher:     encryptionCipher,
+		Params:     params,
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	}, nil
+}
+
+func openEnvelope(key []byte, envelope encryptedEnvelope) ([]byte, error) {
+	return openEnvelopeFormat(encryptedProfileFormat, key, envelope)
+}
+
+func openEnvelopeFormat(format string, key []byte, envelope encryptedEnvelope) ([]byte, error) {
+	if envelope.Cipher != encryptionCipher {
+		return nil, fmt.Errorf("unsupported cipher %q", envelope.Cipher)
+	}
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := base64.StdEncoding.DecodeString(envelope.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(envelope.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(format))
+	if err != nil {
+		return nil, errors.New("decryption failed (wrong passphrase or corrupted file)")
+	}
+	return plaintext, nil
+}
+
+func parseEncryptedEnvelope(content []byte) (encryptedEnvelope, bool) {
+	if !bytes.Contains(content, []byte(encryptedProfileFormat)) {
+		return encryptedEnvelope{}, false
+	}
+	var envelope encryptedEnvelope
+	if err := json.Unmarshal(content, &envelope); err != nil || envelope.Format != encryptedProfileFormat {
+		return encryptedEnvelope{}, false
+	}
+	return envelope, true
+}
+
+func decryptProfileContent(content []byte) ([]byte, bool, error) {
+	envelope, ok := parseEncryptedEnvelope(content)
+	if !ok {
+		return content, false, nil
+	}
+	key, err := deriveEncryptionKey(envelope.Params, false)
+	if err != nil {
+		return nil, true, err
+	}
+	plaintext, err := openEnvelope(key, envelope)
+	if err != nil {
+		return nil, true, err
+	}
+	return plaintext, true, nil
+}
+
+func loadEncryptionMarker(dir string) (encryptionMarker, bool, error) {
+	var marker encryptionMarker
+	if err := readJSONFile(filepath.Join(dir, encryptionMarkerName), &marker); err != nil {
+		if os.IsNotExist(err) {
+			return encryptionMarker{}, false, nil
+		}
+		return encryptionMarker{}, false, err
+	}
+	return marker, true, nil
+}
+
+func storeEncryptionKey(marker encryptionMarker, confirmNew bool) ([]byte, error) {
+	key, err := deriveEncryptionKey(marker.Params, confirmNew)
+	if err != nil {
+		return nil, err
+	}
+	check, err := openEnvelope(key, marker.Check)
+	if err != nil || string(check) != encryptionCheckText {
+		return nil, errors.New("passphrase does not match the encrypted profile store")
+	}
+	return key, nil
+}
+
+func newEncryptionParams() (encryptionParams, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return encryptionParams{}, err
+	}
+	return encryptionParams{KDF: encryptionKDF, Salt: base64.StdEncoding.EncodeToString(salt), N: scryptN, R: scryptR, P: scryptP}, nil
+}
+
+func newEncryptionMarker() (encryptionMarker, error) {
+	params, err := newEncryptionParams()
+	if err != nil {
+		return encryptionMarker{}, err
+	}
+	key, err := deriveEncryptionKey(params, true)
+	if err != nil {
+		return encryptionMarker{}, err
+	}
+	check, err := sealEnvelope(key, params, []byte(encryptionCheckText))
+	if err != nil {
+		return encryptionMarker{}, err
+	}
+	return encryptionMarker{Version: 1, Params: params, Check: check}, nil
+}
+
+// inheritEncryptionMarker keeps a newly created store (the vault) encrypted
+// when any of the stores it is populated from already is.
+func inheritEncryptionMarker(dir string, sources []ToolPaths) error {
+	if _, ok, err := loadEncryptionMarker(dir); err != nil || ok {
+		return err
+	}
+	for _, paths := range sources {
+		marker, ok, err := loadEncryptionMarker(paths.ProfileDir)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return writeJSONAtomic(filepath.Join(dir, encryptionMarkerName), marker)
+		}
+	}
+	return nil
+}
+
+func encodeProfileFile(dir string, p ProfileFile) ([]byte, error) {
+	plaintext, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	marker, encrypted, err := loadEncryptionMarker(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !encrypted {
+		return append(plaintext, '\n'), nil
+	}
+	key, err := storeEncryptionKey(marker, false)
+	if err != nil {
+		return nil, err
+	}
+	envelope, err := sealEnvelope(key, marker.Params, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	content, err := json.MarshalIndent(envelope, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(content, '\n'), nil
+}
+
+func writeProfileFile(path string, p ProfileFile) error {
+	if err := ensureParentDir(path); err != nil {
+		return err
+	}
+	content, err := encodeProfileFile(filepath.Dir(path), p)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, content, 0o600)
+}
+
+type ProfileEncryptionResult struct {
+	Store    string `json:"store"`
+	Dir      string `json:"dir"`
+	Profiles int    `json:"profiles"`
+	Status   string `json:"status"`
+}
+
+func profileStoreDirs(tools []ToolName) ([]ToolPaths, []string, error) {
+	pathsList := make([]ToolPaths, 0, len(tools))
+	stores := make([]string, 0, len(tools)+1)
+	for _, tool := range tools {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return nil, nil, err
+		}
+		pathsList = append(pathsList, paths)
+		stores = append(stores, string(tool))
+	}
+	if vaultDir, ok := activeVaultDir(); ok {
+		pathsList = append(pathsList, ToolPaths{Tool: "vault", ProfileDir: vaultDir})
+		stores = append(stores, "vault")
+	}
+	return pathsList, stores, nil
+}
+
+func (s *Service) EncryptProfiles(tools []ToolName) ([]ProfileEncryptionResult, error) {
+	return s.convertProfileStores(tools, true)
+}
+
+func (s *Service) DecryptProfiles(tools []ToolName) ([]ProfileEncryptionResult, error) {
+	return s.convertProfileStores(tools, false)
+}
+
+func (s *Service) convertProfileStores(tools []ToolName, encrypt bool) ([]ProfileEncryptionResult, error) {
+	stores, names, err := profileStoreDirs(tools)
+	if err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+
+	locks := make([]*FileLock, 0, len(stores))
+	defer func() {
+		for _, lock := range locks {
+			_ = lock.Release()
+		}
+	}()
+	for _, paths := range stores {
+		if paths.LockPath == "" {
+			continue
+		}
+		lock, err := acquireLock(paths.LockPath)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		locks = append(locks, lock)
+	}
+
+	results := make([]ProfileEncryptionResult, 0, len(stores))
+	var sharedMarker *encryptionMarker
+	for i, paths := range stores {
+		result := ProfileEncryptionResult{Store: names[i], Dir: paths.ProfileDir}
+		profiles, err := listProfiles(paths)
+		if err != nil {
+			return results, WrapExit(ExitIOFailure, err)
+		}
+		result.Profiles = len(profiles)
+
+		_, encrypted, err := loadEncryptionMarker(paths.ProfileDir)
+		if err != nil {
+			return results, WrapExit(ExitIOFailure, err)
+		}
+
+		decoded := make(map[string]ProfileFile, len(profiles))
+		for _, name := range profiles {
+			file, err := readProfileFile(profilePath(paths, name))
+			if err != nil {
+				return results, WrapExit(ExitAuthFailure, fmt.Errorf("%s/%s: %w", names[i], name, err))
+			}
+			decoded[name] = file
+		}
+
+		markerPath := filepath.Join(paths.ProfileDir, encryptionMarkerName)
+		if encrypt {
+			if encrypted {
+				result.Status = "already_encrypted"
+			} else {
+				if sharedMarker == nil {
+					marker, err := newEncryptionMarker()
+					if err != nil {
+						return results, WrapExit(ExitAuthFailure, err)
+					}
+					sharedMarker = &marker
+				}
+				if err := writeJSONAtomic(markerPath, sharedMarker); err != nil {
+					return results, WrapExit(ExitIOFailure, err)
+				}
+				result.Status = "encrypted"
+			}
+		} else {
+			if !encrypted {
+				result.Status = "not_encrypted"
+			} else {
+				if err := os.Remove(markerPath); err != nil && !os.IsNotExist(err) {
+					return results, WrapExit(ExitIOFailure, err)
+				}
+				result.Status = "decrypted"
+			}
+		}
+
+		for _, name := range profiles {
+			if err := writeProfileFile(profilePath(paths, name), decoded[name]); err != nil {
+				return results, WrapExit(ExitIOFailure, fmt.Errorf("%s/%s: %w", names[i], name, err))
+			}
+		}
+		if err := reencodeProfileHistory(paths); err != nil {
+			return results, WrapExit(ExitIOFailure, fmt.Errorf("%s history: %w", names[i], err))
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
@@ -0,0 +1,100 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptProfilesRoundTrip(t *testing.T) {
+	setupVaultTestHome(t)
+	t.Setenv("CODEX_SWITCHER_PASSPHRASE", "correct horse")
+	t.Setenv("CODEX_SWITCHER_KEY_FILE", "")
+	paths := mustToolPaths(t, ToolCodex)
+
+	if err := saveProfile(paths, "work", Credential{Provider: "openai-codex", Access: "work-access", Refresh: "work-refresh", AccountID: "acct-work"}, true); err != nil {
+		t.Fatalf("save work: %v", err)
+	}
+
+	svc := NewService()
+	results, err := svc.EncryptProfiles([]ToolName{ToolCodex})
+	if err != nil {
+		t.Fatalf("encrypt profiles: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != "encrypted" || results[0].Profiles != 1 {
+		t.Fatalf("unexpected encrypt results %+v", results)
+	}
+
+	raw, err := os.ReadFile(profilePath(paths, "work"))
+	if err != nil {
+		t.Fatalf("read encrypted file: %v", err)
+	}
+	if strings.Contains(string(raw), "work-refresh") || !strings.Contains(string(raw), encryptedProfileFormat) {
+		t.Fatalf("expected encrypted envelope on disk, got %s", raw)
+	}
+
+	if err := saveProfile(paths, "personal", Credential{Provider: "openai-codex", Access: "p-access", Refresh: "p-refresh", AccountID: "acct-p"}, true); err != nil {
+		t.Fatalf("save personal: %v", err)
+	}
+	raw, err = os.ReadFile(profilePath(paths, "personal"))
+	if err != nil {
+		t.Fatalf("read personal: %v", err)
+	}
+	if strings.Contains(string(raw), "p-refresh") {
+		t.Fatalf("expected new profile written encrypted, got %s", raw)
+	}
+	cred, err := loadProfile(paths, "personal")
+	if err != nil {
+		t.Fatalf("load personal: %v", err)
+	}
+	if cred.Refresh != "p-refresh" {
+		t.Fatalf("unexpected decrypted credential %+v", cred)
+	}
+
+	t.Setenv("CODEX_SWITCHER_PASSPHRASE", "wrong")
+	if _, err := loadProfile(paths, "work"); err == nil {
+		t.Fatalf("expected wrong passphrase to fail")
+	}
+
+	t.Setenv("CODEX_SWITCHER_PASSPHRASE", "")
+	keyFile := filepath.Join(t.TempDir(), "key")
+	if err := os.WriteFile(keyFile, []byte("correct horse\n"), 0o600); err != nil {
+		t.Fatalf("write key file: %v", err)
+	}
+	t.Setenv("CODEX_SWITCHER_KEY_FILE", keyFile)
+	if _, err := svc.DecryptProfiles([]ToolName{ToolCodex}); err != nil {
+		t.Fatalf("decrypt profiles: %v", err)
+	}
+	raw, err = os.ReadFile(profilePath(paths, "work"))
+	if err != nil {
+		t.Fatalf("read decrypted file: %v", err)
+	}
+	if !strings.Contains(string(raw), "work-refresh") {
+		t.Fatalf("expected plaintext profile after decrypt, got %s", raw)
+	}
+	if _, err := os.Stat(filepath.Join(paths.ProfileDir, encryptionMarkerName)); !os.IsNotExist(err) {
+		t.Fatalf("expected encryption marker removed, got %v", err)
+	}
+}
+
+func TestEncryptProfilesRequiresKeySource(t *testing.T) {
+	setupVaultTestHome(t)
+	t.Setenv("CODEX_SWITCHER_PASSPHRASE", "")
+	t.Setenv("CODEX_SWITCHER_KEY_FILE", "")
+	paths := mustToolPaths(t, ToolCodex)
+	if err := saveProfile(paths, "work", Credential{Provider: "openai-codex", Access: "a", Refresh: "r", AccountID: "acct"}, true); err != nil {
+		t.Fatalf("save work: %v", err)
+	}
+
+	if _, err := NewService().EncryptProfiles([]ToolName{ToolCodex}); err == nil {
+		t.Fatalf("expected missing key source error")
+	}
+	raw, err := os.ReadFile(profilePath(paths, "work"))
+	if err != nil {
+		t.Fatalf("read profile: %v", err)
+	}
+	if !strings.Contains(string(raw), `"refresh": "r"`) {
+		t.Fatalf("expected plaintext profile left untouched, got %s", raw)
+	}
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+type AnnotateOptions struct {
+	Label      *string
+	Note       *string
+	Owner      *string
+	Plan       *string
+	AddTags    []string
+	RemoveTags []string
+	ClearTags  bool
+}
+
+type AnnotateResult struct {
+	Tool     ToolName        `json:"tool"`
+	Profile  string          `json:"profile"`
+	Metadata ProfileMetadata `json:"metadata"`
+	Changed  bool            `json:"changed"`
+}
+
+// NormalizeTag lowercases a tag and rejects characters that cannot be used
+// in a tag filter.
+func NormalizeTag(raw string) (string, error) {
+	tag := strings.ToLower(strings.TrimSpace(raw))
+	if tag == "" || !profileNamePattern.MatchString(tag) {
+		return "", fmt.Errorf("invalid tag %q (allowed: letters, numbers, ., _, -)", raw)
+	}
+	return tag, nil
+}
+
+func (o AnnotateOptions) apply(meta ProfileMetadata) (ProfileMetadata, error) {
+	if o.Label != nil {
+		meta.Label = strings.TrimSpace(*o.Label)
+	}
+	if o.Note != nil {
+		meta.Note = strings.TrimSpace(*o.Note)
+	}
+	if o.Owner != nil {
+		meta.Owner = strings.TrimSpace(*o.Owner)
+	}
+	if o.Plan != nil {
+		meta.Plan = strings.TrimSpace(*o.Plan)
+	}
+	tags := map[string]struct{}{}
+	if !o.ClearTags {
+		for _, tag := range meta.Tags {
+			tags[tag] = struct{}{}
+		}
+	}
+	for _, raw := range o.AddTags {
+		tag, err := NormalizeTag(raw)
+		if err != nil {
+			return meta, err
+		}
+		tags[tag] = struct{}{}
+	}
+	for _, raw := range o.RemoveTags {
+		tag, err := NormalizeTag(raw)
+		if err != nil {
+			return meta, err
+		}
+		delete(tags, tag)
+	}
+	meta.Tags = nil
+	for tag := range tags {
+		meta.Tags = append(meta.Tags, tag)
+	}
+	sort.Strings(meta.Tags)
+	return meta, nil
+}
+
+// AnnotateProfile updates the metadata of a profile in every selected tool
+// that stores it. Token fields are left untouched.
+func (s *Service) AnnotateProfile(name string, tools []ToolName, opts AnnotateOptions) ([]AnnotateResult, error) {
+	if err := validateProfileName(name); err != nil {
+		return nil, WrapExit(ExitUserError, err)
+	}
+	vaultDir, vaultActive := activeVaultDir()
+	results := make([]AnnotateResult, 0, len(tools))
+	for _, tool := range tools {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		result, found, err := annotateToolProfile(paths, name, opts, vaultDir, vaultActive)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			results = append(results, result)
+		}
+	}
+	if len(results) == 0 {
+		return nil, WrapExit(ExitUserError, fmt.Errorf("profile %q not found for selected tools", name))
+	}
+	return results, nil
+}
+
+func annotateToolProfile(paths ToolPaths, name string, opts AnnotateOptions, vaultDir string, vaultActive bool) (AnnotateResult, bool, error) {
+	lock, err := acquireLock(paths.LockPath)
+	if err != nil {
+		return AnnotateResult{}, false, WrapExit(ExitIOFailure, err)
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+
+	current, err := readStoredProfile(paths, name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return AnnotateResult{}, false, nil
+		}
+		return AnnotateResult{}, false, WrapExit(ExitIOFailure, err)
+	}
+	meta, err := opts.apply(current.ProfileMetadata)
+	if err != nil {
+		return AnnotateResult{}, false, WrapExit(ExitUserError, err)
+	}
+	if meta.CreatedAt == 0 {
+		meta.CreatedAt = current.UpdatedAt
+	}
+	result := AnnotateResult{Tool: paths.Tool, Profile: name, Metadata: meta, Changed: !profileMetadataEqual(meta, current.ProfileMetadata)}
+	if !result.Changed && current.Version == profileFileVersion {
+		return result, true, nil
+	}
+
+	current.ProfileMetadata = meta
+	current.Version = profileFileVersion
+	if vaultActive {
+		if err := writeProfileFile(vaultProfilePath(vaultDir, name), current); err != nil {
+			return result, true, WrapExit(ExitIOFailure, err)
+		}
+	}
+	if err := writeProfileFile(profilePath(paths, name), current); err != nil {
+		return result, true, WrapExit(ExitIOFailure, err)
+	}
+	_ = recordProfileVersion(paths, name, current, historyOpAnnotate)
+	return result, true, nil
+}
+
+func profilesWithTag(paths ToolPaths, tag string) ([]string, error) {
+	names, err := listProfiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	matched := make([]string, 0, len(names))
+	for _, name := range names {
+		if existingProfileMetadata(paths, name).HasTag(tag) {
+			matched = append(matched, name)
+		}
+	}
+	return matched, nil
+}
@@ -0,0 +1,68 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAnnotateProfileUpgradesV1AndSurvivesTokenUpdates(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+
+	paths := mustToolPaths(t, ToolCodex)
+	legacy := `{"version":1,"provider":"openai-codex","access":"a1","refresh":"r1","accountId":"acct","updatedAt":1700000000000}`
+	if err := os.MkdirAll(paths.ProfileDir, 0o700); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(profilePath(paths, "client"), []byte(legacy), 0o600); err != nil {
+		t.Fatalf("write legacy profile: %v", err)
+	}
+	if cred, err := loadProfile(paths, "client"); err != nil || cred.Refresh != "r1" {
+		t.Fatalf("expected v1 profile to load, got %+v %v", cred, err)
+	}
+
+	label, note := "Client A", "billed monthly"
+	svc := NewService()
+	results, err := svc.AnnotateProfile("client", []ToolName{ToolCodex, ToolOpenCode}, AnnotateOptions{Label: &label, Note: &note, AddTags: []string{"Client-A", "billing", "billing"}})
+	if err != nil {
+		t.Fatalf("annotate: %v", err)
+	}
+	if len(results) != 1 || !results[0].Changed || strings.Join(results[0].Metadata.Tags, ",") != "billing,client-a" {
+		t.Fatalf("unexpected annotate results %+v", results)
+	}
+
+	if err := saveProfile(paths, "client", Credential{Provider: "openai-codex", Access: "a2", Refresh: "r2", AccountID: "acct"}, true); err != nil {
+		t.Fatalf("save refreshed tokens: %v", err)
+	}
+	stored, err := readProfileFile(profilePath(paths, "client"))
+	if err != nil {
+		t.Fatalf("read profile: %v", err)
+	}
+	if stored.Version != profileFileVersion || stored.Refresh != "r2" {
+		t.Fatalf("expected upgraded profile with new tokens, got %+v", stored)
+	}
+	if stored.Label != label || stored.Note != note || !stored.HasTag("client-a") || stored.CreatedAt != 1700000000000 {
+		t.Fatalf("expected metadata preserved across token update, got %+v", stored.ProfileMetadata)
+	}
+
+	names, err := profilesWithTag(paths, "billing")
+	if err != nil || len(names) != 1 || names[0] != "client" {
+		t.Fatalf("expected tag filter to match, got %v %v", names, err)
+	}
+	if _, err := svc.AnnotateProfile("client", []ToolName{ToolCodex}, AnnotateOptions{AddTags: []string{"bad tag"}}); ExitCode(err) != ExitUserError {
+		t.Fatalf("expected invalid tag rejected, got %v", err)
+	}
+}
+
+func TestReadProfileFileRejectsNewerFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "openai-codex.future.json")
+	if err := os.WriteFile(path, []byte(`{"version":99,"provider":"openai-codex","access":"a","refresh":"r"}`), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := readProfileFile(path); err == nil || !strings.Contains(err.Error(), "newer") {
+		t.Fatalf("expected newer format rejected, got %v", err)
+	}
+}
@@ -42,12 +42,27 @@ func listProfiles(paths ToolPaths) ([]string, error) {
 	return profiles, nil
 }
 
-func loadProfile(paths ToolPaths, name string) (Credential, error) {
+// readStoredProfile returns the authoritative copy of a tool's profile file:
+// the vault entry when one is in use. It never writes; drifted caches are
+// healed by reconcileProfileCaches under the exclusive lock.
+func readStoredProfile(paths ToolPaths, name string) (ProfileFile, error) {
 	if err := validateProfileName(name); err != nil {
-		return Credential{}, err
+		return ProfileFile{}, err
+	}
+	p, err := readProfileFile(profilePath(paths, name))
+	if err != nil {
+		return ProfileFile{}, err
+	}
+	if vaultDir, ok := activeVaultDir(); ok {
+		p, _, err = resolveVaultProfile(vaultDir, paths, name, p)
+		return p, err
 	}
-	var p ProfileFile
-	if err := readJSONFile(profilePath(paths, name), &p); err != nil {
+	return p, nil
+}
+
+func loadProfile(paths ToolPaths, name string) (Credential, error) {
+	p, err := readStoredProfile(paths, name)
+	if err != nil {
 		return Credential{}, err
 	}
 	if p.Provider != "openai-codex" {
@@ -56,20 +71,22 @@ func loadProfile(paths ToolPaths, name string) (Credential, error) {
 	if p.Access == "" || p.Refresh == "" {
 		return Credential{}, fmt.Errorf("profile %q is missing access/refresh token", name)
 	}
-	cred := Credential{
-		Provider:  p.Provider,
-		Access:    p.Access,
-		Refresh:   p.Refresh,
-		Expires:   p.Expires,
-		AccountID: p.AccountID,
-		IDToken:   p.IDToken,
-		Email:     p.Email,
-		UpdatedAt: p.UpdatedAt,
-	}
-	return normalizeCredentialIdentity(cred), nil
+	return normalizeCredentialIdentity(credentialFromProfileFile(p)), nil
 }
 
 func saveProfile(paths ToolPaths, name string, cred Credential, force bool) error {
+	return saveProfileAs(paths, name, cred, force, historyOpSave)
+}
+
+// saveProfileAs is saveProfile with the operation recorded in the profile's
+// version history. Archiving is best effort and never fails the save.
+func saveProfileAs(paths ToolPaths, name string, cred Credential, force bool, op string) error {
+	return saveProfileWithMetadata(paths, name, cred, force, op, nil)
+}
+
+// saveProfileWithMetadata stores meta alongside the tokens; a nil meta keeps
+// the metadata already stored under name.
+func saveProfileWithMetadata(paths ToolPaths, name string, cred Credential, force bool, op string, meta *ProfileMetadata) error {
 	if err := validateProfileName(name); err != nil {
 		return err
 	}
@@ -91,7 +108,7 @@ func saveProfile(paths ToolPaths, name string, cred Credential, force bool) erro
 	}
 
 	p := ProfileFile{
-		Version:   1,
+		Version:   profileFileVersion,
 		Provider:  "openai-codex",
 		Access:    cred.Access,
 		Refresh:   cred.Refresh,
@@ -101,7 +118,74 @@ func saveProfile(paths ToolPaths, name string, cred Credential, force bool) erro
 		Email:     cred.Email,
 		UpdatedAt: time.Now().UnixMilli(),
 	}
-	return writeJSONAtomic(path, p)
+	if meta != nil {
+		p.ProfileMetadata = *meta
+	} else {
+		p.ProfileMetadata = existingProfileMetadata(paths, name)
+	}
+	if p.CreatedAt == 0 {
+		p.CreatedAt = p.UpdatedAt
+	}
+	if vaultDir, ok := activeVaultDir(); ok {
+		lock, err := acquireVaultLock()
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = lock.Release()
+		}()
+		vaultPath := vaultProfilePath(vaultDir, name)
+		existing, err := readProfileFile(vaultPath)
+		if err == nil {
+			// The vault holds one account per name; replacing it is only safe
+			// while no other tool still caches the old account.
+			vaultAccount, incomingAccount := profileFileAccountID(existing), normalizeCredentialIdentity(cred).AccountID
+			if vaultAccount != "" && incomingAccount != "" && vaultAccount != incomingAccount && profileReferencedByOtherTool(name, paths.Tool) {
+				return &vaultAccountMismatchError{tool: paths.Tool, profile: name, cachedAccount: incomingAccount, vaultAccount: vaultAccount}
+			}
+		}
+		if err == nil && vaultEntryNewer(existing, cred) {
+			// Another tool already stored newer tokens for this account; a stale
+			// snapshot must not roll the vault back to a rotated refresh token.
+			p = existing
+		} else if err := writeProfileFile(vaultPath, p); err != nil {
+			return err
+		}
+	}
+	if err := writeProfileFile(path, p); err != nil {
+		return err
+	}
+	_ = recordProfileVersion(paths, name, p, op)
+	return nil
+}
+
+// existingProfileMetadata returns the metadata already stored under name so a
+// token update does not drop labels and notes.
+func existingProfileMetadata(paths ToolPaths, name string) ProfileMetadata {
+	if vaultDir, ok := activeVaultDir(); ok {
+		if existing, err := readProfileFile(vaultProfilePath(vaultDir, name)); err == nil {
+			return existing.ProfileMetadata
+		}
+	}
+	if existing, err := readProfileFile(profilePath(paths, name)); err == nil {
+		return existing.ProfileMetadata
+	}
+	return ProfileMetadata{}
+}
+
+func vaultEntryNewer(existing ProfileFile, incoming Credential) bool {
+	return credentialNewer(credentialFromProfileFile(existing), incoming)
+}
+
+// credentialNewer reports whether current holds other tokens for the same
+// account that expire after incoming's.
+func credentialNewer(current Credential, incoming Credential) bool {
+	current, incoming = normalizeCredentialIdentity(current), normalizeCredentialIdentity(incoming)
+	if current.AccountID == "" || current.AccountID != incoming.AccountID || current.Refresh == incoming.Refresh {
+		return false
+	}
+	currentExpires, incomingExpires := current.ExpiresAt(), incoming.ExpiresAt()
+	return currentExpires > 0 && incomingExpires > 0 && currentExpires > incomingExpires
 }
 
 func deleteProfile(paths ToolPaths, name string) error {
@@ -112,5 +196,5 @@ func deleteProfile(paths ToolPaths, name string) error {
 	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	return nil
+	return removeVaultProfileIfUnreferenced(name)
 }
@@ -0,0 +1,58 @@
+package app
+
+import (
+	"path/filepath"
+	"time"
+)
+
+type PromptSegment struct {
+	Tool        ToolName `json:"tool"`
+	Profile     string   `json:"profile"`
+	Window      string   `json:"window,omitempty"`
+	UsedPercent *float64 `json:"usedPercent,omitempty"`
+	SampledAt   int64    `json:"sampledAt,omitempty"`
+}
+
+// PromptSegments reports the active profile of each tool together with the
+// most constrained window of its last recorded usage sample. It reads only
+// the state files and the latest-sample cache and writes nothing, so it is
+// cheap and safe to run on every shell prompt; tools without a recorded
+// active profile are omitted.
+func (s *Service) PromptSegments(tools []ToolName, now time.Time) ([]PromptSegment, error) {
+	var latest map[string]UsageSample
+	if dataDir, err := resolveSwitcherDataDir(); err == nil {
+		latest, _ = readLatestUsage(filepath.Join(dataDir, usageLatestFileName))
+	}
+
+	segments := make([]PromptSegment, 0, len(tools))
+	for _, tool := range tools {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return nil, err
+		}
+		state, err := loadState(paths)
+		if err != nil {
+			return nil, err
+		}
+		name := state.ActiveProfile
+		if name == "" {
+			continue
+		}
+		segment := PromptSegment{Tool: tool, Profile: name}
+		if sample, ok := latest[latestUsageKey(tool, name)]; ok {
+			segment.SampledAt = sample.At
+			for _, window := range sample.Windows {
+				if window.ResetAt > 0 && window.ResetAt <= now.UnixMilli() {
+					continue
+				}
+				if segment.UsedPercent == nil || window.UsedPercent > *segment.UsedPercent {
+					used := window.UsedPercent
+					segment.UsedPercent = &used
+					segment.Window = window.Label
+				}
+			}
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
@@ -0,0 +1,94 @@
+package app
+
+import (
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPromptSegmentsUseLatestCachedSample(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmp, "xdg"))
+	t.Setenv("CODEX_SWITCHER_DATA_DIR", filepath.Join(tmp, "data"))
+
+	paths := mustToolPaths(t, ToolCodex)
+	if err := saveProfile(paths, "work", Credential{Provider: "openai-codex", Access: "work-access", Refresh: "work-refresh", AccountID: "acct-work"}, true); err != nil {
+		t.Fatalf("save profile: %v", err)
+	}
+	svc := NewService()
+	if _, err := svc.Switch("work", []ToolName{ToolCodex}, SwitchOptions{}); err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+
+	now := time.Now()
+	older := usageSampleResult("work", 90, now.Add(time.Hour).UnixMilli())
+	if err := svc.RecordUsage([]UsageResult{older}, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	latest := usageSampleResult("work", 42, now.Add(time.Hour).UnixMilli())
+	latest.Windows = append(latest.Windows, UsageWindow{Label: "weekly", UsedPercent: 99, ResetAt: now.Add(-time.Minute).UnixMilli()})
+	if err := svc.RecordUsage([]UsageResult{latest}, now); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	segments, err := svc.PromptSegments([]ToolName{ToolCodex, ToolOpenCode}, now)
+	if err != nil {
+		t.Fatalf("prompt: %v", err)
+	}
+	if len(segments) != 1 || segments[0].Profile != "work" {
+		t.Fatalf("expected only the codex segment, got %+v", segments)
+	}
+	if segments[0].UsedPercent == nil || *segments[0].UsedPercent != 42 || segments[0].Window != "5h" {
+		t.Fatalf("expected latest unexpired window at 42%%, got %+v", segments[0])
+	}
+}
+
+func TestPromptSegmentsWriteNothing(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmp, "xdg"))
+	t.Setenv("CODEX_SWITCHER_DATA_DIR", filepath.Join(tmp, "data"))
+
+	paths := mustToolPaths(t, ToolCodex)
+	if err := saveProfile(paths, "work", Credential{Provider: "openai-codex", Access: "work-access", Refresh: "work-refresh", AccountID: "acct-work"}, true); err != nil {
+		t.Fatalf("save profile: %v", err)
+	}
+	svc := NewService()
+	if _, err := svc.Switch("work", []ToolName{ToolCodex}, SwitchOptions{}); err != nil {
+		t.Fatalf("switch: %v", err)
+	}
+
+	snapshot := func() map[string]string {
+		files := map[string]string{}
+		_ = filepath.WalkDir(tmp, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			files[path] = info.ModTime().String() + "/" + info.Mode().String()
+			return nil
+		})
+		return files
+	}
+	before := snapshot()
+	segments, err := svc.PromptSegments([]ToolName{ToolCodex}, time.Now())
+	if err != nil || len(segments) != 1 || segments[0].Profile != "work" {
+		t.Fatalf("expected the work segment, got %+v %v", segments, err)
+	}
+	after := snapshot()
+	if len(after) != len(before) {
+		t.Fatalf("expected no files created, before %v after %v", before, after)
+	}
+	for path, stamp := range before {
+		if after[path] != stamp {
+			t.Fatalf("expected %s untouched", path)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+)
+
+const defaultRefreshWithin = 24 * time.Hour
+
+type RefreshOptions struct {
+	Tools    []ToolName
+	Within   time.Duration
+	Force    bool
+	OnResult func(RefreshResult)
+}
+
+type RefreshResult struct {
+	Tool          ToolName `json:"tool"`
+	Profile       string   `json:"profile"`
+	AccountID     string   `json:"accountId,omitempty"`
+	Active        bool     `json:"active,omitempty"`
+	Status        string   `json:"status"`
+	ExpiresBefore int64    `json:"expiresBefore,omitempty"`
+	ExpiresAfter  int64    `json:"expiresAfter,omitempty"`
+	Error         string   `json:"error,omitempty"`
+	At            string   `json:"at"`
+}
+
+type refreshCandidate struct {
+	profile string
+	cred    Credential
+	active  bool
+	// loadErr is why the profile could not be read; cred is empty then.
+	loadErr error
+}
+
+func (s *Service) RefreshProfiles(opts RefreshOptions) ([]RefreshResult, error) {
+	within := opts.Within
+	if within <= 0 {
+		within = defaultRefreshWithin
+	}
+	httpClient := &http.Client{Timeout: defaultHTTPTimeout}
+
+	results := make([]RefreshResult, 0)
+	emit := func(result RefreshResult) {
+		result.At = time.Now().UTC().Format(time.RFC3339)
+		results = append(results, result)
+		if opts.OnResult != nil {
+			opts.OnResult(result)
+		}
+	}
+
+	for _, tool := range opts.Tools {
+		adapter, err := adapterFor(tool)
+		if err != nil {
+			return results, WrapExit(ExitUserError, err)
+		}
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return results, WrapExit(ExitIOFailure, err)
+		}
+
+		candidates, err := collectRefreshCandidates(paths, adapter)
+		if err != nil {
+			return results, WrapExit(ExitIOFailure, err)
+		}
+
+		for _, candidate := range candidates {
+			result := RefreshResult{
+				Tool:          tool,
+				Profile:       candidate.profile,
+				AccountID:     candidate.cred.AccountID,
+				Active:        candidate.active,
+				ExpiresBefore: candidate.cred.ExpiresAt(),
+			}
+			if candidate.loadErr != nil {
+				result.Status = "error"
+				result.Error = candidate.loadErr.Error()
+				emit(result)
+				continue
+			}
+			if candidate.cred.Refresh == "" {
+				result.Status = "error"
+				result.Error = "profile has no refresh token"
+				emit(result)
+				continue
+			}
+			if !opts.Force {
+				expires := candidate.cred.ExpiresAt()
+				if expires <= 0 {
+					result.Status = "skipped"
+					result.Error = "token expiry unknown (use --force to refresh anyway)"
+					emit(result)
+					continue
+				}
+				if time.Now().Add(within).UnixMilli() < expires {
+					result.Status = "fresh"
+					emit(result)
+					continue
+				}
+			}
+
+			next, err := refreshCredential(context.Background(), httpClient, candidate.cred)
+			if err != nil {
+				result.Status = "error"
+				if isTokenRejected(err) {
+					result.Status = "auth_error"
+				}
+				result.Error = err.Error()
+				emit(result)
+				continue
+			}
+
+			stored, err := storeRefreshedProfile(paths, adapter, candidate, next)
+			if err != nil {
+				result.Status = "error"
+				result.Error = err.Error()
+				emit(result)
+				continue
+			}
+			if !stored {
+				result.Status = "skipped"
+				result.Error = "profile changed to newer tokens or another account while refreshing"
+				emit(result)
+				continue
+			}
+			result.Status = "refreshed"
+			result.AccountID = next.AccountID
+			result.ExpiresAfter = next.ExpiresAt()
+			emit(result)
+		}
+	}
+	return results, nil
+}
+
+func collectRefreshCandidates(paths ToolPaths, adapter Adapter) ([]refreshCandidate, error) {
+	lock, err := acquireLock(paths.LockPath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+
+	state, err := loadState(paths)
+	if err != nil {
+		return nil, err
+	}
+	profiles, err := listProfiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	activeCred, hasActive, activeErr := adapter.ReadActiveCredential(paths)
+	if activeErr != nil && !os.IsNotExist(activeErr) {
+		return nil, activeErr
+	}
+	activeName := ""
+	if hasActive {
+		activeName = verifiedStateActiveProfile(paths, state, activeCred)
+	}
+
+	candidates := make([]refreshCandidate, 0, len(profiles))
+	for _, name := range profiles {
+		cred, err := loadProfile(paths, name)
+		if err != nil {
+			candidates = append(candidates, refreshCandidate{profile: name, loadErr: err})
+			continue
+		}
+		candidate := refreshCandidate{profile: name, cred: cred}
+		if hasActive && activeCred.Expires <= 0 && credentialsLikelyMatch(activeCred, cred) {
+			activeCred.Expires = cred.Expires
+		}
+		if name == activeName {
+			candidate.active = true
+			candidate.cred = activeCred
+		} else if hasActive && name == state.ActiveProfile && activeCred.AccountID != "" && activeCred.AccountID == cred.AccountID {
+			// The tool rotated its own tokens since the last switch; its copy is the newest.
+			candidate.active = true
+			candidate.cred = activeCred
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+// refreshedCredentialApplies reports whether tokens refreshed from an older
+// copy may replace latest: the account must match and latest must not hold
+// tokens that expire later.
+func refreshedCredentialApplies(latest Credential, next Credential) bool {
+	latest, next = normalizeCredentialIdentity(latest), normalizeCredentialIdentity(next)
+	return next.AccountID != "" && latest.AccountID == next.AccountID && !credentialNewer(latest, next)
+}
+
+func storeRefreshedProfile(paths ToolPaths, adapter Adapter, candidate refreshCandidate, next Credential) (bool, error) {
+	lock, err := acquireLock(paths.LockPath)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+
+	current, err := loadProfile(paths, candidate.profile)
+	if err != nil {
+		return false, err
+	}
+	state, err := loadState(paths)
+	if err != nil {
+		return false, err
+	}
+	activeCred, hasActive, activeErr := adapter.ReadActiveCredential(paths)
+	if activeErr != nil && !os.IsNotExist(activeErr) {
+		return false, activeErr
+	}
+
+	// The refresh token sent to the server is spent, so the tokens it issued
+	// replace any copy that still holds it, or that has since moved to other
+	// tokens of the same account expiring no later.
+	stillActive := candidate.active && hasActive &&
+		(activeCred.Refresh == candidate.cred.Refresh || refreshedCredentialApplies(activeCred, next))
+	if !stillActive && current.Refresh != candidate.cred.Refresh && !refreshedCredentialApplies(current, next) {
+		return false, nil
+	}
+
+	if err := saveProfileAs(paths, candidate.profile, next, true, historyOpRefresh); err != nil {
+		return false, err
+	}
+
+	if !candidate.active && hasActive && verifiedStateActiveProfile(paths, state, activeCred) == candidate.profile {
+		stillActive = credentialsLikelyMatch(activeCred, candidate.cred) || credentialsLikelyMatch(activeCred, current)
+	}
+	if !stillActive {
+		return true, nil
+	}
+
+	if oa, ok := adapter.(*openClawAdapter); ok {
+		err = oa.WriteWithProfile(paths, candidate.profile, next)
+	} else {
+		err = adapter.WriteActiveCredential(paths, next)
+	}
+	if err != nil {
+		return true, err
+	}
+	if state.ActiveProfile == candidate.profile {
+		setActiveProfileTracking(&state, candidate.profile, next)
+		if err := saveState(paths, state); err != nil {
+			return true, err
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,215 @@
+package app
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newRefreshTokenServer(t *testing.T, rotations map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != "refresh_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		next, ok := rotations[r.PostForm.Get("refresh_token")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token":  next + "-access",
+			"refresh_token": next,
+			"expires_in":    7200,
+		})
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("CODEX_SWITCHER_TOKEN_URL", server.URL+"/oauth/token")
+	return server
+}
+
+func TestRefreshProfilesRefreshesNearExpiryAndPropagatesActive(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	newRefreshTokenServer(t, map[string]string{
+		"work-refresh":    "work-refresh-2",
+		"expired-refresh": "expired-refresh-2",
+	})
+
+	paths, err := resolveToolPaths(ToolCodex)
+	if err != nil {
+		t.Fatalf("resolve paths: %v", err)
+	}
+
+	soon := time.Now().Add(10 * time.Minute).UnixMilli()
+	later := time.Now().Add(72 * time.Hour).UnixMilli()
+	work := Credential{Provider: "openai-codex", Access: "work-access", Refresh: "work-refresh", Expires: soon, AccountID: "acct-work"}
+	if err := saveProfile(paths, "work", work, true); err != nil {
+		t.Fatalf("save work: %v", err)
+	}
+	if err := saveProfile(paths, "idle", Credential{Provider: "openai-codex", Access: "idle-access", Refresh: "idle-refresh", Expires: later, AccountID: "acct-idle"}, true); err != nil {
+		t.Fatalf("save idle: %v", err)
+	}
+	if err := saveProfile(paths, "expired", Credential{Provider: "openai-codex", Access: "expired-access", Refresh: "expired-refresh", Expires: time.Now().Add(-time.Hour).UnixMilli(), AccountID: "acct-expired"}, true); err != nil {
+		t.Fatalf("save expired: %v", err)
+	}
+	if err := (&codexAdapter{}).WriteActiveCredential(paths, work); err != nil {
+		t.Fatalf("write active: %v", err)
+	}
+	if err := saveState(paths, StateFile{Version: 1, ActiveProfile: "work", ActiveCredentialHash: credentialFingerprint(normalizeCredentialIdentity(Credential{Provider: "openai-codex", Access: work.Access, Refresh: work.Refresh, AccountID: work.AccountID}))}); err != nil {
+		t.Fatalf("save state: %v", err)
+	}
+
+	logged := 0
+	svc := NewService()
+	results, err := svc.RefreshProfiles(RefreshOptions{
+		Tools:    []ToolName{ToolCodex},
+		Within:   time.Hour,
+		OnResult: func(RefreshResult) { logged++ },
+	})
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if logged != len(results) || len(results) != 3 {
+		t.Fatalf("expected three logged results, got %d logged and %+v", logged, results)
+	}
+
+	byProfile := map[string]RefreshResult{}
+	for _, item := range results {
+		byProfile[item.Profile] = item
+	}
+	if byProfile["work"].Status != "refreshed" || !byProfile["work"].Active {
+		t.Fatalf("expected active work refreshed, got %+v", byProfile["work"])
+	}
+	if byProfile["expired"].Status != "refreshed" || byProfile["expired"].Active {
+		t.Fatalf("expected expired profile refreshed, got %+v", byProfile["expired"])
+	}
+	if byProfile["idle"].Status != "fresh" {
+		t.Fatalf("expected idle profile left alone, got %+v", byProfile["idle"])
+	}
+
+	saved, err := loadProfile(paths, "work")
+	if err != nil {
+		t.Fatalf("load work: %v", err)
+	}
+	if saved.Refresh != "work-refresh-2" {
+		t.Fatalf("expected rotated work refresh token, got %+v", saved)
+	}
+	activeTokens, err := readCodexTokens(paths.ActivePath)
+	if err != nil {
+		t.Fatalf("read active tokens: %v", err)
+	}
+	if activeTokens["refresh_token"] != "work-refresh-2" {
+		t.Fatalf("expected active auth updated, got %+v", activeTokens)
+	}
+	state, err := loadState(paths)
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	active, _, err := (&codexAdapter{}).ReadActiveCredential(paths)
+	if err != nil {
+		t.Fatalf("read active: %v", err)
+	}
+	if verifiedStateActiveProfile(paths, state, active) != "work" {
+		t.Fatalf("expected work to remain the verified active profile, got state %+v", state)
+	}
+	idle, err := loadProfile(paths, "idle")
+	if err != nil {
+		t.Fatalf("load idle: %v", err)
+	}
+	if idle.Refresh != "idle-refresh" {
+		t.Fatalf("expected idle profile untouched, got %+v", idle)
+	}
+}
+
+func TestRefreshProfilesReportsRejectedRefreshToken(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	newRefreshTokenServer(t, map[string]string{})
+
+	paths, err := resolveToolPaths(ToolCodex)
+	if err != nil {
+		t.Fatalf("resolve paths: %v", err)
+	}
+	if err := saveProfile(paths, "stale", Credential{Provider: "openai-codex", Access: "a", Refresh: "revoked", Expires: time.Now().UnixMilli()}, true); err != nil {
+		t.Fatalf("save profile: %v", err)
+	}
+
+	svc := NewService()
+	results, err := svc.RefreshProfiles(RefreshOptions{Tools: []ToolName{ToolCodex}})
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != "auth_error" {
+		t.Fatalf("expected auth_error result, got %+v", results)
+	}
+	saved, err := loadProfile(paths, "stale")
+	if err != nil {
+		t.Fatalf("load profile: %v", err)
+	}
+	if saved.Refresh != "revoked" {
+		t.Fatalf("expected profile untouched after failed refresh, got %+v", saved)
+	}
+}
+
+func TestRefreshProfilesReportsProfileLoadError(t *testing.T) {
+	setupVaultTestHome(t)
+	newRefreshTokenServer(t, map[string]string{})
+	paths := mustToolPaths(t, ToolCodex)
+	if err := saveProfile(paths, "broken", Credential{Provider: "openai-codex", Access: "a", Refresh: "r"}, true); err != nil {
+		t.Fatalf("save profile: %v", err)
+	}
+	if err := os.WriteFile(profilePath(paths, "broken"), []byte("{not json"), 0o600); err != nil {
+		t.Fatalf("corrupt profile: %v", err)
+	}
+
+	results, err := NewService().RefreshProfiles(RefreshOptions{Tools: []ToolName{ToolCodex}, Force: true})
+	if err != nil {
+		t.Fatalf("refresh failed: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != "error" || strings.Contains(results[0].Error, "no refresh token") {
+		t.Fatalf("expected the load error reported, got %+v", results)
+	}
+}
+
+func TestStoreRefreshedProfileKeepsTokensWhenProfileMovedOn(t *testing.T) {
+	setupVaultTestHome(t)
+	paths := mustToolPaths(t, ToolCodex)
+	adapter := mustAdapter(t, ToolCodex)
+	now := time.Now()
+	sent := Credential{Provider: "openai-codex", Access: "a1", Refresh: "r1", Expires: now.Add(time.Minute).UnixMilli(), AccountID: "acct-work"}
+	next := Credential{Provider: "openai-codex", Access: "a2", Refresh: "r2", Expires: now.Add(2 * time.Hour).UnixMilli(), AccountID: "acct-work"}
+	candidate := refreshCandidate{profile: "work", cred: sent}
+
+	// An older copy of the same account landed while the refresh ran.
+	if err := saveProfile(paths, "work", Credential{Provider: "openai-codex", Access: "a0", Refresh: "r0", Expires: now.Add(30 * time.Second).UnixMilli(), AccountID: "acct-work"}, true); err != nil {
+		t.Fatalf("save older copy: %v", err)
+	}
+	stored, err := storeRefreshedProfile(paths, adapter, candidate, next)
+	if err != nil || !stored {
+		t.Fatalf("expected refreshed tokens kept, got %v %v", stored, err)
+	}
+	if saved, _ := loadProfile(paths, "work"); saved.Refresh != "r2" {
+		t.Fatalf("expected the issued tokens saved, got %+v", saved)
+	}
+
+	// A newer copy of the same account wins.
+	newer := Credential{Provider: "openai-codex", Access: "a3", Refresh: "r3", Expires: now.Add(4 * time.Hour).UnixMilli(), AccountID: "acct-work"}
+	if err := saveProfile(paths, "work", newer, true); err != nil {
+		t.Fatalf("save newer copy: %v", err)
+	}
+	stored, err = storeRefreshedProfile(paths, adapter, candidate, next)
+	if err != nil || stored {
+		t.Fatalf("expected newer profile kept, got %v %v", stored, err)
+	}
+	if saved, _ := loadProfile(paths, "work"); saved.Refresh != "r3" {
+		t.Fatalf("expected the newer copy untouched, got %+v", saved)
+	}
+}
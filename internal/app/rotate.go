@@ -0,0 +1,233 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+type RotateOptions struct {
+	Tools     []ToolName
+	Threshold float64
+	DryRun    bool
+}
+
+type RotateCandidate struct {
+	Profile     string     `json:"profile"`
+	Tools       []ToolName `json:"tools"`
+	AccountID   string     `json:"accountId,omitempty"`
+	UsedPercent float64    `json:"usedPercent"`
+	ResetAt     int64      `json:"resetAt,omitempty"`
+	Status      string     `json:"status"`
+	Active      bool       `json:"active,omitempty"`
+	Eligible    bool       `json:"eligible"`
+	Rank        int        `json:"rank,omitempty"`
+	Reason      string     `json:"reason,omitempty"`
+}
+
+type RotateResult struct {
+	ActiveProfile string            `json:"activeProfile,omitempty"`
+	ActiveUsage   *float64          `json:"activeUsage,omitempty"`
+	Threshold     float64           `json:"threshold,omitempty"`
+	Selected      string            `json:"selected,omitempty"`
+	Action        string            `json:"action"`
+	Reason        string            `json:"reason"`
+	Candidates    []RotateCandidate `json:"candidates"`
+	Switch        []SwitchResult    `json:"switch,omitempty"`
+}
+
+// Rotate ranks every saved profile by primary-window usage (then earliest
+// reset) and switches the selected tools to the best one. Cancelling ctx
+// stops the usage queries and skips the switch.
+func (s *Service) Rotate(ctx context.Context, opts RotateOptions) (RotateResult, error) {
+	tools, err := resolveUsageTools(opts.Tools)
+	if err != nil {
+		return RotateResult{}, WrapExit(ExitUserError, err)
+	}
+	result := RotateResult{Threshold: opts.Threshold, Candidates: []RotateCandidate{}}
+	result.ActiveProfile = currentActiveProfile(tools)
+
+	usage, err := s.Usage(ctx, UsageOptions{Tools: tools, AllProfiles: true})
+	if err != nil {
+		return result, err
+	}
+	result.Candidates = rankRotateCandidates(usage, result.ActiveProfile)
+
+	for _, c := range result.Candidates {
+		if c.Active && c.Status == "ok" {
+			used := c.UsedPercent
+			result.ActiveUsage = &used
+		}
+	}
+
+	var best *RotateCandidate
+	for i := range result.Candidates {
+		if result.Candidates[i].Rank == 1 {
+			best = &result.Candidates[i]
+		}
+	}
+	switch {
+	case best == nil:
+		result.Action = "no_candidate"
+		result.Reason = "no profile returned usable rate-limit data"
+		return result, WrapExit(ExitPartial, fmt.Errorf("%s", result.Reason))
+	case best.Active:
+		result.Selected = best.Profile
+		result.Action = "already_best"
+		result.Reason = fmt.Sprintf("active profile %q already has the lowest usage (%.0f%%)", best.Profile, best.UsedPercent)
+		return result, nil
+	case opts.Threshold > 0 && result.ActiveUsage != nil && *result.ActiveUsage < opts.Threshold:
+		result.Selected = best.Profile
+		result.Action = "below_threshold"
+		result.Reason = fmt.Sprintf("active profile %q is at %.0f%%, below the %.0f%% threshold", result.ActiveProfile, *result.ActiveUsage, opts.Threshold)
+		return result, nil
+	}
+
+	result.Selected = best.Profile
+	result.Reason = fmt.Sprintf("%q has the lowest primary-window usage (%.0f%%)", best.Profile, best.UsedPercent)
+	if result.ActiveUsage != nil {
+		result.Reason += fmt.Sprintf("; active %q is at %.0f%%", result.ActiveProfile, *result.ActiveUsage)
+	}
+	if opts.DryRun {
+		result.Action = "would_switch"
+		switchResults, err := s.Switch(best.Profile, tools, SwitchOptions{DryRun: true})
+		result.Switch = switchResults
+		return result, err
+	}
+	result.Action = "switched"
+	switchResults, err := s.Switch(best.Profile, tools, SwitchOptions{})
+	result.Switch = switchResults
+	return result, err
+}
+
+func currentActiveProfile(tools []ToolName) string {
+	for _, tool := range tools {
+		adapter, err := adapterFor(tool)
+		if err != nil {
+			continue
+		}
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			continue
+		}
+		state, err := loadState(paths)
+		if err != nil {
+			continue
+		}
+		if name := activeProfileForDisplay(paths, adapter, state); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// rankRotateCandidates folds per-tool usage rows into one candidate per
+// profile, keeping the highest usage any tool reported so a profile is never
+// ranked better than its worst copy.
+func rankRotateCandidates(usage []UsageResult, activeProfile string) []RotateCandidate {
+	byProfile := map[string]*RotateCandidate{}
+	order := []string{}
+	for _, item := range usage {
+		if item.Profile == "" || item.Profile == unknownProfileName || item.Profile == "__last__" {
+			continue
+		}
+		c, ok := byProfile[item.Profile]
+		if !ok {
+			c = &RotateCandidate{Profile: item.Profile, Status: item.Status, Active: item.Profile == activeProfile}
+			byProfile[item.Profile] = c
+			order = append(order, item.Profile)
+		}
+		c.Tools = append(c.Tools, item.Tool)
+		if c.AccountID == "" {
+			c.AccountID = item.AccountID
+		}
+		switch {
+		case item.Status == "auth_error" || c.Status == "auth_error":
+			c.Status = "auth_error"
+			c.Reason = firstNonEmpty(item.Error, c.Reason)
+			continue
+		case item.Status == "shared":
+			// Usage came from another copy of the account; this copy's
+			// tokens were never tried, so it cannot make the profile eligible.
+			if c.Status != "ok" {
+				c.Status = "shared"
+			}
+			continue
+		case item.Status != "ok":
+			if c.Status != "ok" {
+				c.Reason = firstNonEmpty(item.Error, c.Reason)
+			}
+			continue
+		}
+		if c.Status != "ok" {
+			c.Reason = ""
+		}
+		c.Status = "ok"
+		if len(item.Windows) == 0 {
+			continue
+		}
+		primary := item.Windows[0]
+		if primary.UsedPercent >= c.UsedPercent {
+			c.UsedPercent = primary.UsedPercent
+			c.ResetAt = primary.ResetAt
+		}
+		for _, window := range item.Windows {
+			if window.UsedPercent >= 100 {
+				c.Reason = fmt.Sprintf("%s window exhausted", window.Label)
+			}
+		}
+	}
+
+	candidates := make([]RotateCandidate, 0, len(order))
+	for _, name := range order {
+		c := byProfile[name]
+		switch {
+		case c.Status == "auth_error":
+			c.Reason = "skipped: authentication failed (" + zeroReason(c.Reason) + ")"
+		case c.Status == "shared":
+			c.Reason = "skipped: tokens not verified (usage came from another copy of the account)"
+		case c.Status != "ok":
+			c.Reason = "skipped: usage unavailable (" + zeroReason(c.Reason) + ")"
+		case c.Reason != "":
+			c.Reason = "skipped: " + c.Reason
+		default:
+			c.Eligible = true
+		}
+		candidates = append(candidates, *c)
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Eligible != b.Eligible {
+			return a.Eligible
+		}
+		if a.UsedPercent != b.UsedPercent {
+			return a.UsedPercent < b.UsedPercent
+		}
+		if a.ResetAt != b.ResetAt {
+			if a.ResetAt == 0 || b.ResetAt == 0 {
+				return a.ResetAt != 0
+			}
+			return a.ResetAt < b.ResetAt
+		}
+		if a.Active != b.Active {
+			return a.Active
+		}
+		return a.Profile < b.Profile
+	})
+	rank := 0
+	for i := range candidates {
+		if candidates[i].Eligible {
+			rank++
+			candidates[i].Rank = rank
+		}
+	}
+	return candidates
+}
+
+func zeroReason(reason string) string {
+	if reason == "" {
+		return "no details"
+	}
+	return reason
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func setupRotateProfiles(t *testing.T) ToolPaths {
+	t.Helper()
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+
+	usage := map[string]struct {
+		used  int
+		reset int64
+	}{
+		"busy-access":  {used: 92, reset: 1773000000},
+		"late-access":  {used: 20, reset: 1773090000},
+		"early-access": {used: 20, reset: 1773010000},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth/token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		entry, ok := usage[token]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"rate_limit":{"primary_window":{"limit_window_seconds":18000,"used_percent":%d,"reset_at":%d}}}`, entry.used, entry.reset)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv("CODEX_SWITCHER_USAGE_URL", server.URL+"/backend-api/wham/usage")
+	t.Setenv("CODEX_SWITCHER_TOKEN_URL", server.URL+"/oauth/token")
+
+	paths := mustToolPaths(t, ToolCodex)
+	for name, access := range map[string]string{"busy": "busy-access", "late": "late-access", "early": "early-access", "revoked": "revoked-access"} {
+		if err := saveProfile(paths, name, Credential{Provider: "openai-codex", Access: access, Refresh: name + "-refresh", AccountID: "acct-" + name}, true); err != nil {
+			t.Fatalf("save %s: %v", name, err)
+		}
+	}
+	if _, err := NewService().Switch("busy", []ToolName{ToolCodex}, SwitchOptions{}); err != nil {
+		t.Fatalf("switch to busy: %v", err)
+	}
+	return paths
+}
+
+func TestRotateSwitchesToLeastUsedProfile(t *testing.T) {
+	paths := setupRotateProfiles(t)
+
+	result, err := NewService().Rotate(context.Background(), RotateOptions{Tools: []ToolName{ToolCodex}, Threshold: 90})
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if result.Action != "switched" || result.Selected != "early" || result.ActiveProfile != "busy" {
+		t.Fatalf("unexpected rotate result %+v", result)
+	}
+	order := []string{}
+	for _, c := range result.Candidates {
+		order = append(order, c.Profile)
+		if c.Profile == "revoked" && (c.Eligible || c.Status == "ok") {
+			t.Fatalf("expected revoked profile skipped, got %+v", c)
+		}
+	}
+	if strings.Join(order, ",") != "early,late,busy,revoked" {
+		t.Fatalf("unexpected ranking %v", order)
+	}
+
+	state, err := loadState(paths)
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if state.ActiveProfile != "early" {
+		t.Fatalf("expected early active after rotate, got %+v", state)
+	}
+}
+
+func TestRotateStaysBelowThreshold(t *testing.T) {
+	paths := setupRotateProfiles(t)
+
+	result, err := NewService().Rotate(context.Background(), RotateOptions{Tools: []ToolName{ToolCodex}, Threshold: 95, DryRun: true})
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if result.Action != "below_threshold" || len(result.Switch) != 0 {
+		t.Fatalf("expected rotate to stay put, got %+v", result)
+	}
+	state, err := loadState(paths)
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if state.ActiveProfile != "busy" {
+		t.Fatalf("expected busy to remain active, got %+v", state)
+	}
+}
+
+func TestRotateStopsWhenContextCancelled(t *testing.T) {
+	paths := setupRotateProfiles(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := NewService().Rotate(ctx, RotateOptions{Tools: []ToolName{ToolCodex}, Threshold: 90}); err == nil {
+		t.Fatalf("expected cancelled rotate to fail")
+	}
+	state, err := loadState(paths)
+	if err != nil {
+		t.Fatalf("load state: %v", err)
+	}
+	if state.ActiveProfile != "busy" {
+		t.Fatalf("expected busy to remain active, got %+v", state)
+	}
+}
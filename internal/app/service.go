@@ -19,10 +19,13 @@ type SwitchOptions struct {
 type rollbackRecord struct {
 	tool       ToolName
 	paths      ToolPaths
+	adapter    Adapter
 	activeRaw  []byte
 	activeSeen bool
 	stateRaw   []byte
 	stateSeen  bool
+	profile    string
+	action     string
 }
 
 func NewService() *Service {
@@ -30,8 +33,14 @@ func NewService() *Service {
 }
 
 func ParseTools(raw string) ([]ToolName, error) {
+	// A broken [tools] table only matters to the tools it would declare.
+	regs, configErr := registeredTools()
+	known := make(map[ToolName]struct{}, len(regs))
+	for _, reg := range regs {
+		known[reg.tool] = struct{}{}
+	}
 	if strings.TrimSpace(raw) == "" {
-		return append([]ToolName{}, AllTools...), nil
+		return AllTools()
 	}
 	parts := strings.Split(raw, ",")
 	tools := make([]ToolName, 0, len(parts))
@@ -41,7 +50,10 @@ func ParseTools(raw string) ([]ToolName, error) {
 		if name == "" {
 			continue
 		}
-		if name != ToolCodex && name != ToolOpenCode && name != ToolOpenClaw {
+		if _, ok := known[name]; !ok {
+			if configErr != nil {
+				return nil, fmt.Errorf("unknown tool %q: %w", name, configErr)
+			}
 			return nil, fmt.Errorf("unknown tool %q", name)
 		}
 		if _, ok := seen[name]; ok {
@@ -60,15 +72,20 @@ func ParseTools(raw string) ([]ToolName, error) {
 func (s *Service) Inspect(tools []ToolName) ([]InspectToolResult, error) {
 	results := make([]InspectToolResult, 0, len(tools))
 	for _, tool := range tools {
-		adapter := adapterFor(tool)
-		if adapter == nil {
-			return nil, fmt.Errorf("no adapter for %s", tool)
+		adapter, err := adapterFor(tool)
+		if err != nil {
+			return nil, err
 		}
 		paths, err := resolveToolPaths(tool)
 		if err != nil {
 			return nil, err
 		}
+		lock, err := acquireSharedLock(paths.LockPath)
+		if err != nil {
+			return nil, err
+		}
 		result, err := adapter.Inspect(paths)
+		_ = lock.Release()
 		if err != nil {
 			return nil, err
 		}
@@ -84,7 +101,10 @@ func (s *Service) Capture(profile string, tools []ToolName, force bool) ([]Inspe
 
 	results := make([]InspectToolResult, 0, len(tools))
 	for _, tool := range tools {
-		adapter := adapterFor(tool)
+		adapter, err := adapterFor(tool)
+		if err != nil {
+			return nil, WrapExit(ExitUserError, err)
+		}
 		paths, err := resolveToolPaths(tool)
 		if err != nil {
 			return nil, WrapExit(ExitIOFailure, err)
@@ -97,6 +117,10 @@ func (s *Service) Capture(profile string, tools []ToolName, force bool) ([]Inspe
 		releaseLock := func() {
 			_ = lock.Release()
 		}
+		if err := reconcileProfileCaches(paths); err != nil {
+			releaseLock()
+			return nil, WrapExit(ExitIOFailure, err)
+		}
 
 		cred, ok, err := adapter.ReadActiveCredential(paths)
 		if err != nil {
@@ -113,7 +137,7 @@ func (s *Service) Capture(profile string, tools []ToolName, force bool) ([]Inspe
 			continue
 		}
 
-		if err := saveProfile(paths, profile, cred, force); err != nil {
+		if err := saveProfileAs(paths, profile, cred, force, historyOpCapture); err != nil {
 			releaseLock()
 			return nil, WrapExit(ExitUserError, err)
 		}
@@ -180,9 +204,26 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 	if err := validateProfileName(profile); err != nil {
 		return nil, WrapExit(ExitUserError, err)
 	}
+	plan := make([]switchPlanEntry, 0, len(tools))
+	for _, tool := range tools {
+		plan = append(plan, switchPlanEntry{tool: tool, profile: profile})
+	}
+	return s.switchPlan(plan, opts, false)
+}
+
+type switchPlanEntry struct {
+	tool    ToolName
+	profile string
+}
 
+// switchPlan switches every tool in plan to its own profile. All writes share
+// one set of locks and one rollback list, so a failure on any tool restores
+// every tool touched so far. With requireAll, a blocked tool or a missing
+// profile aborts the switch before anything is written.
+func (s *Service) switchPlan(plan []switchPlanEntry, opts SwitchOptions, requireAll bool) ([]SwitchResult, error) {
 	type target struct {
 		tool        ToolName
+		profile     string
 		paths       ToolPaths
 		adapter     Adapter
 		state       StateFile
@@ -191,17 +232,42 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 		materialize bool
 	}
 
-	targets := make([]target, 0, len(tools))
-	results := make([]SwitchResult, 0, len(tools))
-	for _, tool := range tools {
-		adapter := adapterFor(tool)
-		if adapter == nil {
-			return nil, WrapExit(ExitUserError, fmt.Errorf("unknown tool %s", tool))
+	// Plan under the locks as well: a profile read before locking could be
+	// rotated by a concurrent refresh before it is written to the tool.
+	locks := make([]*FileLock, 0, len(plan))
+	defer func() {
+		for _, lock := range locks {
+			_ = lock.Release()
+		}
+	}()
+
+	targets := make([]target, 0, len(plan))
+	results := make([]SwitchResult, 0, len(plan))
+	for _, entry := range plan {
+		tool, profile := entry.tool, entry.profile
+		adapter, err := adapterFor(tool)
+		if err != nil {
+			return nil, WrapExit(ExitUserError, err)
 		}
 		paths, err := resolveToolPaths(tool)
 		if err != nil {
 			return nil, WrapExit(ExitIOFailure, err)
 		}
+		var lock *FileLock
+		if opts.DryRun {
+			lock, err = acquireSharedLock(paths.LockPath)
+		} else {
+			lock, err = acquireLock(paths.LockPath)
+		}
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		locks = append(locks, lock)
+		if !opts.DryRun {
+			if err := reconcileProfileCaches(paths); err != nil {
+				return nil, WrapExit(ExitIOFailure, err)
+			}
+		}
 		inspect, err := adapter.Inspect(paths)
 		if err != nil {
 			return nil, WrapExit(ExitIOFailure, err)
@@ -228,11 +294,11 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 				}
 				canMaterialize := hasActiveCred && activeCred.Access != "" && activeCred.Refresh != ""
 				if canMaterialize && state.PendingCreateProfile == profile {
-					targets = append(targets, target{tool: tool, paths: paths, adapter: adapter, state: state, action: "switch", cred: activeCred, materialize: true})
+					targets = append(targets, target{tool: tool, profile: profile, paths: paths, adapter: adapter, state: state, action: "switch", cred: activeCred, materialize: true})
 					continue
 				}
 				if opts.CreateMissing {
-					targets = append(targets, target{tool: tool, paths: paths, adapter: adapter, state: state, action: "prepare"})
+					targets = append(targets, target{tool: tool, profile: profile, paths: paths, adapter: adapter, state: state, action: "prepare"})
 				} else {
 					results = append(results, SwitchResult{
 						Tool:      tool,
@@ -245,11 +311,17 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 			}
 			return nil, WrapExit(ExitUserError, fmt.Errorf("%s: %w", tool, err))
 		}
-		targets = append(targets, target{tool: tool, paths: paths, adapter: adapter, cred: cred, state: state, action: "switch"})
+		targets = append(targets, target{tool: tool, profile: profile, paths: paths, adapter: adapter, cred: cred, state: state, action: "switch"})
+	}
+
+	if requireAll && len(results) > 0 {
+		item := results[0]
+		return nil, WrapExit(ExitUserError, fmt.Errorf("%s: cannot switch to %s: %s", item.Tool, item.ToProfile, item.Warning))
 	}
 
 	if opts.DryRun {
 		for _, t := range targets {
+			profile := t.profile
 			status := "switched"
 			pending := false
 			changed := true
@@ -281,29 +353,14 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 		return results, nil
 	}
 
-	locks := make([]*FileLock, 0, len(targets))
-	for _, t := range targets {
-		lock, err := acquireLock(t.paths.LockPath)
-		if err != nil {
-			for _, held := range locks {
-				_ = held.Release()
-			}
-			return nil, WrapExit(ExitIOFailure, err)
-		}
-		locks = append(locks, lock)
-	}
-	defer func() {
-		for _, lock := range locks {
-			_ = lock.Release()
-		}
-	}()
-
-	rollback := []rollbackRecord{}
-
-	for _, t := range targets {
-		activeRaw, activeErr := os.ReadFile(t.paths.ActivePath)
-		activeSeen := activeErr == nil
-		if activeErr != nil && !os.IsNotExist(activeErr) {
+	// Snapshot every target before the first write so the journal can undo a
+	// switch that is interrupted part-way through.
+	rollback := make([]rollbackRecord, 0, len(targets))
+	oldCreds := make([]Credential, len(targets))
+	hadCreds := make([]bool, len(targets))
+	for i, t := range targets {
+		activeRaw, activeSeen, activeErr := snapshotActive(t.adapter, t.paths)
+		if activeErr != nil {
 			return nil, WrapExit(ExitIOFailure, activeErr)
 		}
 		stateRaw, stateErr := os.ReadFile(t.paths.StatePath)
@@ -316,13 +373,33 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 		if err != nil && !os.IsNotExist(err) {
 			return nil, WrapExit(ExitIOFailure, err)
 		}
+		oldCreds[i], hadCreds[i] = oldCred, hadCred
 
-		oldState := t.state
 		rollback = append(rollback, rollbackRecord{
-			tool: t.tool, paths: t.paths,
+			tool: t.tool, paths: t.paths, adapter: t.adapter,
 			activeRaw: activeRaw, activeSeen: activeSeen,
 			stateRaw: stateRaw, stateSeen: stateSeen,
+			profile: t.profile, action: t.action,
 		})
+	}
+
+	journal, err := beginSwitchJournal(rollback)
+	if err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+	if err := hitSwitchFailpoint("journal"); err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+	abort := func(err error) ([]SwitchResult, error) {
+		s.rollback(rollback)
+		_ = journal.remove()
+		return nil, err
+	}
+
+	for i, t := range targets {
+		profile := t.profile
+		oldCred, hadCred := oldCreds[i], hadCreds[i]
+		oldState := t.state
 
 		sameActiveTarget := t.action == "switch" && !t.materialize && oldState.ActiveProfile == profile
 		if sameActiveTarget && t.tool == ToolOpenClaw {
@@ -333,9 +410,8 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 			changed := false
 
 			if oldCred.Refresh != "" && oldCred.Access != "" {
-				if err := saveProfile(t.paths, profile, oldCred, true); err != nil {
-					s.rollback(rollback)
-					return nil, WrapExit(ExitIOFailure, err)
+				if err := saveProfileAs(t.paths, profile, oldCred, true, historyOpSwitchSnapshot); err != nil {
+					return abort(WrapExit(ExitIOFailure, err))
 				}
 			} else {
 				status = "switched"
@@ -343,17 +419,14 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 				if t.tool == ToolOpenClaw {
 					oa, ok := t.adapter.(*openClawAdapter)
 					if !ok {
-						s.rollback(rollback)
-						return nil, WrapExit(ExitIOFailure, errors.New("openclaw adapter mismatch"))
+						return abort(WrapExit(ExitIOFailure, errors.New("openclaw adapter mismatch")))
 					}
 					if err := oa.WriteWithProfile(t.paths, profile, t.cred); err != nil {
-						s.rollback(rollback)
-						return nil, WrapExit(ExitIOFailure, err)
+						return abort(WrapExit(ExitIOFailure, err))
 					}
 				} else {
 					if err := t.adapter.WriteActiveCredential(t.paths, t.cred); err != nil {
-						s.rollback(rollback)
-						return nil, WrapExit(ExitIOFailure, err)
+						return abort(WrapExit(ExitIOFailure, err))
 					}
 				}
 			}
@@ -365,8 +438,10 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 			newState.PendingCreateSince = ""
 			newState.LastSwitchAt = time.Now().UTC().Format(time.RFC3339)
 			if err := saveState(t.paths, newState); err != nil {
-				s.rollback(rollback)
-				return nil, WrapExit(ExitIOFailure, err)
+				return abort(WrapExit(ExitIOFailure, err))
+			}
+			if err := journal.markApplied(i); err != nil {
+				return abort(WrapExit(ExitIOFailure, err))
 			}
 
 			results = append(results, SwitchResult{
@@ -383,16 +458,17 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 
 		snapshotProfile := chooseSnapshotProfile(oldState, profile)
 		if hadCred && oldCred.Refresh != "" && oldCred.Access != "" {
-			if err := saveProfile(t.paths, snapshotProfile, oldCred, true); err != nil {
-				s.rollback(rollback)
-				return nil, WrapExit(ExitIOFailure, err)
+			if err := saveProfileAs(t.paths, snapshotProfile, oldCred, true, historyOpSwitchSnapshot); err != nil {
+				return abort(WrapExit(ExitIOFailure, err))
 			}
 		}
+		if err := hitSwitchFailpoint(string(t.tool) + "/snapshot"); err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
 
 		if t.materialize {
-			if err := saveProfile(t.paths, profile, t.cred, true); err != nil {
-				s.rollback(rollback)
-				return nil, WrapExit(ExitIOFailure, err)
+			if err := saveProfileAs(t.paths, profile, t.cred, true, historyOpCapture); err != nil {
+				return abort(WrapExit(ExitIOFailure, err))
 			}
 		}
 
@@ -402,27 +478,26 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 			if t.tool == ToolOpenClaw {
 				oa, ok := t.adapter.(*openClawAdapter)
 				if !ok {
-					s.rollback(rollback)
-					return nil, WrapExit(ExitIOFailure, errors.New("openclaw adapter mismatch"))
+					return abort(WrapExit(ExitIOFailure, errors.New("openclaw adapter mismatch")))
 				}
 				if err := oa.WriteWithProfile(t.paths, profile, t.cred); err != nil {
-					s.rollback(rollback)
-					return nil, WrapExit(ExitIOFailure, err)
+					return abort(WrapExit(ExitIOFailure, err))
 				}
 			} else {
 				if err := t.adapter.WriteActiveCredential(t.paths, t.cred); err != nil {
-					s.rollback(rollback)
-					return nil, WrapExit(ExitIOFailure, err)
+					return abort(WrapExit(ExitIOFailure, err))
 				}
 			}
 		} else {
 			status = "prepared"
 			pendingCreate = true
 			if err := t.adapter.ClearActiveCredential(t.paths); err != nil {
-				s.rollback(rollback)
-				return nil, WrapExit(ExitIOFailure, err)
+				return abort(WrapExit(ExitIOFailure, err))
 			}
 		}
+		if err := hitSwitchFailpoint(string(t.tool) + "/active"); err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
 
 		newState := StateFile{
 			Version:         1,
@@ -439,9 +514,14 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 			newState.PendingCreateSince = time.Now().UTC().Format(time.RFC3339)
 		}
 		if err := saveState(t.paths, newState); err != nil {
-			s.rollback(rollback)
+			return abort(WrapExit(ExitIOFailure, err))
+		}
+		if err := hitSwitchFailpoint(string(t.tool) + "/state"); err != nil {
 			return nil, WrapExit(ExitIOFailure, err)
 		}
+		if err := journal.markApplied(i); err != nil {
+			return abort(WrapExit(ExitIOFailure, err))
+		}
 
 		results = append(results, SwitchResult{
 			Tool:            t.tool,
@@ -454,6 +534,13 @@ func (s *Service) Switch(profile string, tools []ToolName, opts SwitchOptions) (
 		})
 	}
 
+	if err := hitSwitchFailpoint("commit"); err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+	// A journal left behind here has every entry applied, so recovery only
+	// needs to discard it.
+	_ = journal.remove()
+
 	sortSwitchResults(results)
 	return results, nil
 }
@@ -474,11 +561,7 @@ func chooseSnapshotProfile(state StateFile, target string) string {
 func (s *Service) rollback(records []rollbackRecord) {
 	for i := len(records) - 1; i >= 0; i-- {
 		record := records[i]
-		if record.activeSeen {
-			_ = writeFileAtomic(record.paths.ActivePath, record.activeRaw, 0o600)
-		} else {
-			_ = os.Remove(record.paths.ActivePath)
-		}
+		_ = restoreActive(record.adapter, record.paths, record.activeRaw, record.activeSeen)
 		if record.stateSeen {
 			_ = writeFileAtomic(record.paths.StatePath, record.stateRaw, 0o600)
 		} else {
@@ -559,22 +642,26 @@ func (s *Service) RenameProfile(from string, to string, tools []ToolName) ([]Ren
 		targets = append(targets, renameTarget{tool: tool, paths: paths})
 	}
 
-	locks := make([]*FileLock, 0, len(targets))
+	locks := make([]*FileLock, 0, len(targets)+1)
+	defer func() {
+		for _, lock := range locks {
+			_ = lock.Release()
+		}
+	}()
 	for _, t := range targets {
 		lock, err := acquireLock(t.paths.LockPath)
 		if err != nil {
-			for _, held := range locks {
-				_ = held.Release()
-			}
 			return nil, WrapExit(ExitIOFailure, err)
 		}
 		locks = append(locks, lock)
 	}
-	defer func() {
-		for _, lock := range locks {
-			_ = lock.Release()
+	if _, ok := activeVaultDir(); ok {
+		lock, err := acquireVaultLock()
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
 		}
-	}()
+		locks = append(locks, lock)
+	}
 
 	for _, t := range targets {
 		fromPath := profilePath(t.paths, from)
@@ -600,6 +687,12 @@ func (s *Service) RenameProfile(from string, to string, tools []ToolName) ([]Ren
 		if err := os.Rename(profilePath(t.paths, from), profilePath(t.paths, to)); err != nil {
 			return nil, WrapExit(ExitIOFailure, err)
 		}
+		if err := renameProfileHistory(t.paths, from, to); err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		if err := renameVaultProfile(from, to); err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
 
 		state, err := loadState(t.paths)
 		if err != nil {
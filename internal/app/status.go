@@ -5,54 +5,125 @@ type StatusToolResult struct {
 	Paths                ToolPaths `json:"paths"`
 	HasActive            bool      `json:"hasActive"`
 	StoreMode            string    `json:"storeMode,omitempty"`
+	CredentialBackend    string    `json:"credentialBackend,omitempty"`
 	SwitchBlocked        bool      `json:"switchBlocked,omitempty"`
 	SwitchBlockReason    string    `json:"switchBlockReason,omitempty"`
 	ActiveProfile        string    `json:"activeProfile,omitempty"`
 	PreviousProfile      string    `json:"previousProfile,omitempty"`
+	LastSwitchAt         string    `json:"lastSwitchAt,omitempty"`
+	ActiveGroup          string    `json:"activeGroup,omitempty"`
 	PendingCreateProfile string    `json:"pendingCreateProfile,omitempty"`
 	PendingCreateSince   string    `json:"pendingCreateSince,omitempty"`
 	ProfileCount         int       `json:"profileCount"`
 	Profiles             []string  `json:"profiles,omitempty"`
+	Warning              string    `json:"warning,omitempty"`
 }
 
 func (s *Service) Status(tools []ToolName) ([]StatusToolResult, error) {
+	// A broken [groups] table only costs the active_group annotation.
+	groups, groupErr := s.Groups()
+	group, groupActive := activeGroup(groups)
+
 	results := make([]StatusToolResult, 0, len(tools))
 	for _, tool := range tools {
 		paths, err := resolveToolPaths(tool)
 		if err != nil {
 			return nil, err
 		}
-		adapter := adapterFor(tool)
-		if adapter == nil {
-			continue
-		}
-		inspect, err := adapter.Inspect(paths)
+		adapter, err := adapterFor(tool)
 		if err != nil {
 			return nil, err
 		}
-		state, err := loadState(paths)
+		result, err := statusForTool(paths, adapter)
 		if err != nil {
 			return nil, err
 		}
-		profiles, err := listProfiles(paths)
-		if err != nil {
-			return nil, err
+		if _, ok := group.Profiles[tool]; groupActive && ok {
+			result.ActiveGroup = group.Name
 		}
-
-		results = append(results, StatusToolResult{
-			Tool:                 tool,
-			Paths:                paths,
-			HasActive:            inspect.HasActive,
-			StoreMode:            inspect.StoreMode,
-			SwitchBlocked:        inspect.SwitchBlocked,
-			SwitchBlockReason:    inspect.SwitchBlockReason,
-			ActiveProfile:        activeProfileForDisplay(paths, adapter, state),
-			PreviousProfile:      state.PreviousProfile,
-			PendingCreateProfile: state.PendingCreateProfile,
-			PendingCreateSince:   state.PendingCreateSince,
-			ProfileCount:         len(profiles),
-			Profiles:             profiles,
-		})
+		if groupErr != nil {
+			result.Warning = "groups ignored: " + groupErr.Error()
+		}
+		results = append(results, result)
 	}
 	return results, nil
 }
+
+// statusForTool reads a tool's state under a shared lock so it never observes
+// a switch halfway through.
+func statusForTool(paths ToolPaths, adapter Adapter) (StatusToolResult, error) {
+	lock, err := acquireSharedLock(paths.LockPath)
+	if err != nil {
+		return StatusToolResult{}, err
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+
+	inspect, err := adapter.Inspect(paths)
+	if err != nil {
+		return StatusToolResult{}, err
+	}
+	state, err := loadState(paths)
+	if err != nil {
+		return StatusToolResult{}, err
+	}
+	profiles, err := listProfiles(paths)
+	if err != nil {
+		return StatusToolResult{}, err
+	}
+	return StatusToolResult{
+		Tool:                 paths.Tool,
+		Paths:                paths,
+		HasActive:            inspect.HasActive,
+		StoreMode:            inspect.StoreMode,
+		CredentialBackend:    inspect.CredentialBackend,
+		SwitchBlocked:        inspect.SwitchBlocked,
+		SwitchBlockReason:    inspect.SwitchBlockReason,
+		ActiveProfile:        activeProfileForDisplay(paths, adapter, state),
+		PreviousProfile:      state.PreviousProfile,
+		LastSwitchAt:         state.LastSwitchAt,
+		PendingCreateProfile: state.PendingCreateProfile,
+		PendingCreateSince:   state.PendingCreateSince,
+		ProfileCount:         len(profiles),
+		Profiles:             profiles,
+	}, nil
+}
+
+type ProfileSummary struct {
+	Tool      ToolName `json:"tool"`
+	Profile   string   `json:"profile"`
+	AccountID string   `json:"accountId,omitempty"`
+	Email     string   `json:"email,omitempty"`
+	ExpiresAt int64    `json:"expiresAt,omitempty"`
+	Error     string   `json:"error,omitempty"`
+
+	ProfileMetadata
+}
+
+// ProfileSummaries describes each stored profile of a tool without touching
+// the network.
+func (s *Service) ProfileSummaries(tool ToolName) ([]ProfileSummary, error) {
+	paths, err := resolveToolPaths(tool)
+	if err != nil {
+		return nil, err
+	}
+	names, err := listProfiles(paths)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]ProfileSummary, 0, len(names))
+	for _, name := range names {
+		summary := ProfileSummary{Tool: tool, Profile: name, ProfileMetadata: existingProfileMetadata(paths, name)}
+		cred, err := loadProfile(paths, name)
+		if err != nil {
+			summary.Error = err.Error()
+		} else {
+			summary.AccountID = cred.AccountID
+			summary.Email = cred.Email
+			summary.ExpiresAt = cred.ExpiresAt()
+		}
+		out = append(out, summary)
+	}
+	return out, nil
+}
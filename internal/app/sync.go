@@ -0,0 +1,266 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+)
+
+type SyncOptions struct {
+	Tools        []ToolName
+	DryRun       bool
+	TrialRefresh bool
+}
+
+type SyncResult struct {
+	AccountID string   `json:"accountId"`
+	Email     string   `json:"email,omitempty"`
+	Tool      ToolName `json:"tool"`
+	Location  string   `json:"location"`
+	Profile   string   `json:"profile,omitempty"`
+	Status    string   `json:"status"`
+	Expires   int64    `json:"expires,omitempty"`
+	Updated   bool     `json:"updated,omitempty"`
+	Warning   string   `json:"warning,omitempty"`
+}
+
+type syncTool struct {
+	tool    ToolName
+	paths   ToolPaths
+	adapter Adapter
+	state   StateFile
+	blocked bool
+}
+
+type syncCopy struct {
+	target  *syncTool
+	profile string
+	cred    Credential
+}
+
+func (c syncCopy) location() string {
+	if c.profile == "" {
+		return "active"
+	}
+	return "profile"
+}
+
+func (s *Service) Sync(opts SyncOptions) ([]SyncResult, error) {
+	targets := make([]*syncTool, 0, len(opts.Tools))
+	for _, tool := range opts.Tools {
+		adapter, err := adapterFor(tool)
+		if err != nil {
+			return nil, WrapExit(ExitUserError, err)
+		}
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		targets = append(targets, &syncTool{tool: tool, paths: paths, adapter: adapter})
+	}
+
+	locks := make([]*FileLock, 0, len(targets))
+	defer func() {
+		for _, lock := range locks {
+			_ = lock.Release()
+		}
+	}()
+	for _, t := range targets {
+		lock, err := acquireLock(t.paths.LockPath)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		locks = append(locks, lock)
+	}
+
+	groups := map[string][]syncCopy{}
+	for _, t := range targets {
+		inspect, err := t.adapter.Inspect(t.paths)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		t.blocked = inspect.SwitchBlocked
+		state, err := loadState(t.paths)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		t.state = state
+
+		active, ok, err := t.adapter.ReadActiveCredential(t.paths)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		if ok && active.AccountID != "" && active.Refresh != "" {
+			groups[active.AccountID] = append(groups[active.AccountID], syncCopy{target: t, cred: active})
+		}
+
+		names, err := listProfiles(t.paths)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		for _, name := range names {
+			cred, err := loadProfile(t.paths, name)
+			if err != nil || cred.AccountID == "" {
+				continue
+			}
+			groups[cred.AccountID] = append(groups[cred.AccountID], syncCopy{target: t, profile: name, cred: cred})
+		}
+	}
+
+	accounts := make([]string, 0, len(groups))
+	for accountID, copies := range groups {
+		if hasActiveCopy(copies) {
+			accounts = append(accounts, accountID)
+		}
+	}
+	sort.Strings(accounts)
+
+	httpClient := &http.Client{Timeout: defaultHTTPTimeout}
+	results := make([]SyncResult, 0)
+	for _, accountID := range accounts {
+		copies := groups[accountID]
+		fillKnownExpiry(copies)
+		winner, winnerIndex, warning := pickFreshestCopy(httpClient, copies, opts.TrialRefresh && !opts.DryRun)
+
+		for i, c := range copies {
+			result := SyncResult{
+				AccountID: accountID,
+				Email:     winner.Email,
+				Tool:      c.target.tool,
+				Location:  c.location(),
+				Profile:   c.profile,
+				Expires:   c.cred.ExpiresAt(),
+			}
+			switch {
+			case i == winnerIndex:
+				result.Status = "freshest"
+				if c.cred.Refresh != winner.Refresh {
+					result.Status = "refreshed"
+				}
+				result.Warning = warning
+			case c.cred.Refresh == winner.Refresh:
+				result.Status = "in_sync"
+			default:
+				result.Status = "stale"
+			}
+
+			if result.Status == "stale" || result.Status == "refreshed" {
+				if c.location() == "active" && c.target.blocked {
+					result.Warning = "active store is not file-backed; left unchanged"
+				} else if !opts.DryRun {
+					if err := writeSyncCopy(c, winner); err != nil {
+						return results, WrapExit(ExitIOFailure, fmt.Errorf("%s: %w", c.target.tool, err))
+					}
+					result.Updated = true
+				}
+			}
+			results = append(results, result)
+		}
+	}
+
+	if !opts.DryRun {
+		for _, t := range targets {
+			if err := retrackSyncedActiveProfile(t); err != nil {
+				return results, WrapExit(ExitIOFailure, fmt.Errorf("%s: %w", t.tool, err))
+			}
+		}
+	}
+	return results, nil
+}
+
+func hasActiveCopy(copies []syncCopy) bool {
+	for _, c := range copies {
+		if c.profile == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// fillKnownExpiry lets copies that carry no expiry (Codex's auth.json) borrow
+// it from another copy holding the same refresh token.
+func fillKnownExpiry(copies []syncCopy) {
+	for i := range copies {
+		if copies[i].cred.ExpiresAt() > 0 {
+			continue
+		}
+		for _, other := range copies {
+			if other.cred.Refresh == copies[i].cred.Refresh && other.cred.Expires > 0 {
+				copies[i].cred.Expires = other.cred.Expires
+				break
+			}
+		}
+	}
+}
+
+func pickFreshestCopy(client *http.Client, copies []syncCopy, trialRefresh bool) (Credential, int, string) {
+	order := make([]int, len(copies))
+	for i := range copies {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return credentialFresher(copies[order[i]].cred, copies[order[j]].cred)
+	})
+
+	best := order[0]
+	if !trialRefresh || !distinctRefreshTokens(copies) {
+		return copies[best].cred, best, ""
+	}
+
+	tried := map[string]struct{}{}
+	for _, idx := range order {
+		refresh := copies[idx].cred.Refresh
+		if _, ok := tried[refresh]; ok {
+			continue
+		}
+		tried[refresh] = struct{}{}
+		next, err := refreshCredential(context.Background(), client, copies[idx].cred)
+		if err == nil {
+			return next, idx, ""
+		}
+		if !isTokenRejected(err) {
+			return copies[best].cred, best, "trial refresh failed: " + err.Error()
+		}
+	}
+	return copies[best].cred, best, "every copy was rejected by the token endpoint; re-login required"
+}
+
+func distinctRefreshTokens(copies []syncCopy) bool {
+	for _, c := range copies[1:] {
+		if c.cred.Refresh != copies[0].cred.Refresh {
+			return true
+		}
+	}
+	return false
+}
+
+func writeSyncCopy(c syncCopy, winner Credential) error {
+	if c.profile != "" {
+		return saveProfileAs(c.target.paths, c.profile, winner, true, historyOpSync)
+	}
+	if oa, ok := c.target.adapter.(*openClawAdapter); ok {
+		return oa.WriteWithProfile(c.target.paths, c.target.state.ActiveProfile, winner)
+	}
+	return c.target.adapter.WriteActiveCredential(c.target.paths, winner)
+}
+
+func retrackSyncedActiveProfile(t *syncTool) error {
+	if t.state.ActiveProfile == "" {
+		return nil
+	}
+	active, ok, err := t.adapter.ReadActiveCredential(t.paths)
+	if err != nil || !ok {
+		return nil
+	}
+	if !profileMatchesCredential(t.paths, t.state.ActiveProfile, active) {
+		return nil
+	}
+	if t.state.ActiveCredentialHash == credentialFingerprint(active) {
+		return nil
+	}
+	state := t.state
+	setActiveProfileTracking(&state, state.ActiveProfile, active)
+	return saveState(t.paths, state)
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSyncPropagatesFreshestCredentialAcrossTools(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmp, "xdg"))
+
+	codexPaths := mustToolPaths(t, ToolCodex)
+	openCodePaths := mustToolPaths(t, ToolOpenCode)
+
+	stale := Credential{Provider: "openai-codex", Access: "stale-access", Refresh: "stale-refresh", Expires: time.Now().Add(time.Hour).UnixMilli(), AccountID: "acct-work"}
+	fresh := Credential{Provider: "openai-codex", Access: "fresh-access", Refresh: "fresh-refresh", Expires: time.Now().Add(8 * time.Hour).UnixMilli(), AccountID: "acct-work"}
+
+	if err := saveProfile(codexPaths, "work", stale, true); err != nil {
+		t.Fatalf("save codex work: %v", err)
+	}
+	if err := (&codexAdapter{}).WriteActiveCredential(codexPaths, stale); err != nil {
+		t.Fatalf("write codex active: %v", err)
+	}
+	if err := saveState(codexPaths, StateFile{Version: 1, ActiveProfile: "work", ActiveCredentialHash: credentialFingerprint(stale)}); err != nil {
+		t.Fatalf("save codex state: %v", err)
+	}
+	if err := (&openCodeAdapter{}).WriteActiveCredential(openCodePaths, fresh); err != nil {
+		t.Fatalf("write opencode active: %v", err)
+	}
+
+	svc := NewService()
+	results, err := svc.Sync(SyncOptions{Tools: []ToolName{ToolCodex, ToolOpenCode}})
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+
+	statuses := map[string]string{}
+	for _, item := range results {
+		statuses[string(item.Tool)+"/"+item.Location+"/"+item.Profile] = item.Status
+	}
+	if statuses["opencode/active/"] != "freshest" || statuses["codex/active/"] != "stale" || statuses["codex/profile/work"] != "stale" {
+		t.Fatalf("unexpected sync statuses %+v", statuses)
+	}
+
+	tokens, err := readCodexTokens(codexPaths.ActivePath)
+	if err != nil {
+		t.Fatalf("read codex tokens: %v", err)
+	}
+	if tokens["refresh_token"] != "fresh-refresh" {
+		t.Fatalf("expected codex active healed, got %+v", tokens)
+	}
+	work, err := loadProfile(codexPaths, "work")
+	if err != nil {
+		t.Fatalf("load codex work: %v", err)
+	}
+	if work.Refresh != "fresh-refresh" {
+		t.Fatalf("expected saved profile healed, got %+v", work)
+	}
+	state, err := loadState(codexPaths)
+	if err != nil {
+		t.Fatalf("load codex state: %v", err)
+	}
+	active, _, err := (&codexAdapter{}).ReadActiveCredential(codexPaths)
+	if err != nil {
+		t.Fatalf("read codex active: %v", err)
+	}
+	if verifiedStateActiveProfile(codexPaths, state, active) != "work" {
+		t.Fatalf("expected codex to keep tracking work as active, got %+v", state)
+	}
+}
+
+func TestSyncDryRunLeavesFilesUntouched(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmp, "xdg"))
+
+	codexPaths := mustToolPaths(t, ToolCodex)
+	openCodePaths := mustToolPaths(t, ToolOpenCode)
+	if err := (&codexAdapter{}).WriteActiveCredential(codexPaths, Credential{Access: "a1", Refresh: "r1", AccountID: "acct", Expires: 1000}); err != nil {
+		t.Fatalf("write codex active: %v", err)
+	}
+	if err := (&openCodeAdapter{}).WriteActiveCredential(openCodePaths, Credential{Access: "a2", Refresh: "r2", AccountID: "acct", Expires: time.Now().Add(time.Hour).UnixMilli()}); err != nil {
+		t.Fatalf("write opencode active: %v", err)
+	}
+
+	svc := NewService()
+	results, err := svc.Sync(SyncOptions{Tools: []ToolName{ToolCodex, ToolOpenCode}, DryRun: true})
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("expected two copies reported, got %+v", results)
+	}
+	for _, item := range results {
+		if item.Updated {
+			t.Fatalf("expected no updates in dry-run, got %+v", item)
+		}
+	}
+	tokens, err := readCodexTokens(codexPaths.ActivePath)
+	if err != nil {
+		t.Fatalf("read codex tokens: %v", err)
+	}
+	if tokens["refresh_token"] != "r1" {
+		t.Fatalf("expected codex active untouched, got %+v", tokens)
+	}
+}
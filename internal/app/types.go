@@ -10,8 +10,6 @@ const (
 	ToolOpenClaw ToolName = "openclaw"
 )
 
-var AllTools = []ToolName{ToolCodex, ToolOpenCode, ToolOpenClaw}
-
 type Credential struct {
 	Provider  string `json:"provider"`
 	Access    string `json:"access"`
@@ -37,6 +35,22 @@ func (c Credential) NearExpiry(now time.Time, threshold time.Duration) bool {
 	return now.Add(threshold).UnixMilli() >= c.Expires
 }
 
+func (c Credential) ExpiresAt() int64 {
+	if c.Expires > 0 {
+		return c.Expires
+	}
+	if claims := parseJWTClaims(c.Access); claims != nil {
+		if exp := toInt64(claims["exp"]); exp > 0 {
+			return exp * 1000
+		}
+	}
+	return 0
+}
+
+// profileFileVersion 2 added ProfileMetadata; version 1 files carry tokens
+// only and read back with empty metadata.
+const profileFileVersion = 2
+
 type ProfileFile struct {
 	Version  int    `json:"version"`
 	Provider string `json:"provider"`
@@ -48,6 +62,28 @@ type ProfileFile struct {
 	IDToken   string `json:"idToken,omitempty"`
 	Email     string `json:"email,omitempty"`
 	UpdatedAt int64  `json:"updatedAt,omitempty"`
+
+	ProfileMetadata
+}
+
+// ProfileMetadata is user-maintained information about a profile. It is
+// carried across token updates and never sent anywhere.
+type ProfileMetadata struct {
+	Label     string   `json:"label,omitempty"`
+	Note      string   `json:"note,omitempty"`
+	Owner     string   `json:"owner,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+	Plan      string   `json:"plan,omitempty"`
+	CreatedAt int64    `json:"createdAt,omitempty"`
+}
+
+func (m ProfileMetadata) HasTag(tag string) bool {
+	for _, item := range m.Tags {
+		if item == tag {
+			return true
+		}
+	}
+	return false
 }
 
 type StateFile struct {
@@ -78,19 +114,27 @@ type InspectToolResult struct {
 	Email             string    `json:"email,omitempty"`
 	Expires           int64     `json:"expires,omitempty"`
 	StoreMode         string    `json:"storeMode,omitempty"`
+	CredentialBackend string    `json:"credentialBackend,omitempty"`
 	SwitchBlocked     bool      `json:"switchBlocked,omitempty"`
 	SwitchBlockReason string    `json:"switchBlockReason,omitempty"`
 	Warnings          []string  `json:"warnings,omitempty"`
 }
 
 type UsageWindow struct {
-	Label         string  `json:"label"`
-	UsedPercent   float64 `json:"usedPercent"`
-	ResetAt       int64   `json:"resetAt,omitempty"`
-	ResetAtISO    string  `json:"resetAtIso,omitempty"`
-	RemainingDays float64 `json:"remainingDays,omitempty"`
+	Label               string  `json:"label"`
+	UsedPercent         float64 `json:"usedPercent"`
+	ResetAt             int64   `json:"resetAt,omitempty"`
+	ResetAtISO          string  `json:"resetAtIso,omitempty"`
+	RemainingDays       float64 `json:"remainingDays,omitempty"`
+	BurnRatePerHour     float64 `json:"burnRatePerHour,omitempty"`
+	ExhaustAt           int64   `json:"exhaustAt,omitempty"`
+	ExhaustAtISO        string  `json:"exhaustAtIso,omitempty"`
+	ExhaustsBeforeReset bool    `json:"exhaustsBeforeReset,omitempty"`
 }
 
+// UsageResult is the usage of one tool/profile pair. Status "shared" marks a
+// copy that was not queried because another copy of the same account
+// answered: its windows are the account's, but its own tokens are unverified.
 type UsageResult struct {
 	Tool           ToolName      `json:"tool,omitempty"`
 	Profile        string        `json:"profile"`
@@ -102,4 +146,40 @@ type UsageResult struct {
 	Status         string        `json:"status"`
 	Error          string        `json:"error,omitempty"`
 	Refreshed      bool          `json:"refreshed,omitempty"`
+	Label          string        `json:"label,omitempty"`
+	Warning        string        `json:"warning,omitempty"`
+
+	accountKey string
+}
+
+// HasUsage reports whether the result carries usage windows, whether queried
+// itself or shared from another copy of the account.
+func (r UsageResult) HasUsage() bool {
+	return usageStatusHasData(r.Status)
+}
+
+func usageStatusHasData(status string) bool {
+	return status == "ok" || status == "shared"
+}
+
+// UsageAccount is one account's usage together with every tool/profile pair
+// that stores it.
+type UsageAccount struct {
+	AccountID      string                `json:"accountId,omitempty"`
+	Profiles       []UsageAccountProfile `json:"profiles"`
+	Provider       string                `json:"provider"`
+	Plan           string                `json:"plan,omitempty"`
+	CreditsBalance *float64              `json:"creditsBalance,omitempty"`
+	Windows        []UsageWindow         `json:"windows"`
+	Status         string                `json:"status"`
+	Error          string                `json:"error,omitempty"`
+}
+
+type UsageAccountProfile struct {
+	Tool      ToolName `json:"tool,omitempty"`
+	Profile   string   `json:"profile"`
+	Label     string   `json:"label,omitempty"`
+	Refreshed bool     `json:"refreshed,omitempty"`
+	Shared    bool     `json:"shared,omitempty"`
+	Warning   string   `json:"warning,omitempty"`
 }
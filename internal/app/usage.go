@@ -2,7 +2,9 @@ package app
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,16 +13,20 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const (
 	defaultUsageURL    = "https://chatgpt.com/backend-api/wham/usage"
-	refreshURL         = "https://auth.openai.com/oauth/token"
+	defaultTokenURL    = "https://auth.openai.com/oauth/token"
 	oauthClientID      = "app_EMoamEEZ73f0CkXaXp7hrann"
 	refreshThreshold   = 30 * time.Second
 	defaultHTTPTimeout = 12 * time.Second
-	unknownProfileName = "-"
+	// defaultUsageConcurrency bounds parallel usage requests so a large
+	// vault does not burst the usage endpoint.
+	defaultUsageConcurrency = 4
+	unknownProfileName      = "-"
 )
 
 type UsageOptions struct {
@@ -28,14 +34,25 @@ type UsageOptions struct {
 	AllProfiles bool
 	Tools       []ToolName
 	ActiveOnly  bool
+	Tag         string
+	// Concurrency caps in-flight usage requests; zero uses
+	// defaultUsageConcurrency.
+	Concurrency int
 }
 
-func (s *Service) Usage(opts UsageOptions) ([]UsageResult, error) {
+// Usage queries every selected profile across the selected tools. Requests
+// for the same credential stored under several tools are sent once, and
+// cancelling ctx aborts requests still in flight; tokens already rotated are
+// written back before the context error is returned.
+func (s *Service) Usage(ctx context.Context, opts UsageOptions) ([]UsageResult, error) {
 	if opts.Profile != "" {
 		if err := validateProfileName(opts.Profile); err != nil {
 			return nil, WrapExit(ExitUserError, err)
 		}
 	}
+	if opts.Concurrency < 0 {
+		return nil, WrapExit(ExitUserError, fmt.Errorf("usage concurrency must not be negative"))
+	}
 
 	tools, err := resolveUsageTools(opts.Tools)
 	if err != nil {
@@ -44,9 +61,10 @@ func (s *Service) Usage(opts UsageOptions) ([]UsageResult, error) {
 
 	httpClient := &http.Client{Timeout: defaultHTTPTimeout}
 	usageURL := firstNonEmpty(strings.TrimSpace(os.Getenv("CODEX_SWITCHER_USAGE_URL")), defaultUsageURL)
-	defaultActiveQuery := opts.Profile == "" && !opts.AllProfiles && (len(opts.Tools) == 0 || opts.ActiveOnly)
+	defaultActiveQuery := opts.Profile == "" && opts.Tag == "" && !opts.AllProfiles && (len(opts.Tools) == 0 || opts.ActiveOnly)
 
 	results := make([]UsageResult, 0)
+	snapshots := make([]usageSnapshot, 0, len(tools))
 	for _, tool := range tools {
 		paths, pathErr := resolveToolPaths(tool)
 		if pathErr != nil {
@@ -59,34 +77,30 @@ func (s *Service) Usage(opts UsageOptions) ([]UsageResult, error) {
 			})
 			continue
 		}
-		adapter := adapterFor(tool)
-		if adapter == nil {
+		adapter, err := adapterFor(tool)
+		if err != nil {
 			results = append(results, UsageResult{
 				Tool:     tool,
 				Profile:  unknownProfileName,
 				Provider: "openai-codex",
 				Status:   "error",
-				Error:    "unsupported tool adapter",
+				Error:    err.Error(),
 			})
 			continue
 		}
 
-		state, _ := loadState(paths)
-		if shouldMaterializePendingUsageForScopedTools(opts, state) {
-			state, err = materializePendingUsageProfile(httpClient, usageURL, paths, adapter, state)
-			if err != nil {
-				results = append(results, UsageResult{
-					Tool:     tool,
-					Profile:  state.PendingCreateProfile,
-					Provider: "openai-codex",
-					Status:   "error",
-					Error:    err.Error(),
-				})
-				continue
-			}
+		if pending, err := materializePendingUsageProfile(ctx, httpClient, usageURL, opts, paths, adapter); err != nil {
+			results = append(results, UsageResult{
+				Tool:     tool,
+				Profile:  pending,
+				Provider: "openai-codex",
+				Status:   "error",
+				Error:    err.Error(),
+			})
+			continue
 		}
 
-		profilesToLoad, selectErr := selectUsageProfilesForTool(opts, paths)
+		state, targets, selectErr := snapshotUsageTargets(opts, paths, adapter, defaultActiveQuery)
 		if selectErr != nil {
 			results = append(results, UsageResult{
 				Tool:     tool,
@@ -97,7 +111,10 @@ func (s *Service) Usage(opts UsageOptions) ([]UsageResult, error) {
 			})
 			continue
 		}
-		if len(profilesToLoad) == 0 {
+		if len(targets) == 0 && opts.Tag != "" {
+			continue
+		}
+		if len(targets) == 0 {
 			results = append(results, UsageResult{
 				Tool:     tool,
 				Profile:  unknownProfileName,
@@ -107,114 +124,122 @@ func (s *Service) Usage(opts UsageOptions) ([]UsageResult, error) {
 			})
 			continue
 		}
+		snapshots = append(snapshots, usageSnapshot{tool: tool, paths: paths, adapter: adapter, state: state, targets: targets})
+	}
 
-		hadSuccess := false
-		lastSuccessProfile := ""
-		resolvedPendingProfile := false
+	requests := make([]usageRequest, 0)
+	accounts := make([]usageAccountRequests, 0)
+	requestIndex := map[string]int{}
+	accountIndex := map[string]int{}
+	for i := range snapshots {
+		for j, target := range snapshots[i].targets {
+			if target.err != nil {
+				continue
+			}
+			key := usageRequestKey(target.cred)
+			idx, ok := requestIndex[key]
+			if !ok {
+				accountKey := usageAccountKey(target.cred)
+				account, ok := accountIndex[accountKey]
+				if !ok {
+					account = len(accounts)
+					accountIndex[accountKey] = account
+					accounts = append(accounts, usageAccountRequests{served: -1})
+				}
+				idx = len(requests)
+				requestIndex[key] = idx
+				requests = append(requests, usageRequest{cred: target.cred, account: account})
+				accounts[account].requests = append(accounts[account].requests, idx)
+			}
+			snapshots[i].requests = append(snapshots[i].requests, usageRequestRef{target: j, request: idx})
+		}
+	}
+	runUsageRequests(ctx, httpClient, usageURL, requests, accounts, opts.Concurrency)
 
-		for _, name := range profilesToLoad {
-			cred, sourceLabel, sourceVerified, resolveErr := resolveUsageCredential(paths, adapter, name, state, defaultActiveQuery)
-			if resolveErr != nil {
+	for _, snapshot := range snapshots {
+		for _, target := range snapshot.targets {
+			if target.err != nil {
 				results = append(results, UsageResult{
-					Tool:     tool,
-					Profile:  usageProfileLabel(name),
+					Tool:     snapshot.tool,
+					Profile:  usageProfileLabel(target.name),
 					Provider: "openai-codex",
 					Status:   "error",
-					Error:    resolveErr.Error(),
+					Error:    target.err.Error(),
 				})
-				continue
 			}
+		}
 
-			result, newCred, refreshed, usageErr := fetchUsageWithRefresh(httpClient, usageURL, cred)
-			if usageErr != nil {
+		fetches := make([]usageFetch, 0, len(snapshot.requests))
+		fetchResults := make([]int, 0, len(snapshot.requests))
+		for _, ref := range snapshot.requests {
+			target := snapshot.targets[ref.target]
+			request := requests[ref.request]
+			shared := false
+			if !request.attempted {
+				// Another copy of the same account answered, or the run was
+				// cancelled first; either way this one's tokens are untouched
+				// and unverified.
+				request.newCred = target.cred
+				if served := accounts[request.account].served; served >= 0 {
+					request.result = requests[served].result
+					shared = true
+				} else {
+					request.err = ctx.Err()
+				}
+			}
+			fetches = append(fetches, usageFetch{target: target, newCred: request.newCred, refreshed: request.refreshed, failed: request.err != nil})
+			fetchResults = append(fetchResults, len(results))
+			if request.err != nil {
 				status := "error"
-				if refreshed {
+				if request.refreshed {
 					status = "auth_error"
 				}
 				results = append(results, UsageResult{
-					Tool:      tool,
-					Profile:   sourceLabel,
+					Tool:      snapshot.tool,
+					Profile:   target.sourceLabel,
 					Provider:  "openai-codex",
-					AccountID: cred.AccountID,
+					AccountID: target.cred.AccountID,
 					Status:    status,
-					Error:     usageErr.Error(),
-					Refreshed: refreshed,
+					Error:     request.err.Error(),
+					Refreshed: request.refreshed,
 				})
 				continue
 			}
 
-			result.Tool = tool
-			result.Profile = sourceLabel
+			result := request.result
+			result.Windows = append([]UsageWindow(nil), result.Windows...)
+			result.accountKey = usageAccountKey(target.cred)
+			result.Tool = snapshot.tool
+			result.Profile = target.sourceLabel
 			if result.AccountID == "" {
-				result.AccountID = cred.AccountID
-			}
-			result.Refreshed = refreshed
-			results = append(results, result)
-			hadSuccess = true
-			if name != "__active__" {
-				lastSuccessProfile = name
-			} else if sourceVerified && sourceLabel != unknownProfileName {
-				lastSuccessProfile = sourceLabel
-			}
-
-			if refreshed {
-				if name != "__active__" {
-					_ = saveProfile(paths, name, newCred, true)
-					stateAfterRefresh, _ := loadState(paths)
-					if activeProfileForDisplay(paths, adapter, stateAfterRefresh) == name {
-						if tool == ToolOpenClaw {
-							oa, ok := adapter.(*openClawAdapter)
-							if ok {
-								_ = oa.WriteWithProfile(paths, name, newCred)
-							}
-						} else {
-							_ = adapter.WriteActiveCredential(paths, newCred)
-						}
-					}
-				} else {
-					if sourceVerified && sourceLabel != unknownProfileName {
-						_ = saveProfile(paths, sourceLabel, newCred, true)
-					}
-					_ = adapter.WriteActiveCredential(paths, newCred)
-				}
+				result.AccountID = target.cred.AccountID
 			}
-
-			if name == "__active__" && sourceVerified && sourceLabel != unknownProfileName {
-				synced := cred
-				if refreshed {
-					synced = newCred
-				}
-				targetProfile := sourceLabel
-				if targetProfile == unknownProfileName {
-					targetProfile = state.PendingCreateProfile
-				}
-				if targetProfile != "" && targetProfile != unknownProfileName {
-					if state.PendingCreateProfile != "" && targetProfile == state.PendingCreateProfile {
-						resolvedPendingProfile = true
-					}
-					_ = saveProfile(paths, targetProfile, synced, true)
-				}
+			result.Refreshed = request.refreshed
+			if shared {
+				result.Status = "shared"
 			}
+			results = append(results, result)
 		}
 
-		shouldClearPending := state.PendingCreateProfile != "" && (resolvedPendingProfile || (opts.Profile != "" && opts.Profile == state.PendingCreateProfile))
-		if hadSuccess && shouldClearPending {
-			pendingProfile := state.PendingCreateProfile
-			state.PendingCreateProfile = ""
-			state.PendingCreateSince = ""
-			if opts.Profile != "" {
-				setActiveProfileTracking(&state, opts.Profile, Credential{})
-				state.ActiveCredentialHash = ""
-			} else if lastSuccessProfile != "" {
-				setActiveProfileTracking(&state, lastSuccessProfile, Credential{})
-				state.ActiveCredentialHash = ""
-			} else if state.ActiveProfile == "" {
-				state.ActiveProfile = pendingProfile
+		writeErrs, stateErr := storeUsageWriteBacks(opts, snapshot.paths, snapshot.adapter, snapshot.state, fetches)
+		for i, idx := range fetchResults {
+			switch {
+			case writeErrs[i] != nil:
+				results[idx].Warning = "rotated tokens not saved: " + writeErrs[i].Error()
+			case stateErr != nil:
+				results[idx].Warning = "state not updated: " + stateErr.Error()
 			}
-			_ = saveState(paths, state)
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
+	for i := range results {
+		if paths, err := resolveToolPaths(results[i].Tool); err == nil {
+			results[i].Label = existingProfileMetadata(paths, results[i].Profile).Label
+		}
+	}
 	sort.Slice(results, func(i, j int) bool {
 		if results[i].Tool == results[j].Tool {
 			return results[i].Profile < results[j].Profile
@@ -224,15 +249,344 @@ func (s *Service) Usage(opts UsageOptions) ([]UsageResult, error) {
 	return results, nil
 }
 
+// GroupUsageByAccount folds results for the same account into one entry,
+// keeping the order in which accounts first appear. Failed results stay
+// separate since they say nothing about the account as a whole.
+func GroupUsageByAccount(results []UsageResult) []UsageAccount {
+	accounts := make([]UsageAccount, 0, len(results))
+	index := map[string]int{}
+	for _, item := range results {
+		member := UsageAccountProfile{Tool: item.Tool, Profile: item.Profile, Label: item.Label, Refreshed: item.Refreshed, Shared: item.Status == "shared", Warning: item.Warning}
+		if item.HasUsage() && item.accountKey != "" {
+			if idx, ok := index[item.accountKey]; ok {
+				accounts[idx].Profiles = append(accounts[idx].Profiles, member)
+				if item.Status == "ok" {
+					accounts[idx].Status = "ok"
+				}
+				continue
+			}
+			index[item.accountKey] = len(accounts)
+		}
+		accounts = append(accounts, UsageAccount{
+			AccountID:      item.AccountID,
+			Profiles:       []UsageAccountProfile{member},
+			Provider:       item.Provider,
+			Plan:           item.Plan,
+			CreditsBalance: item.CreditsBalance,
+			Windows:        item.Windows,
+			Status:         item.Status,
+			Error:          item.Error,
+		})
+	}
+	return accounts
+}
+
+// usageSnapshot is one tool's targets plus the shared requests serving them.
+type usageSnapshot struct {
+	tool     ToolName
+	paths    ToolPaths
+	adapter  Adapter
+	state    StateFile
+	targets  []usageTarget
+	requests []usageRequestRef
+}
+
+type usageRequestRef struct {
+	target  int
+	request int
+}
+
+// usageRequest is a single usage query, shared by every target holding the
+// same credential.
+type usageRequest struct {
+	cred      Credential
+	account   int
+	attempted bool
+	result    UsageResult
+	newCred   Credential
+	refreshed bool
+	err       error
+}
+
+// usageAccountRequests groups the distinct credentials stored for one account.
+// They are tried freshest first until one answers, whose result then serves
+// every copy; served is -1 until then.
+type usageAccountRequests struct {
+	requests []int
+	served   int
+}
+
+func usageRequestKey(cred Credential) string {
+	return cred.Access + "\x00" + cred.Refresh + "\x00" + cred.AccountID
+}
+
+// usageAccountKey identifies the account behind cred, so one account saved
+// under several tools or profiles is queried once.
+func usageAccountKey(cred Credential) string {
+	if accountID := strings.TrimSpace(cred.AccountID); accountID != "" {
+		return "account:" + accountID
+	}
+	return "fingerprint:" + credentialFingerprint(cred)
+}
+
+// runUsageRequests serves every account using at most concurrency workers.
+func runUsageRequests(ctx context.Context, client *http.Client, usageURL string, requests []usageRequest, accounts []usageAccountRequests, concurrency int) {
+	if concurrency <= 0 {
+		concurrency = defaultUsageConcurrency
+	}
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(concurrency, len(accounts)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := range next {
+				serveUsageAccount(ctx, client, usageURL, requests, &accounts[idx])
+			}
+		}()
+	}
+	for idx := range accounts {
+		next <- idx
+	}
+	close(next)
+	wg.Wait()
+}
+
+func serveUsageAccount(ctx context.Context, client *http.Client, usageURL string, requests []usageRequest, account *usageAccountRequests) {
+	order := append([]int(nil), account.requests...)
+	sort.SliceStable(order, func(i, j int) bool {
+		return credentialFresher(requests[order[i]].cred, requests[order[j]].cred)
+	})
+	for _, idx := range order {
+		request := &requests[idx]
+		request.attempted = true
+		request.result, request.newCred, request.refreshed, request.err = fetchUsageWithRefresh(ctx, client, usageURL, request.cred)
+		if request.err == nil {
+			account.served = idx
+			return
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// usageTarget is one credential Usage will query, resolved under the tool
+// lock so every target comes from the same snapshot of the tool's files.
+type usageTarget struct {
+	name           string
+	cred           Credential
+	sourceLabel    string
+	sourceVerified bool
+	err            error
+}
+
+// usageFetch is a usage query whose tokens may need writing back. A failed
+// query can still have rotated the refresh token before failing.
+type usageFetch struct {
+	target    usageTarget
+	newCred   Credential
+	refreshed bool
+	failed    bool
+}
+
+func snapshotUsageTargets(opts UsageOptions, paths ToolPaths, adapter Adapter, defaultActiveQuery bool) (StateFile, []usageTarget, error) {
+	lock, err := acquireLock(paths.LockPath)
+	if err != nil {
+		return StateFile{}, nil, err
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+
+	_ = reconcileProfileCaches(paths)
+	state, _ := loadState(paths)
+	names, err := selectUsageProfilesForTool(opts, paths)
+	if err != nil {
+		return state, nil, err
+	}
+	targets := make([]usageTarget, 0, len(names))
+	for _, name := range names {
+		target := usageTarget{name: name}
+		target.cred, target.sourceLabel, target.sourceVerified, target.err = resolveUsageCredential(paths, adapter, name, state, defaultActiveQuery)
+		targets = append(targets, target)
+	}
+	return state, targets, nil
+}
+
+// storeUsageWriteBacks persists refreshed tokens and active-profile syncing
+// under the tool lock. A copy that moved on to newer tokens or another account
+// while usage was being fetched is left alone, as storeRefreshedProfile does
+// for refresh. The server has already spent the old refresh token, so it
+// returns, per fetch, the error that kept rotated tokens from being stored,
+// and separately any failure to update the state file.
+func storeUsageWriteBacks(opts UsageOptions, paths ToolPaths, adapter Adapter, snapshot StateFile, fetches []usageFetch) ([]error, error) {
+	errs := make([]error, len(fetches))
+	if len(fetches) == 0 {
+		return errs, nil
+	}
+	lock, err := acquireLock(paths.LockPath)
+	if err != nil {
+		for i, fetch := range fetches {
+			if fetch.refreshed {
+				errs[i] = err
+			}
+		}
+		return errs, nil
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+
+	lastSuccessProfile := ""
+	resolvedPendingProfile := false
+	for i, fetch := range fetches {
+		target := fetch.target
+		name := target.name
+		if fetch.failed && !fetch.refreshed {
+			continue
+		}
+		switch {
+		case fetch.failed:
+		case name != "__active__":
+			lastSuccessProfile = name
+		case target.sourceVerified && target.sourceLabel != unknownProfileName:
+			lastSuccessProfile = target.sourceLabel
+		}
+
+		if name != "__active__" {
+			if !fetch.refreshed {
+				continue
+			}
+			stored, err := storeRotatedProfileTokens(paths, name, target.cred, fetch.newCred)
+			if err != nil || stored == "" {
+				errs[i] = err
+				continue
+			}
+			name = stored
+			state, _ := loadState(paths)
+			if activeProfileForDisplay(paths, adapter, state) != name {
+				continue
+			}
+			if oa, ok := adapter.(*openClawAdapter); ok {
+				err = oa.WriteWithProfile(paths, name, fetch.newCred)
+			} else {
+				err = adapter.WriteActiveCredential(paths, fetch.newCred)
+			}
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			setActiveProfileTracking(&state, name, fetch.newCred)
+			errs[i] = saveState(paths, state)
+			continue
+		}
+
+		verified := target.sourceVerified && target.sourceLabel != unknownProfileName
+		active, ok, err := adapter.ReadActiveCredential(paths)
+		if err != nil || !ok || active.Refresh != target.cred.Refresh {
+			// Switched away meanwhile; the profile now holds the only copy of
+			// the consumed refresh token, so the rotated one must reach it.
+			if fetch.refreshed && verified {
+				_, errs[i] = storeRotatedProfileTokens(paths, target.sourceLabel, target.cred, fetch.newCred)
+			} else if fetch.refreshed && err != nil && !os.IsNotExist(err) {
+				errs[i] = err
+			}
+			continue
+		}
+		synced := target.cred
+		if fetch.refreshed {
+			synced = fetch.newCred
+			if err := adapter.WriteActiveCredential(paths, fetch.newCred); err != nil {
+				errs[i] = err
+				continue
+			}
+			if state, err := loadState(paths); err == nil && state.ActiveProfile == target.sourceLabel && state.ActiveCredentialHash != "" {
+				setActiveProfileTracking(&state, target.sourceLabel, fetch.newCred)
+				if err := saveState(paths, state); err != nil {
+					errs[i] = err
+				}
+			}
+		}
+		if verified {
+			if !fetch.failed && snapshot.PendingCreateProfile != "" && target.sourceLabel == snapshot.PendingCreateProfile {
+				resolvedPendingProfile = true
+			}
+			if err := saveProfileAs(paths, target.sourceLabel, synced, true, historyOpUsageRefresh); err != nil && fetch.refreshed {
+				errs[i] = err
+			}
+		}
+	}
+
+	state, err := loadState(paths)
+	if err != nil || state.PendingCreateProfile == "" || state.PendingCreateProfile != snapshot.PendingCreateProfile {
+		return errs, err
+	}
+	if !resolvedPendingProfile && (opts.Profile == "" || opts.Profile != state.PendingCreateProfile) {
+		return errs, nil
+	}
+	pendingProfile := state.PendingCreateProfile
+	state.PendingCreateProfile = ""
+	state.PendingCreateSince = ""
+	if opts.Profile != "" {
+		setActiveProfileTracking(&state, opts.Profile, Credential{})
+		state.ActiveCredentialHash = ""
+	} else if lastSuccessProfile != "" {
+		setActiveProfileTracking(&state, lastSuccessProfile, Credential{})
+		state.ActiveCredentialHash = ""
+	} else if state.ActiveProfile == "" {
+		state.ActiveProfile = pendingProfile
+	}
+	return errs, saveState(paths, state)
+}
+
+// storeRotatedProfileTokens saves next under name if the profile still holds
+// the refresh token that was spent to obtain it, or older tokens of the same
+// account, and returns the name it saved under. A profile renamed meanwhile
+// is found by the spent token; one deleted meanwhile is an error, since next
+// is then the only live copy of the account's tokens.
+func storeRotatedProfileTokens(paths ToolPaths, name string, spent Credential, next Credential) (string, error) {
+	current, err := loadProfile(paths, name)
+	if os.IsNotExist(err) {
+		name, current, err = findProfileByRefresh(paths, spent.Refresh)
+		if err != nil {
+			return "", err
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	if current.Refresh != spent.Refresh && !refreshedCredentialApplies(current, next) {
+		return "", nil
+	}
+	if err := saveProfileAs(paths, name, next, true, historyOpUsageRefresh); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func findProfileByRefresh(paths ToolPaths, refresh string) (string, Credential, error) {
+	names, err := listProfiles(paths)
+	if err != nil {
+		return "", Credential{}, err
+	}
+	for _, name := range names {
+		if cred, err := loadProfile(paths, name); err == nil && cred.Refresh == refresh {
+			return name, cred, nil
+		}
+	}
+	return "", Credential{}, fmt.Errorf("no profile holds the spent refresh token any more")
+}
+
 func resolveUsageTools(selected []ToolName) ([]ToolName, error) {
 	if len(selected) == 0 {
-		return append([]ToolName{}, AllTools...), nil
+		return AllTools()
 	}
 	tools := make([]ToolName, 0, len(selected))
 	seen := map[ToolName]struct{}{}
 	for _, tool := range selected {
-		if tool != ToolCodex && tool != ToolOpenCode && tool != ToolOpenClaw {
-			return nil, fmt.Errorf("unsupported tool %s", tool)
+		if _, err := lookupTool(tool); err != nil {
+			return nil, err
 		}
 		if _, ok := seen[tool]; ok {
 			continue
@@ -252,6 +606,10 @@ func selectUsageProfilesForTool(opts UsageOptions, paths ToolPaths) ([]string, e
 		return []string{"__active__"}, nil
 	}
 
+	if opts.Tag != "" {
+		return profilesWithTag(paths, opts.Tag)
+	}
+
 	if len(opts.Tools) > 0 {
 		list, err := listProfiles(paths)
 		if err != nil {
@@ -272,33 +630,69 @@ func selectUsageProfilesForTool(opts UsageOptions, paths ToolPaths) ([]string, e
 }
 
 func shouldMaterializePendingUsageForScopedTools(opts UsageOptions, state StateFile) bool {
-	return opts.Profile == "" && len(opts.Tools) > 0 && !opts.AllProfiles && !opts.ActiveOnly && state.PendingCreateProfile != ""
+	return opts.Profile == "" && opts.Tag == "" && len(opts.Tools) > 0 && !opts.AllProfiles && !opts.ActiveOnly && state.PendingCreateProfile != ""
 }
 
-func materializePendingUsageProfile(client *http.Client, usageURL string, paths ToolPaths, adapter Adapter, state StateFile) (StateFile, error) {
+// materializePendingUsageProfile saves the active credential as the pending
+// profile once usage confirms it works. It returns the pending profile name
+// for error reporting.
+func materializePendingUsageProfile(ctx context.Context, client *http.Client, usageURL string, opts UsageOptions, paths ToolPaths, adapter Adapter) (string, error) {
+	lock, err := acquireLock(paths.LockPath)
+	if err != nil {
+		return "", err
+	}
+	state, _ := loadState(paths)
+	pending := state.PendingCreateProfile
+	if !shouldMaterializePendingUsageForScopedTools(opts, state) {
+		_ = lock.Release()
+		return pending, nil
+	}
 	cred, sourceLabel, sourceVerified, err := resolveUsageCredential(paths, adapter, "__active__", state, true)
+	_ = lock.Release()
 	if err != nil {
-		return state, nil
+		return pending, nil
 	}
-	if !sourceVerified || sourceLabel == unknownProfileName || sourceLabel != state.PendingCreateProfile {
-		return state, nil
+	if !sourceVerified || sourceLabel == unknownProfileName || sourceLabel != pending {
+		return pending, nil
 	}
 
-	_, newCred, refreshed, usageErr := fetchUsageWithRefresh(client, usageURL, cred)
+	_, newCred, refreshed, usageErr := fetchUsageWithRefresh(ctx, client, usageURL, cred)
 	if usageErr != nil {
-		return state, nil
+		return pending, nil
+	}
+
+	lock, err = acquireLock(paths.LockPath)
+	if err != nil {
+		return pending, err
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+	state, err = loadState(paths)
+	if err != nil {
+		return pending, err
+	}
+	active, ok, err := adapter.ReadActiveCredential(paths)
+	if err != nil || !ok || active.Refresh != cred.Refresh || state.PendingCreateProfile != pending {
+		// Switched or re-logged in meanwhile; the next usage run will see it.
+		if refreshed {
+			if _, err := storeRotatedProfileTokens(paths, sourceLabel, cred, newCred); err != nil {
+				return pending, err
+			}
+		}
+		return pending, nil
 	}
 
 	synced := cred
 	if refreshed {
 		synced = newCred
 	}
-	if err := saveProfile(paths, sourceLabel, synced, true); err != nil {
-		return state, err
+	if err := saveProfileAs(paths, sourceLabel, synced, true, historyOpUsageRefresh); err != nil {
+		return pending, err
 	}
 	if refreshed {
 		if err := adapter.WriteActiveCredential(paths, newCred); err != nil {
-			return state, err
+			return pending, err
 		}
 	}
 
@@ -306,9 +700,9 @@ func materializePendingUsageProfile(client *http.Client, usageURL string, paths
 	state.PendingCreateSince = ""
 	setActiveProfileTracking(&state, sourceLabel, synced)
 	if err := saveState(paths, state); err != nil {
-		return state, err
+		return pending, err
 	}
-	return state, nil
+	return pending, nil
 }
 
 func usageProfileLabel(name string) string {
@@ -377,33 +771,33 @@ func credentialsLikelyMatch(a Credential, b Credential) bool {
 	return false
 }
 
-func fetchUsageWithRefresh(client *http.Client, usageURL string, cred Credential) (UsageResult, Credential, bool, error) {
+func fetchUsageWithRefresh(ctx context.Context, client *http.Client, usageURL string, cred Credential) (UsageResult, Credential, bool, error) {
 	current := cred
 	refreshed := false
 	now := time.Now()
 
 	if current.NearExpiry(now, refreshThreshold) {
-		next, err := refreshCredential(client, current)
+		next, err := refreshCredential(ctx, client, current)
 		if err == nil {
 			current = next
 			refreshed = true
 		}
 	}
 
-	result, statusCode, err := fetchUsage(client, usageURL, current)
+	result, statusCode, err := fetchUsage(ctx, client, usageURL, current)
 	if err == nil {
 		return result, current, refreshed, nil
 	}
 
 	if statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden {
-		next, refreshErr := refreshCredential(client, current)
+		next, refreshErr := refreshCredential(ctx, client, current)
 		if refreshErr != nil {
-			return UsageResult{}, cred, refreshed, fmt.Errorf("usage unauthorized and refresh failed: %w", refreshErr)
+			return UsageResult{}, current, refreshed, fmt.Errorf("usage unauthorized and refresh failed: %w", refreshErr)
 		}
 		current = next
 		refreshed = true
 
-		retryResult, _, retryErr := fetchUsage(client, usageURL, current)
+		retryResult, _, retryErr := fetchUsage(ctx, client, usageURL, current)
 		if retryErr != nil {
 			return UsageResult{}, current, refreshed, retryErr
 		}
@@ -413,20 +807,20 @@ func fetchUsageWithRefresh(client *http.Client, usageURL string, cred Credential
 	return UsageResult{}, current, refreshed, err
 }
 
-func fetchUsage(client *http.Client, usageURL string, cred Credential) (UsageResult, int, error) {
-	result, status, err := fetchUsageOnce(client, usageURL, cred)
+func fetchUsage(ctx context.Context, client *http.Client, usageURL string, cred Credential) (UsageResult, int, error) {
+	result, status, err := fetchUsageOnce(ctx, client, usageURL, cred)
 	if err == nil {
 		return result, status, nil
 	}
 	if status == http.StatusNotFound && strings.Contains(usageURL, "/wham/usage") {
 		fallbackURL := strings.Replace(usageURL, "/wham/usage", "/api/codex/usage", 1)
-		return fetchUsageOnce(client, fallbackURL, cred)
+		return fetchUsageOnce(ctx, client, fallbackURL, cred)
 	}
 	return UsageResult{}, status, err
 }
 
-func fetchUsageOnce(client *http.Client, usageURL string, cred Credential) (UsageResult, int, error) {
-	req, err := http.NewRequest(http.MethodGet, usageURL, nil)
+func fetchUsageOnce(ctx context.Context, client *http.Client, usageURL string, cred Credential) (UsageResult, int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, usageURL, nil)
 	if err != nil {
 		return UsageResult{}, 0, err
 	}
@@ -520,7 +914,7 @@ func normalizeUsage(body []byte) (UsageResult, error) {
 	}, nil
 }
 
-func refreshCredential(client *http.Client, cred Credential) (Credential, error) {
+func refreshCredential(ctx context.Context, client *http.Client, cred Credential) (Credential, error) {
 	if cred.Refresh == "" {
 		return Credential{}, fmt.Errorf("missing refresh token")
 	}
@@ -531,17 +925,29 @@ func refreshCredential(client *http.Client, cred Credential) (Credential, error)
 	values.Set("client_id", oauthClientID)
 	values.Set("scope", "openid profile email")
 
-	req, err := http.NewRequest(http.MethodPost, refreshURL, bytes.NewBufferString(values.Encode()))
+	body, err := postTokenRequest(ctx, client, values, "refresh")
 	if err != nil {
 		return Credential{}, err
 	}
+	return credentialFromTokenResponse(body, cred, "refresh")
+}
+
+func oauthTokenURL() string {
+	return firstNonEmpty(strings.TrimSpace(os.Getenv("CODEX_SWITCHER_TOKEN_URL")), defaultTokenURL)
+}
+
+func postTokenRequest(ctx context.Context, client *http.Client, values url.Values, operation string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, oauthTokenURL(), bytes.NewBufferString(values.Encode()))
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Accept", "application/json")
 	req.Header.Set("User-Agent", "codex-switcher")
 
 	res, err := client.Do(req)
 	if err != nil {
-		return Credential{}, err
+		return nil, err
 	}
 	defer res.Body.Close()
 	body, _ := io.ReadAll(io.LimitReader(res.Body, 2*1024*1024))
@@ -551,20 +957,44 @@ func refreshCredential(client *http.Client, cred Credential) (Credential, error)
 		if msg == "" {
 			msg = http.StatusText(res.StatusCode)
 		}
-		return Credential{}, fmt.Errorf("refresh failed (%d): %s", res.StatusCode, msg)
+		return nil, &tokenEndpointError{Operation: operation, StatusCode: res.StatusCode, Message: msg}
 	}
+	return body, nil
+}
+
+type tokenEndpointError struct {
+	Operation  string
+	StatusCode int
+	Message    string
+}
 
+func (e *tokenEndpointError) Error() string {
+	return fmt.Sprintf("%s failed (%d): %s", e.Operation, e.StatusCode, e.Message)
+}
+
+func isTokenRejected(err error) bool {
+	var endpointErr *tokenEndpointError
+	if !errors.As(err, &endpointErr) {
+		return false
+	}
+	return endpointErr.StatusCode == http.StatusBadRequest || endpointErr.StatusCode == http.StatusUnauthorized || endpointErr.StatusCode == http.StatusForbidden
+}
+
+func credentialFromTokenResponse(body []byte, previous Credential, operation string) (Credential, error) {
 	var payload map[string]any
 	if err := json.Unmarshal(body, &payload); err != nil {
 		return Credential{}, err
 	}
 	access, _ := payload["access_token"].(string)
 	if access == "" {
-		return Credential{}, fmt.Errorf("refresh response missing access_token")
+		return Credential{}, fmt.Errorf("%s response missing access_token", operation)
 	}
 	refresh, _ := payload["refresh_token"].(string)
 	if refresh == "" {
-		refresh = cred.Refresh
+		refresh = previous.Refresh
+	}
+	if refresh == "" {
+		return Credential{}, fmt.Errorf("%s response missing refresh_token", operation)
 	}
 	idToken, _ := payload["id_token"].(string)
 	expiresIn := toInt64(payload["expires_in"])
@@ -573,8 +1003,8 @@ func refreshCredential(client *http.Client, cred Credential) (Credential, error)
 	}
 	expires := time.Now().Add(time.Duration(expiresIn) * time.Second).UnixMilli()
 
-	accountID := cred.AccountID
-	email := cred.Email
+	accountID := previous.AccountID
+	email := previous.Email
 	claims := parseJWTClaims(idToken)
 	if claims == nil {
 		claims = parseJWTClaims(access)
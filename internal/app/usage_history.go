@@ -0,0 +1,359 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	usageHistoryFileName     = "usage-history.jsonl"
+	usageHistoryLockName     = "usage-history.lock"
+	usageLatestFileName      = "usage-latest.json"
+	usageHistoryCompactAt    = 4 * 1024 * 1024
+	usageHistoryRawRetention = 7 * 24 * time.Hour
+	usageHistoryMaxRetention = 180 * 24 * time.Hour
+	usageWindowResetSlack    = 10 * time.Minute
+)
+
+type UsageSample struct {
+	At             int64         `json:"at"`
+	Tool           ToolName      `json:"tool"`
+	Profile        string        `json:"profile"`
+	AccountID      string        `json:"accountId,omitempty"`
+	Plan           string        `json:"plan,omitempty"`
+	CreditsBalance *float64      `json:"creditsBalance,omitempty"`
+	Windows        []UsageWindow `json:"windows"`
+}
+
+type UsageHistoryOptions struct {
+	Tools   []ToolName
+	Profile string
+	Window  string
+	Since   time.Duration
+}
+
+type UsageSeriesPoint struct {
+	At          int64   `json:"at"`
+	UsedPercent float64 `json:"usedPercent"`
+	ResetAt     int64   `json:"resetAt,omitempty"`
+}
+
+type UsageSeries struct {
+	Tool    ToolName           `json:"tool"`
+	Profile string             `json:"profile"`
+	Window  string             `json:"window"`
+	Points  []UsageSeriesPoint `json:"points"`
+}
+
+type UsageDailyAggregate struct {
+	Day      string   `json:"day"`
+	Tool     ToolName `json:"tool"`
+	Profile  string   `json:"profile"`
+	Window   string   `json:"window"`
+	Samples  int      `json:"samples"`
+	Min      float64  `json:"min"`
+	Max      float64  `json:"max"`
+	Avg      float64  `json:"avg"`
+	Consumed float64  `json:"consumed"`
+}
+
+type UsagePeak struct {
+	Tool        ToolName `json:"tool"`
+	Profile     string   `json:"profile"`
+	Window      string   `json:"window"`
+	UsedPercent float64  `json:"usedPercent"`
+	At          int64    `json:"at"`
+}
+
+type UsageHistoryReport struct {
+	Path   string                `json:"path"`
+	Series []UsageSeries         `json:"series"`
+	Daily  []UsageDailyAggregate `json:"daily"`
+	Peaks  []UsagePeak           `json:"peaks"`
+}
+
+func resolveUsageHistoryPath() (string, error) {
+	dataDir, err := resolveSwitcherDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, usageHistoryFileName), nil
+}
+
+// RecordUsage appends every successful usage result to the history store,
+// refreshes the latest-sample cache read by `prompt`, and compacts the store
+// once it grows past usageHistoryCompactAt.
+func (s *Service) RecordUsage(results []UsageResult, at time.Time) error {
+	path, err := resolveUsageHistoryPath()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	samples := make([]UsageSample, 0, len(results))
+	for _, item := range results {
+		if !item.HasUsage() || len(item.Windows) == 0 {
+			continue
+		}
+		sample := UsageSample{
+			At:             at.UnixMilli(),
+			Tool:           item.Tool,
+			Profile:        item.Profile,
+			AccountID:      item.AccountID,
+			Plan:           item.Plan,
+			CreditsBalance: item.CreditsBalance,
+			Windows:        item.Windows,
+		}
+		line, err := json.Marshal(sample)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		samples = append(samples, sample)
+	}
+	if buf.Len() == 0 {
+		return nil
+	}
+
+	lock, err := acquireLock(filepath.Join(filepath.Dir(path), usageHistoryLockName))
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if err := updateLatestUsage(filepath.Join(filepath.Dir(path), usageLatestFileName), samples); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Size() < usageHistoryCompactAt {
+		return err
+	}
+	return compactUsageHistory(path, at)
+}
+
+func latestUsageKey(tool ToolName, profile string) string {
+	return string(tool) + "/" + profile
+}
+
+func updateLatestUsage(path string, samples []UsageSample) error {
+	latest, err := readLatestUsage(path)
+	if err != nil {
+		// The cache is rebuilt from the next samples; a damaged copy is not worth failing over.
+		latest = map[string]UsageSample{}
+	}
+	for _, sample := range samples {
+		key := latestUsageKey(sample.Tool, sample.Profile)
+		if current, ok := latest[key]; ok && current.At > sample.At {
+			continue
+		}
+		latest[key] = sample
+	}
+	return writeJSONAtomic(path, latest)
+}
+
+// readLatestUsage returns the most recent recorded sample per tool and
+// profile, keyed by latestUsageKey.
+func readLatestUsage(path string) (map[string]UsageSample, error) {
+	latest := map[string]UsageSample{}
+	if err := readJSONFile(path, &latest); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return latest, nil
+}
+
+func readUsageHistory(path string) ([]UsageSample, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	samples := []UsageSample{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var sample UsageSample
+		if err := json.Unmarshal(line, &sample); err != nil {
+			// A torn final line from an interrupted append is skipped rather
+			// than making the whole history unreadable.
+			continue
+		}
+		samples = append(samples, sample)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(samples, func(i, j int) bool { return samples[i].At < samples[j].At })
+	return samples, nil
+}
+
+// compactUsageHistory keeps raw samples for the last week, thins older ones
+// to the last sample per tool/profile/hour and drops anything past retention.
+func compactUsageHistory(path string, now time.Time) error {
+	samples, err := readUsageHistory(path)
+	if err != nil {
+		return err
+	}
+	rawCutoff := now.Add(-usageHistoryRawRetention).UnixMilli()
+	dropCutoff := now.Add(-usageHistoryMaxRetention).UnixMilli()
+
+	hourly := map[string]int{}
+	kept := make([]UsageSample, 0, len(samples))
+	for _, sample := range samples {
+		switch {
+		case sample.At < dropCutoff:
+			continue
+		case sample.At < rawCutoff:
+			key := fmt.Sprintf("%s\x00%s\x00%d", sample.Tool, sample.Profile, sample.At/int64(time.Hour/time.Millisecond))
+			if idx, ok := hourly[key]; ok {
+				kept[idx] = sample
+				continue
+			}
+			hourly[key] = len(kept)
+		}
+		kept = append(kept, sample)
+	}
+
+	var buf bytes.Buffer
+	for _, sample := range kept {
+		line, err := json.Marshal(sample)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	return writeFileAtomic(path, buf.Bytes(), 0o600)
+}
+
+func (s *Service) UsageHistory(opts UsageHistoryOptions) (UsageHistoryReport, error) {
+	path, err := resolveUsageHistoryPath()
+	if err != nil {
+		return UsageHistoryReport{}, WrapExit(ExitIOFailure, err)
+	}
+	samples, err := readUsageHistory(path)
+	if err != nil {
+		return UsageHistoryReport{}, WrapExit(ExitIOFailure, err)
+	}
+	return buildUsageHistoryReport(path, filterUsageSamples(samples, opts, time.Now()), opts.Window), nil
+}
+
+func filterUsageSamples(samples []UsageSample, opts UsageHistoryOptions, now time.Time) []UsageSample {
+	tools := map[ToolName]struct{}{}
+	for _, tool := range opts.Tools {
+		tools[tool] = struct{}{}
+	}
+	cutoff := int64(0)
+	if opts.Since > 0 {
+		cutoff = now.Add(-opts.Since).UnixMilli()
+	}
+	out := make([]UsageSample, 0, len(samples))
+	for _, sample := range samples {
+		if sample.At < cutoff {
+			continue
+		}
+		if opts.Profile != "" && sample.Profile != opts.Profile {
+			continue
+		}
+		if len(tools) > 0 {
+			if _, ok := tools[sample.Tool]; !ok {
+				continue
+			}
+		}
+		out = append(out, sample)
+	}
+	return out
+}
+
+func buildUsageHistoryReport(path string, samples []UsageSample, windowFilter string) UsageHistoryReport {
+	report := UsageHistoryReport{Path: path, Series: []UsageSeries{}, Daily: []UsageDailyAggregate{}, Peaks: []UsagePeak{}}
+
+	seriesIndex := map[string]int{}
+	for _, sample := range samples {
+		for _, window := range sample.Windows {
+			if windowFilter != "" && window.Label != windowFilter {
+				continue
+			}
+			key := string(sample.Tool) + "\x00" + sample.Profile + "\x00" + window.Label
+			idx, ok := seriesIndex[key]
+			if !ok {
+				idx = len(report.Series)
+				seriesIndex[key] = idx
+				report.Series = append(report.Series, UsageSeries{Tool: sample.Tool, Profile: sample.Profile, Window: window.Label})
+			}
+			report.Series[idx].Points = append(report.Series[idx].Points, UsageSeriesPoint{At: sample.At, UsedPercent: window.UsedPercent, ResetAt: window.ResetAt})
+		}
+	}
+	sort.SliceStable(report.Series, func(i, j int) bool {
+		a, b := report.Series[i], report.Series[j]
+		if a.Tool != b.Tool {
+			return a.Tool < b.Tool
+		}
+		if a.Profile != b.Profile {
+			return a.Profile < b.Profile
+		}
+		return a.Window < b.Window
+	})
+
+	for _, series := range report.Series {
+		peak := UsagePeak{Tool: series.Tool, Profile: series.Profile, Window: series.Window}
+		dayIdx := -1
+		for i, point := range series.Points {
+			if point.UsedPercent >= peak.UsedPercent {
+				peak.UsedPercent = point.UsedPercent
+				peak.At = point.At
+			}
+			dayKey := time.UnixMilli(point.At).Local().Format("2006-01-02")
+			if dayIdx < 0 || report.Daily[dayIdx].Day != dayKey {
+				report.Daily = append(report.Daily, UsageDailyAggregate{Day: dayKey, Tool: series.Tool, Profile: series.Profile, Window: series.Window, Min: point.UsedPercent, Max: point.UsedPercent})
+				dayIdx = len(report.Daily) - 1
+			}
+			day := &report.Daily[dayIdx]
+			day.Samples++
+			day.Min = min(day.Min, point.UsedPercent)
+			day.Max = max(day.Max, point.UsedPercent)
+			day.Avg += (point.UsedPercent - day.Avg) / float64(day.Samples)
+			if i > 0 {
+				day.Consumed += usageConsumedSince(series.Points[i-1], point)
+			}
+		}
+		report.Peaks = append(report.Peaks, peak)
+	}
+	return report
+}
+
+// usageConsumedSince is the window usage burnt between two samples; a reset in
+// between means everything used in the new window was consumed since then.
+func usageConsumedSince(previous UsageSeriesPoint, current UsageSeriesPoint) float64 {
+	windowReset := current.ResetAt != 0 && previous.ResetAt != 0 && current.ResetAt-previous.ResetAt > usageWindowResetSlack.Milliseconds()
+	if windowReset || current.UsedPercent < previous.UsedPercent {
+		return current.UsedPercent
+	}
+	return current.UsedPercent - previous.UsedPercent
+}
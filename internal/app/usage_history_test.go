@@ -0,0 +1,109 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func usageSampleResult(profile string, used float64, resetAt int64) UsageResult {
+	return UsageResult{
+		Tool:     ToolCodex,
+		Profile:  profile,
+		Provider: "openai-codex",
+		Status:   "ok",
+		Windows:  []UsageWindow{{Label: "5h", UsedPercent: used, ResetAt: resetAt}},
+	}
+}
+
+func TestRecordUsageBuildsDailyAggregatesAndPeaks(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+	t.Setenv("CODEX_SWITCHER_DATA_DIR", dataDir)
+
+	svc := NewService()
+	base := time.Now().Add(-2 * time.Hour)
+	firstReset := base.Add(time.Hour).UnixMilli()
+	secondReset := base.Add(6 * time.Hour).UnixMilli()
+	ticks := []struct {
+		offset time.Duration
+		used   float64
+		reset  int64
+	}{
+		{0, 10, firstReset},
+		{20 * time.Minute, 40, firstReset},
+		{40 * time.Minute, 70, firstReset},
+		{80 * time.Minute, 15, secondReset},
+	}
+	for _, tick := range ticks {
+		results := []UsageResult{
+			usageSampleResult("work", tick.used, tick.reset),
+			{Tool: ToolCodex, Profile: "broken", Status: "error", Error: "boom"},
+		}
+		if err := svc.RecordUsage(results, base.Add(tick.offset)); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+
+	report, err := svc.UsageHistory(UsageHistoryOptions{Profile: "work", Since: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("usage history: %v", err)
+	}
+	if len(report.Series) != 1 || len(report.Series[0].Points) != 4 {
+		t.Fatalf("expected one series with four points, got %+v", report.Series)
+	}
+	if len(report.Peaks) != 1 || report.Peaks[0].UsedPercent != 70 {
+		t.Fatalf("unexpected peaks %+v", report.Peaks)
+	}
+	consumed := 0.0
+	for _, day := range report.Daily {
+		consumed += day.Consumed
+	}
+	if consumed != 75 {
+		t.Fatalf("expected 60%% burnt before reset plus 15%% after, got %v (%+v)", consumed, report.Daily)
+	}
+
+	other, err := svc.UsageHistory(UsageHistoryOptions{Profile: "broken"})
+	if err != nil {
+		t.Fatalf("usage history: %v", err)
+	}
+	if len(other.Series) != 0 {
+		t.Fatalf("expected failed results not recorded, got %+v", other.Series)
+	}
+}
+
+func TestCompactUsageHistoryThinsOldSamples(t *testing.T) {
+	path := filepath.Join(t.TempDir(), usageHistoryFileName)
+	t.Setenv("CODEX_SWITCHER_DATA_DIR", filepath.Dir(path))
+	svc := NewService()
+	now := time.Now()
+	hourStart := now.Add(-10 * 24 * time.Hour).Truncate(time.Hour)
+	for _, at := range []time.Time{
+		now.Add(-200 * 24 * time.Hour),
+		hourStart.Add(5 * time.Minute),
+		hourStart.Add(35 * time.Minute),
+		now.Add(-time.Hour),
+		now.Add(-30 * time.Minute),
+	} {
+		if err := svc.RecordUsage([]UsageResult{usageSampleResult("work", 50, 0)}, at); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+
+	if err := compactUsageHistory(path, now); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	samples, err := readUsageHistory(path)
+	if err != nil {
+		t.Fatalf("read history: %v", err)
+	}
+	if len(samples) != 3 {
+		t.Fatalf("expected expired sample dropped and old hour thinned, got %d samples", len(samples))
+	}
+	if samples[0].At != hourStart.Add(35*time.Minute).UnixMilli() {
+		t.Fatalf("expected the last sample of the old hour kept, got %+v", samples[0])
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("expected private history file, got %v %v", info, err)
+	}
+}
@@ -1,10 +1,15 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestUsageDefaultMaterializesPendingCreateProfile(t *testing.T) {
@@ -60,7 +65,7 @@ func TestUsageDefaultMaterializesPendingCreateProfile(t *testing.T) {
 	}
 
 	svc := NewService()
-	results, err := svc.Usage(UsageOptions{})
+	results, err := svc.Usage(context.Background(), UsageOptions{})
 	if err != nil {
 		t.Fatalf("usage failed: %v", err)
 	}
@@ -144,7 +149,7 @@ func TestUsageWithExplicitToolsMaterializesPendingCreateProfileAndPreservesSaved
 	}
 
 	svc := NewService()
-	results, err := svc.Usage(UsageOptions{Tools: []ToolName{ToolCodex}})
+	results, err := svc.Usage(context.Background(), UsageOptions{Tools: []ToolName{ToolCodex}})
 	if err != nil {
 		t.Fatalf("usage failed: %v", err)
 	}
@@ -231,7 +236,7 @@ func TestUsageWithExplicitToolsMaterializesPendingCreateProfileForOpenCodeWithou
 	}
 
 	svc := NewService()
-	results, err := svc.Usage(UsageOptions{Tools: []ToolName{ToolOpenCode}})
+	results, err := svc.Usage(context.Background(), UsageOptions{Tools: []ToolName{ToolOpenCode}})
 	if err != nil {
 		t.Fatalf("usage failed: %v", err)
 	}
@@ -313,7 +318,7 @@ func TestUsageWithExplicitToolsActiveOnlyShowsOnlyActiveProfile(t *testing.T) {
 	}
 
 	svc := NewService()
-	results, err := svc.Usage(UsageOptions{Tools: []ToolName{ToolCodex}, ActiveOnly: true})
+	results, err := svc.Usage(context.Background(), UsageOptions{Tools: []ToolName{ToolCodex}, ActiveOnly: true})
 	if err != nil {
 		t.Fatalf("usage failed: %v", err)
 	}
@@ -368,7 +373,7 @@ func TestUsageAllProfilesDoesNotClearPendingCreateFromOtherProfileQuery(t *testi
 	}
 
 	svc := NewService()
-	results, err := svc.Usage(UsageOptions{Tools: []ToolName{ToolCodex}, AllProfiles: true})
+	results, err := svc.Usage(context.Background(), UsageOptions{Tools: []ToolName{ToolCodex}, AllProfiles: true})
 	if err != nil {
 		t.Fatalf("usage failed: %v", err)
 	}
@@ -461,7 +466,7 @@ func TestUsageDefaultDoesNotTrustStaleActiveProfileLabel(t *testing.T) {
 	}
 
 	svc := NewService()
-	results, err := svc.Usage(UsageOptions{})
+	results, err := svc.Usage(context.Background(), UsageOptions{})
 	if err != nil {
 		t.Fatalf("usage failed: %v", err)
 	}
@@ -536,7 +541,7 @@ func TestUsageDefaultOpenClawDoesNotTrustStaleStateLabel(t *testing.T) {
 	}
 
 	svc := NewService()
-	results, err := svc.Usage(UsageOptions{})
+	results, err := svc.Usage(context.Background(), UsageOptions{})
 	if err != nil {
 		t.Fatalf("usage failed: %v", err)
 	}
@@ -605,7 +610,7 @@ func TestUsageDefaultOpenClawUsesVerifiedStateTracking(t *testing.T) {
 	}
 
 	svc := NewService()
-	results, err := svc.Usage(UsageOptions{})
+	results, err := svc.Usage(context.Background(), UsageOptions{})
 	if err != nil {
 		t.Fatalf("usage failed: %v", err)
 	}
@@ -671,7 +676,7 @@ func TestUsageDefaultOpenClawAmbiguousMatchReturnsUnknown(t *testing.T) {
 	}
 
 	svc := NewService()
-	results, err := svc.Usage(UsageOptions{})
+	results, err := svc.Usage(context.Background(), UsageOptions{})
 	if err != nil {
 		t.Fatalf("usage failed: %v", err)
 	}
@@ -686,3 +691,207 @@ func TestUsageDefaultOpenClawAmbiguousMatchReturnsUnknown(t *testing.T) {
 	}
 	t.Fatalf("expected openclaw usage result, got %+v", results)
 }
+
+func TestUsageDeduplicatesSharedCredentialsAndBoundsConcurrency(t *testing.T) {
+	setupVaultTestHome(t)
+	var mu sync.Mutex
+	hits := map[string]int{}
+	inFlight, maxInFlight := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.Header.Get("Authorization")]++
+		inFlight++
+		maxInFlight = max(maxInFlight, inFlight)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"plan_type":"plus","rate_limit":{"primary_window":{"limit_window_seconds":18000,"used_percent":1,"reset_at":1773000000}}}`))
+	}))
+	defer server.Close()
+	t.Setenv("CODEX_SWITCHER_USAGE_URL", server.URL+"/backend-api/wham/usage")
+
+	tools := []ToolName{ToolCodex, ToolOpenCode}
+	for _, tool := range tools {
+		paths := mustToolPaths(t, tool)
+		if err := saveProfile(paths, "shared", Credential{Provider: "openai-codex", Access: "shared-access", Refresh: "shared-refresh", AccountID: "acct-shared"}, true); err != nil {
+			t.Fatalf("save shared: %v", err)
+		}
+		for _, name := range []string{"a", "b", "c"} {
+			access := string(tool) + "-" + name + "-access"
+			if err := saveProfile(paths, name, Credential{Provider: "openai-codex", Access: access, Refresh: access + "-refresh", AccountID: "acct-" + string(tool) + "-" + name}, true); err != nil {
+				t.Fatalf("save %s: %v", name, err)
+			}
+		}
+	}
+
+	results, err := NewService().Usage(context.Background(), UsageOptions{Tools: tools, AllProfiles: true, Concurrency: 2})
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	if len(results) != 8 {
+		t.Fatalf("expected a result per profile, got %+v", results)
+	}
+	for i, result := range results {
+		if result.Status != "ok" {
+			t.Fatalf("expected ok, got %+v", result)
+		}
+		if i > 0 && (results[i-1].Tool > result.Tool || results[i-1].Tool == result.Tool && results[i-1].Profile > result.Profile) {
+			t.Fatalf("expected results sorted by tool and profile, got %+v", results)
+		}
+	}
+	if hits["Bearer shared-access"] != 1 || len(hits) != 7 {
+		t.Fatalf("expected the shared credential queried once, got %v", hits)
+	}
+	if maxInFlight > 2 {
+		t.Fatalf("expected at most 2 requests in flight, got %d", maxInFlight)
+	}
+}
+
+func TestUsageCancellationAbortsInFlightRequests(t *testing.T) {
+	setupVaultTestHome(t)
+	started := make(chan struct{}, 8)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-r.Context().Done():
+		case <-time.After(5 * time.Second):
+		}
+	}))
+	defer server.Close()
+	t.Setenv("CODEX_SWITCHER_USAGE_URL", server.URL+"/backend-api/wham/usage")
+	paths := mustToolPaths(t, ToolCodex)
+	if err := saveProfile(paths, "work", Credential{Provider: "openai-codex", Access: "work-access", Refresh: "work-refresh"}, true); err != nil {
+		t.Fatalf("save: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	begin := time.Now()
+	_, err := NewService().Usage(ctx, UsageOptions{Tools: []ToolName{ToolCodex}, AllProfiles: true})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+	if elapsed := time.Since(begin); elapsed > 2*time.Second {
+		t.Fatalf("expected the in-flight request aborted, took %s", elapsed)
+	}
+}
+
+func TestUsageQueriesEachAccountOnceAndGroupsProfiles(t *testing.T) {
+	setupVaultTestHome(t)
+	var mu sync.Mutex
+	hits := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		access := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		mu.Lock()
+		hits[access]++
+		mu.Unlock()
+		if access == "stale-access" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write([]byte(`{"plan_type":"plus","rate_limit":{"primary_window":{"limit_window_seconds":18000,"used_percent":40,"reset_at":1773000000}}}`))
+	}))
+	defer server.Close()
+	t.Setenv("CODEX_SWITCHER_USAGE_URL", server.URL+"/backend-api/wham/usage")
+
+	// The same account holds different tokens in each tool; the freshest
+	// copy fails, so the next one answers for the rest.
+	future := time.Now().Add(time.Hour).UnixMilli()
+	copies := map[ToolName]Credential{
+		ToolCodex:    {Provider: "openai-codex", Access: "codex-access", Refresh: "codex-refresh", AccountID: "acct-work", Expires: future + 2},
+		ToolOpenCode: {Provider: "openai-codex", Access: "stale-access", Refresh: "stale-refresh", AccountID: "acct-work", Expires: future + 3},
+		ToolOpenClaw: {Provider: "openai-codex", Access: "openclaw-access", Refresh: "openclaw-refresh", AccountID: "acct-work", Expires: future + 1},
+	}
+	for tool, cred := range copies {
+		if err := saveProfile(mustToolPaths(t, tool), "work", cred, true); err != nil {
+			t.Fatalf("save %s: %v", tool, err)
+		}
+	}
+	if err := saveProfile(mustToolPaths(t, ToolCodex), "personal", Credential{Provider: "openai-codex", Access: "personal-access", Refresh: "personal-refresh", AccountID: "acct-personal"}, true); err != nil {
+		t.Fatalf("save personal: %v", err)
+	}
+
+	results, err := NewService().Usage(context.Background(), UsageOptions{AllProfiles: true})
+	if err != nil {
+		t.Fatalf("usage: %v", err)
+	}
+	if hits["stale-access"] != 1 || hits["codex-access"] != 1 || hits["openclaw-access"] != 0 || hits["personal-access"] != 1 {
+		t.Fatalf("expected each account queried once after skipping the failed copy, got %v", hits)
+	}
+	want := map[ToolName]string{ToolCodex: "ok", ToolOpenCode: "error", ToolOpenClaw: "shared"}
+	for _, result := range results {
+		if result.Profile == "personal" {
+			continue
+		}
+		if result.Status != want[result.Tool] || result.HasUsage() && result.Windows[0].UsedPercent != 40 {
+			t.Fatalf("expected %s copy %s, got %+v", result.Tool, want[result.Tool], result)
+		}
+	}
+
+	// The failed copy keeps its own row; it says nothing about the account.
+	accounts := GroupUsageByAccount(results)
+	if len(accounts) != 3 {
+		t.Fatalf("expected three rows, got %+v", accounts)
+	}
+	if accounts[0].AccountID != "acct-personal" || len(accounts[0].Profiles) != 1 {
+		t.Fatalf("expected personal alone, got %+v", accounts[0])
+	}
+	work := accounts[1]
+	if work.AccountID != "acct-work" || work.Status != "ok" || len(work.Profiles) != 2 || work.Profiles[0].Tool != ToolCodex || work.Profiles[1].Tool != ToolOpenClaw || !work.Profiles[1].Shared {
+		t.Fatalf("expected work served by codex and shared with openclaw, got %+v", work)
+	}
+	candidates := rankRotateCandidates(results, "")
+	for _, c := range candidates {
+		if c.Profile == "work" && !c.Eligible {
+			t.Fatalf("expected work eligible through its verified codex copy, got %+v", c)
+		}
+	}
+	var shared UsageResult
+	for _, result := range results {
+		if result.Status == "shared" {
+			shared = result
+		}
+	}
+	if onlyShared := rankRotateCandidates([]UsageResult{shared}, ""); onlyShared[0].Eligible {
+		t.Fatalf("expected a profile with only a shared copy not eligible, got %+v", onlyShared)
+	}
+	if accounts[2].Status != "error" || accounts[2].Profiles[0].Tool != ToolOpenCode {
+		t.Fatalf("expected the failed opencode copy separate, got %+v", accounts[2])
+	}
+	if cred, err := loadProfile(mustToolPaths(t, ToolOpenClaw), "work"); err != nil || cred.Refresh != "openclaw-refresh" {
+		t.Fatalf("expected unqueried copy untouched, got %+v %v", cred, err)
+	}
+}
+
+func TestUsageWriteBacksFollowRenamesAndReportLostTokens(t *testing.T) {
+	setupVaultTestHome(t)
+	paths := mustToolPaths(t, ToolOpenCode)
+	adapter := mustAdapter(t, ToolOpenCode)
+	spent := Credential{Provider: "openai-codex", Access: "a1", Refresh: "r1", AccountID: "acct-spare"}
+	next := Credential{Provider: "openai-codex", Access: "a2", Refresh: "r2", AccountID: "acct-spare"}
+	if err := saveProfile(paths, "spare-renamed", spent, true); err != nil {
+		t.Fatalf("save renamed copy: %v", err)
+	}
+	fetches := []usageFetch{
+		{target: usageTarget{name: "spare", cred: spent}, newCred: next, refreshed: true},
+		{target: usageTarget{name: "gone", cred: Credential{Provider: "openai-codex", Access: "g1", Refresh: "g1r", AccountID: "acct-gone"}}, newCred: next, refreshed: true},
+	}
+	errs, err := storeUsageWriteBacks(UsageOptions{}, paths, adapter, StateFile{}, fetches)
+	if err != nil {
+		t.Fatalf("state update: %v", err)
+	}
+	if errs[0] != nil {
+		t.Fatalf("expected the renamed profile found by its spent token, got %v", errs[0])
+	}
+	if saved, _ := loadProfile(paths, "spare-renamed"); saved.Refresh != "r2" {
+		t.Fatalf("expected rotated tokens saved under the new name, got %+v", saved)
+	}
+	if errs[1] == nil {
+		t.Fatalf("expected tokens of a deleted profile reported as lost")
+	}
+}
@@ -16,8 +16,11 @@ func toInt64(value any) int64 {
 	case float64:
 		return int64(v)
 	case json.Number:
-		i, _ := v.Int64()
-		return i
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return int64(f)
 	case string:
 		if v == "" {
 			return 0
@@ -0,0 +1,436 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+type VaultMigrationResult struct {
+	Profile    string     `json:"profile"`
+	Tools      []ToolName `json:"tools"`
+	SourceTool ToolName   `json:"sourceTool,omitempty"`
+	AccountID  string     `json:"accountId,omitempty"`
+	Status     string     `json:"status"`
+	Warning    string     `json:"warning,omitempty"`
+}
+
+type VaultStatus struct {
+	Dir      string   `json:"dir"`
+	Enabled  bool     `json:"enabled"`
+	Profiles []string `json:"profiles,omitempty"`
+}
+
+func resolveSwitcherDataDir() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	if override := strings.TrimSpace(os.Getenv("CODEX_SWITCHER_DATA_DIR")); override != "" {
+		return resolvePathWithHome(override, home), nil
+	}
+	xdgData := firstNonEmpty(os.Getenv("XDG_DATA_HOME"), filepath.Join(home, ".local", "share"))
+	return filepath.Join(resolvePathWithHome(xdgData, home), "codex-switcher"), nil
+}
+
+func resolveVaultDir() (string, error) {
+	dataDir, err := resolveSwitcherDataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, "vault"), nil
+}
+
+// activeVaultDir returns the vault directory once it has been created by
+// `vault migrate`; until then profiles live only in the per-tool directories.
+func activeVaultDir() (string, bool) {
+	dir, err := resolveVaultDir()
+	if err != nil {
+		return "", false
+	}
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+	return dir, true
+}
+
+// vaultLockName is the lock guarding the vault. Every tool writes the vault
+// under only its own lock, so read-compare-write sequences on vault entries
+// take this one too. It is taken after any tool locks and never nested.
+const vaultLockName = "vault.lock"
+
+func acquireVaultLock() (*FileLock, error) {
+	dataDir, err := resolveSwitcherDataDir()
+	if err != nil {
+		return nil, err
+	}
+	return acquireLock(filepath.Join(dataDir, vaultLockName))
+}
+
+func vaultProfilePath(dir string, name string) string {
+	return filepath.Join(dir, profilePrefix+name+profileSuffix)
+}
+
+func readProfileFile(path string) (ProfileFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ProfileFile{}, err
+	}
+	content, _, err = decryptProfileContent(content)
+	if err != nil {
+		return ProfileFile{}, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	var p ProfileFile
+	if err := json.Unmarshal(content, &p); err != nil {
+		return ProfileFile{}, err
+	}
+	if p.Version > profileFileVersion {
+		return ProfileFile{}, fmt.Errorf("%s: profile format version %d is newer than this codex-switcher supports", filepath.Base(path), p.Version)
+	}
+	return p, nil
+}
+
+func profileFilesEquivalent(a ProfileFile, b ProfileFile) bool {
+	return a.Provider == b.Provider && a.Access == b.Access && a.Refresh == b.Refresh && a.Expires == b.Expires && a.AccountID == b.AccountID && a.IDToken == b.IDToken && a.Email == b.Email && profileMetadataEqual(a.ProfileMetadata, b.ProfileMetadata)
+}
+
+func profileMetadataEqual(a ProfileMetadata, b ProfileMetadata) bool {
+	return a.Label == b.Label && a.Note == b.Note && a.Owner == b.Owner && a.Plan == b.Plan && a.CreatedAt == b.CreatedAt && stringSliceEqual(a.Tags, b.Tags)
+}
+
+func credentialFromProfileFile(p ProfileFile) Credential {
+	return Credential{
+		Provider:  p.Provider,
+		Access:    p.Access,
+		Refresh:   p.Refresh,
+		Expires:   p.Expires,
+		AccountID: p.AccountID,
+		IDToken:   p.IDToken,
+		Email:     p.Email,
+		UpdatedAt: p.UpdatedAt,
+	}
+}
+
+// credentialFresher reports whether a should be preferred over b as the
+// current copy of the same account's tokens.
+func credentialFresher(a Credential, b Credential) bool {
+	aExpires, bExpires := a.ExpiresAt(), b.ExpiresAt()
+	if aExpires != bExpires && aExpires > 0 && bExpires > 0 {
+		return aExpires > bExpires
+	}
+	return a.UpdatedAt > b.UpdatedAt
+}
+
+// vaultAccountMismatchError reports a tool's cached profile and the vault
+// entry of the same name holding different accounts. Neither copy is trusted
+// until one of them is renamed.
+type vaultAccountMismatchError struct {
+	tool          ToolName
+	profile       string
+	cachedAccount string
+	vaultAccount  string
+}
+
+func (e *vaultAccountMismatchError) Error() string {
+	return fmt.Sprintf("%s profile %q holds account %s but the vault entry holds %s; rename one copy with `profiles rename --tools`", e.tool, e.profile, e.cachedAccount, e.vaultAccount)
+}
+
+func profileFileAccountID(p ProfileFile) string {
+	return normalizeCredentialIdentity(credentialFromProfileFile(p)).AccountID
+}
+
+// resolveVaultProfile returns the vault entry that is authoritative for a
+// cached per-tool profile without writing anything. A cache the vault has
+// never seen is returned as is.
+func resolveVaultProfile(vaultDir string, paths ToolPaths, name string, cached ProfileFile) (ProfileFile, bool, error) {
+	entry, err := readProfileFile(vaultProfilePath(vaultDir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return cached, false, nil
+		}
+		return cached, false, err
+	}
+	cachedAccount, vaultAccount := profileFileAccountID(cached), profileFileAccountID(entry)
+	if cachedAccount != "" && vaultAccount != "" && cachedAccount != vaultAccount {
+		return cached, false, &vaultAccountMismatchError{tool: paths.Tool, profile: name, cachedAccount: cachedAccount, vaultAccount: vaultAccount}
+	}
+	return entry, true, nil
+}
+
+// reconcileVaultProfile makes the vault entry the source of truth for a cached
+// per-tool profile file: caches that drifted are rewritten from the vault and
+// caches the vault has never seen are adopted into it. It writes, so callers
+// hold the tool's exclusive lock and the vault lock.
+func reconcileVaultProfile(vaultDir string, paths ToolPaths, name string, cached ProfileFile) (ProfileFile, error) {
+	entry, inVault, err := resolveVaultProfile(vaultDir, paths, name, cached)
+	if err != nil {
+		return cached, err
+	}
+	if !inVault {
+		if err := writeProfileFile(vaultProfilePath(vaultDir, name), cached); err != nil {
+			return cached, err
+		}
+		return cached, nil
+	}
+	if !profileFilesEquivalent(entry, cached) {
+		if err := writeProfileFile(profilePath(paths, name), entry); err != nil {
+			return entry, err
+		}
+	}
+	return entry, nil
+}
+
+func reconcileProfileCaches(paths ToolPaths) error {
+	vaultDir, ok := activeVaultDir()
+	if !ok {
+		return nil
+	}
+	names, err := listProfiles(paths)
+	if err != nil {
+		return err
+	}
+	lock, err := acquireVaultLock()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = lock.Release()
+	}()
+	var errs []error
+	for _, name := range names {
+		cached, err := readProfileFile(profilePath(paths, name))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %w", paths.Tool, name, err))
+			continue
+		}
+		if _, err := reconcileVaultProfile(vaultDir, paths, name, cached); err != nil {
+			errs = append(errs, fmt.Errorf("%s/%s: %w", paths.Tool, name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func profileReferencedByAnyTool(name string) bool {
+	return profileReferencedByOtherTool(name, "")
+}
+
+// profileReferencedByOtherTool reports whether any tool but except caches a
+// profile called name. When the config is broken it answers yes, since a tool
+// it fails to declare may still hold a copy.
+func profileReferencedByOtherTool(name string, except ToolName) bool {
+	tools, err := AllTools()
+	if err != nil {
+		return true
+	}
+	for _, tool := range tools {
+		if tool == except {
+			continue
+		}
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(profilePath(paths, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func removeVaultProfileIfUnreferenced(name string) error {
+	vaultDir, ok := activeVaultDir()
+	if !ok || profileReferencedByAnyTool(name) {
+		return nil
+	}
+	err := os.Remove(vaultProfilePath(vaultDir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func renameVaultProfile(from string, to string) error {
+	vaultDir, ok := activeVaultDir()
+	if !ok {
+		return nil
+	}
+	entry, err := readProfileFile(vaultProfilePath(vaultDir, from))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := writeProfileFile(vaultProfilePath(vaultDir, to), entry); err != nil {
+		return err
+	}
+	return removeVaultProfileIfUnreferenced(from)
+}
+
+func (s *Service) VaultStatus() (VaultStatus, error) {
+	dir, err := resolveVaultDir()
+	if err != nil {
+		return VaultStatus{}, WrapExit(ExitIOFailure, err)
+	}
+	status := VaultStatus{Dir: dir}
+	if _, ok := activeVaultDir(); !ok {
+		return status, nil
+	}
+	status.Enabled = true
+	profiles, err := listProfiles(ToolPaths{ProfileDir: dir})
+	if err != nil {
+		return status, WrapExit(ExitIOFailure, err)
+	}
+	status.Profiles = profiles
+	return status, nil
+}
+
+func (s *Service) MigrateVault(dryRun bool) ([]VaultMigrationResult, error) {
+	vaultDir, err := resolveVaultDir()
+	if err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+
+	type copyRef struct {
+		paths ToolPaths
+		file  ProfileFile
+	}
+	copies := map[string][]copyRef{}
+	tools, err := AllTools()
+	if err != nil {
+		return nil, WrapExit(ExitUserError, err)
+	}
+	allPaths := make([]ToolPaths, 0, len(tools))
+	for _, tool := range tools {
+		paths, err := resolveToolPaths(tool)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		allPaths = append(allPaths, paths)
+	}
+
+	locks := make([]*FileLock, 0, len(allPaths))
+	defer func() {
+		for _, lock := range locks {
+			_ = lock.Release()
+		}
+	}()
+	for _, paths := range allPaths {
+		lock, err := acquireLock(paths.LockPath)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		locks = append(locks, lock)
+	}
+	vaultLock, err := acquireVaultLock()
+	if err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+	locks = append(locks, vaultLock)
+
+	for _, paths := range allPaths {
+		names, err := listProfiles(paths)
+		if err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		for _, name := range names {
+			file, err := readProfileFile(profilePath(paths, name))
+			if err != nil {
+				return nil, WrapExit(ExitIOFailure, fmt.Errorf("%s/%s: %w", paths.Tool, name, err))
+			}
+			copies[name] = append(copies[name], copyRef{paths: paths, file: file})
+		}
+	}
+
+	names := make([]string, 0, len(copies))
+	for name := range copies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]VaultMigrationResult, 0, len(names))
+	chosen := map[string]ProfileFile{}
+	conflicts := []string{}
+	for _, name := range names {
+		refs := copies[name]
+		result := VaultMigrationResult{Profile: name}
+		for _, ref := range refs {
+			result.Tools = append(result.Tools, ref.paths.Tool)
+		}
+
+		if existing, err := readProfileFile(vaultProfilePath(vaultDir, name)); err == nil {
+			result.Status = "already_present"
+			result.AccountID = existing.AccountID
+			chosen[name] = existing
+			results = append(results, result)
+			continue
+		}
+
+		accounts := map[string]struct{}{}
+		best := 0
+		for i, ref := range refs {
+			cred := normalizeCredentialIdentity(credentialFromProfileFile(ref.file))
+			if cred.AccountID != "" {
+				accounts[cred.AccountID] = struct{}{}
+			}
+			if i > 0 && credentialFresher(cred, normalizeCredentialIdentity(credentialFromProfileFile(refs[best].file))) {
+				best = i
+			}
+		}
+		if len(accounts) > 1 {
+			result.Status = "conflict"
+			result.Warning = "profile name maps to different accounts across tools; rename one copy with `profiles rename --tools` first"
+			conflicts = append(conflicts, name)
+			results = append(results, result)
+			continue
+		}
+
+		result.Status = "imported"
+		result.SourceTool = refs[best].paths.Tool
+		result.AccountID = refs[best].file.AccountID
+		if len(refs) > 1 {
+			for _, ref := range refs {
+				if !profileFilesEquivalent(ref.file, refs[best].file) {
+					result.Warning = "tool copies differed; kept the freshest tokens"
+					break
+				}
+			}
+		}
+		chosen[name] = refs[best].file
+		results = append(results, result)
+	}
+
+	if len(conflicts) > 0 {
+		return results, WrapExit(ExitUserError, fmt.Errorf("vault migration blocked by conflicting profiles: %s", strings.Join(conflicts, ", ")))
+	}
+	if dryRun {
+		return results, nil
+	}
+
+	if err := os.MkdirAll(vaultDir, 0o700); err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+	if err := inheritEncryptionMarker(vaultDir, allPaths); err != nil {
+		return nil, WrapExit(ExitIOFailure, err)
+	}
+	for _, name := range names {
+		file := chosen[name]
+		if err := writeProfileFile(vaultProfilePath(vaultDir, name), file); err != nil {
+			return nil, WrapExit(ExitIOFailure, err)
+		}
+		for _, ref := range copies[name] {
+			if profileFilesEquivalent(ref.file, file) {
+				continue
+			}
+			if err := writeProfileFile(profilePath(ref.paths, name), file); err != nil {
+				return nil, WrapExit(ExitIOFailure, err)
+			}
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,279 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func setupVaultTestHome(t *testing.T) string {
+	t.Helper()
+	tmp := t.TempDir()
+	t.Setenv("HOME", filepath.Join(tmp, "home"))
+	t.Setenv("CODEX_HOME", filepath.Join(tmp, "codex-home"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmp, "xdg"))
+	t.Setenv("OPENCLAW_AGENT_DIR", filepath.Join(tmp, "agent"))
+	t.Setenv("CODEX_SWITCHER_DATA_DIR", "")
+	return tmp
+}
+
+func mustToolPaths(t *testing.T, tool ToolName) ToolPaths {
+	t.Helper()
+	paths, err := resolveToolPaths(tool)
+	if err != nil {
+		t.Fatalf("resolve %s paths: %v", tool, err)
+	}
+	return paths
+}
+
+func mustAdapter(t *testing.T, tool ToolName) Adapter {
+	t.Helper()
+	adapter, err := adapterFor(tool)
+	if err != nil {
+		t.Fatalf("adapter for %s: %v", tool, err)
+	}
+	return adapter
+}
+
+func mustAllTools(t *testing.T) []ToolName {
+	t.Helper()
+	tools, err := AllTools()
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	return tools
+}
+
+func TestMigrateVaultKeepsFreshestCopyAndHealsCaches(t *testing.T) {
+	setupVaultTestHome(t)
+	codexPaths := mustToolPaths(t, ToolCodex)
+	openCodePaths := mustToolPaths(t, ToolOpenCode)
+
+	older := time.Now().Add(time.Hour).UnixMilli()
+	newer := time.Now().Add(5 * time.Hour).UnixMilli()
+	if err := saveProfile(codexPaths, "work", Credential{Provider: "openai-codex", Access: "old-access", Refresh: "old-refresh", Expires: older, AccountID: "acct-work"}, true); err != nil {
+		t.Fatalf("save codex work: %v", err)
+	}
+	if err := saveProfile(openCodePaths, "work", Credential{Provider: "openai-codex", Access: "new-access", Refresh: "new-refresh", Expires: newer, AccountID: "acct-work"}, true); err != nil {
+		t.Fatalf("save opencode work: %v", err)
+	}
+
+	svc := NewService()
+	results, err := svc.MigrateVault(false)
+	if err != nil {
+		t.Fatalf("migrate vault: %v", err)
+	}
+	if len(results) != 1 || results[0].Status != "imported" || results[0].SourceTool != ToolOpenCode {
+		t.Fatalf("unexpected migration results %+v", results)
+	}
+
+	codexWork, err := loadProfile(codexPaths, "work")
+	if err != nil {
+		t.Fatalf("load codex work: %v", err)
+	}
+	if codexWork.Refresh != "new-refresh" {
+		t.Fatalf("expected codex cache healed from vault, got %+v", codexWork)
+	}
+
+	rotated := Credential{Provider: "openai-codex", Access: "rotated-access", Refresh: "rotated-refresh", Expires: time.Now().Add(10 * time.Hour).UnixMilli(), AccountID: "acct-work"}
+	if err := saveProfile(codexPaths, "work", rotated, true); err != nil {
+		t.Fatalf("save rotated work: %v", err)
+	}
+	openCodeWork, err := loadProfile(openCodePaths, "work")
+	if err != nil {
+		t.Fatalf("load opencode work: %v", err)
+	}
+	if openCodeWork.Refresh != "rotated-refresh" {
+		t.Fatalf("expected opencode copy to follow vault, got %+v", openCodeWork)
+	}
+	raw, err := readProfileFile(profilePath(openCodePaths, "work"))
+	if err != nil || raw.Refresh == "rotated-refresh" {
+		t.Fatalf("expected reads to leave the opencode cache alone, got %+v %v", raw, err)
+	}
+	if err := reconcileProfileCaches(openCodePaths); err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	raw, err = readProfileFile(profilePath(openCodePaths, "work"))
+	if err != nil || raw.Refresh != "rotated-refresh" {
+		t.Fatalf("expected opencode cache file rewritten, got %+v %v", raw, err)
+	}
+}
+
+func TestVaultRefusesProfileNameReusedForAnotherAccount(t *testing.T) {
+	setupVaultTestHome(t)
+	codexPaths := mustToolPaths(t, ToolCodex)
+	openCodePaths := mustToolPaths(t, ToolOpenCode)
+	dir, _ := resolveVaultDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatalf("create vault: %v", err)
+	}
+	work := Credential{Provider: "openai-codex", Access: "a-access", Refresh: "a-refresh", Expires: time.Now().Add(time.Hour).UnixMilli(), AccountID: "acct-a"}
+	for _, paths := range []ToolPaths{codexPaths, openCodePaths} {
+		if err := saveProfile(paths, "work", work, true); err != nil {
+			t.Fatalf("save %s: %v", paths.Tool, err)
+		}
+	}
+
+	other := Credential{Provider: "openai-codex", Access: "b-access", Refresh: "b-refresh", Expires: time.Now().Add(5 * time.Hour).UnixMilli(), AccountID: "acct-b"}
+	var mismatch *vaultAccountMismatchError
+	if err := saveProfile(openCodePaths, "work", other, true); !errors.As(err, &mismatch) {
+		t.Fatalf("expected save under another account refused, got %v", err)
+	}
+	if got, err := loadProfile(codexPaths, "work"); err != nil || got.AccountID != "acct-a" {
+		t.Fatalf("expected codex work untouched, got %+v %v", got, err)
+	}
+
+	// A vault entry that drifted to another account is flagged on read
+	// without touching the tool's cache.
+	if err := writeProfileFile(vaultProfilePath(dir, "work"), ProfileFile{Version: profileFileVersion, Provider: "openai-codex", Access: "b-access", Refresh: "b-refresh", AccountID: "acct-b"}); err != nil {
+		t.Fatalf("write vault entry: %v", err)
+	}
+	if _, err := loadProfile(codexPaths, "work"); !errors.As(err, &mismatch) {
+		t.Fatalf("expected mismatch reported, got %v", err)
+	}
+	if err := reconcileProfileCaches(codexPaths); !errors.As(err, &mismatch) {
+		t.Fatalf("expected reconcile to refuse, got %v", err)
+	}
+	raw, err := readProfileFile(profilePath(codexPaths, "work"))
+	if err != nil || raw.AccountID != "acct-a" {
+		t.Fatalf("expected codex cache kept, got %+v %v", raw, err)
+	}
+	findings, err := NewService().Doctor(DoctorOptions{Tools: []ToolName{ToolCodex}})
+	if err != nil || len(doctorFindingsByCheck(findings)["vault_account"]) != 1 {
+		t.Fatalf("expected doctor to flag the mismatch, got %+v %v", findings, err)
+	}
+}
+
+func TestMigrateVaultBlocksConflictingAccounts(t *testing.T) {
+	setupVaultTestHome(t)
+	if err := saveProfile(mustToolPaths(t, ToolCodex), "work", Credential{Provider: "openai-codex", Access: "a1", Refresh: "r1", AccountID: "acct-1"}, true); err != nil {
+		t.Fatalf("save codex work: %v", err)
+	}
+	if err := saveProfile(mustToolPaths(t, ToolOpenCode), "work", Credential{Provider: "openai-codex", Access: "a2", Refresh: "r2", AccountID: "acct-2"}, true); err != nil {
+		t.Fatalf("save opencode work: %v", err)
+	}
+
+	svc := NewService()
+	results, err := svc.MigrateVault(false)
+	if err == nil {
+		t.Fatalf("expected conflict error")
+	}
+	if len(results) != 1 || results[0].Status != "conflict" {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	dir, _ := resolveVaultDir()
+	if _, statErr := os.Stat(dir); !os.IsNotExist(statErr) {
+		t.Fatalf("expected vault not created on conflict, got %v", statErr)
+	}
+}
+
+func TestSaveProfileDoesNotRollVaultBackToStaleSnapshot(t *testing.T) {
+	setupVaultTestHome(t)
+	codexPaths := mustToolPaths(t, ToolCodex)
+	openCodePaths := mustToolPaths(t, ToolOpenCode)
+	dir, _ := resolveVaultDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatalf("create vault: %v", err)
+	}
+
+	fresh := Credential{Provider: "openai-codex", Access: "fresh-access", Refresh: "fresh-refresh", Expires: time.Now().Add(5 * time.Hour).UnixMilli(), AccountID: "acct-work"}
+	if err := saveProfile(codexPaths, "work", fresh, true); err != nil {
+		t.Fatalf("save fresh: %v", err)
+	}
+	stale := Credential{Provider: "openai-codex", Access: "stale-access", Refresh: "stale-refresh", Expires: time.Now().Add(time.Hour).UnixMilli(), AccountID: "acct-work"}
+	if err := saveProfile(openCodePaths, "work", stale, true); err != nil {
+		t.Fatalf("save stale: %v", err)
+	}
+
+	got, err := loadProfile(openCodePaths, "work")
+	if err != nil {
+		t.Fatalf("load opencode work: %v", err)
+	}
+	if got.Refresh != "fresh-refresh" {
+		t.Fatalf("expected vault to keep fresher tokens, got %+v", got)
+	}
+}
+
+func TestConcurrentToolSavesKeepNewestVaultEntry(t *testing.T) {
+	setupVaultTestHome(t)
+	dir, _ := resolveVaultDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatalf("create vault: %v", err)
+	}
+
+	const rounds = 40
+	base := time.Now().Add(time.Hour).UnixMilli()
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*rounds)
+	for offset, tool := range []ToolName{ToolCodex, ToolOpenCode} {
+		wg.Add(1)
+		go func(tool ToolName, offset int64) {
+			defer wg.Done()
+			paths := mustToolPaths(t, tool)
+			for i := int64(0); i < rounds; i++ {
+				expires := base + 2*i + offset
+				cred := Credential{Provider: "openai-codex", Access: fmt.Sprintf("access-%d", expires), Refresh: fmt.Sprintf("refresh-%d", expires), Expires: expires, AccountID: "acct-work"}
+				lock, err := acquireLock(paths.LockPath)
+				if err != nil {
+					errs <- err
+					return
+				}
+				if err := saveProfile(paths, "work", cred, true); err != nil {
+					errs <- err
+				}
+				// The other tool may have stored newer tokens since, never older.
+				if entry, err := readProfileFile(vaultProfilePath(dir, "work")); err == nil && entry.Expires < expires {
+					errs <- fmt.Errorf("%s: vault rolled back to %d after saving %d", tool, entry.Expires, expires)
+				}
+				_ = lock.Release()
+			}
+		}(tool, int64(offset))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatalf("save: %v", err)
+	}
+
+	entry, err := readProfileFile(vaultProfilePath(dir, "work"))
+	if err != nil {
+		t.Fatalf("read vault entry: %v", err)
+	}
+	if want := base + 2*(rounds-1) + 1; entry.Expires != want {
+		t.Fatalf("expected the newest tokens to win, got expiry %d want %d", entry.Expires, want)
+	}
+}
+
+func TestDeleteProfileKeepsVaultEntryWhileReferenced(t *testing.T) {
+	setupVaultTestHome(t)
+	codexPaths := mustToolPaths(t, ToolCodex)
+	openCodePaths := mustToolPaths(t, ToolOpenCode)
+	dir, _ := resolveVaultDir()
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		t.Fatalf("create vault: %v", err)
+	}
+	cred := Credential{Provider: "openai-codex", Access: "a", Refresh: "r", AccountID: "acct"}
+	for _, paths := range []ToolPaths{codexPaths, openCodePaths} {
+		if err := saveProfile(paths, "work", cred, true); err != nil {
+			t.Fatalf("save %s: %v", paths.Tool, err)
+		}
+	}
+
+	svc := NewService()
+	if err := svc.DeleteProfile("work", []ToolName{ToolCodex}); err != nil {
+		t.Fatalf("delete codex work: %v", err)
+	}
+	if _, err := os.Stat(vaultProfilePath(dir, "work")); err != nil {
+		t.Fatalf("expected vault entry kept while opencode references it: %v", err)
+	}
+	if err := svc.DeleteProfile("work", []ToolName{ToolOpenCode}); err != nil {
+		t.Fatalf("delete opencode work: %v", err)
+	}
+	if _, err := os.Stat(vaultProfilePath(dir, "work")); !os.IsNotExist(err) {
+		t.Fatalf("expected vault entry removed, got %v", err)
+	}
+}
@@ -1,16 +1,25 @@
 package cli
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
 
 	"codex-switcher/internal/app"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 )
 
 func NewRootCommand() *cobra.Command {
@@ -21,20 +30,116 @@ func NewRootCommand() *cobra.Command {
 		Short:        "Switch OpenAI Codex OAuth profiles across tools",
 		SilenceUsage: true,
 		Version:      app.Version,
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			recoverInterruptedSwitch(cmd, svc)
+		},
 	}
 
+	app.SetInteractiveKeySource(&app.PromptKeySource{Prompt: promptPassphrase})
+
 	root.AddCommand(newInspectCommand(svc))
 	root.AddCommand(newStatusCommand(svc))
 	root.AddCommand(newCaptureCommand(svc))
+	root.AddCommand(newLoginCommand(svc))
 	root.AddCommand(newSwitchCommand(svc))
+	root.AddCommand(newGroupsCommand(svc))
+	root.AddCommand(newRecoverCommand(svc))
+	root.AddCommand(newExecCommand(svc))
+	root.AddCommand(newAutoCommand(svc))
+	root.AddCommand(newPromptCommand(svc))
+	root.AddCommand(newTUICommand(svc))
+	root.AddCommand(newRotateCommand(svc))
 	root.AddCommand(newUsageCommand(svc))
+	root.AddCommand(newRefreshCommand(svc))
+	root.AddCommand(newSyncCommand(svc))
+	root.AddCommand(newDoctorCommand(svc))
+	root.AddCommand(newServeMetricsCommand(svc))
 	root.AddCommand(newProfilesCommand(svc))
 	root.AddCommand(newMigrateOpenClawCommand(svc))
+	root.AddCommand(newVaultCommand(svc))
 	root.AddCommand(newUpdateCommand(svc))
 
 	return root
 }
 
+// recoverInterruptedSwitch settles a switch journal left by a killed process
+// before any command reads or writes credentials. The prompt command skips it
+// so a shell prompt never waits on locks.
+func recoverInterruptedSwitch(cmd *cobra.Command, svc *app.Service) {
+	top := cmd
+	for top.HasParent() && top.Parent().HasParent() {
+		top = top.Parent()
+	}
+	switch top.Name() {
+	case "recover", "prompt", "help", "completion", cobra.ShellCompRequestCmd, cobra.ShellCompNoDescRequestCmd:
+		return
+	}
+	results, err := svc.Recover(app.RecoverAuto)
+	for _, result := range results {
+		_, _ = fmt.Fprintf(os.Stderr, "codex-switcher: %s\n", describeRecovery(result))
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: an interrupted switch needs recovery: %v (run `codex-switcher recover`)\n", err)
+	}
+}
+
+func describeRecovery(result app.RecoverResult) string {
+	if result.Action == "none" {
+		return "no interrupted switch"
+	}
+	tools := make([]string, 0, len(result.Tools))
+	for _, item := range result.Tools {
+		tools = append(tools, fmt.Sprintf("%s=%s", item.Tool, item.Profile))
+	}
+	verb := "rolled back"
+	if result.Action == "rolled_forward" {
+		verb = "rolled forward"
+	}
+	return fmt.Sprintf("%s interrupted switch from %s (%s)", verb, result.StartedAt, strings.Join(tools, " "))
+}
+
+func newRecoverCommand(svc *app.Service) *cobra.Command {
+	var rollback bool
+	var forward bool
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "recover",
+		Short: "Roll back or finish a switch that was interrupted",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if rollback && forward {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("--rollback and --forward are mutually exclusive"))
+			}
+			mode := app.RecoverAuto
+			if rollback {
+				mode = app.RecoverRollback
+			} else if forward {
+				mode = app.RecoverForward
+			}
+			results, err := svc.Recover(mode)
+			if jsonOut {
+				if printErr := printJSON(results); printErr != nil {
+					return printErr
+				}
+				return err
+			}
+			if len(results) == 0 && err == nil {
+				fmt.Println(describeRecovery(app.RecoverResult{Action: "none"}))
+			}
+			for _, result := range results {
+				fmt.Println(describeRecovery(result))
+				for _, item := range result.Switch {
+					fmt.Printf("%s: %s -> %s (%s)\n", item.Tool, zeroDefault(item.FromProfile, "-"), item.ToProfile, item.Status)
+				}
+			}
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&rollback, "rollback", false, "Restore every tool to its state before the interrupted switch")
+	cmd.Flags().BoolVar(&forward, "forward", false, "Replay the interrupted switch to completion")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
 func newMigrateOpenClawCommand(svc *app.Service) *cobra.Command {
 	var jsonOut bool
 	cmd := &cobra.Command{
@@ -63,6 +168,80 @@ func newMigrateOpenClawCommand(svc *app.Service) *cobra.Command {
 	return cmd
 }
 
+func newVaultCommand(svc *app.Service) *cobra.Command {
+	vault := &cobra.Command{
+		Use:   "vault",
+		Short: "Manage the shared profile vault",
+	}
+	vault.AddCommand(newVaultStatusCommand(svc))
+	vault.AddCommand(newVaultMigrateCommand(svc))
+	return vault
+}
+
+func newVaultStatusCommand(svc *app.Service) *cobra.Command {
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show vault location and stored profiles",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			status, err := svc.VaultStatus()
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				return printJSON(status)
+			}
+			fmt.Printf("vault_dir: %s\n", status.Dir)
+			fmt.Printf("enabled: %v\n", status.Enabled)
+			if status.Enabled {
+				fmt.Printf("profiles: %d\n", len(status.Profiles))
+				fmt.Printf("profile_names: %s\n", zeroDefault(strings.Join(status.Profiles, ","), "-"))
+			} else {
+				fmt.Println("hint: run `codex-switcher vault migrate` to move profiles into the shared vault")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func newVaultMigrateCommand(svc *app.Service) *cobra.Command {
+	var dryRun bool
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Move per-tool profile copies into the shared vault",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			results, err := svc.MigrateVault(dryRun)
+			if jsonOut {
+				if printErr := printJSON(results); printErr != nil {
+					return printErr
+				}
+				return err
+			}
+			for _, item := range results {
+				line := fmt.Sprintf("%s: %s (tools=%s", item.Profile, item.Status, strings.Join(toStrings(item.Tools), ","))
+				if item.SourceTool != "" {
+					line += ", source=" + string(item.SourceTool)
+				}
+				line += ")"
+				if dryRun {
+					line += " [dry-run]"
+				}
+				if item.Warning != "" {
+					line += " - " + item.Warning
+				}
+				fmt.Println(line)
+			}
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show migration plan without writing files")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
 func newUpdateCommand(svc *app.Service) *cobra.Command {
 	var checkOnly bool
 	var force bool
@@ -120,6 +299,7 @@ func newUpdateCommand(svc *app.Service) *cobra.Command {
 
 func newStatusCommand(svc *app.Service) *cobra.Command {
 	var toolCSV string
+	var tag string
 	var jsonOut bool
 	cmd := &cobra.Command{
 		Use:   "status",
@@ -129,36 +309,81 @@ func newStatusCommand(svc *app.Service) *cobra.Command {
 			if err != nil {
 				return app.WrapExit(app.ExitUserError, err)
 			}
+			tagFilter, err := parseTagFilter(tag)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
 			results, err := svc.Status(tools)
 			if err != nil {
 				return app.WrapExit(app.ExitIOFailure, err)
 			}
+			labels := map[app.ToolName]map[string]string{}
+			for i, item := range results {
+				summaries, err := svc.ProfileSummaries(item.Tool)
+				if err != nil {
+					return app.WrapExit(app.ExitIOFailure, err)
+				}
+				labels[item.Tool] = map[string]string{}
+				for _, summary := range summaries {
+					labels[item.Tool][summary.Profile] = summary.Label
+				}
+				if tagFilter != "" {
+					results[i].Profiles = nil
+					for _, summary := range filterProfileSummaries(summaries, tagFilter) {
+						results[i].Profiles = append(results[i].Profiles, summary.Profile)
+					}
+					results[i].ProfileCount = len(results[i].Profiles)
+				}
+			}
 			if jsonOut {
 				return printJSON(results)
 			}
+			for _, item := range results {
+				if item.ActiveGroup != "" {
+					fmt.Printf("active_group: %s\n\n", item.ActiveGroup)
+					break
+				}
+			}
 			for _, item := range results {
 				fmt.Printf("%s\n", item.Tool)
 				fmt.Printf("  active: %v\n", item.HasActive)
 				fmt.Printf("  active_profile: %s\n", zeroDefault(item.ActiveProfile, "-"))
+				if label := labels[item.Tool][item.ActiveProfile]; label != "" {
+					fmt.Printf("  active_label: %s\n", label)
+				}
 				fmt.Printf("  previous_profile: %s\n", zeroDefault(item.PreviousProfile, "-"))
 				fmt.Printf("  pending_create: %s\n", zeroDefault(item.PendingCreateProfile, "-"))
 				if item.PendingCreateSince != "" {
 					fmt.Printf("  pending_since: %s\n", item.PendingCreateSince)
 				}
 				fmt.Printf("  profiles: %d\n", item.ProfileCount)
-				fmt.Printf("  profile_names: %s\n", zeroDefault(strings.Join(item.Profiles, ","), "-"))
+				names := make([]string, 0, len(item.Profiles))
+				for _, name := range item.Profiles {
+					if label := labels[item.Tool][name]; label != "" {
+						name += " (" + label + ")"
+					}
+					names = append(names, name)
+				}
+				fmt.Printf("  profile_names: %s\n", zeroDefault(strings.Join(names, ","), "-"))
 				if item.StoreMode != "" {
 					fmt.Printf("  store_mode: %s\n", item.StoreMode)
 				}
+				if item.CredentialBackend != "" {
+					fmt.Printf("  credential_backend: %s\n", item.CredentialBackend)
+				}
 				if item.SwitchBlocked {
 					fmt.Printf("  switch_blocked: true (%s)\n", item.SwitchBlockReason)
 				}
+				if item.Warning != "" {
+					fmt.Printf("  warning: %s\n", item.Warning)
+				}
 				fmt.Println()
 			}
 			return nil
 		},
 	}
 	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().StringVar(&tag, "tag", "", "Only list profiles carrying this tag")
 	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
 	return cmd
 }
@@ -188,6 +413,9 @@ func newInspectCommand(svc *app.Service) *cobra.Command {
 				if item.StoreMode != "" {
 					fmt.Printf("  store_mode: %s\n", item.StoreMode)
 				}
+				if item.CredentialBackend != "" {
+					fmt.Printf("  credential_backend: %s\n", item.CredentialBackend)
+				}
 				if item.SwitchBlocked {
 					fmt.Printf("  switch_blocked: true (%s)\n", item.SwitchBlockReason)
 				}
@@ -242,24 +470,116 @@ func newCaptureCommand(svc *app.Service) *cobra.Command {
 	return cmd
 }
 
+func newLoginCommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	var force bool
+	var activate bool
+	var noBrowser bool
+	var callbackAddr string
+	var timeout time.Duration
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "login <profile>",
+		Short: "Log in via OAuth in the browser and save the result as a profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			profile := strings.TrimSpace(args[0])
+			results, err := svc.Login(profile, tools, app.LoginOptions{
+				Force:        force,
+				CallbackAddr: strings.TrimSpace(callbackAddr),
+				Timeout:      timeout,
+				OnAuthURL: func(authURL string) {
+					_, _ = fmt.Fprintf(os.Stderr, "Open this URL to log in:\n\n  %s\n\n", authURL)
+					if !noBrowser {
+						if err := openBrowser(authURL); err != nil {
+							_, _ = fmt.Fprintf(os.Stderr, "(could not open browser automatically: %v)\n", err)
+						}
+					}
+					_, _ = fmt.Fprintln(os.Stderr, "Waiting for login callback...")
+				},
+			})
+			if err != nil {
+				return err
+			}
+
+			var switchResults []app.SwitchResult
+			if activate {
+				switchResults, err = svc.Switch(profile, tools, app.SwitchOptions{})
+				if err != nil {
+					return err
+				}
+			}
+			if jsonOut {
+				return printJSON(map[string]any{"login": results, "switch": switchResults})
+			}
+			for _, item := range results {
+				fmt.Printf("%s: saved profile %q (account=%s, email=%s)\n", item.Tool, item.Profile, formatAccountForDisplay(item.AccountID), zeroDefault(item.Email, "-"))
+			}
+			for _, item := range switchResults {
+				fmt.Printf("%s: %s -> %s (%s)\n", item.Tool, zeroDefault(item.FromProfile, "-"), item.ToProfile, item.Status)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing profile file")
+	cmd.Flags().BoolVar(&activate, "switch", false, "Switch to the new profile after login")
+	cmd.Flags().BoolVar(&noBrowser, "no-browser", false, "Print the login URL without opening a browser")
+	cmd.Flags().StringVar(&callbackAddr, "callback-addr", "", "Local address for the OAuth callback server (default 127.0.0.1:1455)")
+	cmd.Flags().DurationVar(&timeout, "timeout", 5*time.Minute, "How long to wait for the browser login to complete")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func openBrowser(target string) error {
+	var command *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		command = exec.Command("open", target)
+	case "windows":
+		command = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		command = exec.Command("xdg-open", target)
+	}
+	return command.Start()
+}
+
 func newSwitchCommand(svc *app.Service) *cobra.Command {
 	var toolCSV string
+	var group string
 	var dryRun bool
 	var createMissing bool
 	var jsonOut bool
 	cmd := &cobra.Command{
-		Use:   "switch <profile>",
-		Short: "Switch active credentials to a named profile",
-		Args:  cobra.ExactArgs(1),
+		Use:   "switch <profile> | --group <name>",
+		Short: "Switch active credentials to a named profile or group",
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			group = strings.TrimSpace(group)
+			if (group == "") == (len(args) == 0) {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("specify either a profile or --group"))
+			}
 			tools, err := app.ParseTools(toolCSV)
 			if err != nil {
 				return app.WrapExit(app.ExitUserError, err)
 			}
-			results, err := svc.Switch(strings.TrimSpace(args[0]), tools, app.SwitchOptions{
+			opts := app.SwitchOptions{
 				DryRun:        dryRun,
 				CreateMissing: createMissing,
-			})
+			}
+			var results []app.SwitchResult
+			if group != "" {
+				if !cmd.Flags().Changed("tools") {
+					tools = nil
+				}
+				results, err = svc.SwitchGroup(group, tools, opts)
+			} else {
+				results, err = svc.Switch(strings.TrimSpace(args[0]), tools, opts)
+			}
 			if err != nil {
 				return err
 			}
@@ -302,99 +622,737 @@ func newSwitchCommand(svc *app.Service) *cobra.Command {
 		},
 	}
 	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().StringVar(&group, "group", "", "Switch each tool to the profile mapped by this group")
 	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show switch plan without writing files")
 	cmd.Flags().BoolVar(&createMissing, "create", false, "Prepare missing profile by clearing active auth and marking pending-create")
 	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
 	return cmd
 }
 
-func newUsageCommand(svc *app.Service) *cobra.Command {
-	var profile string
-	var allProfiles bool
-	var toolsCSV string
+func newGroupsCommand(svc *app.Service) *cobra.Command {
 	var jsonOut bool
-	var watch bool
-	var interval time.Duration
 	cmd := &cobra.Command{
-		Use:   "usage",
-		Short: "Fetch usage for one or more profiles",
+		Use:   "groups",
+		Short: "List profile groups from the switcher config",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			selectedTools := []app.ToolName{}
-			if strings.TrimSpace(toolsCSV) != "" {
-				parsed, err := app.ParseTools(toolsCSV)
-				if err != nil {
-					return app.WrapExit(app.ExitUserError, err)
-				}
-				selectedTools = parsed
+			groups, err := svc.Groups()
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			if jsonOut {
+				return printJSON(groups)
 			}
+			return writeGroups(os.Stdout, groups)
+		},
+	}
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
 
-			trimmedProfile := strings.TrimSpace(profile)
-			if err := validateUsageWatchOptions(watch, interval, selectedTools, trimmedProfile, allProfiles, jsonOut); err != nil {
+func writeGroups(w io.Writer, groups []app.ProfileGroup) error {
+	if len(groups) == 0 {
+		_, err := fmt.Fprintln(w, "no groups configured ([groups] in config.toml under the data dir)")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, group := range groups {
+		marker := " "
+		if group.Active {
+			marker = "*"
+		}
+		mappings := make([]string, 0, len(group.Profiles))
+		for _, tool := range group.Tools() {
+			mappings = append(mappings, fmt.Sprintf("%s=%s", tool, group.Profiles[tool]))
+		}
+		_, _ = fmt.Fprintf(tw, "%s %s\t%s\n", marker, group.Name, strings.Join(mappings, " "))
+	}
+	return tw.Flush()
+}
+
+func newExecCommand(svc *app.Service) *cobra.Command {
+	var profile string
+	var toolCSV string
+	cmd := &cobra.Command{
+		Use:   "exec --profile <name> -- <command> [args...]",
+		Short: "Run a command with a profile active only for that process",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if strings.TrimSpace(profile) == "" {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("--profile is required"))
+			}
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
 				return app.WrapExit(app.ExitUserError, err)
 			}
-			if watch {
-				return watchUsage(cmd, svc, app.UsageOptions{Tools: selectedTools, ActiveOnly: true}, interval, selectedTools)
+			result, err := svc.Exec(app.ExecOptions{
+				Profile: strings.TrimSpace(profile),
+				Tools:   tools,
+				Command: args,
+				Stdin:   os.Stdin,
+				Stdout:  os.Stdout,
+				Stderr:  os.Stderr,
+			})
+			for _, item := range result.Tools {
+				switch item.Status {
+				case "captured":
+					_, _ = fmt.Fprintf(os.Stderr, "codex-switcher: %s: saved refreshed tokens to profile %s\n", item.Tool, item.Profile)
+				case "skipped", "error":
+					if item.Warning != "profile not found" || len(toolCSV) > 0 {
+						_, _ = fmt.Fprintf(os.Stderr, "codex-switcher: %s: %s (%s)\n", item.Tool, item.Status, item.Warning)
+					}
+				}
 			}
+			if err != nil {
+				return err
+			}
+			if result.ExitCode != 0 {
+				cmd.SilenceErrors = true
+				return &app.ExitError{Code: result.ExitCode}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&profile, "profile", "", "Profile to activate for the command")
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	return cmd
+}
 
-			results, err := svc.Usage(app.UsageOptions{
-				Profile:     trimmedProfile,
-				AllProfiles: allProfiles,
-				Tools:       selectedTools,
-			})
+func newAutoCommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	var dryRun bool
+	var quiet bool
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "auto",
+		Short: "Switch to the profile declared by the nearest .codex-profile file",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var tools []app.ToolName
+			if strings.TrimSpace(toolCSV) != "" {
+				parsed, err := app.ParseTools(toolCSV)
+				if err != nil {
+					return app.WrapExit(app.ExitUserError, err)
+				}
+				tools = parsed
+			}
+			result, err := svc.Auto(app.AutoOptions{Tools: tools, DryRun: dryRun})
 			if err != nil {
 				return err
 			}
+			partial := false
+			for _, item := range result.Switch {
+				if item.Status == "blocked" || item.Status == "skipped_missing" {
+					partial = true
+				}
+			}
 			if jsonOut {
-				return printJSON(results)
+				if err := printJSON(result); err != nil {
+					return err
+				}
+			} else if !quiet {
+				switch result.Action {
+				case "would_switch":
+					fmt.Printf("would switch %s to %s (%s)\n", strings.Join(toStrings(result.Pending), ","), result.Pin.Profile, result.Pin.Path)
+				case "switched":
+					for _, item := range result.Switch {
+						if item.Status == "blocked" || item.Status == "skipped_missing" {
+							fmt.Printf("%s: %s (%s)\n", item.Tool, item.Status, item.Warning)
+							continue
+						}
+						fmt.Printf("%s: %s -> %s (%s)\n", item.Tool, zeroDefault(item.FromProfile, "-"), item.ToProfile, result.Pin.Path)
+					}
+				}
+			}
+			if partial {
+				return app.WrapExit(app.ExitPartial, fmt.Errorf("auto switch completed with warnings"))
 			}
-			renderUsageReport(os.Stdout, results, loadUsageActiveProfiles(svc, selectedTools))
 			return nil
 		},
 	}
-	cmd.Flags().StringVar(&profile, "profile", "", "Specific profile name")
-	cmd.Flags().BoolVar(&allProfiles, "all-profiles", false, "Query all profiles (for selected tool(s), or all tools if none selected)")
-	cmd.Flags().StringVar(&toolsCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
-	cmd.Flags().BoolVar(&watch, "watch", false, "Continuously watch active usage for selected tools")
-	cmd.Flags().DurationVar(&interval, "interval", 30*time.Second, "Watch polling interval (for example: 10s, 1m)")
-	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools to consider when the file does not declare any")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report what would be switched without writing files")
+	cmd.Flags().BoolVar(&quiet, "quiet", false, "Print nothing unless an error occurs")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Print JSON output")
+	cmd.AddCommand(newAutoHookCommand())
 	return cmd
 }
 
-func validateUsageWatchOptions(watch bool, interval time.Duration, selectedTools []app.ToolName, profile string, allProfiles bool, jsonOut bool) error {
-	if !watch {
-		return nil
-	}
-	if len(selectedTools) == 0 {
-		return fmt.Errorf("--watch requires --tools")
-	}
-	if profile != "" {
-		return fmt.Errorf("--watch cannot be combined with --profile")
-	}
-	if allProfiles {
-		return fmt.Errorf("--watch cannot be combined with --all-profiles")
-	}
-	if jsonOut {
-		return fmt.Errorf("--watch cannot be combined with --json")
+func newAutoHookCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:       "hook <bash|zsh|fish>",
+		Short:     "Print a shell hook that runs auto whenever the directory changes",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"bash", "zsh", "fish"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			script, err := autoHookScript(args[0], selfExecutable())
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			fmt.Print(script)
+			return nil
+		},
 	}
-	if interval <= 0 {
-		return fmt.Errorf("--interval must be greater than 0")
+}
+
+func autoHookScript(shell string, exe string) (string, error) {
+	switch shell {
+	case "bash":
+		return fmt.Sprintf(`_codex_switcher_auto() {
+  if [ "${_CODEX_SWITCHER_LAST_PWD-}" != "$PWD" ]; then
+    _CODEX_SWITCHER_LAST_PWD="$PWD"
+    %s auto
+  fi
+}
+case ";${PROMPT_COMMAND-};" in
+  *";_codex_switcher_auto;"*) ;;
+  *) PROMPT_COMMAND="_codex_switcher_auto${PROMPT_COMMAND:+;$PROMPT_COMMAND}" ;;
+esac
+`, shellQuote(exe)), nil
+	case "zsh":
+		return fmt.Sprintf(`_codex_switcher_auto() {
+  %s auto
+}
+autoload -Uz add-zsh-hook
+add-zsh-hook chpwd _codex_switcher_auto
+_codex_switcher_auto
+`, shellQuote(exe)), nil
+	case "fish":
+		return fmt.Sprintf(`function __codex_switcher_auto --on-variable PWD
+    %s auto
+end
+__codex_switcher_auto
+`, shellQuote(exe)), nil
+	default:
+		return "", fmt.Errorf("unsupported shell %q (expected bash, zsh or fish)", shell)
 	}
-	return nil
 }
 
-func watchUsage(cmd *cobra.Command, svc *app.Service, opts app.UsageOptions, interval time.Duration, selectedTools []app.ToolName) error {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
+func selfExecutable() string {
+	exe, err := os.Executable()
+	if err != nil {
+		return "codex-switcher"
+	}
+	return exe
+}
 
-	for {
-		results, err := svc.Usage(opts)
-		if err != nil {
-			return err
-		}
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
 
-		resetUsageWatchScreen(os.Stdout)
-		_, _ = fmt.Fprintf(os.Stdout, "Watching active usage for %s (interval %s, updated %s)\n\n", strings.Join(toStrings(selectedTools), ","), interval, time.Now().Local().Format("2006-01-02 15:04:05 MST"))
-		renderUsageReport(os.Stdout, results, loadUsageActiveProfiles(svc, selectedTools))
+const defaultPromptFormat = "{tool}:{profile} {usage}"
+
+func newPromptCommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	var format string
+	var separator string
+	var budget time.Duration
+	cmd := &cobra.Command{
+		Use:   "prompt",
+		Short: "Print a compact active-profile segment for shell prompts",
+		Long:  "Print a compact active-profile segment for shell prompts.\n\nOnly local files are read: usage comes from the last sample recorded by `usage`, `usage --watch` or `serve-metrics`. Format placeholders: {tool}, {profile}, {usage} (e.g. 42%), {used} and {window}.",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			done := make(chan []app.PromptSegment, 1)
+			go func() {
+				segments, err := svc.PromptSegments(tools, time.Now())
+				if err != nil {
+					segments = nil
+				}
+				done <- segments
+			}()
+			var segments []app.PromptSegment
+			select {
+			case segments = <-done:
+			case <-time.After(budget):
+				return nil
+			}
+			parts := make([]string, 0, len(segments))
+			for _, segment := range segments {
+				if part := renderPromptSegment(format, segment); part != "" {
+					parts = append(parts, part)
+				}
+			}
+			if len(parts) > 0 {
+				fmt.Println(strings.Join(parts, separator))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().StringVar(&format, "format", defaultPromptFormat, "Segment template")
+	cmd.Flags().StringVar(&separator, "separator", " ", "Text placed between tool segments")
+	cmd.Flags().DurationVar(&budget, "timeout", 200*time.Millisecond, "Print nothing if the segment is not ready within this time")
+	cmd.AddCommand(newPromptInitCommand())
+	return cmd
+}
+
+func renderPromptSegment(format string, segment app.PromptSegment) string {
+	usage, used := "", ""
+	if segment.UsedPercent != nil {
+		used = strconv.FormatFloat(*segment.UsedPercent, 'f', 0, 64)
+		usage = used + "%"
+	}
+	replacer := strings.NewReplacer(
+		"{tool}", string(segment.Tool),
+		"{profile}", segment.Profile,
+		"{usage}", usage,
+		"{used}", used,
+		"{window}", segment.Window,
+	)
+	return strings.TrimSpace(replacer.Replace(format))
+}
+
+func newPromptInitCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:       "init <starship|p10k|ps1>",
+		Short:     "Print a prompt integration snippet",
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: []string{"starship", "p10k", "ps1"},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			snippet, err := promptInitSnippet(args[0], selfExecutable())
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			fmt.Print(snippet)
+			return nil
+		},
+	}
+}
+
+func promptInitSnippet(kind string, exe string) (string, error) {
+	command := shellQuote(exe) + " prompt"
+	switch kind {
+	case "starship":
+		return fmt.Sprintf(`# Add to ~/.config/starship.toml
+[custom.codex_switcher]
+command = %s
+when = true
+shell = ["sh"]
+format = "[$output]($style) "
+style = "bold purple"
+`, strconv.Quote(command)), nil
+	case "p10k":
+		return fmt.Sprintf(`# Add to ~/.p10k.zsh, then list codex_switcher in
+# POWERLEVEL9K_LEFT_PROMPT_ELEMENTS or POWERLEVEL9K_RIGHT_PROMPT_ELEMENTS.
+function prompt_codex_switcher() {
+  local segment
+  segment="$(%s 2>/dev/null)"
+  [[ -n $segment ]] && p10k segment -f 208 -t "$segment"
+}
+function instant_prompt_codex_switcher() {
+  prompt_codex_switcher
+}
+`, command), nil
+	case "ps1":
+		return fmt.Sprintf(`# Add to ~/.bashrc (or ~/.zshrc with setopt PROMPT_SUBST)
+_codex_switcher_ps1() {
+  local segment
+  segment="$(%s 2>/dev/null)"
+  [ -n "$segment" ] && printf '[%%s] ' "$segment"
+}
+PS1='$(_codex_switcher_ps1)'"$PS1"
+`, command), nil
+	default:
+		return "", fmt.Errorf("unsupported prompt %q (expected starship, p10k or ps1)", kind)
+	}
+}
+
+func newRotateCommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	var threshold float64
+	var dryRun bool
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "rotate",
+		Short: "Switch to the saved profile with the most rate-limit headroom",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			if threshold < 0 || threshold > 100 {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("--threshold must be between 0 and 100"))
+			}
+			result, err := svc.Rotate(cmd.Context(), app.RotateOptions{Tools: tools, Threshold: threshold, DryRun: dryRun})
+			if jsonOut {
+				if printErr := printJSON(result); printErr != nil {
+					return printErr
+				}
+				return err
+			}
+			if dryRun {
+				renderRotateRanking(os.Stdout, result.Candidates)
+				fmt.Println()
+			}
+			fmt.Printf("%s: %s\n", result.Action, result.Reason)
+			for _, item := range result.Switch {
+				mode := item.Status
+				if dryRun {
+					mode = mode + ", dry-run"
+				}
+				if item.Warning != "" {
+					fmt.Printf("%s: %s (%s)\n", item.Tool, item.Status, item.Warning)
+					continue
+				}
+				fmt.Printf("%s: %s -> %s (%s)\n", item.Tool, zeroDefault(item.FromProfile, "-"), item.ToProfile, mode)
+			}
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().Float64Var(&threshold, "threshold", 0, "Only rotate when the active profile's primary-window usage is at or above this percent")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Explain the ranking without switching")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func renderRotateRanking(w io.Writer, candidates []app.RotateCandidate) {
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "RANK\tPROFILE\tUSED\tRESET\tTOOLS\tNOTE")
+	for _, c := range candidates {
+		rank := "-"
+		if c.Rank > 0 {
+			rank = fmt.Sprintf("%d", c.Rank)
+		}
+		name := c.Profile
+		if c.Active {
+			name += " (active)"
+		}
+		used := "-"
+		if c.Status == "ok" {
+			used = fmt.Sprintf("%.0f%%", c.UsedPercent)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", rank, name, used, formatResetForDisplay(c.ResetAt), strings.Join(toStrings(c.Tools), ","), zeroDefault(c.Reason, "-"))
+	}
+	_ = tw.Flush()
+}
+
+func newUsageCommand(svc *app.Service) *cobra.Command {
+	var profile string
+	var tag string
+	var allProfiles bool
+	var toolsCSV string
+	var jsonOut bool
+	var watch bool
+	var interval time.Duration
+	var concurrency int
+	var perTool bool
+	var byAccount bool
+	cmd := &cobra.Command{
+		Use:   "usage",
+		Short: "Fetch usage for one or more profiles",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			selectedTools := []app.ToolName{}
+			if strings.TrimSpace(toolsCSV) != "" {
+				parsed, err := app.ParseTools(toolsCSV)
+				if err != nil {
+					return app.WrapExit(app.ExitUserError, err)
+				}
+				selectedTools = parsed
+			}
+
+			trimmedProfile := strings.TrimSpace(profile)
+			if err := validateUsageWatchOptions(watch, interval, selectedTools, trimmedProfile, allProfiles, jsonOut); err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			tagFilter, err := parseTagFilter(tag)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			if tagFilter != "" && (trimmedProfile != "" || watch) {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("--tag cannot be combined with --profile or --watch"))
+			}
+			if concurrency < 0 {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("--concurrency must not be negative"))
+			}
+			if err := validateUsageLayoutFlags(jsonOut, perTool, byAccount); err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			if watch {
+				return watchUsage(cmd, svc, app.UsageOptions{Tools: selectedTools, ActiveOnly: true, Concurrency: concurrency}, interval, selectedTools, perTool)
+			}
+
+			results, err := svc.Usage(cmd.Context(), app.UsageOptions{
+				Profile:     trimmedProfile,
+				AllProfiles: allProfiles,
+				Tools:       selectedTools,
+				Tag:         tagFilter,
+				Concurrency: concurrency,
+			})
+			if err != nil {
+				return err
+			}
+			recordedAt := recordUsageHistory(svc, results)
+			annotateUsageForecasts(svc, results, recordedAt)
+			if jsonOut {
+				if byAccount {
+					err = printJSON(app.GroupUsageByAccount(results))
+				} else {
+					err = printJSON(results)
+				}
+				if err != nil {
+					return err
+				}
+			} else {
+				renderUsage(os.Stdout, results, loadUsageActiveProfiles(svc, selectedTools), perTool)
+			}
+			return usageWarningsExit(os.Stderr, results)
+		},
+	}
+	cmd.Flags().StringVar(&profile, "profile", "", "Specific profile name")
+	cmd.Flags().StringVar(&tag, "tag", "", "Query every profile carrying this tag")
+	cmd.Flags().BoolVar(&allProfiles, "all-profiles", false, "Query all profiles (for selected tool(s), or all tools if none selected)")
+	cmd.Flags().StringVar(&toolsCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().BoolVar(&watch, "watch", false, "Continuously watch active usage for selected tools")
+	cmd.Flags().DurationVar(&interval, "interval", 30*time.Second, "Watch polling interval (for example: 10s, 1m)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 0, "Maximum usage requests in flight (0 for the default)")
+	cmd.Flags().BoolVar(&perTool, "per-tool", false, "Show one table row per tool/profile instead of one per account (not with --json)")
+	cmd.Flags().BoolVar(&byAccount, "by-account", false, "Output one JSON entry per account instead of per tool/profile (requires --json)")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	cmd.AddCommand(newUsageHistoryCommand(svc))
+	cmd.AddCommand(newUsageForecastCommand(svc))
+	return cmd
+}
+
+// validateUsageLayoutFlags rejects layout flags the chosen output ignores: the
+// table groups by account unless --per-tool, JSON lists tool/profile pairs
+// unless --by-account.
+func validateUsageLayoutFlags(jsonOut bool, perTool bool, byAccount bool) error {
+	if jsonOut && perTool {
+		return fmt.Errorf("--per-tool only applies to the table; --json already lists one entry per tool/profile")
+	}
+	if !jsonOut && byAccount {
+		return fmt.Errorf("--by-account only applies to --json; the table already groups by account")
+	}
+	return nil
+}
+
+// usageWarningsExit reports results whose rotated tokens could not be saved
+// and turns them into a partial-failure exit.
+func usageWarningsExit(w io.Writer, results []app.UsageResult) error {
+	warned := false
+	for _, item := range results {
+		if item.Warning == "" {
+			continue
+		}
+		_, _ = fmt.Fprintf(w, "codex-switcher: %s/%s: %s\n", item.Tool, item.Profile, item.Warning)
+		warned = true
+	}
+	if warned {
+		return app.WrapExit(app.ExitPartial, fmt.Errorf("usage completed with warnings"))
+	}
+	return nil
+}
+
+// recordUsageHistory appends results to the usage history and returns the
+// time stamped on the new samples, or zero if recording failed.
+func recordUsageHistory(svc *app.Service, results []app.UsageResult) time.Time {
+	at := time.Now()
+	if err := svc.RecordUsage(results, at); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: failed to record usage history: %v\n", err)
+		return time.Time{}
+	}
+	return at
+}
+
+func annotateUsageForecasts(svc *app.Service, results []app.UsageResult, recordedAt time.Time) {
+	if _, err := svc.ForecastUsage(results, time.Now(), recordedAt); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "warning: failed to forecast usage: %v\n", err)
+	}
+}
+
+func newUsageForecastCommand(svc *app.Service) *cobra.Command {
+	var toolsCSV string
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "forecast",
+		Short: "Rank profiles by projected rate-limit headroom",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			selectedTools := []app.ToolName{}
+			if strings.TrimSpace(toolsCSV) != "" {
+				parsed, err := app.ParseTools(toolsCSV)
+				if err != nil {
+					return app.WrapExit(app.ExitUserError, err)
+				}
+				selectedTools = parsed
+			}
+			results, err := svc.Usage(cmd.Context(), app.UsageOptions{Tools: selectedTools, AllProfiles: true})
+			if err != nil {
+				return err
+			}
+			recordedAt := recordUsageHistory(svc, results)
+			forecasts, err := svc.ForecastUsage(results, time.Now(), recordedAt)
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				return printJSON(forecasts)
+			}
+			renderUsageForecast(os.Stdout, forecasts)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&toolsCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func renderUsageForecast(w io.Writer, forecasts []app.UsageForecast) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "rank\tprofile\twindow\tused\tburn/h\tat reset\theadroom\teta")
+	rank := 0
+	for _, item := range forecasts {
+		label := fmt.Sprintf("%s/%s", item.Tool, item.Profile)
+		if item.Status != "ok" && item.Status != "shared" {
+			_, _ = fmt.Fprintf(tw, "-\t%s\t-\t-\t-\t-\t-\t%s\n", label, zeroDefault(strings.TrimSpace(item.Error), item.Status))
+			continue
+		}
+		rank++
+		burn := "-"
+		if item.BurnRatePerHour > 0 {
+			burn = fmt.Sprintf("%.1f%%", item.BurnRatePerHour)
+		}
+		eta := formatUsageETA(app.UsageWindow{UsedPercent: item.UsedPercent, ExhaustAt: item.ExhaustAt, ExhaustsBeforeReset: item.ExhaustsBeforeReset})
+		_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%.1f%%\t%s\t%.0f%%\t%.0f%%\t%s\n", rank, label, item.Window, item.UsedPercent, burn, item.ProjectedAtReset, item.Headroom, eta)
+	}
+	_ = tw.Flush()
+}
+
+func formatUsageETA(window app.UsageWindow) string {
+	switch {
+	case window.UsedPercent >= 100:
+		return "exhausted"
+	case window.ExhaustAt <= 0:
+		return "-"
+	case !window.ExhaustsBeforeReset:
+		return "after reset"
+	default:
+		return formatResetForDisplay(window.ExhaustAt)
+	}
+}
+
+func newUsageHistoryCommand(svc *app.Service) *cobra.Command {
+	var profile string
+	var toolsCSV string
+	var window string
+	var since time.Duration
+	var series bool
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "Show recorded usage trends, daily aggregates and peaks",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			selectedTools := []app.ToolName{}
+			if strings.TrimSpace(toolsCSV) != "" {
+				parsed, err := app.ParseTools(toolsCSV)
+				if err != nil {
+					return app.WrapExit(app.ExitUserError, err)
+				}
+				selectedTools = parsed
+			}
+			if since < 0 {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("--since must not be negative"))
+			}
+			report, err := svc.UsageHistory(app.UsageHistoryOptions{
+				Tools:   selectedTools,
+				Profile: strings.TrimSpace(profile),
+				Window:  strings.TrimSpace(window),
+				Since:   since,
+			})
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				return printJSON(report)
+			}
+			if len(report.Series) == 0 {
+				fmt.Printf("no usage history recorded yet (%s)\n", report.Path)
+				return nil
+			}
+			renderUsageHistory(os.Stdout, report, series)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&profile, "profile", "", "Only show this profile")
+	cmd.Flags().StringVar(&toolsCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().StringVar(&window, "window", "", "Only show this window label (for example: 5h, Day)")
+	cmd.Flags().DurationVar(&since, "since", 7*24*time.Hour, "How far back to report (0 for everything)")
+	cmd.Flags().BoolVar(&series, "series", false, "Also print every recorded sample")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func renderUsageHistory(w io.Writer, report app.UsageHistoryReport, series bool) {
+	tw := tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "DAY\tPROFILE\tWINDOW\tSAMPLES\tMIN\tAVG\tMAX\tCONSUMED")
+	for _, day := range report.Daily {
+		_, _ = fmt.Fprintf(tw, "%s\t%s/%s\t%s\t%d\t%.0f%%\t%.0f%%\t%.0f%%\t%.0f%%\n", day.Day, day.Tool, day.Profile, day.Window, day.Samples, day.Min, day.Avg, day.Max, day.Consumed)
+	}
+	_ = tw.Flush()
+
+	_, _ = fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 0, 2, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "PEAK\tPROFILE\tWINDOW\tUSED")
+	for _, peak := range report.Peaks {
+		_, _ = fmt.Fprintf(tw, "%s\t%s/%s\t%s\t%.0f%%\n", time.UnixMilli(peak.At).Local().Format("2006-01-02 15:04"), peak.Tool, peak.Profile, peak.Window, peak.UsedPercent)
+	}
+	_ = tw.Flush()
+
+	if !series {
+		return
+	}
+	for _, item := range report.Series {
+		_, _ = fmt.Fprintf(w, "\n%s/%s %s\n", item.Tool, item.Profile, item.Window)
+		for _, point := range item.Points {
+			_, _ = fmt.Fprintf(w, "  %s  %5.1f%%  reset %s\n", time.UnixMilli(point.At).Local().Format("2006-01-02 15:04:05"), point.UsedPercent, formatResetForDisplay(point.ResetAt))
+		}
+	}
+}
+
+func validateUsageWatchOptions(watch bool, interval time.Duration, selectedTools []app.ToolName, profile string, allProfiles bool, jsonOut bool) error {
+	if !watch {
+		return nil
+	}
+	if len(selectedTools) == 0 {
+		return fmt.Errorf("--watch requires --tools")
+	}
+	if profile != "" {
+		return fmt.Errorf("--watch cannot be combined with --profile")
+	}
+	if allProfiles {
+		return fmt.Errorf("--watch cannot be combined with --all-profiles")
+	}
+	if jsonOut {
+		return fmt.Errorf("--watch cannot be combined with --json")
+	}
+	if interval <= 0 {
+		return fmt.Errorf("--interval must be greater than 0")
+	}
+	return nil
+}
+
+func watchUsage(cmd *cobra.Command, svc *app.Service, opts app.UsageOptions, interval time.Duration, selectedTools []app.ToolName, perTool bool) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		results, err := svc.Usage(cmd.Context(), opts)
+		if cmd.Context().Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		recordedAt := recordUsageHistory(svc, results)
+		annotateUsageForecasts(svc, results, recordedAt)
+
+		resetUsageWatchScreen(os.Stdout)
+		_, _ = fmt.Fprintf(os.Stdout, "Watching active usage for %s (interval %s, updated %s)\n\n", strings.Join(toStrings(selectedTools), ","), interval, time.Now().Local().Format("2006-01-02 15:04:05 MST"))
+		renderUsage(os.Stdout, results, loadUsageActiveProfiles(svc, selectedTools), perTool)
 
 		select {
 		case <-cmd.Context().Done():
@@ -419,7 +1377,11 @@ func loadUsageActiveProfiles(svc *app.Service, selectedTools []app.ToolName) map
 	activeProfiles := map[app.ToolName]string{}
 	statusTools := selectedTools
 	if len(statusTools) == 0 {
-		statusTools = append([]app.ToolName{}, app.AllTools...)
+		tools, err := app.AllTools()
+		if err != nil {
+			return activeProfiles
+		}
+		statusTools = tools
 	}
 	if statusResults, statusErr := svc.Status(statusTools); statusErr == nil {
 		for _, item := range statusResults {
@@ -429,50 +1391,93 @@ func loadUsageActiveProfiles(svc *app.Service, selectedTools []app.ToolName) map
 	return activeProfiles
 }
 
+func renderUsage(w io.Writer, results []app.UsageResult, activeProfiles map[app.ToolName]string, perTool bool) {
+	if perTool {
+		renderUsageReport(w, results, activeProfiles)
+		return
+	}
+	renderUsageAccounts(w, app.GroupUsageByAccount(results), activeProfiles, usageToolResultCounts(results))
+}
+
+// usageRow is one rendered usage entry: a tool/profile pair, or an account
+// with every pair sharing it.
+type usageRow struct {
+	label string
+	item  app.UsageResult
+}
+
 func renderUsageReport(w io.Writer, results []app.UsageResult, activeProfiles map[app.ToolName]string) {
 	toolCounts := usageToolResultCounts(results)
-	formatUsageLabel := func(item app.UsageResult) string {
-		return usageDisplayLabel(item, activeProfiles, toolCounts)
+	rows := make([]usageRow, 0, len(results))
+	for _, item := range results {
+		label := usageDisplayLabel(item, activeProfiles, toolCounts)
+		if item.Status == "shared" {
+			label += " (shared)"
+		}
+		rows = append(rows, usageRow{label: label, item: item})
 	}
+	renderUsageRows(w, "profile", rows)
+}
 
+func renderUsageAccounts(w io.Writer, accounts []app.UsageAccount, activeProfiles map[app.ToolName]string, toolCounts map[app.ToolName]int) {
+	rows := make([]usageRow, 0, len(accounts))
+	for _, account := range accounts {
+		labels := make([]string, 0, len(account.Profiles))
+		for _, member := range account.Profiles {
+			labels = append(labels, usageDisplayLabel(app.UsageResult{Tool: member.Tool, Profile: member.Profile, Label: member.Label}, activeProfiles, toolCounts))
+		}
+		rows = append(rows, usageRow{label: strings.Join(labels, ", "), item: app.UsageResult{
+			AccountID:      account.AccountID,
+			Plan:           account.Plan,
+			CreditsBalance: account.CreditsBalance,
+			Windows:        account.Windows,
+			Status:         account.Status,
+			Error:          account.Error,
+		}})
+	}
+	renderUsageRows(w, "profiles", rows)
+}
+
+func renderUsageRows(w io.Writer, heading string, rows []usageRow) {
 	summary := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
-	_, _ = fmt.Fprintln(summary, "profile\tplan\taccount\tcredits")
-	for _, item := range results {
-		label := formatUsageLabel(item)
+	_, _ = fmt.Fprintf(summary, "%s\tplan\taccount\tcredits\n", heading)
+	for _, row := range rows {
+		item := row.item
 		plan := "N/A"
-		if item.Status == "ok" {
+		if item.HasUsage() {
 			plan = zeroDefault(item.Plan, "unknown")
 		}
 		account := formatAccountForDisplay(item.AccountID)
 		credits := "-"
-		if item.Status == "ok" {
+		if item.HasUsage() {
 			credits = formatCreditsForDisplay(item.CreditsBalance)
 		}
-		_, _ = fmt.Fprintf(summary, "%s\t%s\t%s\t%s\n", label, plan, account, credits)
+		_, _ = fmt.Fprintf(summary, "%s\t%s\t%s\t%s\n", row.label, plan, account, credits)
 	}
 	_ = summary.Flush()
 
 	_, _ = fmt.Fprintln(w)
 
 	windows := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
-	_, _ = fmt.Fprintln(windows, "profile\twindow\tused\treset(local)\tremaining")
-	for i, item := range results {
+	_, _ = fmt.Fprintf(windows, "%s\twindow\tused\treset(local)\tremaining\teta\n", heading)
+	for i, row := range rows {
 		if i > 0 {
-			_, _ = fmt.Fprintln(windows, "----------\t------\t------\t---------------------\t----------------")
+			_, _ = fmt.Fprintln(windows, "----------\t------\t------\t---------------------\t----------------\t---------------------")
 		}
 
-		label := formatUsageLabel(item)
-		if item.Status != "ok" {
+		item := row.item
+		label := row.label
+		if !item.HasUsage() {
 			errText := strings.ReplaceAll(strings.TrimSpace(item.Error), "\n", " ")
 			if errText == "" {
 				errText = "unknown error"
 			}
-			_, _ = fmt.Fprintf(windows, "%s\t-\t-\t-\t%s\n", label, errText)
+			_, _ = fmt.Fprintf(windows, "%s\t-\t-\t-\t%s\t-\n", label, errText)
 			continue
 		}
 
 		if len(item.Windows) == 0 {
-			_, _ = fmt.Fprintf(windows, "%s\t-\t-\t-\t-\n", label)
+			_, _ = fmt.Fprintf(windows, "%s\t-\t-\t-\t-\t-\n", label)
 			continue
 		}
 
@@ -481,34 +1486,315 @@ func renderUsageReport(w io.Writer, results []app.UsageResult, activeProfiles ma
 			if wi == 0 {
 				profileCell = label
 			}
-			reset := "-"
-			remaining := "-"
-			if window.ResetAt > 0 {
-				reset = formatResetForDisplay(window.ResetAt)
-				remaining = formatRemainingForDisplay(window.ResetAt)
+			reset := "-"
+			remaining := "-"
+			if window.ResetAt > 0 {
+				reset = formatResetForDisplay(window.ResetAt)
+				remaining = formatRemainingForDisplay(window.ResetAt)
+			}
+			_, _ = fmt.Fprintf(windows, "%s\t%s\t%.1f%%\t%s\t%s\t%s\n", profileCell, window.Label, window.UsedPercent, reset, remaining, formatUsageETA(window))
+		}
+	}
+	_ = windows.Flush()
+}
+
+func usageToolResultCounts(results []app.UsageResult) map[app.ToolName]int {
+	counts := make(map[app.ToolName]int, len(results))
+	for _, item := range results {
+		counts[item.Tool]++
+	}
+	return counts
+}
+
+func usageDisplayLabel(item app.UsageResult, activeProfiles map[app.ToolName]string, toolCounts map[app.ToolName]int) string {
+	profileName := item.Profile
+	if toolCounts[item.Tool] > 1 {
+		if activeName, ok := activeProfiles[item.Tool]; ok && activeName != "" && profileName == activeName {
+			profileName = profileName + " (active)"
+		}
+	}
+	if item.Label != "" {
+		profileName += " [" + item.Label + "]"
+	}
+	return fmt.Sprintf("%s/%s", item.Tool, profileName)
+}
+
+func newRefreshCommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	var within time.Duration
+	var force bool
+	var watch bool
+	var interval time.Duration
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:     "refresh",
+		Aliases: []string{"daemon"},
+		Short:   "Refresh stored profile tokens that are close to expiry",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			if cmd.CalledAs() == "daemon" {
+				watch = true
+			}
+			if watch && jsonOut {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("--watch cannot be combined with --json"))
+			}
+			if watch && interval <= 0 {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("--interval must be greater than 0"))
+			}
+
+			opts := app.RefreshOptions{Tools: tools, Within: within, Force: force}
+			if !jsonOut {
+				opts.OnResult = func(item app.RefreshResult) {
+					printRefreshResult(os.Stdout, item)
+				}
+			}
+			if !watch {
+				results, err := svc.RefreshProfiles(opts)
+				if err != nil {
+					return err
+				}
+				if jsonOut {
+					return printJSON(results)
+				}
+				for _, item := range results {
+					if item.Status == "error" || item.Status == "auth_error" {
+						return app.WrapExit(app.ExitPartial, fmt.Errorf("refresh completed with errors"))
+					}
+				}
+				return nil
+			}
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				if _, err := svc.RefreshProfiles(opts); err != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "%s refresh pass failed: %v\n", time.Now().UTC().Format(time.RFC3339), err)
+				}
+				select {
+				case <-cmd.Context().Done():
+					return nil
+				case <-ticker.C:
+				}
+			}
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().DurationVar(&within, "within", 24*time.Hour, "Refresh tokens expiring within this window")
+	cmd.Flags().BoolVar(&force, "force", false, "Refresh every profile regardless of expiry")
+	cmd.Flags().BoolVar(&watch, "watch", false, "Keep running and refresh periodically")
+	cmd.Flags().DurationVar(&interval, "interval", time.Hour, "Watch polling interval (for example: 30m, 1h)")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func newSyncCommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	var dryRun bool
+	var verify bool
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "sync",
+		Short: "Reconcile rotated tokens for the same account across tools and profiles",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			results, err := svc.Sync(app.SyncOptions{Tools: tools, DryRun: dryRun, TrialRefresh: verify})
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				return printJSON(results)
+			}
+			if len(results) == 0 {
+				fmt.Println("no active credentials to reconcile")
+				return nil
+			}
+			stale := 0
+			for _, item := range results {
+				location := item.Location
+				if item.Profile != "" {
+					location = "profile " + item.Profile
+				}
+				line := fmt.Sprintf("%s %s/%s: %s", formatAccountForDisplay(item.AccountID), item.Tool, location, item.Status)
+				if item.Status == "stale" {
+					stale++
+					if item.Updated {
+						line += " -> updated"
+					} else if dryRun {
+						line += " (dry-run)"
+					}
+				}
+				if item.Warning != "" {
+					line += " (" + item.Warning + ")"
+				}
+				fmt.Println(line)
+			}
+			if stale > 0 {
+				fmt.Printf("\n%d stale cop%s found; a tool rotated tokens without the switcher noticing\n", stale, pluralSuffix(stale, "y", "ies"))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report stale copies without writing files")
+	cmd.Flags().BoolVar(&verify, "verify", false, "Confirm the freshest copy with a trial refresh when copies disagree")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func newDoctorCommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	var fix bool
+	var verify bool
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check profiles, state and lock files for problems",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			findings, err := svc.Doctor(app.DoctorOptions{Tools: tools, Fix: fix, TrialRefresh: verify})
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				if err := printJSON(findings); err != nil {
+					return err
+				}
+			} else {
+				writeDoctorFindings(os.Stdout, findings, fix)
+			}
+			for _, finding := range findings {
+				if finding.Unresolved() {
+					return app.WrapExit(app.ExitPartial, fmt.Errorf("doctor found unresolved problems"))
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().BoolVar(&fix, "fix", false, "Apply the suggested fix for each finding that has one")
+	cmd.Flags().BoolVar(&verify, "verify", false, "Trial-refresh every profile to detect revoked refresh tokens")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func writeDoctorFindings(w io.Writer, findings []app.DoctorFinding, fix bool) {
+	if len(findings) == 0 {
+		_, _ = fmt.Fprintln(w, "no problems found")
+		return
+	}
+	fixable := 0
+	for _, item := range findings {
+		scope := string(item.Tool)
+		if scope == "" {
+			scope = "switcher"
+		}
+		if item.Profile != "" {
+			scope += "/" + item.Profile
+		}
+		_, _ = fmt.Fprintf(w, "[%s] %s %s: %s\n", item.Severity, scope, item.Check, item.Message)
+		if item.Path != "" {
+			_, _ = fmt.Fprintf(w, "    path: %s\n", item.Path)
+		}
+		if item.Fix == "" {
+			continue
+		}
+		switch {
+		case item.Fixed:
+			_, _ = fmt.Fprintf(w, "    fixed: %s\n", item.Fix)
+		case item.FixError != "":
+			_, _ = fmt.Fprintf(w, "    fix failed: %s (%s)\n", item.Fix, item.FixError)
+		default:
+			fixable++
+			_, _ = fmt.Fprintf(w, "    fix: %s\n", item.Fix)
+		}
+	}
+	if fixable > 0 && !fix {
+		_, _ = fmt.Fprintf(w, "\n%d finding%s can be fixed with --fix\n", fixable, pluralSuffix(fixable, "", "s"))
+	}
+}
+
+func newServeMetricsCommand(svc *app.Service) *cobra.Command {
+	var listen string
+	var interval time.Duration
+	var toolCSV string
+	cmd := &cobra.Command{
+		Use:   "serve-metrics",
+		Short: "Expose usage and token health as Prometheus metrics",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var tools []app.ToolName
+			if strings.TrimSpace(toolCSV) != "" {
+				parsed, err := app.ParseTools(toolCSV)
+				if err != nil {
+					return app.WrapExit(app.ExitUserError, err)
+				}
+				tools = parsed
+			}
+			if interval <= 0 {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("--interval must be greater than 0"))
+			}
+			collector := svc.NewMetricsCollector(app.MetricsOptions{
+				Tools:    tools,
+				Interval: interval,
+				OnResults: func(results []app.UsageResult) {
+					recordUsageHistory(svc, results)
+				},
+			})
+			mux := http.NewServeMux()
+			mux.Handle("/metrics", collector)
+			server := &http.Server{Addr: listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+			listener, err := net.Listen("tcp", listen)
+			if err != nil {
+				return app.WrapExit(app.ExitIOFailure, err)
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "serving metrics on http://%s/metrics (usage polled at most every %s)\n", listener.Addr(), interval)
+			go func() {
+				<-cmd.Context().Done()
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				defer cancel()
+				_ = server.Shutdown(shutdownCtx)
+			}()
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				return app.WrapExit(app.ExitIOFailure, err)
 			}
-			_, _ = fmt.Fprintf(windows, "%s\t%s\t%.1f%%\t%s\t%s\n", profileCell, window.Label, window.UsedPercent, reset, remaining)
-		}
+			return nil
+		},
 	}
-	_ = windows.Flush()
+	cmd.Flags().StringVar(&listen, "listen", "127.0.0.1:9464", "Address to serve /metrics on")
+	cmd.Flags().DurationVar(&interval, "interval", 5*time.Minute, "Minimum time between usage polls")
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	return cmd
 }
 
-func usageToolResultCounts(results []app.UsageResult) map[app.ToolName]int {
-	counts := make(map[app.ToolName]int, len(app.AllTools))
-	for _, item := range results {
-		counts[item.Tool]++
+func pluralSuffix(count int, singular string, plural string) string {
+	if count == 1 {
+		return singular
 	}
-	return counts
+	return plural
 }
 
-func usageDisplayLabel(item app.UsageResult, activeProfiles map[app.ToolName]string, toolCounts map[app.ToolName]int) string {
-	profileName := item.Profile
-	if toolCounts[item.Tool] > 1 {
-		if activeName, ok := activeProfiles[item.Tool]; ok && activeName != "" && profileName == activeName {
-			profileName = profileName + " (active)"
-		}
+func printRefreshResult(w io.Writer, item app.RefreshResult) {
+	label := fmt.Sprintf("%s/%s", item.Tool, item.Profile)
+	if item.Active {
+		label += " (active)"
+	}
+	switch item.Status {
+	case "refreshed":
+		_, _ = fmt.Fprintf(w, "%s %s: refreshed, expires %s\n", item.At, label, formatResetForDisplay(item.ExpiresAfter))
+	case "fresh":
+		_, _ = fmt.Fprintf(w, "%s %s: fresh, expires %s\n", item.At, label, formatResetForDisplay(item.ExpiresBefore))
+	default:
+		_, _ = fmt.Fprintf(w, "%s %s: %s (%s)\n", item.At, label, item.Status, zeroDefault(item.Error, "-"))
 	}
-	return fmt.Sprintf("%s/%s", item.Tool, profileName)
 }
 
 func newProfilesCommand(svc *app.Service) *cobra.Command {
@@ -519,41 +1805,157 @@ func newProfilesCommand(svc *app.Service) *cobra.Command {
 	profiles.AddCommand(newProfilesListCommand(svc))
 	profiles.AddCommand(newProfilesDeleteCommand(svc))
 	profiles.AddCommand(newProfilesRenameCommand(svc))
+	profiles.AddCommand(newProfilesAnnotateCommand(svc))
+	profiles.AddCommand(newProfilesHistoryCommand(svc))
+	profiles.AddCommand(newProfilesRestoreCommand(svc))
+	profiles.AddCommand(newProfilesExportCommand(svc))
+	profiles.AddCommand(newProfilesImportCommand(svc))
+	profiles.AddCommand(newProfilesEncryptCommand(svc, true))
+	profiles.AddCommand(newProfilesEncryptCommand(svc, false))
 	return profiles
 }
 
+func newProfilesEncryptCommand(svc *app.Service, encrypt bool) *cobra.Command {
+	var toolCSV string
+	var jsonOut bool
+	use, short := "encrypt", "Encrypt saved profiles at rest"
+	if !encrypt {
+		use, short = "decrypt", "Convert encrypted profiles back to plaintext"
+	}
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: short,
+		Long:  "Key sources, in order: CODEX_SWITCHER_KEY_FILE, CODEX_SWITCHER_PASSPHRASE, then an interactive passphrase prompt.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			var results []app.ProfileEncryptionResult
+			if encrypt {
+				results, err = svc.EncryptProfiles(tools)
+			} else {
+				results, err = svc.DecryptProfiles(tools)
+			}
+			if jsonOut {
+				if printErr := printJSON(results); printErr != nil {
+					return printErr
+				}
+				return err
+			}
+			for _, item := range results {
+				fmt.Printf("%s: %s (%d %s) %s\n", item.Store, item.Status, item.Profiles, pluralSuffix(item.Profiles, "profile", "profiles"), item.Dir)
+			}
+			return err
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func promptPassphrase(confirmNew bool) ([]byte, error) {
+	return readPassphrase("Profile passphrase: ", confirmNew)
+}
+
+func readPassphrase(label string, confirmNew bool) ([]byte, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, nil
+	}
+	fmt.Fprint(os.Stderr, label)
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if !confirmNew {
+		return secret, nil
+	}
+	fmt.Fprint(os.Stderr, "Confirm passphrase: ")
+	confirm, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if string(secret) != string(confirm) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return secret, nil
+}
+
 func newProfilesListCommand(svc *app.Service) *cobra.Command {
 	var tool string
+	var tag string
 	var jsonOut bool
 	cmd := &cobra.Command{
 		Use:   "list",
 		Short: "List profiles for a tool",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			target := app.ToolName(strings.ToLower(strings.TrimSpace(tool)))
-			if target == "" {
-				target = app.ToolCodex
+			target := app.ToolCodex
+			if strings.TrimSpace(tool) != "" {
+				parsed, err := app.ParseTools(tool)
+				if err != nil || len(parsed) != 1 {
+					return app.WrapExit(app.ExitUserError, fmt.Errorf("invalid --tool %q", tool))
+				}
+				target = parsed[0]
 			}
-			if target != app.ToolCodex && target != app.ToolOpenCode && target != app.ToolOpenClaw {
-				return app.WrapExit(app.ExitUserError, fmt.Errorf("invalid --tool %q", tool))
+			tagFilter, err := parseTagFilter(tag)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
 			}
-			profiles, err := svc.ListProfiles(target)
+			summaries, err := svc.ProfileSummaries(target)
 			if err != nil {
 				return app.WrapExit(app.ExitIOFailure, err)
 			}
+			summaries = filterProfileSummaries(summaries, tagFilter)
 			if jsonOut {
-				return printJSON(map[string]any{"tool": target, "profiles": profiles})
+				profiles := make([]string, 0, len(summaries))
+				for _, item := range summaries {
+					profiles = append(profiles, item.Profile)
+				}
+				return printJSON(map[string]any{"tool": target, "profiles": profiles, "entries": summaries})
 			}
-			for _, name := range profiles {
-				fmt.Println(name)
+			out := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, item := range summaries {
+				line := item.Profile
+				if item.Label != "" || len(item.Tags) > 0 {
+					line += "\t" + item.Label
+				}
+				if len(item.Tags) > 0 {
+					line += "\t[" + strings.Join(item.Tags, ",") + "]"
+				}
+				_, _ = fmt.Fprintln(out, line)
 			}
-			return nil
+			return out.Flush()
 		},
 	}
 	cmd.Flags().StringVar(&tool, "tool", "codex", "Target tool")
+	cmd.Flags().StringVar(&tag, "tag", "", "Only list profiles carrying this tag")
 	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
 	return cmd
 }
 
+func parseTagFilter(raw string) (string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return "", nil
+	}
+	return app.NormalizeTag(raw)
+}
+
+func filterProfileSummaries(summaries []app.ProfileSummary, tag string) []app.ProfileSummary {
+	if tag == "" {
+		return summaries
+	}
+	out := make([]app.ProfileSummary, 0, len(summaries))
+	for _, item := range summaries {
+		if item.HasTag(tag) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func newProfilesDeleteCommand(svc *app.Service) *cobra.Command {
 	var toolCSV string
 	var jsonOut bool
@@ -616,6 +2018,344 @@ func newProfilesRenameCommand(svc *app.Service) *cobra.Command {
 	return cmd
 }
 
+func newProfilesAnnotateCommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	var label, note, owner, plan string
+	var addTags, removeTags []string
+	var clearTags bool
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "annotate <profile>",
+		Short: "Set a profile's label, note, owner, plan hint and tags",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			opts := app.AnnotateOptions{AddTags: addTags, RemoveTags: removeTags, ClearTags: clearTags}
+			flags := cmd.Flags()
+			if flags.Changed("label") {
+				opts.Label = &label
+			}
+			if flags.Changed("note") {
+				opts.Note = &note
+			}
+			if flags.Changed("owner") {
+				opts.Owner = &owner
+			}
+			if flags.Changed("plan") {
+				opts.Plan = &plan
+			}
+			results, err := svc.AnnotateProfile(strings.TrimSpace(args[0]), tools, opts)
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				return printJSON(results)
+			}
+			for _, item := range results {
+				state := "unchanged"
+				if item.Changed {
+					state = "updated"
+				}
+				fmt.Printf("%s: %s %s\n", item.Tool, item.Profile, state)
+				fmt.Printf("  label: %s\n", zeroDefault(item.Metadata.Label, "-"))
+				fmt.Printf("  owner: %s\n", zeroDefault(item.Metadata.Owner, "-"))
+				fmt.Printf("  plan: %s\n", zeroDefault(item.Metadata.Plan, "-"))
+				fmt.Printf("  tags: %s\n", zeroDefault(strings.Join(item.Metadata.Tags, ","), "-"))
+				fmt.Printf("  note: %s\n", zeroDefault(item.Metadata.Note, "-"))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().StringVar(&label, "label", "", "Display label (empty string clears it)")
+	cmd.Flags().StringVar(&note, "note", "", "Free-form note (empty string clears it)")
+	cmd.Flags().StringVar(&owner, "owner", "", "Owner of the account")
+	cmd.Flags().StringVar(&plan, "plan", "", "Plan hint, for example plus or pro")
+	cmd.Flags().StringArrayVar(&addTags, "tag", nil, "Add a tag (repeatable)")
+	cmd.Flags().StringArrayVar(&removeTags, "untag", nil, "Remove a tag (repeatable)")
+	cmd.Flags().BoolVar(&clearTags, "clear-tags", false, "Remove all existing tags before adding --tag values")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func newProfilesHistoryCommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "history <profile>",
+		Short: "List archived versions of a profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			versions, err := svc.ProfileHistory(strings.TrimSpace(args[0]), tools)
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				return printJSON(versions)
+			}
+			return writeProfileHistory(os.Stdout, versions)
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func writeProfileHistory(w io.Writer, versions []app.ProfileVersion) error {
+	if len(versions) == 0 {
+		_, err := fmt.Fprintln(w, "no history")
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "TOOL\tVERSION\tSAVED\tOP\tACCOUNT\tEMAIL\tEXPIRY")
+	for _, item := range versions {
+		expiry := formatExpiryForDisplay(item.ExpiresAt)
+		if item.Error != "" {
+			expiry = "unreadable: " + item.Error
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\n", item.Tool, item.Version, time.UnixMilli(item.SavedAt).Local().Format(time.RFC3339), item.Op, formatAccountForDisplay(item.AccountID), zeroDefault(item.Email, "-"), expiry)
+	}
+	return tw.Flush()
+}
+
+func newProfilesRestoreCommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	var at string
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "restore <profile> --at <version|timestamp>",
+		Short: "Restore a profile from its version history",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if strings.TrimSpace(at) == "" {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("--at is required"))
+			}
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			results, err := svc.RestoreProfile(strings.TrimSpace(args[0]), tools, at)
+			if err != nil {
+				return err
+			}
+			partial := false
+			for _, item := range results {
+				if item.Status != "restored" {
+					partial = true
+				}
+			}
+			if jsonOut {
+				if err := printJSON(results); err != nil {
+					return err
+				}
+				if partial {
+					return app.WrapExit(app.ExitPartial, fmt.Errorf("restore completed with warnings"))
+				}
+				return nil
+			}
+			for _, item := range results {
+				if item.Status != "restored" {
+					fmt.Printf("%s: %s %s (%s)\n", item.Tool, item.Profile, item.Status, item.Warning)
+					continue
+				}
+				line := fmt.Sprintf("%s: %s restored version %d from %s", item.Tool, item.Profile, item.Version, time.UnixMilli(item.SavedAt).Local().Format(time.RFC3339))
+				if item.Active {
+					line += " (active credential updated)"
+				}
+				if item.Warning != "" {
+					line += " (" + item.Warning + ")"
+				}
+				fmt.Println(line)
+			}
+			if partial {
+				return app.WrapExit(app.ExitPartial, fmt.Errorf("restore completed with warnings"))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().StringVar(&at, "at", "", "Version number, RFC3339 time, or YYYY-MM-DD")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+// bundlePassphrase reads the bundle passphrase from --passphrase-file,
+// CODEX_SWITCHER_BUNDLE_PASSPHRASE or the terminal. It is kept separate from
+// the profile store passphrase so a bundle can be opened on another machine.
+func bundlePassphrase(file string, confirmNew bool) ([]byte, error) {
+	if strings.TrimSpace(file) != "" {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		content = bytes.TrimSpace(content)
+		if len(content) == 0 {
+			return nil, fmt.Errorf("passphrase file %s is empty", file)
+		}
+		return content, nil
+	}
+	if value := os.Getenv("CODEX_SWITCHER_BUNDLE_PASSPHRASE"); value != "" {
+		return []byte(value), nil
+	}
+	secret, err := readPassphrase("Bundle passphrase: ", confirmNew)
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("bundle passphrase required: use --passphrase-file, set CODEX_SWITCHER_BUNDLE_PASSPHRASE, or run interactively")
+	}
+	return secret, nil
+}
+
+func newProfilesExportCommand(svc *app.Service) *cobra.Command {
+	var out string
+	var profileCSV string
+	var toolCSV string
+	var passphraseFile string
+	var force bool
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "export --out <bundle.cswb>",
+		Short: "Export profiles, metadata and switcher state to an encrypted bundle",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if strings.TrimSpace(out) == "" {
+				return app.WrapExit(app.ExitUserError, fmt.Errorf("--out is required"))
+			}
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			var names []string
+			for _, name := range strings.Split(profileCSV, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+			passphrase, err := bundlePassphrase(passphraseFile, true)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			result, err := svc.ExportBundle(app.ExportBundleOptions{Out: out, Tools: tools, Profiles: names, Passphrase: passphrase, Force: force})
+			if err != nil {
+				return err
+			}
+			if jsonOut {
+				return printJSON(result)
+			}
+			for _, item := range result.Profiles {
+				fmt.Printf("%s: %s (account=%s)\n", item.Tool, item.Profile, formatAccountForDisplay(item.AccountID))
+			}
+			fmt.Printf("exported %d profile(s) to %s (config included: %t)\n", len(result.Profiles), result.Out, result.Config)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&out, "out", "", "Bundle file to write")
+	cmd.Flags().StringVar(&profileCSV, "profiles", "", "Comma-separated profiles to export (default: all)")
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "Read the bundle passphrase from this file")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing bundle file")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func newProfilesImportCommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	var conflict string
+	var passphraseFile string
+	var dryRun bool
+	var jsonOut bool
+	cmd := &cobra.Command{
+		Use:   "import <bundle.cswb>",
+		Short: "Import profiles from an encrypted bundle",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			passphrase, err := bundlePassphrase(passphraseFile, false)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			result, err := svc.ImportBundle(app.ImportBundleOptions{Path: args[0], Tools: tools, Passphrase: passphrase, Conflict: conflict, DryRun: dryRun})
+			if err != nil {
+				return err
+			}
+			if !dryRun {
+				writeTokenSinkWarning(os.Stderr, result)
+			}
+			partial := false
+			for _, item := range result.Profiles {
+				if item.Status == "invalid" || item.Status == "skipped_conflict" {
+					partial = true
+				}
+			}
+			if jsonOut {
+				if err := printJSON(result); err != nil {
+					return err
+				}
+			} else {
+				for _, item := range result.Profiles {
+					line := fmt.Sprintf("%s: %s %s", item.Tool, item.Profile, item.Status)
+					if item.StoredAs != "" {
+						line += " as " + item.StoredAs
+					}
+					if dryRun {
+						line += " (dry-run)"
+					}
+					if item.Warning != "" {
+						line += " (" + item.Warning + ")"
+					}
+					fmt.Println(line)
+				}
+				if result.Config != "" {
+					fmt.Printf("config: %s\n", result.Config)
+				}
+			}
+			if partial {
+				return app.WrapExit(app.ExitPartial, fmt.Errorf("import completed with warnings"))
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	cmd.Flags().StringVar(&conflict, "conflict", app.ImportConflictSkip, "When a profile exists: skip, rename or overwrite")
+	cmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "Read the bundle passphrase from this file")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Show what would be imported without writing")
+	cmd.Flags().BoolVar(&jsonOut, "json", false, "Output JSON")
+	return cmd
+}
+
+func writeTokenSinkWarning(w io.Writer, result app.ImportBundleResult) {
+	risky := result.TokenSinkRisk()
+	if len(risky) == 0 {
+		return
+	}
+	source := zeroDefault(result.Source, "the source machine")
+	_, _ = fmt.Fprintln(w, "!!! WARNING: imported refresh tokens may still be in use on "+source+" !!!")
+	_, _ = fmt.Fprintln(w, "OpenAI rotates refresh tokens on refresh. Whichever machine refreshes first")
+	_, _ = fmt.Fprintln(w, "invalidates the other copy (a \"token sink\"), forcing a re-login there.")
+	_, _ = fmt.Fprintln(w, "Stop using these profiles on the source machine, or run")
+	_, _ = fmt.Fprintln(w, "`codex-switcher login <profile>` here to get tokens of your own:")
+	for _, item := range risky {
+		name := zeroDefault(item.StoredAs, item.Profile)
+		note := ""
+		if item.SourceActive {
+			note = " (active on source: highest risk)"
+		}
+		_, _ = fmt.Fprintf(w, "  %s/%s%s\n", item.Tool, name, note)
+	}
+	_, _ = fmt.Fprintln(w)
+}
+
 func printJSON(value any) error {
 	enc := json.NewEncoder(os.Stdout)
 	enc.SetIndent("", "  ")
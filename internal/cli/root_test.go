@@ -1,6 +1,7 @@
 package cli
 
 import (
+	"strings"
 	"testing"
 	"time"
 
@@ -86,3 +87,116 @@ func TestValidateUsageWatchOptionsAcceptsSelectedTools(t *testing.T) {
 		t.Fatalf("expected watch options to be accepted, got %v", err)
 	}
 }
+
+func TestValidateUsageLayoutFlagsRejectsIgnoredFlags(t *testing.T) {
+	if err := validateUsageLayoutFlags(true, true, false); err == nil || !strings.Contains(err.Error(), "--per-tool") {
+		t.Fatalf("expected --per-tool rejected with --json, got %v", err)
+	}
+	if err := validateUsageLayoutFlags(false, false, true); err == nil || !strings.Contains(err.Error(), "--by-account") {
+		t.Fatalf("expected --by-account rejected without --json, got %v", err)
+	}
+	if err := validateUsageLayoutFlags(true, false, true); err != nil {
+		t.Fatalf("expected --json --by-account accepted, got %v", err)
+	}
+	if err := validateUsageLayoutFlags(false, true, false); err != nil {
+		t.Fatalf("expected --per-tool table accepted, got %v", err)
+	}
+}
+
+func TestFormatUsageETA(t *testing.T) {
+	exhaust := time.Now().Add(2 * time.Hour).UnixMilli()
+	cases := []struct {
+		window app.UsageWindow
+		want   string
+	}{
+		{app.UsageWindow{UsedPercent: 100}, "exhausted"},
+		{app.UsageWindow{UsedPercent: 40}, "-"},
+		{app.UsageWindow{UsedPercent: 40, ExhaustAt: exhaust}, "after reset"},
+		{app.UsageWindow{UsedPercent: 40, ExhaustAt: exhaust, ExhaustsBeforeReset: true}, formatResetForDisplay(exhaust)},
+	}
+	for _, tc := range cases {
+		if got := formatUsageETA(tc.window); got != tc.want {
+			t.Fatalf("formatUsageETA(%+v) = %q, want %q", tc.window, got, tc.want)
+		}
+	}
+}
+
+func TestAutoHookScriptQuotesExecutable(t *testing.T) {
+	script, err := autoHookScript("zsh", "/opt/it's here/codex-switcher")
+	if err != nil {
+		t.Fatalf("hook: %v", err)
+	}
+	if !strings.Contains(script, `'/opt/it'\''s here/codex-switcher' auto`) || !strings.Contains(script, "add-zsh-hook chpwd") {
+		t.Fatalf("unexpected zsh hook:\n%s", script)
+	}
+	if _, err := autoHookScript("tcsh", "codex-switcher"); err == nil {
+		t.Fatalf("expected unsupported shell error")
+	}
+}
+
+func TestRenderPromptSegment(t *testing.T) {
+	used := 41.6
+	segment := app.PromptSegment{Tool: app.ToolCodex, Profile: "work", Window: "5h", UsedPercent: &used}
+	if got := renderPromptSegment(defaultPromptFormat, segment); got != "codex:work 42%" {
+		t.Fatalf("unexpected default segment %q", got)
+	}
+	if got := renderPromptSegment("{profile}[{window}:{used}]", segment); got != "work[5h:42]" {
+		t.Fatalf("unexpected custom segment %q", got)
+	}
+	segment.UsedPercent = nil
+	if got := renderPromptSegment(defaultPromptFormat, segment); got != "codex:work" {
+		t.Fatalf("expected usage omitted without a cached sample, got %q", got)
+	}
+}
+
+func TestUsageDisplayLabelShowsProfileLabel(t *testing.T) {
+	item := app.UsageResult{Tool: app.ToolCodex, Profile: "client", Label: "Client A"}
+	if got := usageDisplayLabel(item, map[app.ToolName]string{}, map[app.ToolName]int{app.ToolCodex: 1}); got != "codex/client [Client A]" {
+		t.Fatalf("unexpected label %q", got)
+	}
+}
+
+func TestWriteTokenSinkWarningListsImportedProfiles(t *testing.T) {
+	var out strings.Builder
+	writeTokenSinkWarning(&out, app.ImportBundleResult{Source: "old-laptop", Profiles: []app.ImportBundleEntry{
+		{Tool: app.ToolCodex, Profile: "work", StoredAs: "work-imported", Status: "renamed", SourceActive: true},
+		{Tool: app.ToolCodex, Profile: "personal", Status: "unchanged"},
+	}})
+	text := out.String()
+	if !strings.Contains(text, "old-laptop") || !strings.Contains(text, "codex/work-imported (active on source") || strings.Contains(text, "personal") {
+		t.Fatalf("unexpected warning:\n%s", text)
+	}
+
+	out.Reset()
+	writeTokenSinkWarning(&out, app.ImportBundleResult{Profiles: []app.ImportBundleEntry{{Tool: app.ToolCodex, Profile: "work", Status: "skipped_conflict"}}})
+	if out.Len() != 0 {
+		t.Fatalf("expected no warning when nothing was imported, got %q", out.String())
+	}
+}
+
+func TestWriteDoctorFindingsSuggestsFix(t *testing.T) {
+	var out strings.Builder
+	writeDoctorFindings(&out, []app.DoctorFinding{
+		{Tool: app.ToolCodex, Check: "lock", Severity: app.DoctorWarning, Path: "/tmp/.rotater.lock", Message: "stale lock file", Fix: "remove the lock file"},
+		{Check: "permissions", Severity: app.DoctorWarning, Message: "mode 0644", Fix: "chmod 0600", Fixed: true},
+	}, false)
+	text := out.String()
+	if !strings.Contains(text, "[warning] codex lock: stale lock file") || !strings.Contains(text, "switcher permissions") || !strings.Contains(text, "fixed: chmod 0600") || !strings.Contains(text, "1 finding can be fixed with --fix") {
+		t.Fatalf("unexpected output:\n%s", text)
+	}
+}
+
+func TestRenderUsageAccountsListsSharingProfiles(t *testing.T) {
+	accounts := []app.UsageAccount{{
+		AccountID: "acct-work",
+		Profiles:  []app.UsageAccountProfile{{Tool: app.ToolCodex, Profile: "work"}, {Tool: app.ToolOpenCode, Profile: "work"}},
+		Plan:      "plus",
+		Windows:   []app.UsageWindow{{Label: "5h", UsedPercent: 40}},
+		Status:    "ok",
+	}}
+	var out strings.Builder
+	renderUsageAccounts(&out, accounts, map[app.ToolName]string{}, map[app.ToolName]int{app.ToolCodex: 1, app.ToolOpenCode: 1})
+	if !strings.Contains(out.String(), "codex/work, opencode/work") || strings.Count(out.String(), "40.0%") != 1 {
+		t.Fatalf("expected one row for the shared account, got:\n%s", out.String())
+	}
+}
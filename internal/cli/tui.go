@@ -0,0 +1,636 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"codex-switcher/internal/app"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const (
+	tuiBarWidth      = 10
+	tuiTickInterval  = time.Second
+	tuiDefaultWidth  = 120
+	tuiHelpLine      = "up/down select  enter switch  c capture  n rename  d delete  r refresh usage  t refresh tokens  q quit"
+	ansiReset        = "\033[0m"
+	ansiBold         = "\033[1m"
+	ansiDim          = "\033[2m"
+	ansiReverse      = "\033[7m"
+	ansiGreen        = "\033[32m"
+	ansiYellow       = "\033[33m"
+	ansiRed          = "\033[31m"
+	ansiEnterScreen  = "\033[?1049h\033[?25l"
+	ansiLeaveScreen  = "\033[?25h\033[?1049l"
+	ansiClearAndHome = "\033[H\033[2J"
+)
+
+func newTUICommand(svc *app.Service) *cobra.Command {
+	var toolCSV string
+	cmd := &cobra.Command{
+		Use:   "tui",
+		Short: "Browse profiles and usage and switch interactively",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tools, err := app.ParseTools(toolCSV)
+			if err != nil {
+				return app.WrapExit(app.ExitUserError, err)
+			}
+			model := newTUIModel(svc, tools)
+			if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+				model.reload()
+				model.loadUsage()(cmd.Context())(model)
+				for _, line := range model.view(tuiDefaultWidth, 0, false) {
+					fmt.Println(line)
+				}
+				return nil
+			}
+			return runTUI(cmd.Context(), model, os.Stdin, os.Stdout)
+		},
+	}
+	cmd.Flags().StringVar(&toolCSV, "tools", "", "Comma-separated tools: codex,opencode,openclaw")
+	return cmd
+}
+
+// tuiJob runs off the event loop (network work and profile changes) and
+// returns the update to apply to the model once it finishes. ctx is
+// cancelled when the TUI quits; the loop still waits for the job to return so
+// tokens it rotated are saved before exit.
+type tuiJob func(ctx context.Context) func(*tuiModel)
+
+type tuiRow struct {
+	tool    app.ToolName
+	summary app.ProfileSummary
+	empty   bool
+}
+
+type tuiInput struct {
+	label  string
+	value  string
+	submit func(string) tuiJob
+}
+
+type tuiConfirm struct {
+	label  string
+	accept func() tuiJob
+}
+
+type tuiModel struct {
+	svc     *app.Service
+	tools   []app.ToolName
+	status  map[app.ToolName]app.StatusToolResult
+	rows    []tuiRow
+	usage   map[string]app.UsageResult
+	usageAt time.Time
+	busy    int
+	cursor  int
+	message string
+	input   *tuiInput
+	confirm *tuiConfirm
+}
+
+func newTUIModel(svc *app.Service, tools []app.ToolName) *tuiModel {
+	return &tuiModel{
+		svc:    svc,
+		tools:  tools,
+		status: map[app.ToolName]app.StatusToolResult{},
+		usage:  map[string]app.UsageResult{},
+	}
+}
+
+func runTUI(ctx context.Context, model *tuiModel, in *os.File, out *os.File) error {
+	state, err := term.MakeRaw(int(in.Fd()))
+	if err != nil {
+		return app.WrapExit(app.ExitIOFailure, err)
+	}
+	defer func() {
+		_ = term.Restore(int(in.Fd()), state)
+	}()
+	_, _ = fmt.Fprint(out, ansiEnterScreen)
+	defer func() {
+		_, _ = fmt.Fprint(out, ansiLeaveScreen)
+	}()
+
+	keys := make(chan string, 16)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := in.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			for _, key := range parseTUIKeys(buf[:n]) {
+				keys <- key
+			}
+		}
+	}()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	updates := make(chan func(*tuiModel), 4)
+	start := func(job tuiJob) {
+		if job == nil {
+			return
+		}
+		model.busy++
+		go func() {
+			updates <- job(ctx)
+		}()
+	}
+	draw := func() {
+		width, height, err := term.GetSize(int(out.Fd()))
+		if err != nil || width <= 0 {
+			width, height = tuiDefaultWidth, 24
+		}
+		_, _ = fmt.Fprint(out, ansiClearAndHome+strings.Join(model.view(width, height, true), "\r\n"))
+	}
+	// finish cancels outstanding jobs and waits for them, so a refresh that
+	// already rotated a token still gets to store it.
+	finish := func() {
+		cancel()
+		for model.busy > 0 {
+			model.message = fmt.Sprintf("finishing %d background job(s)...", model.busy)
+			draw()
+			<-updates
+			model.busy--
+		}
+	}
+
+	model.reload()
+	start(model.loadUsage())
+	ticker := time.NewTicker(tuiTickInterval)
+	defer ticker.Stop()
+	for {
+		draw()
+
+		select {
+		case key, ok := <-keys:
+			if !ok {
+				finish()
+				return nil
+			}
+			quit, job := model.handleKey(key)
+			if quit {
+				finish()
+				return nil
+			}
+			start(job)
+		case apply := <-updates:
+			model.busy--
+			apply(model)
+		case <-ticker.C:
+		}
+	}
+}
+
+// parseTUIKeys splits raw terminal input into key names: arrows and control
+// keys get symbolic names, everything else is returned rune by rune.
+func parseTUIKeys(buf []byte) []string {
+	keys := []string{}
+	for len(buf) > 0 {
+		switch {
+		case len(buf) >= 3 && buf[0] == 0x1b && (buf[1] == '[' || buf[1] == 'O'):
+			switch buf[2] {
+			case 'A':
+				keys = append(keys, "up")
+			case 'B':
+				keys = append(keys, "down")
+			case 'H':
+				keys = append(keys, "home")
+			case 'F':
+				keys = append(keys, "end")
+			}
+			buf = buf[3:]
+			continue
+		case buf[0] == 0x1b:
+			keys = append(keys, "esc")
+		case buf[0] == '\r' || buf[0] == '\n':
+			keys = append(keys, "enter")
+		case buf[0] == 0x7f || buf[0] == 0x08:
+			keys = append(keys, "backspace")
+		case buf[0] == 0x03:
+			keys = append(keys, "ctrl-c")
+		case buf[0] < 0x20:
+		default:
+			r, size := utf8.DecodeRune(buf)
+			keys = append(keys, string(r))
+			buf = buf[size:]
+			continue
+		}
+		buf = buf[1:]
+	}
+	return keys
+}
+
+func (m *tuiModel) reload() {
+	status, err := m.svc.Status(m.tools)
+	if err != nil {
+		m.message = "status failed: " + err.Error()
+		return
+	}
+	m.status = map[app.ToolName]app.StatusToolResult{}
+	rows := []tuiRow{}
+	for _, item := range status {
+		m.status[item.Tool] = item
+		summaries, err := m.svc.ProfileSummaries(item.Tool)
+		if err != nil {
+			m.message = fmt.Sprintf("%s profiles failed: %v", item.Tool, err)
+		}
+		if len(summaries) == 0 {
+			rows = append(rows, tuiRow{tool: item.Tool, empty: true})
+			continue
+		}
+		for _, summary := range summaries {
+			rows = append(rows, tuiRow{tool: item.Tool, summary: summary})
+		}
+	}
+	m.rows = rows
+	m.cursor = max(0, min(m.cursor, len(m.rows)-1))
+}
+
+func (m *tuiModel) loadUsage() tuiJob {
+	svc, tools := m.svc, m.tools
+	return func(ctx context.Context) func(*tuiModel) {
+		results, err := svc.Usage(ctx, app.UsageOptions{Tools: tools, AllProfiles: true})
+		if err == nil {
+			recordUsageHistory(svc, results)
+		}
+		return func(m *tuiModel) {
+			if err != nil {
+				m.message = "usage failed: " + err.Error()
+				return
+			}
+			m.usage = map[string]app.UsageResult{}
+			for _, item := range results {
+				m.usage[string(item.Tool)+"/"+item.Profile] = item
+			}
+			m.usageAt = time.Now()
+		}
+	}
+}
+
+func (m *tuiModel) refreshTokens(tool app.ToolName) tuiJob {
+	svc := m.svc
+	return func(context.Context) func(*tuiModel) {
+		results, err := svc.RefreshProfiles(app.RefreshOptions{Tools: []app.ToolName{tool}, Force: true})
+		return func(m *tuiModel) {
+			if err != nil {
+				m.message = "refresh failed: " + err.Error()
+				return
+			}
+			counts := map[string]int{}
+			for _, item := range results {
+				counts[item.Status]++
+			}
+			m.message = fmt.Sprintf("%s: refreshed %d, failed %d", tool, counts["refreshed"], counts["error"]+counts["auth_error"])
+			m.reload()
+		}
+	}
+}
+
+// action runs a profile change off the event loop and reports its outcome.
+func (m *tuiModel) action(run func() (string, error)) tuiJob {
+	return func(context.Context) func(*tuiModel) {
+		message, err := run()
+		return func(m *tuiModel) { m.report(err, message) }
+	}
+}
+
+func (m *tuiModel) selected() (tuiRow, bool) {
+	if m.cursor < 0 || m.cursor >= len(m.rows) {
+		return tuiRow{}, false
+	}
+	return m.rows[m.cursor], true
+}
+
+// handleKey applies a key press and reports whether to quit and any
+// background job to start.
+func (m *tuiModel) handleKey(key string) (bool, tuiJob) {
+	if key == "ctrl-c" {
+		return true, nil
+	}
+	if m.input != nil {
+		switch key {
+		case "esc":
+			m.input = nil
+		case "enter":
+			input := m.input
+			m.input = nil
+			if value := strings.TrimSpace(input.value); value != "" {
+				return false, input.submit(value)
+			}
+		case "backspace":
+			if m.input.value != "" {
+				_, size := utf8.DecodeLastRuneInString(m.input.value)
+				m.input.value = m.input.value[:len(m.input.value)-size]
+			}
+		default:
+			if utf8.RuneCountInString(key) == 1 {
+				m.input.value += key
+			}
+		}
+		return false, nil
+	}
+	if m.confirm != nil {
+		confirm := m.confirm
+		m.confirm = nil
+		if key == "y" || key == "Y" {
+			return false, confirm.accept()
+		}
+		m.message = "cancelled"
+		return false, nil
+	}
+
+	row, ok := m.selected()
+	switch key {
+	case "q", "esc":
+		return true, nil
+	case "up", "k":
+		m.cursor = max(0, m.cursor-1)
+	case "down", "j":
+		m.cursor = min(len(m.rows)-1, m.cursor+1)
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.rows) - 1
+	case "r":
+		m.reload()
+		m.message = ""
+		return false, m.loadUsage()
+	case "t":
+		if ok {
+			m.message = fmt.Sprintf("%s: refreshing tokens...", row.tool)
+			return false, m.refreshTokens(row.tool)
+		}
+	case "c":
+		if ok {
+			svc := m.svc
+			m.input = &tuiInput{label: fmt.Sprintf("capture active %s credentials as", row.tool), submit: func(name string) tuiJob {
+				return m.action(func() (string, error) {
+					_, err := svc.Capture(name, []app.ToolName{row.tool}, false)
+					return fmt.Sprintf("%s: captured %s", row.tool, name), err
+				})
+			}}
+		}
+	case "enter", "s":
+		if ok && !row.empty {
+			svc := m.svc
+			m.message = fmt.Sprintf("%s: switching to %s...", row.tool, row.summary.Profile)
+			return false, m.action(func() (string, error) {
+				results, err := svc.Switch(row.summary.Profile, []app.ToolName{row.tool}, app.SwitchOptions{})
+				message := ""
+				for _, item := range results {
+					message = fmt.Sprintf("%s: %s -> %s (%s)", item.Tool, zeroDefault(item.FromProfile, "-"), item.ToProfile, item.Status)
+					if item.Warning != "" {
+						message += ": " + item.Warning
+					}
+				}
+				return message, err
+			})
+		}
+	case "n":
+		if ok && !row.empty {
+			svc := m.svc
+			m.input = &tuiInput{label: fmt.Sprintf("rename %s profile %s to", row.tool, row.summary.Profile), value: row.summary.Profile, submit: func(name string) tuiJob {
+				return m.action(func() (string, error) {
+					_, err := svc.RenameProfile(row.summary.Profile, name, []app.ToolName{row.tool})
+					return fmt.Sprintf("%s: renamed %s to %s", row.tool, row.summary.Profile, name), err
+				})
+			}}
+		}
+	case "d":
+		if ok && !row.empty {
+			svc := m.svc
+			m.confirm = &tuiConfirm{label: fmt.Sprintf("delete %s profile %s? (y/N)", row.tool, row.summary.Profile), accept: func() tuiJob {
+				return m.action(func() (string, error) {
+					err := svc.DeleteProfile(row.summary.Profile, []app.ToolName{row.tool})
+					return fmt.Sprintf("%s: deleted %s", row.tool, row.summary.Profile), err
+				})
+			}}
+		}
+	}
+	return false, nil
+}
+
+func (m *tuiModel) report(err error, success string) {
+	if err != nil {
+		m.message = "error: " + err.Error()
+	} else {
+		m.message = success
+	}
+	m.reload()
+}
+
+// view renders the screen as lines no wider than width. A height of zero
+// renders everything, which is what the non-interactive fallback uses.
+func (m *tuiModel) view(width int, height int, color bool) []string {
+	style := func(code string, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + ansiReset
+	}
+
+	header := []string{style(ansiBold, "codex-switcher"), style(ansiDim, tuiHelpLine), ""}
+	if !color {
+		header = []string{"codex-switcher", ""}
+	}
+
+	body := []string{}
+	selectedLine := 0
+	var current app.ToolName
+	for i, row := range m.rows {
+		if row.tool != current {
+			current = row.tool
+			if len(body) > 0 {
+				body = append(body, "")
+			}
+			body = append(body, style(ansiBold, m.toolHeading(row.tool)))
+		}
+		line := m.rowLine(row, color)
+		if i == m.cursor && color {
+			selectedLine = len(body)
+			line = ansiReverse + stripANSI(line) + ansiReset
+		}
+		body = append(body, line)
+	}
+	if len(m.rows) == 0 {
+		body = append(body, "no tools selected")
+	}
+
+	footer := []string{""}
+	switch {
+	case m.input != nil:
+		footer = append(footer, fmt.Sprintf("%s: %s_", m.input.label, m.input.value))
+	case m.confirm != nil:
+		footer = append(footer, m.confirm.label)
+	default:
+		usageLine := "usage: not loaded"
+		if !m.usageAt.IsZero() {
+			usageLine = "usage updated " + m.usageAt.Local().Format("15:04:05")
+		}
+		if m.busy > 0 {
+			usageLine += " (working...)"
+		}
+		if m.message != "" {
+			usageLine += "  " + m.message
+		}
+		footer = append(footer, usageLine)
+	}
+
+	if height > 0 {
+		room := height - len(header) - len(footer)
+		if room < 1 {
+			room = 1
+		}
+		if len(body) > room {
+			start := min(max(0, selectedLine-room/2), len(body)-room)
+			body = body[start : start+room]
+		}
+	}
+
+	lines := append(append(header, body...), footer...)
+	for i, line := range lines {
+		lines[i] = truncateDisplay(line, width)
+	}
+	return lines
+}
+
+func (m *tuiModel) toolHeading(tool app.ToolName) string {
+	status := m.status[tool]
+	parts := []string{strings.ToUpper(string(tool)), "active: " + zeroDefault(status.ActiveProfile, "-")}
+	if status.LastSwitchAt != "" {
+		if at, err := time.Parse(time.RFC3339, status.LastSwitchAt); err == nil {
+			parts = append(parts, "last switch: "+at.Local().Format("2006-01-02 15:04"))
+		}
+	}
+	if status.CredentialBackend != "" {
+		parts = append(parts, "backend: "+status.CredentialBackend)
+	}
+	if status.SwitchBlocked {
+		parts = append(parts, "blocked: "+status.SwitchBlockReason)
+	}
+	return strings.Join(parts, "  ")
+}
+
+func (m *tuiModel) rowLine(row tuiRow, color bool) string {
+	if row.empty {
+		return "    (no profiles - press c to capture the active login)"
+	}
+	summary := row.summary
+	marker := " "
+	name := fmt.Sprintf("%-16s", summary.Profile)
+	if summary.Profile == m.status[row.tool].ActiveProfile {
+		marker = "*"
+		if color {
+			name = ansiGreen + ansiBold + name + ansiReset
+		}
+	}
+	identity := zeroDefault(summary.Label, zeroDefault(summary.Email, formatAccountForDisplay(summary.AccountID)))
+	parts := []string{fmt.Sprintf("  %s %s %-24s %-18s", marker, name, identity, formatExpiryForDisplay(summary.ExpiresAt))}
+	if summary.Error != "" {
+		parts = append(parts, summary.Error)
+	}
+
+	usage, ok := m.usage[string(row.tool)+"/"+summary.Profile]
+	switch {
+	case !ok:
+	case !usage.HasUsage():
+		text := usage.Status
+		if color {
+			text = ansiRed + text + ansiReset
+		}
+		parts = append(parts, text)
+	default:
+		for _, window := range usage.Windows {
+			parts = append(parts, fmt.Sprintf("%s %s", window.Label, renderUsageBar(window.UsedPercent, color)))
+		}
+	}
+	return strings.Join(parts, "  ")
+}
+
+func formatExpiryForDisplay(expiresAt int64) string {
+	if expiresAt <= 0 {
+		return "expiry unknown"
+	}
+	if time.Until(time.UnixMilli(expiresAt)) <= 0 {
+		return "expired"
+	}
+	return "expires in " + formatRemainingForDisplay(expiresAt)
+}
+
+func renderUsageBar(used float64, color bool) string {
+	clamped := min(max(used, 0), 100)
+	filled := int(clamped/100*tuiBarWidth + 0.5)
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", tuiBarWidth-filled)
+	if color {
+		code := ansiGreen
+		switch {
+		case used >= 90:
+			code = ansiRed
+		case used >= 70:
+			code = ansiYellow
+		}
+		bar = code + bar + ansiReset
+	}
+	return fmt.Sprintf("[%s] %3.0f%%", bar, used)
+}
+
+// truncateDisplay cuts a line to width visible runes, keeping ANSI escape
+// sequences intact so styling is not left half-applied.
+func truncateDisplay(line string, width int) string {
+	if width <= 0 {
+		return line
+	}
+	var out strings.Builder
+	visible := 0
+	truncated := false
+	for i := 0; i < len(line); {
+		if line[i] == 0x1b {
+			end := i + 1
+			for end < len(line) && (line[end] < 0x40 || line[end] > 0x7e || line[end] == '[') {
+				end++
+			}
+			if end < len(line) {
+				end++
+			}
+			out.WriteString(line[i:end])
+			i = end
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		if visible < width {
+			out.WriteRune(r)
+			visible++
+		} else {
+			truncated = true
+		}
+		i += size
+	}
+	if truncated && strings.Contains(line, "\033") {
+		out.WriteString(ansiReset)
+	}
+	return out.String()
+}
+
+func stripANSI(line string) string {
+	var out strings.Builder
+	for i := 0; i < len(line); {
+		if line[i] == 0x1b {
+			i++
+			for i < len(line) && (line[i] < 0x40 || line[i] > 0x7e || line[i] == '[') {
+				i++
+			}
+			i++
+			continue
+		}
+		out.WriteByte(line[i])
+		i++
+	}
+	return out.String()
+}
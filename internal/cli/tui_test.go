@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"codex-switcher/internal/app"
+)
+
+func TestParseTUIKeys(t *testing.T) {
+	got := parseTUIKeys([]byte("\x1b[Aj\x1bOB\r\x7fé\x03"))
+	want := []string{"up", "j", "down", "enter", "backspace", "é", "ctrl-c"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestRenderUsageBar(t *testing.T) {
+	if got := renderUsageBar(42, false); got != "[####......]  42%" {
+		t.Fatalf("unexpected bar %q", got)
+	}
+	if got := renderUsageBar(130, false); got != "[##########] 130%" {
+		t.Fatalf("expected bar clamped, got %q", got)
+	}
+}
+
+func TestTruncateDisplayKeepsEscapes(t *testing.T) {
+	line := ansiBold + "codex-switcher" + ansiReset + " tail"
+	got := truncateDisplay(line, 5)
+	if stripANSI(got) != "codex" || !strings.HasPrefix(got, ansiBold) || !strings.HasSuffix(got, ansiReset) {
+		t.Fatalf("unexpected truncation %q", got)
+	}
+}
+
+func testTUIModel() *tuiModel {
+	m := newTUIModel(nil, []app.ToolName{app.ToolCodex})
+	m.status[app.ToolCodex] = app.StatusToolResult{Tool: app.ToolCodex, ActiveProfile: "work", LastSwitchAt: "2026-01-02T03:04:05Z"}
+	m.rows = []tuiRow{
+		{tool: app.ToolCodex, summary: app.ProfileSummary{Tool: app.ToolCodex, Profile: "personal", AccountID: "acct-personal"}},
+		{tool: app.ToolCodex, summary: app.ProfileSummary{Tool: app.ToolCodex, Profile: "work", Email: "me@example.com", ExpiresAt: time.Now().Add(time.Hour).UnixMilli()}},
+	}
+	m.usage["codex/work"] = app.UsageResult{Tool: app.ToolCodex, Profile: "work", Status: "ok", Windows: []app.UsageWindow{{Label: "5h", UsedPercent: 42}}}
+	return m
+}
+
+func TestTUIViewHighlightsActiveProfileAndUsage(t *testing.T) {
+	m := testTUIModel()
+	lines := m.view(200, 0, false)
+	text := strings.Join(lines, "\n")
+	if !strings.Contains(text, "CODEX  active: work  last switch: ") {
+		t.Fatalf("missing tool heading:\n%s", text)
+	}
+	var workLine string
+	for _, line := range lines {
+		if strings.Contains(line, "me@example.com") {
+			workLine = line
+		}
+	}
+	if !strings.HasPrefix(workLine, "  * work") || !strings.Contains(workLine, "5h [####......]  42%") || !strings.Contains(workLine, "expires in ") {
+		t.Fatalf("unexpected active row %q", workLine)
+	}
+
+	for _, line := range m.view(30, 6, true) {
+		if utf8.RuneCountInString(stripANSI(line)) > 30 {
+			t.Fatalf("line exceeds width: %q", stripANSI(line))
+		}
+	}
+	if got := len(m.view(30, 6, true)); got > 6 {
+		t.Fatalf("expected view to fit the screen height, got %d lines", got)
+	}
+}
+
+func TestTUIHandleKeyNavigationAndInput(t *testing.T) {
+	m := testTUIModel()
+	m.handleKey("down")
+	m.handleKey("down")
+	if m.cursor != 1 {
+		t.Fatalf("expected cursor clamped to last row, got %d", m.cursor)
+	}
+	m.handleKey("k")
+	if m.cursor != 0 {
+		t.Fatalf("expected cursor moved up, got %d", m.cursor)
+	}
+
+	submitted := ""
+	m.input = &tuiInput{label: "name", value: "ab", submit: func(value string) tuiJob {
+		return m.action(func() (string, error) {
+			submitted = value
+			return "submitted", nil
+		})
+	}}
+	var job tuiJob
+	for _, key := range []string{"backspace", "c", "d", "enter"} {
+		quit, next := m.handleKey(key)
+		if quit {
+			t.Fatalf("input keys must not quit")
+		}
+		if next != nil {
+			job = next
+		}
+	}
+	if job == nil || submitted != "" {
+		t.Fatalf("expected submit to return a job instead of running inline")
+	}
+	job(context.Background())
+	if submitted != "acd" || m.input != nil {
+		t.Fatalf("expected input submitted as acd, got %q (input=%v)", submitted, m.input)
+	}
+
+	m.confirm = &tuiConfirm{label: "delete?", accept: func() tuiJob {
+		t.Fatalf("confirm must require y")
+		return nil
+	}}
+	m.handleKey("n")
+	if m.confirm != nil || m.message != "cancelled" {
+		t.Fatalf("expected confirmation cancelled, got %+v %q", m.confirm, m.message)
+	}
+	if quit, _ := m.handleKey("q"); !quit {
+		t.Fatalf("expected q to quit")
+	}
+}